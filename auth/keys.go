@@ -0,0 +1,207 @@
+// Package auth signs and verifies the access tokens issued by the server.
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gc2-yugo/config"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// LegacyKeyID is the kid of the key made from the JWT secret when no keys are configured.
+const LegacyKeyID = "default"
+
+type key struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{} // nil for verify-only keys
+	verifyKey interface{}
+}
+
+// KeySet holds the keys accepted for verification and the one used for signing.
+type KeySet struct {
+	keys    map[string]*key
+	signing *key
+	// Tokens issued before keys had ids carry no kid, they are verified with the legacy key
+	allowMissingKID bool
+}
+
+// NewKeySet loads the keys described by the configuration.
+func NewKeySet(cfg config.AuthConfig) (*KeySet, error) {
+	if len(cfg.Keys) == 0 {
+		legacy := &key{
+			id:        LegacyKeyID,
+			method:    jwt.SigningMethodHS256,
+			signKey:   []byte(cfg.JWTSecret),
+			verifyKey: []byte(cfg.JWTSecret),
+		}
+		return &KeySet{
+			keys:            map[string]*key{LegacyKeyID: legacy},
+			signing:         legacy,
+			allowMissingKID: true,
+		}, nil
+	}
+
+	set := &KeySet{keys: map[string]*key{}}
+	for _, keyConfig := range cfg.Keys {
+		k, err := loadKey(keyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key %s: %w", keyConfig.ID, err)
+		}
+		set.keys[k.id] = k
+	}
+
+	set.signing = set.keys[cfg.SigningKey]
+	if set.signing == nil || set.signing.signKey == nil {
+		return nil, fmt.Errorf("signing key %q is not configured with a private key", cfg.SigningKey)
+	}
+	return set, nil
+}
+
+func loadKey(cfg config.KeyConfig) (*key, error) {
+	k := &key{id: cfg.ID}
+
+	switch cfg.Algorithm {
+	case config.KeyAlgorithmHS256:
+		secret := []byte(cfg.Secret)
+		if cfg.SecretFile != "" {
+			data, err := os.ReadFile(cfg.SecretFile)
+			if err != nil {
+				return nil, err
+			}
+			secret = []byte(strings.TrimSpace(string(data)))
+		}
+		if len(secret) == 0 {
+			return nil, errors.New("empty secret")
+		}
+		k.method = jwt.SigningMethodHS256
+		k.signKey, k.verifyKey = secret, secret
+
+	case config.KeyAlgorithmRS256:
+		k.method = jwt.SigningMethodRS256
+		if cfg.PrivateKeyFile != "" {
+			privateKey, err := readPEM(cfg.PrivateKeyFile, jwt.ParseRSAPrivateKeyFromPEM)
+			if err != nil {
+				return nil, err
+			}
+			k.signKey, k.verifyKey = privateKey, &privateKey.PublicKey
+		} else {
+			publicKey, err := readPEM(cfg.PublicKeyFile, jwt.ParseRSAPublicKeyFromPEM)
+			if err != nil {
+				return nil, err
+			}
+			k.verifyKey = publicKey
+		}
+
+	case config.KeyAlgorithmEdDSA:
+		k.method = jwt.SigningMethodEdDSA
+		if cfg.PrivateKeyFile != "" {
+			privateKey, err := readPEM(cfg.PrivateKeyFile, jwt.ParseEdPrivateKeyFromPEM)
+			if err != nil {
+				return nil, err
+			}
+			k.signKey, k.verifyKey = privateKey, privateKey.(ed25519.PrivateKey).Public()
+		} else {
+			publicKey, err := readPEM(cfg.PublicKeyFile, jwt.ParseEdPublicKeyFromPEM)
+			if err != nil {
+				return nil, err
+			}
+			k.verifyKey = publicKey
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", cfg.Algorithm)
+	}
+
+	return k, nil
+}
+
+func readPEM[T any](path string, parse func([]byte) (T, error)) (T, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return parse(data)
+}
+
+// Sign returns the token for the claims, signed by the signing key and naming it in the kid header.
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.signing.method, claims)
+	token.Header["kid"] = s.signing.id
+	return token.SignedString(s.signing.signKey)
+}
+
+// Parse verifies the token with the key named by its kid header and returns its claims.
+func (s *KeySet) Parse(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" && s.allowMissingKID {
+			kid = LegacyKeyID
+		}
+
+		k, ok := s.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		// The algorithm must be the key's, never the one the token asks for
+		if token.Method.Alg() != k.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return k.verifyKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		return claims, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+// JWK is a public key in the JSON Web Key format of RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`   // RSA modulus
+	E         string `json:"e,omitempty"`   // RSA exponent
+	Curve     string `json:"crv,omitempty"` // OKP curve
+	X         string `json:"x,omitempty"`   // OKP public key
+}
+
+// PublicKeys returns the asymmetric keys in JWKS form, sorted by kid.
+// HMAC secrets are never published.
+func (s *KeySet) PublicKeys() []JWK {
+	var keys []JWK
+	for _, k := range s.keys {
+		jwk := JWK{KeyID: k.id, Use: "sig", Algorithm: k.method.Alg()}
+
+		switch publicKey := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+		default:
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].KeyID < keys[j].KeyID })
+	return keys
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gc2-yugo/config"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{"user_id": "peter", "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+func TestLegacySecret(t *testing.T) {
+	keys, err := NewKeySet(config.AuthConfig{JWTSecret: "12345"})
+	require.NoError(t, err)
+
+	token, err := keys.Sign(testClaims())
+	require.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, LegacyKeyID, parsed.Header["kid"])
+
+	// Tokens issued before kid headers are still accepted
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString([]byte("12345"))
+	require.NoError(t, err)
+	claims, err := keys.Parse(legacy)
+	require.NoError(t, err)
+	assert.Equal(t, "peter", claims["user_id"])
+
+	// Secrets are never published
+	assert.Empty(t, keys.PublicKeys())
+}
+
+func TestKeyRotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	edPrivateDER, err := x509.MarshalPKCS8PrivateKey(edPrivate)
+	require.NoError(t, err)
+	edPublicDER, err := x509.MarshalPKIXPublicKey(edPublic)
+	require.NoError(t, err)
+
+	rsaKeyFile := writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	edPrivateFile := writePEM(t, "PRIVATE KEY", edPrivateDER)
+	edPublicFile := writePEM(t, "PUBLIC KEY", edPublicDER)
+
+	// Tokens are first signed with the EdDSA key
+	before, err := NewKeySet(config.AuthConfig{
+		SigningKey: "ed-1",
+		Keys: []config.KeyConfig{
+			{ID: "ed-1", Algorithm: config.KeyAlgorithmEdDSA, PrivateKeyFile: edPrivateFile},
+		},
+	})
+	require.NoError(t, err)
+	oldToken, err := before.Sign(testClaims())
+	require.NoError(t, err)
+
+	// Then the RSA key takes over and the EdDSA key only verifies
+	after, err := NewKeySet(config.AuthConfig{
+		SigningKey: "rsa-2",
+		Keys: []config.KeyConfig{
+			{ID: "ed-1", Algorithm: config.KeyAlgorithmEdDSA, PublicKeyFile: edPublicFile},
+			{ID: "rsa-2", Algorithm: config.KeyAlgorithmRS256, PrivateKeyFile: rsaKeyFile},
+			{ID: "hs-3", Algorithm: config.KeyAlgorithmHS256, Secret: "internal"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = after.Parse(oldToken)
+	assert.NoError(t, err)
+
+	newToken, err := after.Sign(testClaims())
+	require.NoError(t, err)
+	_, err = after.Parse(newToken)
+	assert.NoError(t, err)
+
+	// The old set does not know the new key
+	_, err = before.Parse(newToken)
+	assert.Error(t, err)
+
+	// A token must use the algorithm of the key it names
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = "rsa-2"
+	forgedToken, err := forged.SignedString(x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey))
+	require.NoError(t, err)
+	_, err = after.Parse(forgedToken)
+	assert.Error(t, err)
+
+	// Tokens without a kid are rejected once keys are configured
+	unnamed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString([]byte("internal"))
+	require.NoError(t, err)
+	_, err = after.Parse(unnamed)
+	assert.Error(t, err)
+
+	jwks := after.PublicKeys()
+	require.Len(t, jwks, 2)
+
+	assert.Equal(t, JWK{KeyType: "OKP", KeyID: "ed-1", Use: "sig", Algorithm: "EdDSA", Curve: "Ed25519",
+		X: base64.RawURLEncoding.EncodeToString(edPublic)}, jwks[0])
+
+	assert.Equal(t, "RSA", jwks[1].KeyType)
+	assert.Equal(t, "rsa-2", jwks[1].KeyID)
+	assert.Equal(t, "RS256", jwks[1].Algorithm)
+	assert.Equal(t, "AQAB", jwks[1].E)
+	modulus, err := base64.RawURLEncoding.DecodeString(jwks[1].N)
+	require.NoError(t, err)
+	assert.Equal(t, rsaKey.PublicKey.N.Bytes(), modulus)
+}
+
+func TestSigningKeyNeedsPrivateKey(t *testing.T) {
+	_, err := NewKeySet(config.AuthConfig{
+		SigningKey: "missing",
+		Keys:       []config.KeyConfig{{ID: "hs", Algorithm: config.KeyAlgorithmHS256, Secret: "secret"}},
+	})
+	assert.Error(t, err)
+}
@@ -1,13 +1,10 @@
 package handler
 
 import (
-	"context"
 	"gc2-yugo/pb"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/metadata"
 )
 
 // AddBook godoc
@@ -21,6 +18,8 @@ import (
 // @Success 200 {object} pb.AddBookResponse "Successfully added the book"
 // @Failure 400 {object} ErrorResponse "Bad request"
 // @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the librarian role"
+// @Failure 409 {object} ErrorResponse "A barcode is already used"
 // @Failure 500 {object} ErrorResponse "Internal Server Error"
 // @Router /book/add [post]
 func AddBook(c echo.Context) error {
@@ -29,25 +28,19 @@ func AddBook(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	grpcConn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	client, err := grpcClient(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
-	defer grpcConn.Close()
 
-	client := pb.NewBookRentalServiceClient(grpcConn)
-
-	token := c.Request().Header.Get("Authorization")
-	if token == "" {
-		return echo.NewHTTPError(http.StatusUnauthorized, "missing token")
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
 	}
 
-	md := metadata.Pairs("authorization", token)
-	ctx := metadata.NewOutgoingContext(context.Background(), md)
-
 	resp, err := client.AddBook(ctx, req)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return grpcError(err)
 	}
 
 	return c.JSON(http.StatusOK, resp)
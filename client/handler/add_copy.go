@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AddCopy godoc
+// @Summary Add a copy of a book
+// @Description Adds a physical copy with a barcode, condition and shelf location to a book. Librarian or admin only.
+// @Tags copies
+// @Accept json
+// @Produce json
+// @Param id path string true "Book ID" format(string)
+// @Param request body pb.AddCopyRequest true "Barcode, condition and location of the copy"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.CopyResponse "Successfully added the copy"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the librarian role"
+// @Failure 404 {object} ErrorResponse "Book not found"
+// @Failure 409 {object} ErrorResponse "The barcode is already used"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /books/{id}/copies [post]
+func AddCopy(c echo.Context) error {
+	req := new(pb.AddCopyRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	req.BookId = c.Param("id")
+	if _, err := primitive.ObjectIDFromHex(req.BookId); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid book ID format")
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.AddCopy(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
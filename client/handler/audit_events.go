@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ListAuditEvents godoc
+// @Summary List audit events
+// @Description Lists blocked logins, lockouts and unlocks, newest first. Admin only.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param username query string false "Only events of this username"
+// @Param type query string false "Only events of this type: login_blocked, account_locked or account_unlocked"
+// @Param page_size query int false "Number of events, defaults to 20, at most 100"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.ListAuditEventsResponse "List of audit events"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the admin role"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /audit [get]
+func ListAuditEvents(c echo.Context) error {
+	req := &pb.ListAuditEventsRequest{
+		Username: c.QueryParam("username"),
+		Type:     c.QueryParam("type"),
+	}
+	if pageSize := c.QueryParam("page_size"); pageSize != "" {
+		size, err := strconv.ParseInt(pageSize, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid page_size")
+		}
+		req.PageSize = int32(size)
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ListAuditEvents(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -1,14 +1,11 @@
 package handler
 
 import (
-	"context"
 	"gc2-yugo/pb"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/metadata"
 )
 
 // BorrowBook godoc
@@ -22,6 +19,8 @@ import (
 // @Success 200 {object} pb.BorrowBookResponse "Successfully borrowed the book"
 // @Failure 400 {object} ErrorResponse "Bad request"
 // @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 404 {object} ErrorResponse "Book not found"
+// @Failure 409 {object} map[string]interface{} "No copy is available, or the circulation rules refuse the loan, with the violated rule"
 // @Failure 500 {object} ErrorResponse "Internal Server Error"
 // @Router /book/borrow/{id} [post]
 func BorrowBook(c echo.Context) error {
@@ -31,24 +30,17 @@ func BorrowBook(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid book ID format")
 	}
 
-	// Retrieve token from the request header
-	token := c.Request().Header.Get("Authorization")
-	if token == "" {
-		return echo.NewHTTPError(http.StatusUnauthorized, "Missing token")
+	// Get the shared gRPC client
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
 	}
 
-	// Create gRPC connection
-	grpcConn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	// Forward the token from the request header
+	ctx, err := authContext(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to connect to gRPC server")
+		return err
 	}
-	defer grpcConn.Close()
-
-	client := pb.NewBookRentalServiceClient(grpcConn)
-
-	// Add token to metadata
-	md := metadata.Pairs("authorization", token)
-	ctx := metadata.NewOutgoingContext(context.Background(), md)
 
 	// Prepare BorrowBookRequest
 	req := &pb.BorrowBookRequest{
@@ -58,9 +50,43 @@ func BorrowBook(c echo.Context) error {
 	// Call BorrowBook gRPC service
 	resp, err := client.BorrowBook(ctx, req)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return grpcError(err)
 	}
 
 	// Return success response
 	return c.JSON(http.StatusOK, resp)
 }
+
+// BorrowCopy godoc
+// @Summary Borrow a copy by barcode
+// @Description Allows a user to borrow the copy of a book carrying the barcode
+// @Tags books
+// @Accept json
+// @Produce json
+// @Param barcode path string true "Copy barcode" format(string)
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.BorrowBookResponse "Successfully borrowed the copy"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 404 {object} ErrorResponse "Copy not found"
+// @Failure 409 {object} map[string]interface{} "The copy is not available, or the circulation rules refuse the loan, with the violated rule"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /copy/borrow/{barcode} [post]
+func BorrowCopy(c echo.Context) error {
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.BorrowBook(ctx, &pb.BorrowBookRequest{Barcode: c.Param("barcode")})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
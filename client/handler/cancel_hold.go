@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CancelHold godoc
+// @Summary Cancel a hold
+// @Description Leaves the queue of a book. A copy kept for the hold goes to the next patron. Librarians can cancel any hold.
+// @Tags holds
+// @Produce json
+// @Param id path string true "Hold ID" format(string)
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.HoldResponse "Successfully cancelled the hold"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - the hold belongs to another user"
+// @Failure 404 {object} ErrorResponse "Hold not found"
+// @Failure 409 {object} ErrorResponse "The hold is no longer active"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /holds/{id} [delete]
+func CancelHold(c echo.Context) error {
+	holdID := c.Param("id")
+	if _, err := primitive.ObjectIDFromHex(holdID); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid hold ID format")
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.CancelHold(ctx, &pb.CancelHoldRequest{HoldId: holdID})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
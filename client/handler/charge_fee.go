@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ChargeFee godoc
+// @Summary Charge a fee
+// @Description Charges a lost or damaged fee, in cents, defaulting to the configured fee. A lost fee ends the loan and marks the copy lost. A loan is charged each kind of fee once. Librarians only.
+// @Tags fees
+// @Accept json
+// @Produce json
+// @Param request body pb.ChargeFeeRequest true "The fee, with a loan_id or a user_id"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.FeeTransactionResponse "Successfully charged the fee"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the librarian role"
+// @Failure 404 {object} ErrorResponse "Borrow record or user not found"
+// @Failure 409 {object} ErrorResponse "The loan is returned or was already charged this fee"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /fees [post]
+func ChargeFee(c echo.Context) error {
+	req := new(pb.ChargeFeeRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ChargeFee(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CreateWebhookSubscription godoc
+// @Summary Subscribe a webhook
+// @Description Subscribes a partner's URL to event types: book.added, book.removed, book.borrowed, book.returned, book.status_changed or hold.ready. The events are posted as JSON, signed in the X-Webhook-Signature header with the secret of the response, which cannot be read again. Failed posts are retried with exponential backoff, then dead-lettered. Admin only.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param request body pb.CreateWebhookSubscriptionRequest true "The URL and the event types"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.WebhookSubscriptionResponse "Successfully subscribed, with the secret"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the admin role"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /webhooks [post]
+func CreateWebhookSubscription(c echo.Context) error {
+	req := new(pb.CreateWebhookSubscriptionRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.CreateWebhookSubscription(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DeleteWebhookSubscription godoc
+// @Summary Delete a webhook subscription
+// @Description Deletes the subscription with its delivery log. Its pending deliveries are not sent. Admin only.
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Subscription ID" format(string)
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.WebhookSubscriptionResponse "Successfully deleted the subscription"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the admin role"
+// @Failure 404 {object} ErrorResponse "Webhook subscription not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /webhooks/{id} [delete]
+func DeleteWebhookSubscription(c echo.Context) error {
+	subID := c.Param("id")
+	if _, err := primitive.ObjectIDFromHex(subID); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid webhook subscription ID format")
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.DeleteWebhookSubscription(ctx, &pb.DeleteWebhookSubscriptionRequest{Id: subID})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
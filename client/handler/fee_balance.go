@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetFeeBalance godoc
+// @Summary Get a fee balance
+// @Description Returns the unpaid fines and fees of the caller, in cents. Librarians can read the balance of any user.
+// @Tags fees
+// @Produce json
+// @Param user_id query string false "User ID, defaults to the caller"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.GetFeeBalanceResponse "The balance"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - only librarians can view another user's fees"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /fees/balance [get]
+func GetFeeBalance(c echo.Context) error {
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.GetFeeBalance(ctx, &pb.GetFeeBalanceRequest{UserId: c.QueryParam("user_id")})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetBooks godoc
+// @Summary List books
+// @Description Lists books in the library, filtered and paged with an opaque cursor
+// @Tags books
+// @Accept json
+// @Produce json
+// @Param status query string false "Filter by book status"
+// @Param author query string false "Filter by author"
+// @Param title query string false "Filter by title prefix"
+// @Param published_from query string false "Earliest published date (YYYY-MM-DD)"
+// @Param published_to query string false "Latest published date (YYYY-MM-DD)"
+// @Param page_size query int false "Number of books per page (default 20, max 100)"
+// @Param page_token query string false "Cursor returned as next_page_token by the previous page"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.GetBooksResponse "List of books"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - only librarians can view another user's loans"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /books [get]
+func GetBooks(c echo.Context) error {
+	req := &pb.GetBooksRequest{
+		Status:        c.QueryParam("status"),
+		Author:        c.QueryParam("author"),
+		TitlePrefix:   c.QueryParam("title"),
+		PublishedFrom: c.QueryParam("published_from"),
+		PublishedTo:   c.QueryParam("published_to"),
+		PageToken:     c.QueryParam("page_token"),
+	}
+
+	if pageSize := c.QueryParam("page_size"); pageSize != "" {
+		size, err := strconv.ParseInt(pageSize, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid page_size")
+		}
+		req.PageSize = int32(size)
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.GetBooks(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
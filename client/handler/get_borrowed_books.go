@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetMyLoans godoc
+// @Summary List my loans
+// @Description Lists the logged in user's loans, optionally filtered to active, returned or overdue loans
+// @Tags loans
+// @Accept json
+// @Produce json
+// @Param status query string false "Filter loans: active, returned or overdue"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.GetBorrowedBooksResponse "List of loans"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /me/loans [get]
+func GetMyLoans(c echo.Context) error {
+	return getBorrowedBooks(c, "")
+}
+
+// GetUserLoans godoc
+// @Summary List a user's loans
+// @Description Lists another user's loans, optionally filtered to active, returned or overdue loans. Admin only.
+// @Tags loans
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID" format(string)
+// @Param status query string false "Filter loans: active, returned or overdue"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.GetBorrowedBooksResponse "List of loans"
+// @Failure 400 {object} ErrorResponse "Invalid user ID format"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - only admins can view another user's loans"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /users/{id}/loans [get]
+func GetUserLoans(c echo.Context) error {
+	userID := c.Param("id")
+
+	if _, err := primitive.ObjectIDFromHex(userID); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user ID format")
+	}
+
+	return getBorrowedBooks(c, userID)
+}
+
+func getBorrowedBooks(c echo.Context, userID string) error {
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	req := &pb.GetBorrowedBooksRequest{
+		UserId: userID,
+		Filter: c.QueryParam("status"),
+	}
+
+	resp, err := client.GetBorrowedBooks(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"context"
+	"gc2-yugo/pb"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcClientKey is the echo context key holding the gRPC client.
+const grpcClientKey = "grpcClient"
+
+// streamRoutes are the routes of event streams, which last as long as the
+// client listens.
+var streamRoutes = map[string]bool{
+	"/books/watch": true,
+}
+
+// GRPCClient makes the shared gRPC client available to the handlers and
+// bounds every request forwarded to the gRPC server by timeout, except on the
+// stream routes. The client IP is forwarded as x-forwarded-for so the server
+// can throttle logins per client.
+func GRPCClient(client pb.BookRentalServiceClient, timeout time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var ctx context.Context
+			var cancel context.CancelFunc
+			if streamRoutes[c.Path()] {
+				ctx, cancel = context.WithCancel(c.Request().Context())
+			} else {
+				ctx, cancel = context.WithTimeout(c.Request().Context(), timeout)
+			}
+			defer cancel()
+
+			ctx = metadata.AppendToOutgoingContext(ctx, "x-forwarded-for", c.RealIP())
+
+			c.SetRequest(c.Request().WithContext(ctx))
+			c.Set(grpcClientKey, client)
+			return next(c)
+		}
+	}
+}
+
+// grpcClient returns the client set by the GRPCClient middleware.
+func grpcClient(c echo.Context) (pb.BookRentalServiceClient, error) {
+	client, ok := c.Get(grpcClientKey).(pb.BookRentalServiceClient)
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "gRPC client is not configured")
+	}
+	return client, nil
+}
+
+// authContext forwards the Authorization header of the request to the gRPC server.
+func authContext(c echo.Context) (context.Context, error) {
+	token := c.Request().Header.Get("Authorization")
+	if token == "" {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "missing token")
+	}
+
+	return metadata.AppendToOutgoingContext(c.Request().Context(), "authorization", token), nil
+}
+
+// httpStatus is the HTTP status answering a gRPC status code of the server.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.FailedPrecondition, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// grpcError turns an error of the gRPC server into the HTTP error of its status
+// code. The unmet preconditions the server details, such as the circulation rule
+// refusing a loan, are listed along with the message.
+func grpcError(err error) error {
+	st := status.Convert(err)
+
+	var violations []map[string]string
+	for _, detail := range st.Details() {
+		if failure, ok := detail.(*errdetails.PreconditionFailure); ok {
+			for _, violation := range failure.Violations {
+				violations = append(violations, map[string]string{
+					"type":        violation.Type,
+					"subject":     violation.Subject,
+					"description": violation.Description,
+				})
+			}
+		}
+	}
+	if len(violations) > 0 {
+		return echo.NewHTTPError(httpStatus(st.Code()), map[string]interface{}{
+			"message":    st.Message(),
+			"violations": violations,
+		})
+	}
+
+	return echo.NewHTTPError(httpStatus(st.Code()), st.Message())
+}
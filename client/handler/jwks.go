@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetJWKS godoc
+// @Summary Token verification keys
+// @Description Returns the public keys that verify the access tokens issued by this API, as a JSON Web Key Set
+// @Tags users
+// @Produce json
+// @Success 200 {object} pb.GetJWKSResponse "JSON Web Key Set"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /.well-known/jwks.json [get]
+func GetJWKS(c echo.Context) error {
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.GetJWKS(c.Request().Context(), &pb.GetJWKSRequest{})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	// Let verifiers cache the keys for a while, rotation keeps the old key active meanwhile
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+
+	// An empty set is still a valid document
+	if resp.Keys == nil {
+		resp.Keys = []*pb.JSONWebKey{}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
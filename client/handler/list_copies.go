@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ListCopies godoc
+// @Summary List the copies of a book
+// @Description Returns every copy of a book with its barcode, status, condition and location
+// @Tags copies
+// @Produce json
+// @Param id path string true "Book ID" format(string)
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.ListCopiesResponse "The copies of the book"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 404 {object} ErrorResponse "Book not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /books/{id}/copies [get]
+func ListCopies(c echo.Context) error {
+	bookID := c.Param("id")
+	if _, err := primitive.ObjectIDFromHex(bookID); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid book ID format")
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ListCopies(ctx, &pb.ListCopiesRequest{BookId: bookID})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ListFeeTransactions godoc
+// @Summary List fee transactions
+// @Description Lists the fines, fees, payments and waivers of the caller, oldest first, with the balance after each. Librarians can read the ledger of any user.
+// @Tags fees
+// @Produce json
+// @Param user_id query string false "User ID, defaults to the caller"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.ListFeeTransactionsResponse "The ledger"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - only librarians can view another user's fees"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /fees [get]
+func ListFeeTransactions(c echo.Context) error {
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ListFeeTransactions(ctx, &pb.ListFeeTransactionsRequest{UserId: c.QueryParam("user_id")})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
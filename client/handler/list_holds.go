@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ListHolds godoc
+// @Summary List holds
+// @Description Lists the caller's holds, oldest first, with the queue position of waiting holds. Librarians can list the whole queue of a book or another user's holds.
+// @Tags holds
+// @Produce json
+// @Param book_id query string false "Only holds on this book"
+// @Param user_id query string false "Holds of this user, librarians only"
+// @Param include_closed query bool false "Also list fulfilled, cancelled and expired holds"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.ListHoldsResponse "List of holds"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - only librarians can view another user's holds"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /holds [get]
+func ListHolds(c echo.Context) error {
+	req := &pb.ListHoldsRequest{
+		BookId: c.QueryParam("book_id"),
+		UserId: c.QueryParam("user_id"),
+	}
+	if includeClosed := c.QueryParam("include_closed"); includeClosed != "" {
+		value, err := strconv.ParseBool(includeClosed)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid include_closed")
+		}
+		req.IncludeClosed = value
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ListHolds(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ListJobRuns godoc
+// @Summary List the runs of a job
+// @Description Lists the latest runs of a job, newest first, with their outcome, counts and error. Admin only.
+// @Tags jobs
+// @Accept json
+// @Produce json
+// @Param name path string true "Job name: late_books, hold_expiry, fine_accrual or notifications" format(string)
+// @Param status query string false "Only runs in this status: running, succeeded or failed"
+// @Param limit query int false "Number of runs, defaults to 20, at most 100"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.ListJobRunsResponse "List of runs"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the admin role"
+// @Failure 404 {object} ErrorResponse "Job not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /jobs/{name}/runs [get]
+func ListJobRuns(c echo.Context) error {
+	req := &pb.ListJobRunsRequest{
+		Name:   c.Param("name"),
+		Status: c.QueryParam("status"),
+	}
+	if limit := c.QueryParam("limit"); limit != "" {
+		n, err := strconv.ParseInt(limit, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+		}
+		req.Limit = int32(n)
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ListJobRuns(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
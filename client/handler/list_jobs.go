@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ListJobs godoc
+// @Summary List the scheduled jobs
+// @Description Lists the jobs of the server with their schedule, next run, pause state and last run. Admin only.
+// @Tags jobs
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.ListJobsResponse "List of jobs"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the admin role"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /jobs [get]
+func ListJobs(c echo.Context) error {
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ListJobs(ctx, &pb.ListJobsRequest{})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ListNotifications godoc
+// @Summary List your notifications
+// @Description Lists the due date reminders, overdue notices and hold pickup notices sent to the caller, newest first.
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param kind query string false "Only notifications of this kind: due_soon, overdue or hold_ready"
+// @Param page_size query int false "Number of notifications, defaults to 20, at most 100"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.ListNotificationsResponse "List of notifications"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /notifications [get]
+func ListNotifications(c echo.Context) error {
+	req := &pb.ListNotificationsRequest{Kind: c.QueryParam("kind")}
+	if pageSize := c.QueryParam("page_size"); pageSize != "" {
+		size, err := strconv.ParseInt(pageSize, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid page_size")
+		}
+		req.PageSize = int32(size)
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ListNotifications(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
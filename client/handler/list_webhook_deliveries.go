@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ListWebhookDeliveries godoc
+// @Summary List the deliveries of a webhook
+// @Description Lists the latest deliveries of a subscription, newest first, with their attempts, last error and response code. Admin only.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID" format(string)
+// @Param status query string false "Only deliveries in this status: pending, delivered or dead"
+// @Param page_size query int false "Number of deliveries, defaults to 20, at most 100"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.ListWebhookDeliveriesResponse "List of deliveries"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the admin role"
+// @Failure 404 {object} ErrorResponse "Webhook subscription not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /webhooks/{id}/deliveries [get]
+func ListWebhookDeliveries(c echo.Context) error {
+	req := &pb.ListWebhookDeliveriesRequest{
+		SubscriptionId: c.Param("id"),
+		Status:         c.QueryParam("status"),
+	}
+	if _, err := primitive.ObjectIDFromHex(req.SubscriptionId); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid webhook subscription ID format")
+	}
+	if pageSize := c.QueryParam("page_size"); pageSize != "" {
+		n, err := strconv.ParseInt(pageSize, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid page_size")
+		}
+		req.PageSize = int32(n)
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ListWebhookDeliveries(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
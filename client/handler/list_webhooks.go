@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ListWebhookSubscriptions godoc
+// @Summary List webhook subscriptions
+// @Description Lists the webhook subscriptions, oldest first, without their secrets. Admin only.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.ListWebhookSubscriptionsResponse "List of subscriptions"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the admin role"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /webhooks [get]
+func ListWebhookSubscriptions(c echo.Context) error {
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ListWebhookSubscriptions(ctx, &pb.ListWebhookSubscriptionsRequest{})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
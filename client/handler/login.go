@@ -1,13 +1,14 @@
 package handler
 
 import (
-	"context"
 	"gc2-yugo/pb"
+	"math"
 	"net/http"
-	"time"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
-	"google.golang.org/grpc"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
 )
 
 // LoginUser godoc
@@ -19,7 +20,8 @@ import (
 // @Param login_user_request body pb.LoginUserRequest true "Login user request"
 // @Success 200 {object} pb.LoginUserResponse "Successfully logged in"
 // @Failure 400 {object} ErrorResponse "Bad request"
-// @Failure 401 {object} ErrorResponse "Unauthorized - invalid credentials"
+// @Failure 401 {object} ErrorResponse "Unauthorized - invalid username or password"
+// @Failure 429 {object} ErrorResponse "Too many failed logins, retry after the Retry-After header"
 // @Failure 500 {object} ErrorResponse "Internal Server Error"
 // @Router /login [post]
 func LoginUser(c echo.Context) error {
@@ -28,20 +30,20 @@ func LoginUser(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	grpcConn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	client, err := grpcClient(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
-	defer grpcConn.Close()
 
-	client := pb.NewBookRentalServiceClient(grpcConn)
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
-
-	resp, err := client.LoginUser(ctx, req)
+	resp, err := client.LoginUser(c.Request().Context(), req)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		// Tell a locked out client when to try again
+		for _, detail := range status.Convert(err).Details() {
+			if retry, ok := detail.(*errdetails.RetryInfo); ok {
+				c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.RetryDelay.AsDuration().Seconds()))))
+			}
+		}
+		return grpcError(err)
 	}
 
 	return c.JSON(http.StatusOK, resp)
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Logout godoc
+// @Summary Log out
+// @Description Revokes the access token immediately, and the refresh token when one is given
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param logout_request body pb.LogoutRequest false "Refresh token to revoke"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.LogoutResponse "Successfully logged out"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - the refresh token belongs to another user"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /logout [post]
+func Logout(c echo.Context) error {
+	req := new(pb.LogoutRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Logout(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetNotificationPreferences godoc
+// @Summary Get your notification preferences
+// @Description Returns the email address, channels and muted kinds of notifications of the caller, and the channels the server can send on.
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.NotificationPreferencesResponse "Notification preferences"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /notifications/preferences [get]
+func GetNotificationPreferences(c echo.Context) error {
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.GetNotificationPreferences(ctx, &pb.GetNotificationPreferencesRequest{})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// UpdateNotificationPreferences godoc
+// @Summary Update your notification preferences
+// @Description Replaces the notification preferences of the caller. Without channels the server's default channels are used, the email channel needs an email address.
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param request body pb.UpdateNotificationPreferencesRequest true "Email address, channels and muted kinds: due_soon, overdue or hold_ready"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.NotificationPreferencesResponse "Successfully updated the preferences"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /notifications/preferences [put]
+func UpdateNotificationPreferences(c echo.Context) error {
+	req := new(pb.UpdateNotificationPreferencesRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.UpdateNotificationPreferences(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// PauseJob godoc
+// @Summary Pause a scheduled job
+// @Description Makes every server replica skip the scheduled runs of the job until it is resumed. The job can still be triggered. Admin only.
+// @Tags jobs
+// @Accept json
+// @Produce json
+// @Param name path string true "Job name: late_books, hold_expiry, fine_accrual or notifications" format(string)
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.JobResponse "Successfully paused the job"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the admin role"
+// @Failure 404 {object} ErrorResponse "Job not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /jobs/{name}/pause [post]
+func PauseJob(c echo.Context) error {
+	req := &pb.PauseJobRequest{Name: c.Param("name")}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.PauseJob(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
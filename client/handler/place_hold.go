@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PlaceHold godoc
+// @Summary Place a hold on a book
+// @Description Joins the queue of a book with no copy on the shelf. A returned copy is kept for the first patron in the queue until the pickup deadline.
+// @Tags holds
+// @Produce json
+// @Param id path string true "Book ID" format(string)
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.HoldResponse "Successfully placed the hold"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 404 {object} ErrorResponse "Book not found"
+// @Failure 409 {object} ErrorResponse "A copy is available, or the book is already on loan to or held by the caller"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /books/{id}/holds [post]
+func PlaceHold(c echo.Context) error {
+	bookID := c.Param("id")
+	if _, err := primitive.ObjectIDFromHex(bookID); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid book ID format")
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.PlaceHold(ctx, &pb.PlaceHoldRequest{BookId: bookID})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
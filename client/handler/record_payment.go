@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RecordPayment godoc
+// @Summary Record a payment
+// @Description Records a payment, in cents, against a user's balance. The payment cannot be more than the balance. Librarians only.
+// @Tags fees
+// @Accept json
+// @Produce json
+// @Param request body pb.RecordPaymentRequest true "The payment"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.FeeTransactionResponse "Successfully recorded the payment"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the librarian role"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 409 {object} ErrorResponse "The payment is more than the balance"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /fees/payments [post]
+func RecordPayment(c echo.Context) error {
+	req := new(pb.RecordPaymentRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.RecordPayment(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
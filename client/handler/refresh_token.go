@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RefreshToken godoc
+// @Summary Refresh an access token
+// @Description Exchanges a refresh token for a new access token and a new refresh token. Each refresh token works only once.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param refresh_token_request body pb.RefreshTokenRequest true "Refresh token request"
+// @Success 200 {object} pb.RefreshTokenResponse "New token pair"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - invalid, expired or revoked refresh token"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /token/refresh [post]
+func RefreshToken(c echo.Context) error {
+	req := new(pb.RefreshTokenRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.RefreshToken(c.Request().Context(), req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -1,13 +1,13 @@
 package handler
 
 import (
-	"context"
 	"gc2-yugo/pb"
 	"net/http"
-	"time"
 
 	"github.com/labstack/echo/v4"
-	"google.golang.org/grpc"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // RegisterUser godoc
@@ -18,7 +18,8 @@ import (
 // @Produce json
 // @Param register_user_request body pb.RegisterUserRequest true "Register user request"
 // @Success 200 {object} map[string]interface{} "Successfully registered"
-// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 400 {object} map[string]interface{} "Bad request, with the rejected fields such as password policy violations"
+// @Failure 409 {object} ErrorResponse "Username already exists"
 // @Failure 500 {object} ErrorResponse "Internal Server Error"
 // @Router /register [post]
 func RegisterUser(c echo.Context) error {
@@ -27,20 +28,29 @@ func RegisterUser(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	grpcConn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	client, err := grpcClient(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
-	defer grpcConn.Close()
 
-	client := pb.NewBookRentalServiceClient(grpcConn)
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
-
-	resp, err := client.RegisterUser(ctx, req)
+	resp, err := client.RegisterUser(c.Request().Context(), req)
+	if st, ok := status.FromError(err); ok && st.Code() == codes.InvalidArgument {
+		// Report each rejected field, such as the password policy rules
+		violations := map[string][]string{}
+		for _, detail := range st.Details() {
+			if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+				for _, violation := range badRequest.FieldViolations {
+					violations[violation.Field] = append(violations[violation.Field], violation.Description)
+				}
+			}
+		}
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"message":    st.Message(),
+			"violations": violations,
+		})
+	}
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return grpcError(err)
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
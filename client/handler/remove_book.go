@@ -1,14 +1,11 @@
 package handler
 
 import (
-	"context"
 	"gc2-yugo/pb"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/metadata"
 )
 
 // RemoveBook godoc
@@ -21,6 +18,9 @@ import (
 // @Success 200 {object} pb.RemoveBookResponse "Successfully removed the book"
 // @Failure 400 {object} ErrorResponse "Invalid book ID format"
 // @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the librarian role"
+// @Failure 404 {object} ErrorResponse "Book not found"
+// @Failure 409 {object} ErrorResponse "The book has copies on loan or borrow records"
 // @Failure 500 {object} ErrorResponse "Internal Server Error"
 // @Router /book/remove/{id} [delete]
 func RemoveBook(c echo.Context) error {
@@ -35,25 +35,19 @@ func RemoveBook(c echo.Context) error {
 		BookId: bookID,
 	}
 
-	grpcConn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	client, err := grpcClient(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
 	}
-	defer grpcConn.Close()
 
-	client := pb.NewBookRentalServiceClient(grpcConn)
-
-	token := c.Request().Header.Get("Authorization")
-	if token == "" {
-		return echo.NewHTTPError(http.StatusUnauthorized, "missing token")
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
 	}
 
-	md := metadata.Pairs("authorization", token)
-	ctx := metadata.NewOutgoingContext(context.Background(), md)
-
 	resp, err := client.RemoveBook(ctx, req)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return grpcError(err)
 	}
 
 	return c.JSON(http.StatusOK, resp)
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RemoveCopy godoc
+// @Summary Remove a copy
+// @Description Deletes a copy that is not on loan. Copies with borrow records should be withdrawn instead. Librarian or admin only.
+// @Tags copies
+// @Produce json
+// @Param id path string true "Copy ID" format(string)
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.CopyResponse "Successfully removed the copy"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the librarian role"
+// @Failure 404 {object} ErrorResponse "Copy not found"
+// @Failure 409 {object} ErrorResponse "The copy is on loan, kept for a hold or has borrow records"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /copies/{id} [delete]
+func RemoveCopy(c echo.Context) error {
+	copyID := c.Param("id")
+	if _, err := primitive.ObjectIDFromHex(copyID); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid copy ID format")
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.RemoveCopy(ctx, &pb.RemoveCopyRequest{CopyId: copyID})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
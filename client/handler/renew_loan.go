@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RenewLoan godoc
+// @Summary Renew a loan
+// @Description Extends the due date of a loan by the loan period, up to the maximum number of renewals. Refused while another patron is waiting for the book. Librarians can renew any loan.
+// @Tags loans
+// @Produce json
+// @Param id path string true "Borrow ID" format(string)
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.RenewLoanResponse "Successfully renewed the loan"
+// @Failure 400 {object} ErrorResponse "Invalid borrow ID format"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - the borrow record belongs to another user"
+// @Failure 404 {object} ErrorResponse "Borrow record not found"
+// @Failure 409 {object} map[string]interface{} "The loan cannot be renewed, with the violated rule when the renewal limit is reached"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /loans/{id}/renew [post]
+func RenewLoan(c echo.Context) error {
+	borrowID := c.Param("id")
+	if _, err := primitive.ObjectIDFromHex(borrowID); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid borrow ID format")
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.RenewLoan(ctx, &pb.RenewLoanRequest{BorrowId: borrowID})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ResumeJob godoc
+// @Summary Resume a scheduled job
+// @Description Schedules the runs of a paused job again, the runs missed meanwhile are skipped. Admin only.
+// @Tags jobs
+// @Accept json
+// @Produce json
+// @Param name path string true "Job name: late_books, hold_expiry, fine_accrual or notifications" format(string)
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.JobResponse "Successfully resumed the job"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the admin role"
+// @Failure 404 {object} ErrorResponse "Job not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /jobs/{name}/resume [post]
+func ResumeJob(c echo.Context) error {
+	req := &pb.ResumeJobRequest{Name: c.Param("name")}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ResumeJob(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReturnBook godoc
+// @Summary Return a borrowed book
+// @Description Allows a user to return a book they borrowed, by its borrow record ID
+// @Tags books
+// @Accept json
+// @Produce json
+// @Param borrow_id path string true "Borrow record ID" format(string)
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.ReturnBookResponse "Successfully returned the book"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - the borrow record belongs to another user"
+// @Failure 404 {object} ErrorResponse "Borrow record not found"
+// @Failure 409 {object} ErrorResponse "The book has already been returned"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /book/return/{borrow_id} [post]
+func ReturnBook(c echo.Context) error {
+	// Extract borrow ID from the URL
+	borrowID, err := primitive.ObjectIDFromHex(c.Param("borrow_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid borrow ID format")
+	}
+
+	// Get the shared gRPC client
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	// Forward the token from the request header
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	// Prepare ReturnBookRequest
+	req := &pb.ReturnBookRequest{
+		BorrowId: borrowID.Hex(),
+	}
+
+	// Call ReturnBook gRPC service
+	resp, err := client.ReturnBook(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	// Return success response
+	return c.JSON(http.StatusOK, resp)
+}
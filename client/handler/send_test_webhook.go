@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SendTestWebhook godoc
+// @Summary Send a test event to a webhook
+// @Description Posts a signed webhook.test event to the subscription right away and returns the delivery with its outcome. A failed test is logged as dead and not retried. Admin only.
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Subscription ID" format(string)
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.SendTestWebhookResponse "The test delivery"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the admin role"
+// @Failure 404 {object} ErrorResponse "Webhook subscription not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /webhooks/{id}/test [post]
+func SendTestWebhook(c echo.Context) error {
+	subID := c.Param("id")
+	if _, err := primitive.ObjectIDFromHex(subID); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid webhook subscription ID format")
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.SendTestWebhook(ctx, &pb.SendTestWebhookRequest{SubscriptionId: subID})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SetUserCategory godoc
+// @Summary Change a user's category
+// @Description Sets the circulation category of a user, such as student or staff, which selects the loan rules that apply to them. An empty category applies the default rules. Librarians only.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID" format(string)
+// @Param request body pb.SetUserCategoryRequest true "The new category"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.SetUserCategoryResponse "Successfully changed the category"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the librarian role"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /users/{id}/category [put]
+func SetUserCategory(c echo.Context) error {
+	req := new(pb.SetUserCategoryRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	req.UserId = c.Param("id")
+	if _, err := primitive.ObjectIDFromHex(req.UserId); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user ID format")
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.SetUserCategory(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SetUserRole godoc
+// @Summary Change a user's role
+// @Description Sets the role of a user to member, librarian or admin. Admin only. The new role applies from the user's next login.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID" format(string)
+// @Param request body pb.SetUserRoleRequest true "The new role"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.SetUserRoleResponse "Successfully changed the role"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the admin role"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 409 {object} ErrorResponse "Admins cannot remove their own admin role"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /users/{id}/role [put]
+func SetUserRole(c echo.Context) error {
+	req := new(pb.SetUserRoleRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	req.UserId = c.Param("id")
+	if _, err := primitive.ObjectIDFromHex(req.UserId); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user ID format")
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.SetUserRole(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
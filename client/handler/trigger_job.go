@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TriggerJob godoc
+// @Summary Run a scheduled job now
+// @Description Starts a run of the job now, even when it is paused or has no schedule, and returns the run as it started. The run goes on in the background. Admin only.
+// @Tags jobs
+// @Accept json
+// @Produce json
+// @Param name path string true "Job name: late_books, hold_expiry, fine_accrual or notifications" format(string)
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.TriggerJobResponse "Successfully started the run"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the admin role"
+// @Failure 404 {object} ErrorResponse "Job not found"
+// @Failure 409 {object} ErrorResponse "The job is already running"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /jobs/{name}/trigger [post]
+func TriggerJob(c echo.Context) error {
+	req := &pb.TriggerJobRequest{Name: c.Param("name")}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.TriggerJob(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -2,23 +2,35 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
 	"gc2-yugo/entity"
 	"gc2-yugo/pb"
 	"log"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
+// testID is a well-formed ObjectID the handlers accept
+const testID = "507f1f77bcf86cd799439011"
+
 // Mock gRPC server implementation
 type mockBookRentalServiceServer struct {
 	pb.UnimplementedBookRentalServiceServer
@@ -32,12 +44,18 @@ var mockUser = entity.User{
 func (s *mockBookRentalServiceServer) LoginUser(ctx context.Context, req *pb.LoginUserRequest) (*pb.LoginUserResponse, error) {
 	log.Println("Mock LoginUser called with:", req.Username)
 
-	if req.Username == "validuser" && req.Password == "validpassword" {
+	if req.Username == "locked" {
+		st, _ := status.New(codes.ResourceExhausted, "too many failed logins").WithDetails(&errdetails.RetryInfo{
+			RetryDelay: durationpb.New(90 * time.Second),
+		})
+		return nil, st.Err()
+	}
+	if req.Username == mockUser.Username && req.Password == mockUser.Password {
 		return &pb.LoginUserResponse{
 			Token: "fake-token",
 		}, nil
 	}
-	return nil, status.Errorf(codes.InvalidArgument, "invalid credentials")
+	return nil, status.Errorf(codes.Unauthenticated, "invalid username or password")
 }
 
 func (s *mockBookRentalServiceServer) AddBook(ctx context.Context, req *pb.AddBookRequest) (*pb.BookResponse, error) {
@@ -63,7 +81,7 @@ func (s *mockBookRentalServiceServer) RemoveBook(ctx context.Context, req *pb.Re
 	}
 
 	// Simulate successful book removal
-	if req.BookId == "valid-book-id" {
+	if req.BookId == testID {
 		return &pb.BookResponse{
 			Message: "Success",
 		}, nil
@@ -83,7 +101,7 @@ func setupMockGRPCServer() (*bufconn.Listener, *grpc.ClientConn) {
 
 	go func() {
 		if err := server.Serve(listener); err != nil {
-			log.Fatalf("Server failed: %v", err)
+			log.Printf("Mock gRPC server stopped: %v", err)
 		}
 	}()
 
@@ -105,7 +123,7 @@ func setupMockRemoveBookGRPCServer() (*bufconn.Listener, *grpc.ClientConn) {
 
 	go func() {
 		if err := server.Serve(listener); err != nil {
-			log.Fatalf("Failed to start mock gRPC server: %v", err)
+			log.Printf("Mock gRPC server stopped: %v", err)
 		}
 	}()
 
@@ -126,37 +144,35 @@ func TestLoginUser(t *testing.T) {
 	defer listener.Close()
 	defer conn.Close()
 
-	// Create Echo instance
-	e := echo.New()
-
-	// Create HTTP request and recorder
-	req := httptest.NewRequest(http.MethodPost, "/login", nil)
-	rec := httptest.NewRecorder()
-	c := e.NewContext(req, rec)
-
-	// Create a mock gRPC client for this test context
-	client := pb.NewBookRentalServiceClient(conn)
-
-	// Pass the mock client into the handler context
-	c.Set("grpcClient", client)
-
-	// Simulate request body
-	loginRequest := pb.LoginUserRequest{
-		Username: "Peter Parker",
-		Password: "klewear123",
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+		retryAfter string
+	}{
+		{"valid credentials", `{"username":"Peter Parker","password":"klewear123"}`, http.StatusOK, "fake-token", ""},
+		{"wrong password", `{"username":"Peter Parker","password":"wrong"}`, http.StatusUnauthorized, "invalid username or password", ""},
+		{"locked out", `{"username":"locked","password":"klewear123"}`, http.StatusTooManyRequests, "too many failed logins", "90"},
+		{"malformed body", `{"username":`, http.StatusBadRequest, "", ""},
 	}
-	c.Set("request", loginRequest)
-
-	// Call the handler
-	if err := LoginUser(c); err != nil {
-		t.Fatalf("Failed to process request: %v", err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Route the request through echo so handler errors become responses
+			e := echo.New()
+			e.Use(GRPCClient(pb.NewBookRentalServiceClient(conn), time.Second))
+			e.POST("/login", LoginUser)
+
+			req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.Equal(t, tt.retryAfter, rec.Header().Get("Retry-After"))
+		})
 	}
-
-	// Assert that the status code is 200 OK
-	assert.Equal(t, http.StatusOK, rec.Code)
-
-	// Assert that the response contains the expected token
-	assert.Contains(t, rec.Body.String(), "fake-token")
 }
 
 func TestAddBook(t *testing.T) {
@@ -169,18 +185,13 @@ func TestAddBook(t *testing.T) {
 	e := echo.New()
 
 	// Create HTTP request and recorder
-	req := httptest.NewRequest(http.MethodPost, "/book/add", nil)
+	body := `{"title":"Test Book","author":"Test Author"}`
+	req := httptest.NewRequest(http.MethodPost, "/book/add", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	req.Header.Set("Authorization", "valid-token") // Set valid token
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
-	// Mock request body
-	addBookRequest := pb.AddBookRequest{
-		Title:  "Test Book",
-		Author: "Test Author",
-	}
-	c.Set("request", addBookRequest)
-
 	// Replace the gRPC client with the mock connection
 	client := pb.NewBookRentalServiceClient(conn)
 	c.Set("grpcClient", client)
@@ -194,7 +205,7 @@ func TestAddBook(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rec.Code)
 
 	// Assert the response body contains success
-	assert.Contains(t, rec.Body.String(), `"success":true`)
+	assert.Contains(t, rec.Body.String(), `"message":"Success"`)
 }
 
 func TestRemoveBook(t *testing.T) {
@@ -207,12 +218,12 @@ func TestRemoveBook(t *testing.T) {
 	e := echo.New()
 
 	// Create HTTP request and recorder
-	req := httptest.NewRequest(http.MethodDelete, "/book/remove/valid-book-id", nil)
+	req := httptest.NewRequest(http.MethodDelete, "/book/remove/"+testID, nil)
 	req.Header.Set("Authorization", "valid-token") // Set valid token
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	c.SetParamNames("id")
-	c.SetParamValues("valid-book-id")
+	c.SetParamValues(testID)
 
 	// Replace the gRPC client with the mock connection
 	client := pb.NewBookRentalServiceClient(conn)
@@ -227,5 +238,320 @@ func TestRemoveBook(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rec.Code)
 
 	// Assert the response body contains success
-	assert.Contains(t, rec.Body.String(), `"success":true`)
+	assert.Contains(t, rec.Body.String(), `"message":"Success"`)
+}
+
+// Only the stream routes are left without a deadline, whatever the client accepts
+func TestGRPCClientDeadline(t *testing.T) {
+	e := echo.New()
+	e.Use(GRPCClient(nil, time.Second))
+	hasDeadline := func(c echo.Context) error {
+		_, ok := c.Request().Context().Deadline()
+		return c.JSON(http.StatusOK, ok)
+	}
+	e.GET("/books/watch", hasDeadline)
+	e.GET("/books", hasDeadline)
+
+	for target, want := range map[string]string{"/books/watch": "false", "/books": "true"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set(echo.HeaderAccept, "text/event-stream")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, want, strings.TrimSpace(rec.Body.String()), target)
+	}
+}
+
+// recordingServer answers every unary call with an empty response, or with err
+// when set, and records the last call it received
+type recordingServer struct {
+	mu      sync.Mutex
+	method  string
+	request proto.Message
+	token   string
+	err     error
+}
+
+func (s *recordingServer) intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, _ grpc.UnaryHandler) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.method = info.FullMethod
+	s.request = req.(proto.Message)
+	s.token = ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("authorization")) > 0 {
+		s.token = md.Get("authorization")[0]
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	// An empty message decodes as any empty response
+	return &emptypb.Empty{}, nil
+}
+
+func (s *recordingServer) lastCall() (string, proto.Message, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.method, s.request, s.token
+}
+
+// setupRecordingServer starts a recordingServer and returns a client connected to it
+func setupRecordingServer(t *testing.T) (*recordingServer, pb.BookRentalServiceClient) {
+	t.Helper()
+
+	recorder := &recordingServer{}
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.UnaryInterceptor(recorder.intercept))
+	pb.RegisterBookRentalServiceServer(server, pb.UnimplementedBookRentalServiceServer{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet", grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return listener.Dial()
+	}), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to connect to recording gRPC server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return recorder, pb.NewBookRentalServiceClient(conn)
+}
+
+// handlerCase is a request to a handler and the gRPC call it should make
+type handlerCase struct {
+	name    string
+	method  string
+	route   string
+	target  string
+	body    string
+	handler echo.HandlerFunc
+	public  bool // Called without a token
+	rpc     string
+	want    proto.Message
+}
+
+var handlerCases = []handlerCase{
+	{"RegisterUser", http.MethodPost, "/register", "/register", `{"username":"peter","password":"secret"}`, RegisterUser, true,
+		pb.BookRentalService_RegisterUser_FullMethodName, &pb.RegisterUserRequest{Username: "peter", Password: "secret"}},
+	{"RefreshToken", http.MethodPost, "/token/refresh", "/token/refresh", `{"refresh_token":"r1"}`, RefreshToken, true,
+		pb.BookRentalService_RefreshToken_FullMethodName, &pb.RefreshTokenRequest{RefreshToken: "r1"}},
+	{"GetJWKS", http.MethodGet, "/.well-known/jwks.json", "/.well-known/jwks.json", "", GetJWKS, true,
+		pb.BookRentalService_GetJWKS_FullMethodName, &pb.GetJWKSRequest{}},
+	{"Logout", http.MethodPost, "/logout", "/logout", `{"refresh_token":"r1"}`, Logout, false,
+		pb.BookRentalService_Logout_FullMethodName, &pb.LogoutRequest{RefreshToken: "r1"}},
+	{"AddBook", http.MethodPost, "/book/add", "/book/add", `{"title":"Dune","author":"Frank Herbert","isbn":"9780441013593"}`, AddBook, false,
+		pb.BookRentalService_AddBook_FullMethodName, &pb.AddBookRequest{Title: "Dune", Author: "Frank Herbert", Isbn: "9780441013593"}},
+	{"RemoveBook", http.MethodDelete, "/book/remove/:id", "/book/remove/" + testID, "", RemoveBook, false,
+		pb.BookRentalService_RemoveBook_FullMethodName, &pb.RemoveBookRequest{BookId: testID}},
+	{"BorrowBook", http.MethodPost, "/book/borrow/:id", "/book/borrow/" + testID, "", BorrowBook, false,
+		pb.BookRentalService_BorrowBook_FullMethodName, &pb.BorrowBookRequest{BookId: testID}},
+	{"BorrowCopy", http.MethodPost, "/copy/borrow/:barcode", "/copy/borrow/B-1", "", BorrowCopy, false,
+		pb.BookRentalService_BorrowBook_FullMethodName, &pb.BorrowBookRequest{Barcode: "B-1"}},
+	{"ReturnBook", http.MethodPost, "/book/return/:borrow_id", "/book/return/" + testID, "", ReturnBook, false,
+		pb.BookRentalService_ReturnBook_FullMethodName, &pb.ReturnBookRequest{BorrowId: testID}},
+	{"GetBooks", http.MethodGet, "/books", "/books?author=Herbert&title=Du&page_size=10", "", GetBooks, false,
+		pb.BookRentalService_GetBooks_FullMethodName, &pb.GetBooksRequest{Author: "Herbert", TitlePrefix: "Du", PageSize: 10}},
+	{"AddCopy", http.MethodPost, "/books/:id/copies", "/books/" + testID + "/copies", `{"barcode":"B-2","location":"Shelf 3"}`, AddCopy, false,
+		pb.BookRentalService_AddCopy_FullMethodName, &pb.AddCopyRequest{BookId: testID, Barcode: "B-2", Location: "Shelf 3"}},
+	{"ListCopies", http.MethodGet, "/books/:id/copies", "/books/" + testID + "/copies", "", ListCopies, false,
+		pb.BookRentalService_ListCopies_FullMethodName, &pb.ListCopiesRequest{BookId: testID}},
+	{"UpdateCopy", http.MethodPut, "/copies/:id", "/copies/" + testID, `{"status":"lost"}`, UpdateCopy, false,
+		pb.BookRentalService_UpdateCopy_FullMethodName, &pb.UpdateCopyRequest{CopyId: testID, Status: "lost"}},
+	{"RemoveCopy", http.MethodDelete, "/copies/:id", "/copies/" + testID, "", RemoveCopy, false,
+		pb.BookRentalService_RemoveCopy_FullMethodName, &pb.RemoveCopyRequest{CopyId: testID}},
+	{"PlaceHold", http.MethodPost, "/books/:id/holds", "/books/" + testID + "/holds", "", PlaceHold, false,
+		pb.BookRentalService_PlaceHold_FullMethodName, &pb.PlaceHoldRequest{BookId: testID}},
+	{"ListHolds", http.MethodGet, "/holds", "/holds?book_id=" + testID + "&include_closed=true", "", ListHolds, false,
+		pb.BookRentalService_ListHolds_FullMethodName, &pb.ListHoldsRequest{BookId: testID, IncludeClosed: true}},
+	{"CancelHold", http.MethodDelete, "/holds/:id", "/holds/" + testID, "", CancelHold, false,
+		pb.BookRentalService_CancelHold_FullMethodName, &pb.CancelHoldRequest{HoldId: testID}},
+	{"GetMyLoans", http.MethodGet, "/me/loans", "/me/loans?status=overdue", "", GetMyLoans, false,
+		pb.BookRentalService_GetBorrowedBooks_FullMethodName, &pb.GetBorrowedBooksRequest{Filter: "overdue"}},
+	{"GetUserLoans", http.MethodGet, "/users/:id/loans", "/users/" + testID + "/loans", "", GetUserLoans, false,
+		pb.BookRentalService_GetBorrowedBooks_FullMethodName, &pb.GetBorrowedBooksRequest{UserId: testID}},
+	{"RenewLoan", http.MethodPost, "/loans/:id/renew", "/loans/" + testID + "/renew", "", RenewLoan, false,
+		pb.BookRentalService_RenewLoan_FullMethodName, &pb.RenewLoanRequest{BorrowId: testID}},
+	{"SetUserRole", http.MethodPut, "/users/:id/role", "/users/" + testID + "/role", `{"role":"librarian"}`, SetUserRole, false,
+		pb.BookRentalService_SetUserRole_FullMethodName, &pb.SetUserRoleRequest{UserId: testID, Role: "librarian"}},
+	{"SetUserCategory", http.MethodPut, "/users/:id/category", "/users/" + testID + "/category", `{"category":"staff"}`, SetUserCategory, false,
+		pb.BookRentalService_SetUserCategory_FullMethodName, &pb.SetUserCategoryRequest{UserId: testID, Category: "staff"}},
+	{"UnlockAccount", http.MethodPost, "/users/unlock", "/users/unlock", `{"username":"peter"}`, UnlockAccount, false,
+		pb.BookRentalService_UnlockAccount_FullMethodName, &pb.UnlockAccountRequest{Username: "peter"}},
+	{"ListAuditEvents", http.MethodGet, "/audit", "/audit?username=peter&page_size=5", "", ListAuditEvents, false,
+		pb.BookRentalService_ListAuditEvents_FullMethodName, &pb.ListAuditEventsRequest{Username: "peter", PageSize: 5}},
+	{"ListFeeTransactions", http.MethodGet, "/fees", "/fees?user_id=" + testID, "", ListFeeTransactions, false,
+		pb.BookRentalService_ListFeeTransactions_FullMethodName, &pb.ListFeeTransactionsRequest{UserId: testID}},
+	{"GetFeeBalance", http.MethodGet, "/fees/balance", "/fees/balance?user_id=" + testID, "", GetFeeBalance, false,
+		pb.BookRentalService_GetFeeBalance_FullMethodName, &pb.GetFeeBalanceRequest{UserId: testID}},
+	{"ChargeFee", http.MethodPost, "/fees", "/fees", `{"user_id":"` + testID + `","kind":"damaged","amount":500}`, ChargeFee, false,
+		pb.BookRentalService_ChargeFee_FullMethodName, &pb.ChargeFeeRequest{UserId: testID, Kind: "damaged", Amount: 500}},
+	{"RecordPayment", http.MethodPost, "/fees/payments", "/fees/payments", `{"user_id":"` + testID + `","amount":500}`, RecordPayment, false,
+		pb.BookRentalService_RecordPayment_FullMethodName, &pb.RecordPaymentRequest{UserId: testID, Amount: 500}},
+	{"WaiveFee", http.MethodPost, "/fees/:id/waive", "/fees/" + testID + "/waive", `{"note":"goodwill"}`, WaiveFee, false,
+		pb.BookRentalService_WaiveFee_FullMethodName, &pb.WaiveFeeRequest{TransactionId: testID, Note: "goodwill"}},
+	{"ListJobs", http.MethodGet, "/jobs", "/jobs", "", ListJobs, false,
+		pb.BookRentalService_ListJobs_FullMethodName, &pb.ListJobsRequest{}},
+	{"TriggerJob", http.MethodPost, "/jobs/:name/trigger", "/jobs/overdue/trigger", "", TriggerJob, false,
+		pb.BookRentalService_TriggerJob_FullMethodName, &pb.TriggerJobRequest{Name: "overdue"}},
+	{"PauseJob", http.MethodPost, "/jobs/:name/pause", "/jobs/overdue/pause", "", PauseJob, false,
+		pb.BookRentalService_PauseJob_FullMethodName, &pb.PauseJobRequest{Name: "overdue"}},
+	{"ResumeJob", http.MethodPost, "/jobs/:name/resume", "/jobs/overdue/resume", "", ResumeJob, false,
+		pb.BookRentalService_ResumeJob_FullMethodName, &pb.ResumeJobRequest{Name: "overdue"}},
+	{"ListJobRuns", http.MethodGet, "/jobs/:name/runs", "/jobs/overdue/runs?status=failed&limit=3", "", ListJobRuns, false,
+		pb.BookRentalService_ListJobRuns_FullMethodName, &pb.ListJobRunsRequest{Name: "overdue", Status: "failed", Limit: 3}},
+	{"ListNotifications", http.MethodGet, "/notifications", "/notifications?kind=overdue&page_size=20", "", ListNotifications, false,
+		pb.BookRentalService_ListNotifications_FullMethodName, &pb.ListNotificationsRequest{Kind: "overdue", PageSize: 20}},
+	{"GetNotificationPreferences", http.MethodGet, "/notifications/preferences", "/notifications/preferences", "", GetNotificationPreferences, false,
+		pb.BookRentalService_GetNotificationPreferences_FullMethodName, &pb.GetNotificationPreferencesRequest{}},
+	{"UpdateNotificationPreferences", http.MethodPut, "/notifications/preferences", "/notifications/preferences", `{"email":"peter@example.com","muted":["due_soon"]}`, UpdateNotificationPreferences, false,
+		pb.BookRentalService_UpdateNotificationPreferences_FullMethodName, &pb.UpdateNotificationPreferencesRequest{Email: "peter@example.com", Muted: []string{"due_soon"}}},
+	{"CreateWebhookSubscription", http.MethodPost, "/webhooks", "/webhooks", `{"url":"https://example.com/hook","event_types":["book.added"]}`, CreateWebhookSubscription, false,
+		pb.BookRentalService_CreateWebhookSubscription_FullMethodName, &pb.CreateWebhookSubscriptionRequest{Url: "https://example.com/hook", EventTypes: []string{"book.added"}}},
+	{"ListWebhookSubscriptions", http.MethodGet, "/webhooks", "/webhooks", "", ListWebhookSubscriptions, false,
+		pb.BookRentalService_ListWebhookSubscriptions_FullMethodName, &pb.ListWebhookSubscriptionsRequest{}},
+	{"DeleteWebhookSubscription", http.MethodDelete, "/webhooks/:id", "/webhooks/" + testID, "", DeleteWebhookSubscription, false,
+		pb.BookRentalService_DeleteWebhookSubscription_FullMethodName, &pb.DeleteWebhookSubscriptionRequest{Id: testID}},
+	{"ListWebhookDeliveries", http.MethodGet, "/webhooks/:id/deliveries", "/webhooks/" + testID + "/deliveries?status=failed", "", ListWebhookDeliveries, false,
+		pb.BookRentalService_ListWebhookDeliveries_FullMethodName, &pb.ListWebhookDeliveriesRequest{SubscriptionId: testID, Status: "failed"}},
+	{"SendTestWebhook", http.MethodPost, "/webhooks/:id/test", "/webhooks/" + testID + "/test", "", SendTestWebhook, false,
+		pb.BookRentalService_SendTestWebhook_FullMethodName, &pb.SendTestWebhookRequest{SubscriptionId: testID}},
+}
+
+// serveHandler sends a request through echo to the handler of tt, with the
+// Authorization header set to token unless it is empty
+func serveHandler(client pb.BookRentalServiceClient, tt handlerCase, target, token string) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.Use(GRPCClient(client, time.Second))
+	e.Add(tt.method, tt.route, tt.handler)
+
+	req := httptest.NewRequest(tt.method, target, strings.NewReader(tt.body))
+	if tt.body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlersForwardRequests(t *testing.T) {
+	recorder, client := setupRecordingServer(t)
+
+	for _, tt := range handlerCases {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveHandler(client, tt, tt.target, "Bearer valid-token")
+			assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+			method, request, token := recorder.lastCall()
+			assert.Equal(t, tt.rpc, method)
+			assert.True(t, proto.Equal(tt.want, request), "got request %v, want %v", request, tt.want)
+			if !tt.public {
+				assert.Equal(t, "Bearer valid-token", token)
+			}
+		})
+	}
+}
+
+func TestHandlersRequireToken(t *testing.T) {
+	recorder, client := setupRecordingServer(t)
+
+	for _, tt := range handlerCases {
+		if tt.public {
+			continue
+		}
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.method = ""
+			rec := serveHandler(client, tt, tt.target, "")
+			assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+			method, _, _ := recorder.lastCall()
+			assert.Empty(t, method, "the gRPC server must not be called")
+		})
+	}
+}
+
+func TestHandlersRejectInvalidIDs(t *testing.T) {
+	recorder, client := setupRecordingServer(t)
+
+	for _, tt := range handlerCases {
+		// Fee transaction IDs are checked by the server only
+		if !strings.Contains(tt.target, testID) || strings.Contains(tt.target, "?") || tt.name == "WaiveFee" {
+			continue
+		}
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.method = ""
+			rec := serveHandler(client, tt, strings.Replace(tt.target, testID, "not-an-id", 1), "Bearer valid-token")
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+			method, _, _ := recorder.lastCall()
+			assert.Empty(t, method, "the gRPC server must not be called")
+		})
+	}
+}
+
+func TestHandlersMapServerErrors(t *testing.T) {
+	recorder, client := setupRecordingServer(t)
+
+	statuses := []struct {
+		code codes.Code
+		want int
+	}{
+		{codes.InvalidArgument, http.StatusBadRequest},
+		{codes.Unauthenticated, http.StatusUnauthorized},
+		{codes.PermissionDenied, http.StatusForbidden},
+		{codes.NotFound, http.StatusNotFound},
+		{codes.AlreadyExists, http.StatusConflict},
+		{codes.FailedPrecondition, http.StatusConflict},
+		{codes.Aborted, http.StatusConflict},
+		{codes.ResourceExhausted, http.StatusTooManyRequests},
+		{codes.Internal, http.StatusInternalServerError},
+		{codes.Unavailable, http.StatusInternalServerError},
+	}
+	for _, st := range statuses {
+		recorder.err = status.Error(st.code, "refused by the server")
+		for _, tt := range handlerCases {
+			t.Run(st.code.String()+"/"+tt.name, func(t *testing.T) {
+				rec := serveHandler(client, tt, tt.target, "Bearer valid-token")
+				assert.Equal(t, st.want, rec.Code)
+				assert.Contains(t, rec.Body.String(), "refused by the server")
+			})
+		}
+	}
+}
+
+func TestHandlersReportPolicyViolations(t *testing.T) {
+	recorder, client := setupRecordingServer(t)
+	st, err := status.New(codes.FailedPrecondition, "at most 2 books can be borrowed at once").WithDetails(&errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{
+			{Type: "max_loans", Subject: "rule/students", Description: "at most 2 books can be borrowed at once"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build status: %v", err)
+	}
+	recorder.err = st.Err()
+
+	for _, tt := range handlerCases {
+		if tt.name != "BorrowBook" && tt.name != "BorrowCopy" && tt.name != "RenewLoan" {
+			continue
+		}
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveHandler(client, tt, tt.target, "Bearer valid-token")
+			assert.Equal(t, http.StatusConflict, rec.Code)
+
+			var body struct {
+				Message    string              `json:"message"`
+				Violations []map[string]string `json:"violations"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to decode %s: %v", rec.Body.String(), err)
+			}
+			assert.Equal(t, "at most 2 books can be borrowed at once", body.Message)
+			if assert.Len(t, body.Violations, 1) {
+				assert.Equal(t, "max_loans", body.Violations[0]["type"])
+				assert.Equal(t, "rule/students", body.Violations[0]["subject"])
+			}
+		})
+	}
 }
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// UnlockAccount godoc
+// @Summary Unlock a username or an IP
+// @Description Clears the failed logins and the lockout of a username, a client IP or both. Admin only.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body pb.UnlockAccountRequest true "Username and/or IP to unlock"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.UnlockAccountResponse "Successfully unlocked"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the admin role"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /users/unlock [post]
+func UnlockAccount(c echo.Context) error {
+	req := new(pb.UnlockAccountRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.Username == "" && req.Ip == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "username or ip is required")
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.UnlockAccount(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UpdateCopy godoc
+// @Summary Update a copy
+// @Description Marks a copy available, lost or withdrawn and changes its condition or location. Librarian or admin only.
+// @Tags copies
+// @Accept json
+// @Produce json
+// @Param id path string true "Copy ID" format(string)
+// @Param request body pb.UpdateCopyRequest true "Fields to change, empty fields are kept"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.CopyResponse "Successfully updated the copy"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the librarian role"
+// @Failure 404 {object} ErrorResponse "Copy not found"
+// @Failure 409 {object} ErrorResponse "The copy is on loan or kept for a hold"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /copies/{id} [put]
+func UpdateCopy(c echo.Context) error {
+	req := new(pb.UpdateCopyRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	req.CopyId = c.Param("id")
+	if _, err := primitive.ObjectIDFromHex(req.CopyId); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid copy ID format")
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.UpdateCopy(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
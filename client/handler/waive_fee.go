@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"gc2-yugo/pb"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// WaiveFee godoc
+// @Summary Waive a fee
+// @Description Waives a fine or fee in whole or in part, by default all of it that is not waived yet. Librarians only.
+// @Tags fees
+// @Accept json
+// @Produce json
+// @Param id path string true "Transaction ID of the fine or fee" format(string)
+// @Param request body pb.WaiveFeeRequest false "The amount to waive, in cents, and a note"
+// @Param Authorization header string true "Bearer <JWT Token>"
+// @Success 200 {object} pb.FeeTransactionResponse "Successfully waived the fee"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 403 {object} ErrorResponse "Forbidden - requires the librarian role"
+// @Failure 404 {object} ErrorResponse "Transaction not found"
+// @Failure 409 {object} ErrorResponse "The transaction is not a charge left to waive"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /fees/{id}/waive [post]
+func WaiveFee(c echo.Context) error {
+	req := new(pb.WaiveFeeRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	req.TransactionId = c.Param("id")
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := authContext(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.WaiveFee(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
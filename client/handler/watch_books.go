@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"gc2-yugo/pb"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// keepAliveInterval is how often an idle event stream gets a comment, so proxies
+// do not close it.
+const keepAliveInterval = 15 * time.Second
+
+// WatchBooks godoc
+// @Summary Watch books
+// @Description Streams the books as Server-Sent Events: a "snapshot" event per matching book and a "synced" event, then an event per change ("added", "removed", "borrowed", "returned", "status_changed"). The id of each event is its resume token, so an EventSource reconnecting with Last-Event-ID gets the changes it missed. Browsers cannot set headers on an EventSource, the token can be passed as access_token instead.
+// @Tags books
+// @Produce text/event-stream
+// @Param book_id query []string false "Only these books" collectionFormat(multi)
+// @Param status query string false "Only books in this status, Available or Unavailable"
+// @Param resume_token query string false "Resume after the event with this id, Last-Event-ID takes precedence"
+// @Param access_token query string false "Access token, when the Authorization header cannot be set"
+// @Param Authorization header string false "Bearer <JWT Token>"
+// @Success 200 {object} pb.BookEvent "Stream of book events"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 401 {object} ErrorResponse "Unauthorized - missing or invalid token"
+// @Failure 410 {object} ErrorResponse "The changes since the resume token were pruned, watch again without it"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /books/watch [get]
+func WatchBooks(c echo.Context) error {
+	req := &pb.WatchBooksRequest{
+		BookIds:     c.QueryParams()["book_id"],
+		Status:      c.QueryParam("status"),
+		ResumeToken: c.QueryParam("resume_token"),
+	}
+	if lastEventID := c.Request().Header.Get("Last-Event-ID"); lastEventID != "" {
+		req.ResumeToken = lastEventID
+	}
+
+	client, err := grpcClient(c)
+	if err != nil {
+		return err
+	}
+
+	token := c.Request().Header.Get("Authorization")
+	if token == "" && c.QueryParam("access_token") != "" {
+		token = "Bearer " + c.QueryParam("access_token")
+	}
+	if token == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "missing token")
+	}
+	ctx := metadata.AppendToOutgoingContext(c.Request().Context(), "authorization", token)
+
+	stream, err := client.WatchBooks(ctx, req)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	// The server refuses the stream before its first event, which is sent promptly
+	events := make(chan *pb.BookEvent)
+	failed := make(chan error, 1)
+	go func() {
+		for {
+			event, err := stream.Recv()
+			if err != nil {
+				failed <- err
+				return
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var first *pb.BookEvent
+	select {
+	case first = <-events:
+	case err := <-failed:
+		// The changes since the resume token were pruned
+		if st := status.Convert(err); st.Code() == codes.OutOfRange {
+			return echo.NewHTTPError(http.StatusGone, st.Message())
+		}
+		return grpcError(err)
+	}
+
+	resp := c.Response()
+	resp.Header().Set(echo.HeaderContentType, "text/event-stream")
+	resp.Header().Set(echo.HeaderCacheControl, "no-cache")
+	resp.Header().Set(echo.HeaderConnection, "keep-alive")
+	resp.WriteHeader(http.StatusOK)
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for event := first; ; {
+		if event != nil {
+			if err := writeBookEvent(resp, event); err != nil {
+				return nil
+			}
+			resp.Flush()
+		}
+
+		event = nil
+		select {
+		case event = <-events:
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(resp, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			resp.Flush()
+		case err := <-failed:
+			// The status is sent already, the browser reconnects with the last event's id
+			c.Logger().Warnf("book stream ended: %v", err)
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// writeBookEvent writes the event as a Server-Sent Event, with its resume token as id.
+func writeBookEvent(resp *echo.Response, event *pb.BookEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if event.ResumeToken != "" {
+		if _, err := fmt.Fprintf(resp, "id: %s\n", event.ResumeToken); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(resp, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
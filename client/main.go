@@ -2,12 +2,17 @@ package main
 
 import (
 	"gc2-yugo/client/handler"
-	"gc2-yugo/utils"
+	"gc2-yugo/config"
+	"gc2-yugo/pb"
+	"log"
+	"os"
 
 	_ "gc2-yugo/client/docs" // This will import your generated docs
 
 	"github.com/labstack/echo/v4"
 	echoSwagger "github.com/swaggo/echo-swagger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 // @title Book Borrowing API
@@ -21,18 +26,73 @@ import (
 // @BasePath /
 // @schemes http https
 func main() {
+	cfg, _, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
 
-	utils.StartSchedulerJob()
+	// One connection to the gRPC server is shared by all requests
+	conn, err := grpc.NewClient(cfg.Gateway.ServerAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("Failed to create gRPC client: %v", err)
+	}
+	defer conn.Close()
 
 	e := echo.New()
+	// Login throttling trusts the client IP, so proxy headers are ignored unless configured
+	if cfg.Gateway.TrustProxyHeaders {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
+	e.Use(handler.GRPCClient(pb.NewBookRentalServiceClient(conn), cfg.Gateway.RequestTimeout))
 
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
 
 	e.POST("/register", handler.RegisterUser)
 	e.POST("/login", handler.LoginUser)
+	e.POST("/token/refresh", handler.RefreshToken)
+	e.POST("/logout", handler.Logout)
+	e.GET("/.well-known/jwks.json", handler.GetJWKS)
 	e.POST("/book/add", handler.AddBook)
 	e.DELETE("/book/remove/:id", handler.RemoveBook)
 	e.POST("/book/borrow/:id", handler.BorrowBook)
+	e.POST("/copy/borrow/:barcode", handler.BorrowCopy)
+	e.POST("/book/return/:borrow_id", handler.ReturnBook)
+	e.GET("/books", handler.GetBooks)
+	e.GET("/books/watch", handler.WatchBooks)
+	e.POST("/books/:id/copies", handler.AddCopy)
+	e.GET("/books/:id/copies", handler.ListCopies)
+	e.PUT("/copies/:id", handler.UpdateCopy)
+	e.DELETE("/copies/:id", handler.RemoveCopy)
+	e.POST("/books/:id/holds", handler.PlaceHold)
+	e.GET("/holds", handler.ListHolds)
+	e.DELETE("/holds/:id", handler.CancelHold)
+	e.GET("/me/loans", handler.GetMyLoans)
+	e.POST("/loans/:id/renew", handler.RenewLoan)
+	e.GET("/users/:id/loans", handler.GetUserLoans)
+	e.PUT("/users/:id/role", handler.SetUserRole)
+	e.PUT("/users/:id/category", handler.SetUserCategory)
+	e.POST("/users/unlock", handler.UnlockAccount)
+	e.GET("/audit", handler.ListAuditEvents)
+	e.GET("/fees", handler.ListFeeTransactions)
+	e.GET("/fees/balance", handler.GetFeeBalance)
+	e.POST("/fees", handler.ChargeFee)
+	e.POST("/fees/payments", handler.RecordPayment)
+	e.POST("/fees/:id/waive", handler.WaiveFee)
+	e.GET("/jobs", handler.ListJobs)
+	e.POST("/jobs/:name/trigger", handler.TriggerJob)
+	e.POST("/jobs/:name/pause", handler.PauseJob)
+	e.POST("/jobs/:name/resume", handler.ResumeJob)
+	e.GET("/jobs/:name/runs", handler.ListJobRuns)
+	e.GET("/notifications", handler.ListNotifications)
+	e.GET("/notifications/preferences", handler.GetNotificationPreferences)
+	e.PUT("/notifications/preferences", handler.UpdateNotificationPreferences)
+	e.POST("/webhooks", handler.CreateWebhookSubscription)
+	e.GET("/webhooks", handler.ListWebhookSubscriptions)
+	e.DELETE("/webhooks/:id", handler.DeleteWebhookSubscription)
+	e.GET("/webhooks/:id/deliveries", handler.ListWebhookDeliveries)
+	e.POST("/webhooks/:id/test", handler.SendTestWebhook)
 
-	e.Logger.Fatal(e.Start(":8080"))
+	e.Logger.Fatal(e.Start(cfg.Gateway.Address))
 }
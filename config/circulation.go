@@ -0,0 +1,225 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// DefaultRule names the loans settings when no circulation rule matches.
+const DefaultRule = "default"
+
+// CirculationRule overrides the loans settings for a user category, an item type or
+// both. Unset fields keep the loans settings.
+type CirculationRule struct {
+	Name           string         `yaml:"name"`          // reported when the rule refuses a loan
+	UserCategory   string         `yaml:"user_category"` // empty matches every category
+	ItemType       string         `yaml:"item_type"`     // empty matches every item type
+	Period         *time.Duration `yaml:"period"`
+	MaxLoans       *int           `yaml:"max_loans"` // counts the loans of the rule's item type, or all loans without one
+	MaxRenewals    *int           `yaml:"max_renewals"`
+	BlockOnOverdue *bool          `yaml:"block_on_overdue"`
+	BlockOnFines   *bool          `yaml:"block_on_fines"`
+	DailyFine      *int           `yaml:"daily_fine"`
+	FineGraceDays  *int           `yaml:"fine_grace_days"`
+	MaxFine        *int           `yaml:"max_fine"`
+}
+
+// Policy is the terms of a loan once the rules are applied.
+type Policy struct {
+	Rule           string // name of the matching rule, DefaultRule when none matched
+	ItemType       string // item type the rule is limited to, empty for all
+	Period         time.Duration
+	MaxLoans       int
+	MaxRenewals    int
+	BlockOnOverdue bool
+	BlockOnFines   bool
+	DailyFine      int // cents per day late
+	FineGraceDays  int // days late without a fine
+	MaxFine        int // cap of the overdue fine of one loan, 0 for none
+}
+
+// FineConfig sets the fees charged to patrons, in cents of Currency. The overdue
+// fine settings can be overridden by circulation rules.
+type FineConfig struct {
+	Currency  string `yaml:"currency"`   // ISO 4217 code, only used for display
+	DailyFine int    `yaml:"daily_fine"` // charged for every day a book is late
+	// GraceDays is how many days a book can be late without a fine. Books returned
+	// later are fined for every day late.
+	GraceDays int `yaml:"grace_days"`
+	MaxFine   int `yaml:"max_fine"`   // cap of the overdue fine of one loan, 0 for none
+	LostFee   int `yaml:"lost_fee"`   // default replacement fee of a lost copy
+	DamageFee int `yaml:"damage_fee"` // default fee of a damaged copy
+}
+
+func defaultFineConfig() FineConfig {
+	return FineConfig{
+		Currency:  "EUR",
+		DailyFine: 25,
+		GraceDays: 1,
+		MaxFine:   1000,
+		LostFee:   2500,
+		DamageFee: 1000,
+	}
+}
+
+func (c *FineConfig) loadEnv(env *envReader) {
+	env.string("FINE_CURRENCY", &c.Currency)
+	env.int("FINE_DAILY", &c.DailyFine)
+	env.int("FINE_GRACE_DAYS", &c.GraceDays)
+	env.int("FINE_MAX", &c.MaxFine)
+	env.int("FINE_LOST_FEE", &c.LostFee)
+	env.int("FINE_DAMAGE_FEE", &c.DamageFee)
+}
+
+func (c *FineConfig) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Currency, "loans.fines.currency", c.Currency, "currency of fines and fees")
+	fs.IntVar(&c.DailyFine, "loans.fines.daily-fine", c.DailyFine, "fine in cents for every day a book is late")
+	fs.IntVar(&c.GraceDays, "loans.fines.grace-days", c.GraceDays, "days a book can be late without a fine")
+	fs.IntVar(&c.MaxFine, "loans.fines.max-fine", c.MaxFine, "cap in cents of the overdue fine of one loan, 0 for none")
+	fs.IntVar(&c.LostFee, "loans.fines.lost-fee", c.LostFee, "default fee in cents of a lost copy")
+	fs.IntVar(&c.DamageFee, "loans.fines.damage-fee", c.DamageFee, "default fee in cents of a damaged copy")
+}
+
+func (c *FineConfig) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(len(c.Currency) == 3, "loans.fines.currency must be a 3 letter code, got %q", c.Currency)
+	check(c.DailyFine >= 0, "loans.fines.daily_fine must not be negative, got %d", c.DailyFine)
+	check(c.GraceDays >= 0, "loans.fines.grace_days must not be negative, got %d", c.GraceDays)
+	check(c.MaxFine >= 0, "loans.fines.max_fine must not be negative, got %d", c.MaxFine)
+	check(c.LostFee >= 0, "loans.fines.lost_fee must not be negative, got %d", c.LostFee)
+	check(c.DamageFee >= 0, "loans.fines.damage_fee must not be negative, got %d", c.DamageFee)
+
+	return errors.Join(errs...)
+}
+
+func (c *LoanConfig) loadCirculationEnv(env *envReader) {
+	env.int("LOAN_MAX_LOANS", &c.MaxLoans)
+	env.bool("LOAN_BLOCK_ON_OVERDUE", &c.BlockOnOverdue)
+	env.bool("LOAN_BLOCK_ON_FINES", &c.BlockOnFines)
+	c.Fines.loadEnv(env)
+}
+
+func (c *LoanConfig) bindCirculationFlags(fs *flag.FlagSet) {
+	fs.IntVar(&c.MaxLoans, "loans.max-loans", c.MaxLoans, "how many books a user can borrow at once")
+	fs.BoolVar(&c.BlockOnOverdue, "loans.block-on-overdue", c.BlockOnOverdue, "refuse loans to users with overdue books")
+	fs.BoolVar(&c.BlockOnFines, "loans.block-on-fines", c.BlockOnFines, "refuse loans to users with unpaid fines")
+	c.Fines.bindFlags(fs)
+}
+
+func (c *LoanConfig) validateRules() error {
+	var errs []error
+	names := map[string]bool{DefaultRule: true}
+	keys := map[[2]string]string{}
+	for _, rule := range c.Rules {
+		if rule.Name == "" {
+			errs = append(errs, errors.New("loans.rules: every rule needs a name"))
+			continue
+		}
+		if names[rule.Name] {
+			errs = append(errs, fmt.Errorf("loans.rules %s: the name is used twice", rule.Name))
+		}
+		names[rule.Name] = true
+
+		key := [2]string{rule.UserCategory, rule.ItemType}
+		if key == [2]string{} {
+			errs = append(errs, fmt.Errorf("loans.rules %s: needs a user_category or an item_type, set the loans settings for everyone", rule.Name))
+		} else if other, ok := keys[key]; ok {
+			errs = append(errs, fmt.Errorf("loans.rules %s: matches the same loans as %s", rule.Name, other))
+		}
+		keys[key] = rule.Name
+
+		if rule.Period != nil && *rule.Period < time.Hour {
+			errs = append(errs, fmt.Errorf("loans.rules %s: period must be at least 1h, got %s", rule.Name, *rule.Period))
+		}
+		if rule.MaxLoans != nil && *rule.MaxLoans < 0 {
+			errs = append(errs, fmt.Errorf("loans.rules %s: max_loans must not be negative, got %d", rule.Name, *rule.MaxLoans))
+		}
+		if rule.MaxRenewals != nil && *rule.MaxRenewals < 0 {
+			errs = append(errs, fmt.Errorf("loans.rules %s: max_renewals must not be negative, got %d", rule.Name, *rule.MaxRenewals))
+		}
+		fines := []struct {
+			field string
+			value *int
+		}{{"daily_fine", rule.DailyFine}, {"fine_grace_days", rule.FineGraceDays}, {"max_fine", rule.MaxFine}}
+		for _, fine := range fines {
+			if fine.value != nil && *fine.value < 0 {
+				errs = append(errs, fmt.Errorf("loans.rules %s: %s must not be negative, got %d", rule.Name, fine.field, *fine.value))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Policy returns the terms for a user category and an item type. A rule naming both
+// wins over one naming the category, which wins over one naming the item type.
+// Without a matching rule the loans settings apply.
+func (c LoanConfig) Policy(userCategory, itemType string) Policy {
+	policy := Policy{
+		Rule:           DefaultRule,
+		Period:         c.Period,
+		MaxLoans:       c.MaxLoans,
+		MaxRenewals:    c.MaxRenewals,
+		BlockOnOverdue: c.BlockOnOverdue,
+		BlockOnFines:   c.BlockOnFines,
+		DailyFine:      c.Fines.DailyFine,
+		FineGraceDays:  c.Fines.GraceDays,
+		MaxFine:        c.Fines.MaxFine,
+	}
+
+	var match *CirculationRule
+	best := 0
+	for i, rule := range c.Rules {
+		if (rule.UserCategory != "" && rule.UserCategory != userCategory) || (rule.ItemType != "" && rule.ItemType != itemType) {
+			continue
+		}
+		score := 0
+		if rule.UserCategory != "" {
+			score += 2
+		}
+		if rule.ItemType != "" {
+			score++
+		}
+		if score > best {
+			match, best = &c.Rules[i], score
+		}
+	}
+	if match == nil {
+		return policy
+	}
+
+	policy.Rule = match.Name
+	policy.ItemType = match.ItemType
+	if match.Period != nil {
+		policy.Period = *match.Period
+	}
+	if match.MaxLoans != nil {
+		policy.MaxLoans = *match.MaxLoans
+	}
+	if match.MaxRenewals != nil {
+		policy.MaxRenewals = *match.MaxRenewals
+	}
+	if match.BlockOnOverdue != nil {
+		policy.BlockOnOverdue = *match.BlockOnOverdue
+	}
+	if match.BlockOnFines != nil {
+		policy.BlockOnFines = *match.BlockOnFines
+	}
+	if match.DailyFine != nil {
+		policy.DailyFine = *match.DailyFine
+	}
+	if match.FineGraceDays != nil {
+		policy.FineGraceDays = *match.FineGraceDays
+	}
+	if match.MaxFine != nil {
+		policy.MaxFine = *match.MaxFine
+	}
+	return policy
+}
@@ -1,103 +1,363 @@
 package config
 
 import (
-	"context"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"gc2-yugo/store"
+	"io"
 	"os"
 	"time"
 
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
 )
 
-func ConnectionDatabaseUsers(ctx context.Context) (*mongo.Collection, error) {
-	// Define the MongoDB connection string
-	var mongoURI string
+// Config holds the settings of the gRPC server, the HTTP gateway and the scheduler.
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Gateway   GatewayConfig   `yaml:"gateway"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Loans     LoanConfig      `yaml:"loans"`
+	Scheduler SchedulerConfig `yaml:"scheduler"`
+	// Notifications are sent by the scheduler's notifications job
+	Notifications NotificationConfig `yaml:"notifications"`
+	// Outbox relays the events of the catalogue and the loans to other systems
+	Outbox OutboxConfig `yaml:"outbox"`
+	// Webhooks posts the events partners subscribed to
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+	Storage  StorageConfig  `yaml:"storage"`
+}
 
-	if os.Getenv("RUNNING_IN_DOCKER") == "true" {
-		mongoURI = "mongodb://host.docker.internal:27017"
-	} else {
-		mongoURI = "mongodb://localhost:27017" // For local development
-	}
+type ServerConfig struct {
+	Address string `yaml:"address"` // gRPC listen address
+}
 
-	// Create client options with the URI
-	clientOptions := options.Client().ApplyURI(mongoURI)
+type GatewayConfig struct {
+	Address        string        `yaml:"address"`         // HTTP listen address
+	ServerAddress  string        `yaml:"server_address"`  // gRPC server the gateway forwards to
+	RequestTimeout time.Duration `yaml:"request_timeout"` // deadline of each forwarded call
+	// TrustProxyHeaders takes the client IP from X-Forwarded-For, only enable it
+	// when the gateway runs behind a proxy that sets the header
+	TrustProxyHeaders bool `yaml:"trust_proxy_headers"`
+}
 
-	// Create a MongoDB client
-	client, err := mongo.Connect(ctx, clientOptions)
-	if err != nil {
-		return nil, err
+// AuthConfig configures the access tokens. Tokens are signed with the HS256
+// JWTSecret unless Keys are set, in which case SigningKey names the key that
+// signs new tokens and every key in Keys is accepted.
+type AuthConfig struct {
+	JWTSecret       string         `yaml:"jwt_secret"`
+	SigningKey      string         `yaml:"signing_key"`
+	Keys            []KeyConfig    `yaml:"keys"`
+	TokenTTL        time.Duration  `yaml:"token_ttl"`         // lifetime of access tokens
+	RefreshTokenTTL time.Duration  `yaml:"refresh_token_ttl"` // lifetime of a login, renewed by each refresh
+	Passwords       PasswordConfig `yaml:"passwords"`
+	Lockout         LockoutConfig  `yaml:"lockout"`
+}
+
+// PasswordConfig sets how passwords are hashed and which passwords are accepted at registration.
+type PasswordConfig struct {
+	BcryptCost    int  `yaml:"bcrypt_cost"`
+	MinLength     int  `yaml:"min_length"`
+	RequireUpper  bool `yaml:"require_upper"`
+	RequireLower  bool `yaml:"require_lower"`
+	RequireDigit  bool `yaml:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol"`
+}
+
+// MaxPasswordLength is the longest password bcrypt can hash, in bytes.
+const MaxPasswordLength = 72
+
+// LoanConfig holds the circulation settings. Rules override them for some user
+// categories or item types.
+type LoanConfig struct {
+	Period         time.Duration     `yaml:"period"`           // how long a book can be borrowed, and how long a renewal extends it
+	MaxRenewals    int               `yaml:"max_renewals"`     // how often a loan can be renewed
+	MaxLoans       int               `yaml:"max_loans"`        // how many books a user can borrow at once
+	BlockOnOverdue bool              `yaml:"block_on_overdue"` // refuse loans to users with overdue books
+	BlockOnFines   bool              `yaml:"block_on_fines"`   // refuse loans to users with unpaid fines
+	Fines          FineConfig        `yaml:"fines"`
+	Rules          []CirculationRule `yaml:"rules"`
+	HoldPickup     time.Duration     `yaml:"hold_pickup"` // how long a returned copy is kept for the next patron in the queue
+}
+
+// SchedulerConfig sets the background jobs of the server. An empty spec disables a job.
+type SchedulerConfig struct {
+	Enabled         bool   `yaml:"enabled"`           // run the jobs in this server process
+	LateBooksSpec   string `yaml:"late_books_spec"`   // cron spec of the late books check
+	HoldExpirySpec  string `yaml:"hold_expiry_spec"`  // cron spec of the job passing uncollected holds on
+	FineAccrualSpec string `yaml:"fine_accrual_spec"` // cron spec of the job charging overdue fines
+	// NotificationsSpec is the cron spec of the job sending due date reminders, overdue
+	// notices and hold pickup notices
+	NotificationsSpec string        `yaml:"notifications_spec"`
+	JobTimeout        time.Duration `yaml:"job_timeout"`   // how long a run can take before it is cancelled
+	RunRetention      time.Duration `yaml:"run_retention"` // how long the history of finished runs is kept
+	// InstanceID names this server among the replicas sharing the store, in job leases
+	// and run history. Empty uses the host name and the process id.
+	InstanceID string        `yaml:"instance_id"`
+	LeaseTTL   time.Duration `yaml:"lease_ttl"` // how long a replica holds a job without renewing its lease
+}
+
+type StorageConfig struct {
+	Backend string      `yaml:"backend"` // "mongo", "postgres" or "sqlite"
+	Mongo   MongoConfig `yaml:"mongo"`
+	SQL     SQLConfig   `yaml:"sql"`
+}
+
+// DefaultJWTSecret is only meant for local development.
+const DefaultJWTSecret = "12345"
+
+// Default returns the configuration used when nothing is overridden.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Address: ":50051",
+		},
+		Gateway: GatewayConfig{
+			Address:        ":8080",
+			ServerAddress:  "localhost:50051",
+			RequestTimeout: 5 * time.Second,
+		},
+		Auth: AuthConfig{
+			JWTSecret:       DefaultJWTSecret,
+			TokenTTL:        15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+			Passwords: PasswordConfig{
+				BcryptCost:   12,
+				MinLength:    8,
+				RequireUpper: true,
+				RequireLower: true,
+				RequireDigit: true,
+			},
+			Lockout: defaultLockoutConfig(),
+		},
+		Loans: LoanConfig{
+			Period:         7 * 24 * time.Hour,
+			MaxRenewals:    2,
+			MaxLoans:       10,
+			BlockOnOverdue: true,
+			BlockOnFines:   true,
+			Fines:          defaultFineConfig(),
+			HoldPickup:     3 * 24 * time.Hour,
+		},
+		Scheduler: SchedulerConfig{
+			Enabled:           true,
+			LateBooksSpec:     "0 0 * * *",    // every day at midnight
+			HoldExpirySpec:    "*/15 * * * *", // every 15 minutes
+			FineAccrualSpec:   "30 0 * * *",   // every day at 00:30
+			NotificationsSpec: "*/15 * * * *", // every 15 minutes
+			JobTimeout:        10 * time.Minute,
+			RunRetention:      30 * 24 * time.Hour,
+			LeaseTTL:          time.Minute,
+		},
+		Notifications: defaultNotificationConfig(),
+		Outbox:        defaultOutboxConfig(),
+		Webhooks:      defaultWebhooksConfig(),
+		Storage: StorageConfig{
+			Backend: "mongo",
+			Mongo:   defaultMongoConfig(),
+		},
 	}
+}
 
-	// Test the connection with a timeout
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-	if err := client.Ping(ctx, nil); err != nil {
-		return nil, err
+// Load builds the configuration from the defaults, then the YAML file named by the
+// -config flag or CONFIG_FILE, then the environment, then the command line flags,
+// and validates the result. It returns the arguments left after the flags.
+func Load(args []string) (*Config, []string, error) {
+	cfg := Default()
+
+	path := configFileFromArgs(args)
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	// Return the collection
-	collection := client.Database("GC2").Collection("users")
-	return collection, nil
-}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, nil, err
+	}
 
-func ConnectionDatabaseBooks(ctx context.Context) (*mongo.Collection, error) {
-	// Define the MongoDB connection string
-	var mongoURI string
+	fs := cfg.flagSet()
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
 
-	if os.Getenv("RUNNING_IN_DOCKER") == "true" {
-		mongoURI = "mongodb://host.docker.internal:27017"
-	} else {
-		mongoURI = "mongodb://localhost:27017" // For local development
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	// Create client options with the URI
-	clientOptions := options.Client().ApplyURI(mongoURI)
+	return cfg, fs.Args(), nil
+}
 
-	// Create a MongoDB client
-	client, err := mongo.Connect(ctx, clientOptions)
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	// Test the connection with a timeout
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-	if err := client.Ping(ctx, nil); err != nil {
-		return nil, err
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
 	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	env := envReader{}
+	env.string("SERVER_ADDRESS", &c.Server.Address)
+	env.string("GATEWAY_ADDRESS", &c.Gateway.Address)
+	env.string("GATEWAY_SERVER_ADDRESS", &c.Gateway.ServerAddress)
+	env.duration("GATEWAY_REQUEST_TIMEOUT", &c.Gateway.RequestTimeout)
+	env.bool("GATEWAY_TRUST_PROXY_HEADERS", &c.Gateway.TrustProxyHeaders)
+	env.string("JWT_SECRET", &c.Auth.JWTSecret)
+	env.string("JWT_SIGNING_KEY", &c.Auth.SigningKey)
+	env.duration("TOKEN_TTL", &c.Auth.TokenTTL)
+	env.duration("REFRESH_TOKEN_TTL", &c.Auth.RefreshTokenTTL)
+	env.int("PASSWORD_BCRYPT_COST", &c.Auth.Passwords.BcryptCost)
+	env.int("PASSWORD_MIN_LENGTH", &c.Auth.Passwords.MinLength)
+	env.bool("PASSWORD_REQUIRE_UPPER", &c.Auth.Passwords.RequireUpper)
+	env.bool("PASSWORD_REQUIRE_LOWER", &c.Auth.Passwords.RequireLower)
+	env.bool("PASSWORD_REQUIRE_DIGIT", &c.Auth.Passwords.RequireDigit)
+	env.bool("PASSWORD_REQUIRE_SYMBOL", &c.Auth.Passwords.RequireSymbol)
+	c.Auth.Lockout.loadEnv(&env)
+	env.duration("LOAN_PERIOD", &c.Loans.Period)
+	env.int("LOAN_MAX_RENEWALS", &c.Loans.MaxRenewals)
+	c.Loans.loadCirculationEnv(&env)
+	env.duration("HOLD_PICKUP_PERIOD", &c.Loans.HoldPickup)
+	env.bool("SCHEDULER_ENABLED", &c.Scheduler.Enabled)
+	env.string("SCHEDULER_LATE_BOOKS_SPEC", &c.Scheduler.LateBooksSpec)
+	env.string("SCHEDULER_HOLD_EXPIRY_SPEC", &c.Scheduler.HoldExpirySpec)
+	env.string("SCHEDULER_FINE_ACCRUAL_SPEC", &c.Scheduler.FineAccrualSpec)
+	env.string("SCHEDULER_NOTIFICATIONS_SPEC", &c.Scheduler.NotificationsSpec)
+	env.duration("SCHEDULER_JOB_TIMEOUT", &c.Scheduler.JobTimeout)
+	env.duration("SCHEDULER_RUN_RETENTION", &c.Scheduler.RunRetention)
+	env.string("SCHEDULER_INSTANCE_ID", &c.Scheduler.InstanceID)
+	env.duration("SCHEDULER_LEASE_TTL", &c.Scheduler.LeaseTTL)
+	c.Notifications.loadEnv(&env)
+	c.Outbox.loadEnv(&env)
+	c.Webhooks.loadEnv(&env)
+	env.string("STORAGE_BACKEND", &c.Storage.Backend)
+	env.string("DATABASE_URL", &c.Storage.SQL.URL)
+	c.Storage.Mongo.loadEnv(&env)
+	return env.err
+}
 
-	// Return the collection
-	collection := client.Database("GC2").Collection("books")
-	return collection, nil
+// flagSet binds one flag per setting, defaulting to the value loaded so far.
+func (c *Config) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.String("config", "", "YAML configuration file")
+	fs.StringVar(&c.Server.Address, "server.address", c.Server.Address, "gRPC listen address")
+	fs.StringVar(&c.Gateway.Address, "gateway.address", c.Gateway.Address, "HTTP gateway listen address")
+	fs.StringVar(&c.Gateway.ServerAddress, "gateway.server-address", c.Gateway.ServerAddress, "gRPC server the gateway forwards to")
+	fs.DurationVar(&c.Gateway.RequestTimeout, "gateway.request-timeout", c.Gateway.RequestTimeout, "deadline of each call forwarded by the gateway")
+	fs.BoolVar(&c.Gateway.TrustProxyHeaders, "gateway.trust-proxy-headers", c.Gateway.TrustProxyHeaders, "take the client IP from X-Forwarded-For")
+	fs.StringVar(&c.Auth.JWTSecret, "auth.jwt-secret", c.Auth.JWTSecret, "secret used to sign access tokens when no keys are configured")
+	fs.StringVar(&c.Auth.SigningKey, "auth.signing-key", c.Auth.SigningKey, "id of the configured key that signs new access tokens")
+	fs.DurationVar(&c.Auth.TokenTTL, "auth.token-ttl", c.Auth.TokenTTL, "lifetime of access tokens")
+	fs.DurationVar(&c.Auth.RefreshTokenTTL, "auth.refresh-token-ttl", c.Auth.RefreshTokenTTL, "lifetime of refresh tokens")
+	fs.IntVar(&c.Auth.Passwords.BcryptCost, "auth.passwords.bcrypt-cost", c.Auth.Passwords.BcryptCost, "bcrypt cost of password hashes")
+	fs.IntVar(&c.Auth.Passwords.MinLength, "auth.passwords.min-length", c.Auth.Passwords.MinLength, "minimum password length")
+	fs.BoolVar(&c.Auth.Passwords.RequireUpper, "auth.passwords.require-upper", c.Auth.Passwords.RequireUpper, "require an upper case letter in passwords")
+	fs.BoolVar(&c.Auth.Passwords.RequireLower, "auth.passwords.require-lower", c.Auth.Passwords.RequireLower, "require a lower case letter in passwords")
+	fs.BoolVar(&c.Auth.Passwords.RequireDigit, "auth.passwords.require-digit", c.Auth.Passwords.RequireDigit, "require a digit in passwords")
+	fs.BoolVar(&c.Auth.Passwords.RequireSymbol, "auth.passwords.require-symbol", c.Auth.Passwords.RequireSymbol, "require a symbol in passwords")
+	c.Auth.Lockout.bindFlags(fs)
+	fs.DurationVar(&c.Loans.Period, "loans.period", c.Loans.Period, "how long a book can be borrowed")
+	fs.IntVar(&c.Loans.MaxRenewals, "loans.max-renewals", c.Loans.MaxRenewals, "how often a loan can be renewed")
+	c.Loans.bindCirculationFlags(fs)
+	fs.DurationVar(&c.Loans.HoldPickup, "loans.hold-pickup", c.Loans.HoldPickup, "how long a returned copy is kept for the next patron in the queue")
+	fs.BoolVar(&c.Scheduler.Enabled, "scheduler.enabled", c.Scheduler.Enabled, "run the scheduled jobs in this process")
+	fs.StringVar(&c.Scheduler.LateBooksSpec, "scheduler.late-books-spec", c.Scheduler.LateBooksSpec, "cron spec of the late books check")
+	fs.StringVar(&c.Scheduler.HoldExpirySpec, "scheduler.hold-expiry-spec", c.Scheduler.HoldExpirySpec, "cron spec of the hold expiry job")
+	fs.StringVar(&c.Scheduler.FineAccrualSpec, "scheduler.fine-accrual-spec", c.Scheduler.FineAccrualSpec, "cron spec of the overdue fine job")
+	fs.StringVar(&c.Scheduler.NotificationsSpec, "scheduler.notifications-spec", c.Scheduler.NotificationsSpec, "cron spec of the job sending notifications")
+	fs.DurationVar(&c.Scheduler.JobTimeout, "scheduler.job-timeout", c.Scheduler.JobTimeout, "how long a job run can take before it is cancelled")
+	fs.DurationVar(&c.Scheduler.RunRetention, "scheduler.run-retention", c.Scheduler.RunRetention, "how long the history of finished job runs is kept")
+	fs.StringVar(&c.Scheduler.InstanceID, "scheduler.instance-id", c.Scheduler.InstanceID, "name of this replica in job leases, defaults to the host name and pid")
+	fs.DurationVar(&c.Scheduler.LeaseTTL, "scheduler.lease-ttl", c.Scheduler.LeaseTTL, "how long a replica holds a job lease without renewing it")
+	c.Notifications.bindFlags(fs)
+	c.Outbox.bindFlags(fs)
+	c.Webhooks.bindFlags(fs)
+	fs.StringVar(&c.Storage.Backend, "storage.backend", c.Storage.Backend, "storage backend: mongo, postgres or sqlite")
+	fs.StringVar(&c.Storage.SQL.URL, "storage.sql.url", c.Storage.SQL.URL, "PostgreSQL or SQLite connection string")
+	c.Storage.Mongo.bindFlags(fs)
+	return fs
 }
 
-func ConnectionDatabaseBorrowedBooks(ctx context.Context) (*mongo.Collection, error) {
-	// Define the MongoDB connection string
-	var mongoURI string
+// configFileFromArgs finds the -config flag before the flags are parsed,
+// since the file must be loaded first. Parse errors are reported by Load.
+func configFileFromArgs(args []string) string {
+	fs := Default().flagSet()
+	fs.SetOutput(io.Discard)
+	_ = fs.Parse(args)
+	return fs.Lookup("config").Value.String()
+}
 
-	if os.Getenv("RUNNING_IN_DOCKER") == "true" {
-		mongoURI = "mongodb://host.docker.internal:27017"
-	} else {
-		mongoURI = "mongodb://localhost:27017" // For local development
+// Validate reports every invalid setting.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
 	}
 
-	// Create client options with the URI
-	clientOptions := options.Client().ApplyURI(mongoURI)
+	check(c.Server.Address != "", "server.address must not be empty")
+	check(c.Gateway.Address != "", "gateway.address must not be empty")
+	check(c.Gateway.ServerAddress != "", "gateway.server_address must not be empty")
+	check(c.Gateway.RequestTimeout > 0, "gateway.request_timeout must be positive, got %s", c.Gateway.RequestTimeout)
+	if len(c.Auth.Keys) == 0 {
+		check(c.Auth.JWTSecret != "", "auth.jwt_secret must not be empty")
+	} else if err := c.Auth.validateKeys(); err != nil {
+		errs = append(errs, err)
+	}
+	check(c.Auth.TokenTTL > 0, "auth.token_ttl must be positive, got %s", c.Auth.TokenTTL)
+	check(c.Auth.RefreshTokenTTL > c.Auth.TokenTTL, "auth.refresh_token_ttl must be longer than auth.token_ttl, got %s", c.Auth.RefreshTokenTTL)
+	check(c.Auth.Passwords.BcryptCost >= bcrypt.MinCost && c.Auth.Passwords.BcryptCost <= bcrypt.MaxCost,
+		"auth.passwords.bcrypt_cost must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, c.Auth.Passwords.BcryptCost)
+	check(c.Auth.Passwords.MinLength > 0 && c.Auth.Passwords.MinLength <= MaxPasswordLength,
+		"auth.passwords.min_length must be between 1 and %d, got %d", MaxPasswordLength, c.Auth.Passwords.MinLength)
+	if err := c.Auth.Lockout.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	check(c.Loans.Period >= time.Hour, "loans.period must be at least 1h, got %s", c.Loans.Period)
+	check(c.Loans.MaxRenewals >= 0, "loans.max_renewals must not be negative, got %d", c.Loans.MaxRenewals)
+	check(c.Loans.MaxLoans >= 0, "loans.max_loans must not be negative, got %d", c.Loans.MaxLoans)
+	if err := c.Loans.Fines.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Loans.validateRules(); err != nil {
+		errs = append(errs, err)
+	}
+	check(c.Loans.HoldPickup >= time.Hour, "loans.hold_pickup must be at least 1h, got %s", c.Loans.HoldPickup)
 
-	// Create a MongoDB client
-	client, err := mongo.Connect(ctx, clientOptions)
-	if err != nil {
-		return nil, err
+	if err := c.Scheduler.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Notifications.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Outbox.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Webhooks.validate(); err != nil {
+		errs = append(errs, err)
 	}
 
-	// Test the connection with a timeout
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-	if err := client.Ping(ctx, nil); err != nil {
-		return nil, err
+	switch c.Storage.Backend {
+	case "mongo":
+		if err := c.Storage.Mongo.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	case store.DriverPostgres, store.DriverSQLite:
+	default:
+		errs = append(errs, fmt.Errorf("storage.backend must be mongo, postgres or sqlite, got %q", c.Storage.Backend))
 	}
 
-	// Return the collection
-	collection := client.Database("GC2").Collection("borrowed_books")
-	return collection, nil
+	return errors.Join(errs...)
 }
@@ -0,0 +1,368 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, rest, err := Load(nil)
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+
+	assert.Equal(t, ":50051", cfg.Server.Address)
+	assert.Equal(t, ":8080", cfg.Gateway.Address)
+	assert.Equal(t, "localhost:50051", cfg.Gateway.ServerAddress)
+	assert.Equal(t, DefaultJWTSecret, cfg.Auth.JWTSecret)
+	assert.Equal(t, 15*time.Minute, cfg.Auth.TokenTTL)
+	assert.Equal(t, 30*24*time.Hour, cfg.Auth.RefreshTokenTTL)
+	assert.Equal(t, 7*24*time.Hour, cfg.Loans.Period)
+	assert.Equal(t, 2, cfg.Loans.MaxRenewals)
+	assert.Equal(t, 10, cfg.Loans.MaxLoans)
+	assert.True(t, cfg.Loans.BlockOnOverdue)
+	assert.True(t, cfg.Loans.BlockOnFines)
+	assert.Equal(t, FineConfig{Currency: "EUR", DailyFine: 25, GraceDays: 1, MaxFine: 1000, LostFee: 2500, DamageFee: 1000}, cfg.Loans.Fines)
+	assert.Equal(t, "30 0 * * *", cfg.Scheduler.FineAccrualSpec)
+	assert.True(t, cfg.Scheduler.Enabled)
+	assert.Equal(t, 10*time.Minute, cfg.Scheduler.JobTimeout)
+	assert.Equal(t, 30*24*time.Hour, cfg.Scheduler.RunRetention)
+	assert.Equal(t, time.Minute, cfg.Scheduler.LeaseTTL)
+	assert.Empty(t, cfg.Scheduler.InstanceID)
+	assert.Equal(t, []JobSpec{
+		{JobLateBooks, "0 0 * * *"},
+		{JobHoldExpiry, "*/15 * * * *"},
+		{JobFineAccrual, "30 0 * * *"},
+		{JobNotifications, "*/15 * * * *"},
+	}, cfg.Scheduler.Jobs())
+	assert.Equal(t, []string{entity.ChannelLog}, cfg.Notifications.Channels)
+	assert.Equal(t, []string{entity.ChannelLog}, cfg.Notifications.Available())
+	assert.Equal(t, 48*time.Hour, cfg.Notifications.DueSoon)
+	assert.Equal(t, 10*time.Second, cfg.Notifications.Webhook.Timeout)
+	assert.Equal(t, SinkBus, cfg.Outbox.Sink)
+	assert.Equal(t, time.Second, cfg.Outbox.Interval)
+	assert.Equal(t, 100, cfg.Outbox.BatchSize)
+	assert.Equal(t, 7*24*time.Hour, cfg.Outbox.Retention)
+	assert.Equal(t, "library.events", cfg.Outbox.NATS.SubjectPrefix)
+	assert.Equal(t, 5*time.Second, cfg.Webhooks.Interval)
+	assert.Equal(t, 8, cfg.Webhooks.MaxAttempts)
+	assert.Equal(t, 30*time.Second, cfg.Webhooks.InitialBackoff)
+	assert.Equal(t, time.Hour, cfg.Webhooks.MaxBackoff)
+	assert.Equal(t, 72*time.Hour, cfg.Loans.HoldPickup)
+	assert.Equal(t, "mongo", cfg.Storage.Backend)
+	assert.Equal(t, "GC2", cfg.Storage.Mongo.Database)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+server:
+  address: ":6000"
+auth:
+  jwt_secret: from-file
+  token_ttl: 1h
+loans:
+  period: 336h
+storage:
+  mongo:
+    database: library
+`)
+
+	// The environment overrides the file, and the flags override both
+	t.Setenv("JWT_SECRET", "from-env")
+	t.Setenv("TOKEN_TTL", "2h")
+	t.Setenv("MONGO_DATABASE", "library_env")
+
+	cfg, rest, err := Load([]string{"-config", path, "-auth.token-ttl", "3h", "migrate", "up"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"migrate", "up"}, rest)
+	assert.Equal(t, ":6000", cfg.Server.Address)
+	assert.Equal(t, 336*time.Hour, cfg.Loans.Period)
+	assert.Equal(t, "from-env", cfg.Auth.JWTSecret)
+	assert.Equal(t, 3*time.Hour, cfg.Auth.TokenTTL)
+	assert.Equal(t, "library_env", cfg.Storage.Mongo.Database)
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, "gateway:\n  address: \":9090\"\n"))
+
+	cfg, _, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, ":9090", cfg.Gateway.Address)
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Run("unknown field", func(t *testing.T) {
+		_, _, err := Load([]string{"-config", writeConfigFile(t, "server:\n  adress: \":1\"\n")})
+		assert.ErrorContains(t, err, "adress")
+	})
+
+	t.Run("bad env value", func(t *testing.T) {
+		t.Setenv("LOAN_PERIOD", "a week")
+		_, _, err := Load(nil)
+		assert.ErrorContains(t, err, "LOAN_PERIOD")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, _, err := Load([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")})
+		assert.Error(t, err)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	require.NoError(t, cfg.Validate())
+
+	cfg.Auth.JWTSecret = ""
+	cfg.Loans.Period = time.Minute
+	cfg.Loans.MaxRenewals = -1
+	cfg.Loans.MaxLoans = -1
+	cfg.Loans.Rules = []CirculationRule{{Name: "everyone"}, {ItemType: "dvd"}}
+	cfg.Loans.HoldPickup = 0
+	cfg.Scheduler.LateBooksSpec = "every day"
+	cfg.Scheduler.HoldExpirySpec = "often"
+	cfg.Scheduler.FineAccrualSpec = "daily"
+	cfg.Scheduler.JobTimeout = 0
+	cfg.Scheduler.RunRetention = time.Minute
+	cfg.Scheduler.LeaseTTL = time.Second
+	cfg.Loans.Fines.Currency = "euro"
+	cfg.Loans.Fines.MaxFine = -1
+	cfg.Storage.Backend = "oracle"
+	cfg.Auth.Lockout.MaxLockout = time.Second
+	cfg.Auth.Lockout.TrustedProxies = []string{"10.0.0.1"}
+	cfg.Scheduler.NotificationsSpec = "hourly"
+	cfg.Notifications.Channels = []string{entity.ChannelEmail, "sms"}
+	cfg.Notifications.DueSoon = time.Hour
+	cfg.Notifications.Webhook.URL = "ftp://example.com"
+	cfg.Outbox.Sink = "kafka"
+	cfg.Outbox.Interval = time.Millisecond
+	cfg.Outbox.BatchSize = 0
+	cfg.Outbox.Retention = time.Minute
+	cfg.Webhooks.MaxAttempts = 0
+	cfg.Webhooks.MaxBackoff = time.Second
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "auth.jwt_secret")
+	assert.ErrorContains(t, err, "loans.period")
+	assert.ErrorContains(t, err, "loans.max_renewals")
+	assert.ErrorContains(t, err, "loans.max_loans")
+	assert.ErrorContains(t, err, "loans.rules everyone")
+	assert.ErrorContains(t, err, "every rule needs a name")
+	assert.ErrorContains(t, err, "loans.hold_pickup")
+	assert.ErrorContains(t, err, "scheduler.late_books_spec")
+	assert.ErrorContains(t, err, "scheduler.hold_expiry_spec")
+	assert.ErrorContains(t, err, "scheduler.fine_accrual_spec")
+	assert.ErrorContains(t, err, "scheduler.notifications_spec")
+	assert.ErrorContains(t, err, "notifications.channels: email is not configured")
+	assert.ErrorContains(t, err, `notifications.channels must be email, webhook or log, got "sms"`)
+	assert.ErrorContains(t, err, "notifications.due_soon")
+	assert.ErrorContains(t, err, "notifications.webhook.url")
+	assert.ErrorContains(t, err, `outbox.sink must be bus, webhook or nats, got "kafka"`)
+	assert.ErrorContains(t, err, "outbox.interval")
+	assert.ErrorContains(t, err, "outbox.batch_size")
+	assert.ErrorContains(t, err, "outbox.retention")
+	assert.ErrorContains(t, err, "webhooks.max_attempts")
+	assert.ErrorContains(t, err, "webhooks.max_backoff")
+	assert.ErrorContains(t, err, "scheduler.job_timeout")
+	assert.ErrorContains(t, err, "scheduler.run_retention")
+	assert.ErrorContains(t, err, "scheduler.lease_ttl")
+	assert.ErrorContains(t, err, "loans.fines.currency")
+	assert.ErrorContains(t, err, "loans.fines.max_fine")
+	assert.ErrorContains(t, err, "storage.backend")
+	assert.ErrorContains(t, err, "auth.lockout.max_lockout")
+	assert.ErrorContains(t, err, "auth.lockout.trusted_proxies")
+}
+
+func TestDisableJob(t *testing.T) {
+	t.Setenv("SCHEDULER_LATE_BOOKS_SPEC", "")
+	t.Setenv("SCHEDULER_ENABLED", "false")
+
+	cfg, _, err := Load([]string{"-scheduler.hold-expiry-spec", "@hourly"})
+	require.NoError(t, err)
+	assert.False(t, cfg.Scheduler.Enabled)
+	assert.Equal(t, []JobSpec{
+		{JobLateBooks, ""},
+		{JobHoldExpiry, "@hourly"},
+		{JobFineAccrual, "30 0 * * *"},
+		{JobNotifications, "*/15 * * * *"},
+	}, cfg.Scheduler.Jobs())
+}
+
+func TestLoadLockout(t *testing.T) {
+	t.Setenv("LOCKOUT_TRUSTED_PROXIES", "10.0.0.0/8, 192.168.0.0/16")
+	t.Setenv("LOCKOUT_MAX_FAILURES", "3")
+
+	cfg, _, err := Load([]string{"-auth.lockout.max", "2h"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, cfg.Auth.Lockout.MaxFailures)
+	assert.Equal(t, 2*time.Hour, cfg.Auth.Lockout.MaxLockout)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.0.0/16"}, cfg.Auth.Lockout.TrustedProxies)
+	assert.Len(t, cfg.Auth.Lockout.TrustedProxyPrefixes(), 2)
+
+	cfg, _, err = Load([]string{"-auth.lockout.trusted-proxies", ""})
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Auth.Lockout.TrustedProxies)
+}
+
+func TestCirculationRules(t *testing.T) {
+	path := writeConfigFile(t, `
+loans:
+  max_loans: 5
+  rules:
+    - name: students
+      user_category: student
+      max_loans: 3
+    - name: reference
+      item_type: reference
+      max_loans: 0
+    - name: student-dvds
+      user_category: student
+      item_type: dvd
+      period: 48h
+      max_renewals: 0
+      block_on_fines: false
+      daily_fine: 100
+      max_fine: 0
+`)
+	t.Setenv("LOAN_BLOCK_ON_OVERDUE", "false")
+	t.Setenv("FINE_GRACE_DAYS", "1")
+
+	cfg, _, err := Load([]string{"-config", path, "-loans.max-loans", "6"})
+	require.NoError(t, err)
+
+	defaults := cfg.Loans.Policy("", "book")
+	assert.Equal(t, Policy{Rule: DefaultRule, Period: 7 * 24 * time.Hour, MaxLoans: 6, MaxRenewals: 2, BlockOnFines: true,
+		DailyFine: 25, FineGraceDays: 1, MaxFine: 1000}, defaults)
+
+	students := cfg.Loans.Policy("student", "book")
+	assert.Equal(t, "students", students.Rule)
+	assert.Equal(t, 3, students.MaxLoans)
+	assert.Equal(t, 2, students.MaxRenewals)
+	assert.Empty(t, students.ItemType)
+
+	// The category wins over the item type, both win over either
+	assert.Equal(t, "students", cfg.Loans.Policy("student", "reference").Rule)
+	assert.Equal(t, "reference", cfg.Loans.Policy("staff", "reference").Rule)
+	assert.Equal(t, 0, cfg.Loans.Policy("staff", "reference").MaxLoans)
+
+	dvds := cfg.Loans.Policy("student", "dvd")
+	assert.Equal(t, Policy{Rule: "student-dvds", ItemType: "dvd", Period: 48 * time.Hour, MaxLoans: 6, MaxRenewals: 0,
+		DailyFine: 100, FineGraceDays: 1, MaxFine: 0}, dvds)
+
+	cfg.Loans.Rules = append(cfg.Loans.Rules, CirculationRule{Name: "more-students", UserCategory: "student"})
+	assert.ErrorContains(t, cfg.Validate(), "matches the same loans as students")
+}
+
+func TestConfigFileFromArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"-config", "a.yaml"}, "a.yaml"},
+		{[]string{"--config=b.yaml"}, "b.yaml"},
+		{[]string{"-server.address", ":1", "-config", "c.yaml"}, "c.yaml"},
+		{[]string{"migrate", "-config", "d.yaml"}, ""},
+		{[]string{"--", "-config", "e.yaml"}, ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, configFileFromArgs(tt.args), "args %q", tt.args)
+	}
+}
+
+func TestValidateKeys(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.JWTSecret = ""
+	cfg.Auth.SigningKey = "rsa-2"
+	cfg.Auth.Keys = []KeyConfig{
+		{ID: "ed-1", Algorithm: KeyAlgorithmEdDSA, PublicKeyFile: "ed-1.pub"},
+		{ID: "rsa-2", Algorithm: KeyAlgorithmRS256, PrivateKeyFile: "rsa-2.pem"},
+	}
+	require.NoError(t, cfg.Validate())
+
+	cfg.Auth.SigningKey = "ed-1"
+	assert.ErrorContains(t, cfg.Validate(), "has no private key")
+
+	cfg.Auth.SigningKey = "rsa-2"
+	cfg.Auth.Keys = append(cfg.Auth.Keys,
+		KeyConfig{ID: "ed-1", Algorithm: KeyAlgorithmEdDSA, PublicKeyFile: "other.pub"},
+		KeyConfig{ID: "hs-3", Algorithm: KeyAlgorithmHS256},
+		KeyConfig{ID: "es-4", Algorithm: "ES256", PrivateKeyFile: "es-4.pem"},
+	)
+	err := cfg.Validate()
+	assert.ErrorContains(t, err, `duplicate key id "ed-1"`)
+	assert.ErrorContains(t, err, "hs-3: HS256 keys need exactly one of secret and secret_file")
+	assert.ErrorContains(t, err, `es-4: algorithm must be HS256, RS256 or EdDSA, got "ES256"`)
+}
+
+func TestNotificationChannels(t *testing.T) {
+	t.Setenv("SMTP_ADDRESS", "localhost:2525")
+	t.Setenv("SMTP_FROM", "Library <library@example.com>")
+	t.Setenv("NOTIFY_WEBHOOK_URL", "https://hooks.example.com/library")
+	t.Setenv("NOTIFY_CHANNELS", "email,webhook")
+
+	cfg, _, err := Load([]string{"-notifications.due-soon", "72h"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{entity.ChannelEmail, entity.ChannelWebhook}, cfg.Notifications.Channels)
+	assert.Equal(t, []string{entity.ChannelLog, entity.ChannelEmail, entity.ChannelWebhook}, cfg.Notifications.Available())
+	assert.Equal(t, 72*time.Hour, cfg.Notifications.DueSoon)
+
+	cfg.Notifications.SMTP.Address = "localhost"
+	cfg.Notifications.SMTP.From = "library"
+	err = cfg.Validate()
+	assert.ErrorContains(t, err, "notifications.smtp.address")
+	assert.ErrorContains(t, err, "notifications.smtp.from")
+}
+
+func TestOutboxSink(t *testing.T) {
+	t.Setenv("OUTBOX_SINK", "nats")
+	t.Setenv("OUTBOX_NATS_ADDRESS", "localhost:4222")
+
+	cfg, _, err := Load([]string{"-outbox.nats.subject-prefix", "branch.events"})
+	require.NoError(t, err)
+	assert.Equal(t, SinkNATS, cfg.Outbox.Sink)
+	assert.Equal(t, "localhost:4222", cfg.Outbox.NATS.Address)
+	assert.Equal(t, "branch.events", cfg.Outbox.NATS.SubjectPrefix)
+
+	cfg.Outbox.NATS.Address = "localhost"
+	assert.ErrorContains(t, cfg.Validate(), "outbox.nats.address")
+
+	cfg.Outbox.Sink = SinkWebhook
+	assert.ErrorContains(t, cfg.Validate(), "outbox.webhook.url")
+	cfg.Outbox.Webhook.URL = "https://events.example.com/library"
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestWebhooksBackoff(t *testing.T) {
+	t.Setenv("WEBHOOKS_MAX_ATTEMPTS", "3")
+	t.Setenv("WEBHOOKS_INITIAL_BACKOFF", "1m")
+
+	cfg, _, err := Load([]string{"-webhooks.max-backoff", "10m"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, cfg.Webhooks.MaxAttempts)
+	assert.Equal(t, time.Minute, cfg.Webhooks.InitialBackoff)
+	assert.Equal(t, 10*time.Minute, cfg.Webhooks.MaxBackoff)
+
+	cfg.Webhooks.InitialBackoff = time.Hour
+	assert.ErrorContains(t, cfg.Validate(), "webhooks.max_backoff must be at least webhooks.initial_backoff")
+
+	// A post must not outlast the dispatcher's lease
+	cfg.Webhooks.InitialBackoff = time.Minute
+	cfg.Webhooks.Timeout = time.Minute
+	assert.ErrorContains(t, cfg.Validate(), "webhooks.timeout must be at most 15s")
+	cfg.Webhooks.Timeout = 15 * time.Second
+	assert.NoError(t, cfg.Validate())
+}
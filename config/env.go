@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envReader applies environment variables over config values, keeping the first parse error.
+type envReader struct {
+	err error
+}
+
+func (r *envReader) string(name string, target *string) {
+	if value, ok := os.LookupEnv(name); ok {
+		*target = value
+	}
+}
+
+func (r *envReader) int(name string, target *int) {
+	value, ok := os.LookupEnv(name)
+	if !ok || r.err != nil {
+		return
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		r.err = fmt.Errorf("invalid %s %q: %w", name, value, err)
+		return
+	}
+	*target = parsed
+}
+
+func (r *envReader) uint(name string, target *uint64) {
+	value, ok := os.LookupEnv(name)
+	if !ok || r.err != nil {
+		return
+	}
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		r.err = fmt.Errorf("invalid %s %q: %w", name, value, err)
+		return
+	}
+	*target = parsed
+}
+
+func (r *envReader) bool(name string, target *bool) {
+	value, ok := os.LookupEnv(name)
+	if !ok || r.err != nil {
+		return
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		r.err = fmt.Errorf("invalid %s %q: %w", name, value, err)
+		return
+	}
+	*target = parsed
+}
+
+func (r *envReader) duration(name string, target *time.Duration) {
+	value, ok := os.LookupEnv(name)
+	if !ok || r.err != nil {
+		return
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		r.err = fmt.Errorf("invalid %s %q: %w", name, value, err)
+		return
+	}
+	*target = parsed
+}
+
+// strings reads a comma separated list, an empty value clears it.
+func (r *envReader) strings(name string, target *[]string) {
+	if value, ok := os.LookupEnv(name); ok {
+		*target = splitList(value)
+	}
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// listFlag binds a comma separated list to a flag.
+type listFlag struct {
+	target *[]string
+}
+
+func (f listFlag) String() string {
+	if f.target == nil {
+		return ""
+	}
+	return strings.Join(*f.target, ",")
+}
+
+func (f listFlag) Set(value string) error {
+	*f.target = splitList(value)
+	return nil
+}
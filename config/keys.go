@@ -0,0 +1,77 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Algorithms of the token signing keys
+const (
+	KeyAlgorithmHS256 = "HS256"
+	KeyAlgorithmRS256 = "RS256"
+	KeyAlgorithmEdDSA = "EdDSA"
+)
+
+// KeyConfig is one token signing key. HS256 keys take a secret, RS256 and EdDSA
+// keys take PEM files. A key with only a public key verifies tokens but cannot
+// sign them, which is how a retired key stays valid until its tokens expire.
+type KeyConfig struct {
+	ID             string `yaml:"id"` // sent as the kid header of the tokens
+	Algorithm      string `yaml:"algorithm"`
+	Secret         string `yaml:"secret"`
+	SecretFile     string `yaml:"secret_file"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKeyFile  string `yaml:"public_key_file"`
+}
+
+// CanSign reports whether the key holds the material needed to sign tokens.
+func (k KeyConfig) CanSign() bool {
+	if k.Algorithm == KeyAlgorithmHS256 {
+		return true
+	}
+	return k.PrivateKeyFile != ""
+}
+
+func (k KeyConfig) validate() error {
+	if k.ID == "" {
+		return errors.New("auth.keys: every key needs an id")
+	}
+
+	switch k.Algorithm {
+	case KeyAlgorithmHS256:
+		if (k.Secret == "") == (k.SecretFile == "") {
+			return fmt.Errorf("auth.keys %s: HS256 keys need exactly one of secret and secret_file", k.ID)
+		}
+	case KeyAlgorithmRS256, KeyAlgorithmEdDSA:
+		if k.PrivateKeyFile == "" && k.PublicKeyFile == "" {
+			return fmt.Errorf("auth.keys %s: %s keys need a private_key_file or a public_key_file", k.ID, k.Algorithm)
+		}
+	default:
+		return fmt.Errorf("auth.keys %s: algorithm must be HS256, RS256 or EdDSA, got %q", k.ID, k.Algorithm)
+	}
+	return nil
+}
+
+// validateKeys checks the keys and that the signing key is one of them.
+func (c AuthConfig) validateKeys() error {
+	var errs []error
+	ids := map[string]KeyConfig{}
+	for _, key := range c.Keys {
+		if err := key.validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, ok := ids[key.ID]; ok {
+			errs = append(errs, fmt.Errorf("auth.keys: duplicate key id %q", key.ID))
+		}
+		ids[key.ID] = key
+	}
+
+	if key, ok := ids[c.SigningKey]; !ok {
+		errs = append(errs, fmt.Errorf("auth.signing_key %q must be the id of one of auth.keys", c.SigningKey))
+	} else if !key.CanSign() {
+		errs = append(errs, fmt.Errorf("auth.signing_key %q has no private key", c.SigningKey))
+	}
+
+	return errors.Join(errs...)
+}
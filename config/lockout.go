@@ -0,0 +1,86 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// LockoutConfig throttles failed logins. Failures are counted per username and
+// per client IP within FailureWindow. Once a counter reaches its maximum the
+// username or IP is locked for BaseLockout, doubling with every further failure
+// up to MaxLockout.
+type LockoutConfig struct {
+	MaxFailures   int           `yaml:"max_failures"`    // failures of one username before it is locked
+	IPMaxFailures int           `yaml:"ip_max_failures"` // failures from one IP before it is locked
+	FailureWindow time.Duration `yaml:"failure_window"`  // failures older than this are forgotten
+	BaseLockout   time.Duration `yaml:"base_lockout"`
+	MaxLockout    time.Duration `yaml:"max_lockout"`
+	// TrustedProxies are the CIDRs, such as the gateway's, whose x-forwarded-for
+	// metadata is trusted to name the client IP
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+func defaultLockoutConfig() LockoutConfig {
+	return LockoutConfig{
+		MaxFailures:    5,
+		IPMaxFailures:  20,
+		FailureWindow:  15 * time.Minute,
+		BaseLockout:    time.Minute,
+		MaxLockout:     time.Hour,
+		TrustedProxies: []string{"127.0.0.1/32", "::1/128"},
+	}
+}
+
+func (c *LockoutConfig) loadEnv(env *envReader) {
+	env.int("LOCKOUT_MAX_FAILURES", &c.MaxFailures)
+	env.int("LOCKOUT_IP_MAX_FAILURES", &c.IPMaxFailures)
+	env.duration("LOCKOUT_FAILURE_WINDOW", &c.FailureWindow)
+	env.duration("LOCKOUT_BASE", &c.BaseLockout)
+	env.duration("LOCKOUT_MAX", &c.MaxLockout)
+	env.strings("LOCKOUT_TRUSTED_PROXIES", &c.TrustedProxies)
+}
+
+func (c *LockoutConfig) bindFlags(fs *flag.FlagSet) {
+	fs.IntVar(&c.MaxFailures, "auth.lockout.max-failures", c.MaxFailures, "failed logins of a username before it is locked")
+	fs.IntVar(&c.IPMaxFailures, "auth.lockout.ip-max-failures", c.IPMaxFailures, "failed logins from an IP before it is locked")
+	fs.DurationVar(&c.FailureWindow, "auth.lockout.failure-window", c.FailureWindow, "how long failed logins are counted")
+	fs.DurationVar(&c.BaseLockout, "auth.lockout.base", c.BaseLockout, "first lockout, doubled by every further failure")
+	fs.DurationVar(&c.MaxLockout, "auth.lockout.max", c.MaxLockout, "longest lockout")
+	fs.Var(listFlag{&c.TrustedProxies}, "auth.lockout.trusted-proxies", "comma separated CIDRs allowed to forward the client IP")
+}
+
+func (c *LockoutConfig) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.MaxFailures > 0, "auth.lockout.max_failures must be positive, got %d", c.MaxFailures)
+	check(c.IPMaxFailures > 0, "auth.lockout.ip_max_failures must be positive, got %d", c.IPMaxFailures)
+	check(c.FailureWindow > 0, "auth.lockout.failure_window must be positive, got %s", c.FailureWindow)
+	check(c.BaseLockout > 0, "auth.lockout.base_lockout must be positive, got %s", c.BaseLockout)
+	check(c.MaxLockout >= c.BaseLockout, "auth.lockout.max_lockout must be at least auth.lockout.base_lockout, got %s", c.MaxLockout)
+	for _, proxy := range c.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err != nil {
+			errs = append(errs, fmt.Errorf("auth.lockout.trusted_proxies: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// TrustedProxyPrefixes returns the parsed TrustedProxies, which Validate has checked.
+func (c LockoutConfig) TrustedProxyPrefixes() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, proxy := range c.TrustedProxies {
+		if prefix, err := netip.ParsePrefix(proxy); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoConfig configures the MongoDB client shared by the whole server.
+type MongoConfig struct {
+	URI                    string        `yaml:"uri"`
+	Database               string        `yaml:"database"`
+	MaxPoolSize            uint64        `yaml:"max_pool_size"`
+	MinPoolSize            uint64        `yaml:"min_pool_size"`
+	ConnectTimeout         time.Duration `yaml:"connect_timeout"`
+	ServerSelectionTimeout time.Duration `yaml:"server_selection_timeout"`
+	TLS                    TLSConfig     `yaml:"tls"`
+}
+
+type TLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+func defaultMongoConfig() MongoConfig {
+	uri := "mongodb://localhost:27017" // For local development
+	if os.Getenv("RUNNING_IN_DOCKER") == "true" {
+		uri = "mongodb://host.docker.internal:27017"
+	}
+
+	return MongoConfig{
+		URI:                    uri,
+		Database:               "GC2",
+		MaxPoolSize:            100,
+		ConnectTimeout:         10 * time.Second,
+		ServerSelectionTimeout: 10 * time.Second,
+	}
+}
+
+func (c *MongoConfig) loadEnv(env *envReader) {
+	env.string("MONGO_URI", &c.URI)
+	env.string("MONGO_DATABASE", &c.Database)
+	env.uint("MONGO_MAX_POOL_SIZE", &c.MaxPoolSize)
+	env.uint("MONGO_MIN_POOL_SIZE", &c.MinPoolSize)
+	env.duration("MONGO_CONNECT_TIMEOUT", &c.ConnectTimeout)
+	env.duration("MONGO_SERVER_SELECTION_TIMEOUT", &c.ServerSelectionTimeout)
+	env.bool("MONGO_TLS", &c.TLS.Enabled)
+	env.string("MONGO_TLS_CA_FILE", &c.TLS.CAFile)
+	env.string("MONGO_TLS_CERT_FILE", &c.TLS.CertFile)
+	env.string("MONGO_TLS_KEY_FILE", &c.TLS.KeyFile)
+	env.bool("MONGO_TLS_INSECURE_SKIP_VERIFY", &c.TLS.InsecureSkipVerify)
+}
+
+func (c *MongoConfig) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.URI, "storage.mongo.uri", c.URI, "MongoDB connection string")
+	fs.StringVar(&c.Database, "storage.mongo.database", c.Database, "MongoDB database name")
+	fs.Uint64Var(&c.MaxPoolSize, "storage.mongo.max-pool-size", c.MaxPoolSize, "maximum number of MongoDB connections")
+	fs.Uint64Var(&c.MinPoolSize, "storage.mongo.min-pool-size", c.MinPoolSize, "minimum number of MongoDB connections")
+	fs.DurationVar(&c.ConnectTimeout, "storage.mongo.connect-timeout", c.ConnectTimeout, "MongoDB connect timeout")
+	fs.DurationVar(&c.ServerSelectionTimeout, "storage.mongo.server-selection-timeout", c.ServerSelectionTimeout, "MongoDB server selection timeout")
+	fs.BoolVar(&c.TLS.Enabled, "storage.mongo.tls", c.TLS.Enabled, "connect to MongoDB over TLS")
+	fs.StringVar(&c.TLS.CAFile, "storage.mongo.tls-ca-file", c.TLS.CAFile, "CA certificates to verify MongoDB with")
+	fs.StringVar(&c.TLS.CertFile, "storage.mongo.tls-cert-file", c.TLS.CertFile, "client certificate for MongoDB")
+	fs.StringVar(&c.TLS.KeyFile, "storage.mongo.tls-key-file", c.TLS.KeyFile, "client certificate key for MongoDB")
+	fs.BoolVar(&c.TLS.InsecureSkipVerify, "storage.mongo.tls-insecure-skip-verify", c.TLS.InsecureSkipVerify, "skip MongoDB certificate verification")
+}
+
+func (c *MongoConfig) validate() error {
+	if c.URI == "" {
+		return fmt.Errorf("storage.mongo.uri must not be empty")
+	}
+	if c.Database == "" {
+		return fmt.Errorf("storage.mongo.database must not be empty")
+	}
+	if c.MaxPoolSize != 0 && c.MinPoolSize > c.MaxPoolSize {
+		return fmt.Errorf("storage.mongo.min_pool_size %d is larger than max_pool_size %d", c.MinPoolSize, c.MaxPoolSize)
+	}
+	if c.ConnectTimeout <= 0 {
+		return fmt.Errorf("storage.mongo.connect_timeout must be positive, got %s", c.ConnectTimeout)
+	}
+	if c.TLS.CertFile != "" && c.TLS.KeyFile == "" || c.TLS.CertFile == "" && c.TLS.KeyFile != "" {
+		return fmt.Errorf("storage.mongo.tls cert_file and key_file must be set together")
+	}
+	return nil
+}
+
+// ConnectMongo creates the MongoDB client and checks the connection.
+// The caller owns the client and must Disconnect it on shutdown.
+func ConnectMongo(ctx context.Context, cfg MongoConfig) (*mongo.Client, error) {
+	// Create client options with the URI
+	clientOptions := options.Client().
+		ApplyURI(cfg.URI).
+		SetMaxPoolSize(cfg.MaxPoolSize).
+		SetMinPoolSize(cfg.MinPoolSize).
+		SetConnectTimeout(cfg.ConnectTimeout).
+		SetServerSelectionTimeout(cfg.ServerSelectionTimeout)
+
+	if cfg.TLS.Enabled {
+		tlsConfig, err := cfg.TLS.load()
+		if err != nil {
+			return nil, err
+		}
+		clientOptions.SetTLSConfig(tlsConfig)
+	}
+
+	// Create a MongoDB client
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Test the connection with a timeout
+	pingCtx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	defer cancel()
+	if err := client.Ping(pingCtx, nil); err != nil {
+		client.Disconnect(ctx)
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (c TLSConfig) load() (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in TLS CA file %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gc2-yugo/entity"
+	"net"
+	"net/mail"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// NotificationConfig sets how patrons are told about due dates, overdue books and
+// holds ready for pickup. Users choose among the available channels, those without
+// preferences are notified on Channels.
+type NotificationConfig struct {
+	Channels []string      `yaml:"channels"` // default channels: email, webhook or log
+	DueSoon  time.Duration `yaml:"due_soon"` // how long before the due date loans are reminded
+	// TemplatesDir holds <kind>.tmpl files replacing the built-in templates
+	TemplatesDir string        `yaml:"templates_dir"`
+	SMTP         SMTPConfig    `yaml:"smtp"`
+	Webhook      WebhookConfig `yaml:"webhook"`
+}
+
+// SMTPConfig enables the email channel when Address is set. The connection is
+// upgraded with STARTTLS when the server offers it.
+type SMTPConfig struct {
+	Address  string `yaml:"address"` // host:port
+	From     string `yaml:"from"`
+	Username string `yaml:"username"` // empty to send without authentication
+	Password string `yaml:"password"`
+}
+
+// WebhookConfig enables the webhook channel when URL is set, notifications are
+// posted to it as JSON.
+type WebhookConfig struct {
+	URL     string        `yaml:"url"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func defaultNotificationConfig() NotificationConfig {
+	return NotificationConfig{
+		Channels: []string{entity.ChannelLog},
+		DueSoon:  48 * time.Hour,
+		Webhook:  WebhookConfig{Timeout: 10 * time.Second},
+	}
+}
+
+// Available returns the channels that are configured, the log always is.
+func (c NotificationConfig) Available() []string {
+	channels := []string{entity.ChannelLog}
+	if c.SMTP.Address != "" {
+		channels = append(channels, entity.ChannelEmail)
+	}
+	if c.Webhook.URL != "" {
+		channels = append(channels, entity.ChannelWebhook)
+	}
+	return channels
+}
+
+func (c *NotificationConfig) loadEnv(env *envReader) {
+	env.strings("NOTIFY_CHANNELS", &c.Channels)
+	env.duration("NOTIFY_DUE_SOON", &c.DueSoon)
+	env.string("NOTIFY_TEMPLATES_DIR", &c.TemplatesDir)
+	env.string("SMTP_ADDRESS", &c.SMTP.Address)
+	env.string("SMTP_FROM", &c.SMTP.From)
+	env.string("SMTP_USERNAME", &c.SMTP.Username)
+	env.string("SMTP_PASSWORD", &c.SMTP.Password)
+	env.string("NOTIFY_WEBHOOK_URL", &c.Webhook.URL)
+	env.duration("NOTIFY_WEBHOOK_TIMEOUT", &c.Webhook.Timeout)
+}
+
+func (c *NotificationConfig) bindFlags(fs *flag.FlagSet) {
+	fs.Var(listFlag{&c.Channels}, "notifications.channels", "comma separated channels of users without preferences: email, webhook or log")
+	fs.DurationVar(&c.DueSoon, "notifications.due-soon", c.DueSoon, "how long before the due date loans are reminded")
+	fs.StringVar(&c.TemplatesDir, "notifications.templates-dir", c.TemplatesDir, "directory of templates replacing the built-in ones")
+	fs.StringVar(&c.SMTP.Address, "notifications.smtp.address", c.SMTP.Address, "host:port of the SMTP server, enables the email channel")
+	fs.StringVar(&c.SMTP.From, "notifications.smtp.from", c.SMTP.From, "sender address of notification emails")
+	fs.StringVar(&c.SMTP.Username, "notifications.smtp.username", c.SMTP.Username, "SMTP user name, empty to send without authentication")
+	fs.StringVar(&c.SMTP.Password, "notifications.smtp.password", c.SMTP.Password, "SMTP password")
+	fs.StringVar(&c.Webhook.URL, "notifications.webhook.url", c.Webhook.URL, "URL notifications are posted to, enables the webhook channel")
+	fs.DurationVar(&c.Webhook.Timeout, "notifications.webhook.timeout", c.Webhook.Timeout, "deadline of each webhook post")
+}
+
+func (c *NotificationConfig) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	available := c.Available()
+	for _, channel := range c.Channels {
+		switch channel {
+		case entity.ChannelEmail, entity.ChannelWebhook, entity.ChannelLog:
+			check(slices.Contains(available, channel), "notifications.channels: %s is not configured", channel)
+		default:
+			errs = append(errs, fmt.Errorf("notifications.channels must be email, webhook or log, got %q", channel))
+		}
+	}
+	check(c.DueSoon >= 24*time.Hour, "notifications.due_soon must be at least 24h, got %s", c.DueSoon)
+
+	if c.SMTP.Address != "" {
+		_, _, err := net.SplitHostPort(c.SMTP.Address)
+		check(err == nil, "notifications.smtp.address must be host:port, got %q", c.SMTP.Address)
+		_, err = mail.ParseAddress(c.SMTP.From)
+		check(err == nil, "notifications.smtp.from must be an email address, got %q", c.SMTP.From)
+	}
+	if c.Webhook.URL != "" {
+		u, err := url.Parse(c.Webhook.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"notifications.webhook.url must be an http or https URL, got %q", c.Webhook.URL)
+	}
+	check(c.Webhook.Timeout > 0, "notifications.webhook.timeout must be positive, got %s", c.Webhook.Timeout)
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Sinks the outbox relay delivers events to
+const (
+	SinkBus     = "bus" // subscribers in the server process
+	SinkWebhook = "webhook"
+	SinkNATS    = "nats"
+)
+
+// OutboxConfig sets how the domain events written to the outbox with the changes of
+// the catalogue and the loans are relayed to other systems. One replica at a time
+// relays the events, in order per book.
+type OutboxConfig struct {
+	Sink      string        `yaml:"sink"`       // bus, webhook or nats
+	Interval  time.Duration `yaml:"interval"`   // how often the relay looks for new events
+	BatchSize int           `yaml:"batch_size"` // events read per pass
+	Retention time.Duration `yaml:"retention"`  // how long delivered events are kept
+	Webhook   WebhookConfig `yaml:"webhook"`    // events are posted to the URL one by one
+	NATS      NATSConfig    `yaml:"nats"`
+}
+
+// NATSConfig is the server the nats sink publishes to. The subject of an event is
+// the prefix and the event's type, such as library.events.book.added.
+type NATSConfig struct {
+	Address       string        `yaml:"address"` // host:port
+	SubjectPrefix string        `yaml:"subject_prefix"`
+	Timeout       time.Duration `yaml:"timeout"`
+}
+
+func defaultOutboxConfig() OutboxConfig {
+	return OutboxConfig{
+		Sink:      SinkBus,
+		Interval:  time.Second,
+		BatchSize: 100,
+		Retention: 7 * 24 * time.Hour,
+		Webhook:   WebhookConfig{Timeout: 10 * time.Second},
+		NATS:      NATSConfig{SubjectPrefix: "library.events", Timeout: 5 * time.Second},
+	}
+}
+
+func (c *OutboxConfig) loadEnv(env *envReader) {
+	env.string("OUTBOX_SINK", &c.Sink)
+	env.duration("OUTBOX_INTERVAL", &c.Interval)
+	env.int("OUTBOX_BATCH_SIZE", &c.BatchSize)
+	env.duration("OUTBOX_RETENTION", &c.Retention)
+	env.string("OUTBOX_WEBHOOK_URL", &c.Webhook.URL)
+	env.duration("OUTBOX_WEBHOOK_TIMEOUT", &c.Webhook.Timeout)
+	env.string("OUTBOX_NATS_ADDRESS", &c.NATS.Address)
+	env.string("OUTBOX_NATS_SUBJECT_PREFIX", &c.NATS.SubjectPrefix)
+	env.duration("OUTBOX_NATS_TIMEOUT", &c.NATS.Timeout)
+}
+
+func (c *OutboxConfig) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Sink, "outbox.sink", c.Sink, "where domain events are relayed: bus, webhook or nats")
+	fs.DurationVar(&c.Interval, "outbox.interval", c.Interval, "how often the relay looks for new events")
+	fs.IntVar(&c.BatchSize, "outbox.batch-size", c.BatchSize, "events the relay reads per pass")
+	fs.DurationVar(&c.Retention, "outbox.retention", c.Retention, "how long delivered events are kept")
+	fs.StringVar(&c.Webhook.URL, "outbox.webhook.url", c.Webhook.URL, "URL the webhook sink posts events to")
+	fs.DurationVar(&c.Webhook.Timeout, "outbox.webhook.timeout", c.Webhook.Timeout, "deadline of each event post")
+	fs.StringVar(&c.NATS.Address, "outbox.nats.address", c.NATS.Address, "host:port of the NATS server of the nats sink")
+	fs.StringVar(&c.NATS.SubjectPrefix, "outbox.nats.subject-prefix", c.NATS.SubjectPrefix, "prefix of the subjects events are published on")
+	fs.DurationVar(&c.NATS.Timeout, "outbox.nats.timeout", c.NATS.Timeout, "deadline of each publish")
+}
+
+func (c *OutboxConfig) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	switch c.Sink {
+	case SinkBus:
+	case SinkWebhook:
+		u, err := url.Parse(c.Webhook.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"outbox.webhook.url must be an http or https URL, got %q", c.Webhook.URL)
+	case SinkNATS:
+		_, _, err := net.SplitHostPort(c.NATS.Address)
+		check(err == nil, "outbox.nats.address must be host:port, got %q", c.NATS.Address)
+		check(c.NATS.SubjectPrefix != "", "outbox.nats.subject_prefix must not be empty")
+	default:
+		errs = append(errs, fmt.Errorf("outbox.sink must be bus, webhook or nats, got %q", c.Sink))
+	}
+	check(c.Interval >= 100*time.Millisecond, "outbox.interval must be at least 100ms, got %s", c.Interval)
+	check(c.BatchSize > 0, "outbox.batch_size must be positive, got %d", c.BatchSize)
+	check(c.Retention >= time.Hour, "outbox.retention must be at least 1h, got %s", c.Retention)
+	check(c.Webhook.Timeout > 0, "outbox.webhook.timeout must be positive, got %s", c.Webhook.Timeout)
+	check(c.NATS.Timeout > 0, "outbox.nats.timeout must be positive, got %s", c.NATS.Timeout)
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Names of the scheduled jobs
+const (
+	JobLateBooks     = "late_books"
+	JobHoldExpiry    = "hold_expiry"
+	JobFineAccrual   = "fine_accrual"
+	JobNotifications = "notifications"
+)
+
+// JobSpec is the cron spec of a named job. An empty spec disables the job.
+type JobSpec struct {
+	Name string
+	Spec string
+}
+
+// Jobs returns the spec of every job in a fixed order.
+func (c SchedulerConfig) Jobs() []JobSpec {
+	return []JobSpec{
+		{JobLateBooks, c.LateBooksSpec},
+		{JobHoldExpiry, c.HoldExpirySpec},
+		{JobFineAccrual, c.FineAccrualSpec},
+		{JobNotifications, c.NotificationsSpec},
+	}
+}
+
+func (c *SchedulerConfig) validate() error {
+	var errs []error
+	for _, job := range c.Jobs() {
+		if job.Spec == "" {
+			continue
+		}
+		if _, err := cron.ParseStandard(job.Spec); err != nil {
+			errs = append(errs, fmt.Errorf("scheduler.%s_spec %q: %w", job.Name, job.Spec, err))
+		}
+	}
+	if c.JobTimeout < time.Second {
+		errs = append(errs, fmt.Errorf("scheduler.job_timeout must be at least 1s, got %s", c.JobTimeout))
+	}
+	if c.RunRetention < time.Hour {
+		errs = append(errs, fmt.Errorf("scheduler.run_retention must be at least 1h, got %s", c.RunRetention))
+	}
+	if c.LeaseTTL < 3*time.Second {
+		errs = append(errs, fmt.Errorf("scheduler.lease_ttl must be at least 3s, got %s", c.LeaseTTL))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"gc2-yugo/store"
+	"strings"
+	"time"
+)
+
+type SQLConfig struct {
+	URL string `yaml:"url"` // defaults to a local database for the selected driver
+}
+
+func ConnectionDatabaseSQL(ctx context.Context, driver string, cfg SQLConfig) (*sql.DB, error) {
+	// Define the connection string, the configured URL overrides the local defaults
+	dsn := cfg.URL
+	if dsn == "" {
+		switch driver {
+		case store.DriverPostgres:
+			dsn = "postgres://localhost:5432/GC2?sslmode=disable"
+		case store.DriverSQLite:
+			dsn = "file:library.db"
+		}
+	}
+
+	switch driver {
+	case store.DriverPostgres:
+	case store.DriverSQLite:
+		// SQLite only enforces foreign keys when asked to, on every connection
+		if !strings.Contains(dsn, "foreign_keys") {
+			if strings.Contains(dsn, "?") {
+				dsn += "&_pragma=foreign_keys(1)"
+			} else {
+				dsn += "?_pragma=foreign_keys(1)"
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported SQL driver %q", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer, serialize access instead of failing with "database is locked"
+	if driver == store.DriverSQLite {
+		db.SetMaxOpenConns(1)
+	}
+
+	// Test the connection with a timeout
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// WebhooksConfig sets how the events partners subscribed to are posted to their
+// webhooks. A failed delivery is retried after InitialBackoff, doubled after each
+// failure up to MaxBackoff, and dead-lettered after MaxAttempts.
+type WebhooksConfig struct {
+	Interval       time.Duration `yaml:"interval"`        // how often due deliveries are sent
+	Timeout        time.Duration `yaml:"timeout"`         // deadline of each post
+	MaxAttempts    int           `yaml:"max_attempts"`    // attempts before a delivery is dead-lettered
+	InitialBackoff time.Duration `yaml:"initial_backoff"` // delay before the first retry
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	Retention      time.Duration `yaml:"retention"` // how long finished deliveries stay in the log
+}
+
+func defaultWebhooksConfig() WebhooksConfig {
+	return WebhooksConfig{
+		Interval:       5 * time.Second,
+		Timeout:        10 * time.Second,
+		MaxAttempts:    8,
+		InitialBackoff: 30 * time.Second,
+		MaxBackoff:     time.Hour,
+		Retention:      30 * 24 * time.Hour,
+	}
+}
+
+func (c *WebhooksConfig) loadEnv(env *envReader) {
+	env.duration("WEBHOOKS_INTERVAL", &c.Interval)
+	env.duration("WEBHOOKS_TIMEOUT", &c.Timeout)
+	env.int("WEBHOOKS_MAX_ATTEMPTS", &c.MaxAttempts)
+	env.duration("WEBHOOKS_INITIAL_BACKOFF", &c.InitialBackoff)
+	env.duration("WEBHOOKS_MAX_BACKOFF", &c.MaxBackoff)
+	env.duration("WEBHOOKS_RETENTION", &c.Retention)
+}
+
+func (c *WebhooksConfig) bindFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&c.Interval, "webhooks.interval", c.Interval, "how often due webhook deliveries are sent")
+	fs.DurationVar(&c.Timeout, "webhooks.timeout", c.Timeout, "deadline of each webhook post")
+	fs.IntVar(&c.MaxAttempts, "webhooks.max-attempts", c.MaxAttempts, "attempts before a webhook delivery is dead-lettered")
+	fs.DurationVar(&c.InitialBackoff, "webhooks.initial-backoff", c.InitialBackoff, "delay before the first retry of a webhook delivery")
+	fs.DurationVar(&c.MaxBackoff, "webhooks.max-backoff", c.MaxBackoff, "longest delay between retries of a webhook delivery")
+	fs.DurationVar(&c.Retention, "webhooks.retention", c.Retention, "how long finished webhook deliveries are logged")
+}
+
+func (c *WebhooksConfig) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Interval >= 100*time.Millisecond, "webhooks.interval must be at least 100ms, got %s", c.Interval)
+	check(c.Timeout > 0, "webhooks.timeout must be positive, got %s", c.Timeout)
+	// The dispatcher renews its 30s lease before each post, which must end well before the lease does
+	check(c.Timeout <= 15*time.Second, "webhooks.timeout must be at most 15s, got %s", c.Timeout)
+	check(c.MaxAttempts > 0, "webhooks.max_attempts must be positive, got %d", c.MaxAttempts)
+	check(c.InitialBackoff > 0, "webhooks.initial_backoff must be positive, got %s", c.InitialBackoff)
+	check(c.MaxBackoff >= c.InitialBackoff, "webhooks.max_backoff must be at least webhooks.initial_backoff, got %s", c.MaxBackoff)
+	check(c.Retention >= time.Hour, "webhooks.retention must be at least 1h, got %s", c.Retention)
+
+	return errors.Join(errs...)
+}
@@ -6,24 +6,306 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// User roles, each one can do everything the previous one can
+const (
+	RoleMember    = "member"
+	RoleLibrarian = "librarian"
+	RoleAdmin     = "admin"
+)
+
 type User struct {
 	ID       primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
 	Username string             `json:"username"`
 	Password string             `json:"password"`
+	Role     string             `json:"role,omitempty" bson:"role,omitempty"`
+	// Category selects the circulation rules of the user, such as "student" or "staff"
+	Category string `json:"category,omitempty" bson:"category,omitempty"`
+	// LoanVersion changes with every loan of the user, so a borrow can tell whether the user's
+	// loans changed since it checked the circulation rules
+	LoanVersion int `json:"loan_version,omitempty" bson:"loan_version"`
 }
 
-type Book struct {
-	ID            primitive.ObjectID `json:"_id" bson:"_id, omitempty"`
+// Title is the bibliographic record of a book. The library holds one or more copies of it.
+type Title struct {
+	ID            primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
 	Title         string             `json:"title"`
 	Author        string             `json:"author"`
+	ISBN          string             `json:"isbn,omitempty" bson:"isbn,omitempty"`
 	PublishedDate time.Time          `json:"published_date" bson:"published_date"`
-	Status        string             `json:"status"`
+	// ItemType selects the circulation rules of the title's copies, such as "dvd" or "reference"
+	ItemType string `json:"item_type,omitempty" bson:"item_type,omitempty"`
+}
+
+// Copy statuses
+const (
+	CopyAvailable = "Available"
+	CopyBorrowed  = "borrowed"
+	CopyOnHold    = "on_hold" // kept for the patron of a ready hold
+	CopyLost      = "lost"
+	CopyWithdrawn = "withdrawn" // taken out of circulation
+)
+
+// Copy conditions
+const (
+	ConditionNew     = "new"
+	ConditionGood    = "good"
+	ConditionFair    = "fair"
+	ConditionPoor    = "poor"
+	ConditionDamaged = "damaged"
+)
+
+// Copy is a physical item of a title.
+type Copy struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	TitleID   string             `json:"title_id" bson:"title_id"`
+	Barcode   string             `json:"barcode" bson:"barcode"`
+	Status    string             `json:"status" bson:"status"`
+	Condition string             `json:"condition" bson:"condition"`
+	Location  string             `json:"location,omitempty" bson:"location,omitempty"` // shelf mark
+}
+
+// Hold statuses
+const (
+	HoldWaiting   = "waiting"   // in the queue of the title
+	HoldReady     = "ready"     // a copy is kept for the patron until the pickup deadline
+	HoldFulfilled = "fulfilled" // the patron borrowed the kept copy
+	HoldCancelled = "cancelled"
+	HoldExpired   = "expired" // the kept copy was not borrowed in time
+)
+
+// Hold is a patron's place in the FIFO queue of a title.
+type Hold struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	TitleID   string             `json:"title_id" bson:"title_id"`
+	UserID    string             `json:"user_id" bson:"user_id"`
+	Status    string             `json:"status" bson:"status"`
+	CopyID    string             `json:"copy_id,omitempty" bson:"copy_id,omitempty"` // the copy kept once ready
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	ReadyAt   *time.Time         `json:"ready_at,omitempty" bson:"ready_at,omitempty"`
+	PickupBy  *time.Time         `json:"pickup_by,omitempty" bson:"pickup_by,omitempty"`
+	ClosedAt  *time.Time         `json:"closed_at,omitempty" bson:"closed_at,omitempty"`
 }
 
 type BorrowedBooks struct {
 	ID           primitive.ObjectID `json:"_id" bson:"_id, omitempty"`
-	BookID       string             `json:"book_id" bson:"book_id"`
+	BookID       string             `json:"book_id" bson:"book_id"` // the title
+	CopyID       string             `json:"copy_id,omitempty" bson:"copy_id,omitempty"`
 	UserID       string             `json:"user_id" bson:"user_id"`
 	BorrowedDate string             `json:"borrowed_date" bson:"borrowed_date"`
-	ReturnDate   string             `json:"return_date" bsong:"return_date"`
+	ReturnDate   string             `json:"return_date" bson:"return_date"`
+	ReturnedAt   *time.Time         `json:"returned_at,omitempty" bson:"returned_at,omitempty"`
+	Renewals     []LoanRenewal      `json:"renewals,omitempty" bson:"renewals,omitempty"` // oldest first
+}
+
+// LoanRenewal records one extension of a loan's due date.
+type LoanRenewal struct {
+	RenewedAt       time.Time `json:"renewed_at" bson:"renewed_at"`
+	RenewedBy       string    `json:"renewed_by" bson:"renewed_by"` // the borrower or a librarian
+	PreviousDueDate string    `json:"previous_due_date" bson:"previous_due_date"`
+	DueDate         string    `json:"due_date" bson:"due_date"`
+}
+
+// Fee transaction kinds. Charges are positive amounts, payments and waivers negative.
+const (
+	FeeOverdue = "overdue_fine"
+	FeeLost    = "lost"    // replacement fee of a lost copy
+	FeeDamaged = "damaged" // repair fee of a damaged copy
+	FeePayment = "payment"
+	FeeWaiver  = "waiver" // cancels part or all of a charge
+)
+
+// FeeTransaction is an entry of a user's fee ledger. Entries are never changed or
+// removed, the balance of a user is the sum of their amounts.
+type FeeTransaction struct {
+	ID       primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	UserID   string             `json:"user_id" bson:"user_id"`
+	Kind     string             `json:"kind" bson:"kind"`
+	Amount   int64              `json:"amount" bson:"amount"` // in cents
+	LoanID   string             `json:"loan_id,omitempty" bson:"loan_id,omitempty"`
+	ChargeID string             `json:"charge_id,omitempty" bson:"charge_id,omitempty"` // the charge a waiver cancels
+	Note     string             `json:"note,omitempty" bson:"note,omitempty"`
+	// CreatedBy is the librarian who recorded the entry, empty for fines charged by the server
+	CreatedBy string    `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	// IdempotencyKey makes the entry unique, so a charge computed twice is recorded once
+	IdempotencyKey string `json:"idempotency_key,omitempty" bson:"idempotency_key,omitempty"`
+}
+
+// RefreshToken is a server-side refresh token. Only the hash of the token is stored.
+type RefreshToken struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	TokenHash string             `json:"-" bson:"token_hash"`
+	UserID    string             `json:"user_id" bson:"user_id"`
+	FamilyID  string             `json:"family_id" bson:"family_id"` // shared by every token rotated from the same login
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+	RevokedAt *time.Time         `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"` // set once used or logged out
+}
+
+// LoginThrottle counts the recent failed logins of a username or a client IP.
+type LoginThrottle struct {
+	Key         string     `json:"key" bson:"_id"` // "user:<username>" or "ip:<address>"
+	Failures    int        `json:"failures" bson:"failures"`
+	LastFailure time.Time  `json:"last_failure" bson:"last_failure"`
+	LockedUntil *time.Time `json:"locked_until,omitempty" bson:"locked_until,omitempty"`
+}
+
+// Audit event types
+const (
+	AuditLoginBlocked    = "login_blocked"    // a login was refused because of a lockout
+	AuditAccountLocked   = "account_locked"   // too many failures locked a username or an IP
+	AuditAccountUnlocked = "account_unlocked" // an admin lifted a lockout
+)
+
+// AuditEvent is an entry of the security audit trail.
+type AuditEvent struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	Type      string             `json:"type" bson:"type"`
+	Username  string             `json:"username,omitempty" bson:"username,omitempty"`
+	IP        string             `json:"ip,omitempty" bson:"ip,omitempty"`
+	ActorID   string             `json:"actor_id,omitempty" bson:"actor_id,omitempty"` // admin who caused the event
+	Detail    string             `json:"detail,omitempty" bson:"detail,omitempty"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// Job run statuses
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// JobRun is one run of a scheduled job.
+type JobRun struct {
+	ID          primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	Job         string             `json:"job" bson:"job"`
+	ScheduledAt time.Time          `json:"scheduled_at" bson:"scheduled_at"` // when the run was due, later runs skip missed ones
+	StartedAt   time.Time          `json:"started_at" bson:"started_at"`
+	FinishedAt  *time.Time         `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+	Status      string             `json:"status" bson:"status"`
+	Error       string             `json:"error,omitempty" bson:"error,omitempty"`
+	Result      JobResult          `json:"result" bson:"result"`
+	Instance    string             `json:"instance,omitempty" bson:"instance,omitempty"`         // server instance that ran it
+	TriggeredBy string             `json:"triggered_by,omitempty" bson:"triggered_by,omitempty"` // admin who started it by hand
+}
+
+// JobResult is what a job run did, kept even when the run failed part way.
+type JobResult struct {
+	Checked int    `json:"checked" bson:"checked"` // records the job looked at
+	Changed int    `json:"changed" bson:"changed"` // records the job changed
+	Summary string `json:"summary,omitempty" bson:"summary,omitempty"`
+}
+
+// JobLease is held by the server instance running a job, so that one instance runs
+// it at a time. An expired lease can be taken over.
+type JobLease struct {
+	Job       string    `json:"job" bson:"_id"`
+	Holder    string    `json:"holder" bson:"holder"` // instance id
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// JobState is what admins set about a job, shared by the server instances.
+type JobState struct {
+	Job       string    `json:"job" bson:"_id"`
+	Paused    bool      `json:"paused" bson:"paused"` // scheduled runs are skipped, triggered runs still run
+	UpdatedBy string    `json:"updated_by" bson:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Notification kinds
+const (
+	NotifyDueSoon   = "due_soon"   // a loan is due in a few days
+	NotifyOverdue   = "overdue"    // a loan is past its due date
+	NotifyHoldReady = "hold_ready" // a copy is kept for the patron's hold
+)
+
+// Notification channels
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+	ChannelLog     = "log" // the server log, for development
+)
+
+// Notification records a message sent to a user, so that it is sent once. A user
+// gets one notification per kind and key.
+type Notification struct {
+	ID       primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	UserID   string             `json:"user_id" bson:"user_id"`
+	Kind     string             `json:"kind" bson:"kind"`
+	Key      string             `json:"key" bson:"key"`           // what it is about, such as a loan and its due date
+	Channels []string           `json:"channels" bson:"channels"` // where it was sent, failed deliveries are only logged
+	Subject  string             `json:"subject" bson:"subject"`
+	SentAt   time.Time          `json:"sent_at" bson:"sent_at"`
+}
+
+// NotificationPreferences are the user's choices of how and about what they are
+// notified. Users without preferences get every kind on the default channels.
+type NotificationPreferences struct {
+	UserID    string    `json:"user_id" bson:"_id"`
+	Email     string    `json:"email,omitempty" bson:"email,omitempty"`
+	Channels  []string  `json:"channels,omitempty" bson:"channels,omitempty"` // empty for the default channels
+	Muted     []string  `json:"muted,omitempty" bson:"muted,omitempty"`       // kinds the user does not want
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Domain event types of the outbox
+const (
+	EventBookAdded    = "book.added"
+	EventBookRemoved  = "book.removed"
+	EventBookBorrowed = "book.borrowed"
+	EventBookReturned = "book.returned"
+	// A copy of the book was added, removed or changed status other than by a loan
+	EventBookStatusChanged = "book.status_changed"
+	// A copy of the book is kept for the patron of a hold
+	EventHoldReady = "hold.ready"
+)
+
+// OutboxEvent is a domain event, stored with the change it describes and relayed to
+// other systems afterwards. Seq orders the events, those of a book are delivered in
+// that order.
+type OutboxEvent struct {
+	ID          primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	Seq         int64              `json:"seq" bson:"seq"`
+	Type        string             `json:"type" bson:"type"`
+	BookID      string             `json:"book_id" bson:"book_id"`
+	Payload     []byte             `json:"payload" bson:"payload"` // JSON
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	Attempts    int                `json:"attempts" bson:"attempts"` // failed deliveries
+	LastError   string             `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	DeliveredAt *time.Time         `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"   // waiting for its next attempt
+	DeliveryDelivered = "delivered" // the receiver answered with a 2xx status
+	DeliveryDead      = "dead"      // every attempt failed, it is not retried anymore
+)
+
+// WebhookSubscription is a partner's URL receiving the events of some types. The
+// deliveries are signed with the secret.
+type WebhookSubscription struct {
+	ID         primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	URL        string             `json:"url" bson:"url"`
+	EventTypes []string           `json:"event_types" bson:"event_types"`
+	Secret     string             `json:"-" bson:"secret"`
+	CreatedBy  string             `json:"created_by" bson:"created_by"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// WebhookDelivery is an event to post to a subscription, with the outcome of its
+// last attempt. A subscription gets an event once.
+type WebhookDelivery struct {
+	ID             primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	SubscriptionID string             `json:"subscription_id" bson:"subscription_id"`
+	EventID        string             `json:"event_id" bson:"event_id"`
+	EventType      string             `json:"event_type" bson:"event_type"`
+	Payload        []byte             `json:"payload" bson:"payload"` // the JSON body posted
+	Status         string             `json:"status" bson:"status"`
+	Attempts       int                `json:"attempts" bson:"attempts"`
+	LastError      string             `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	ResponseCode   int                `json:"response_code,omitempty" bson:"response_code,omitempty"` // of the last attempt
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	NextAttemptAt  time.Time          `json:"next_attempt_at" bson:"next_attempt_at"`
+	DeliveredAt    *time.Time         `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
 }
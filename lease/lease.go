@@ -0,0 +1,163 @@
+// Package lease runs background work that one replica at a time may do, such as
+// relaying the outbox. The replicas sharing a store take turns through a job lease:
+// each pass first takes or renews it, and does nothing while another replica holds it.
+package lease
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gc2-yugo/store"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// TTL is how long a replica holds a lease without renewing it. Keep renews it once
+	// a third of it passed, so each step of a pass must take well under two thirds.
+	TTL = 30 * time.Second
+	// PruneInterval is how often a loop prunes, at most.
+	PruneInterval = time.Hour
+)
+
+// Store is what a loop needs of the store: the job leases.
+type Store interface {
+	AcquireJobLease(ctx context.Context, job, holder string, now, until time.Time) error
+	ReleaseJobLease(ctx context.Context, job, holder string) error
+}
+
+// Config is the work of a loop and the lease it holds to do it.
+type Config struct {
+	Name     string        // of the lease, also names the loop in the log
+	Instance string        // names the replica in the lease
+	Interval time.Duration // between passes
+	// Work makes one pass and returns how many items it handled. A pass of several
+	// steps calls Keep on the lease before each of them.
+	Work func(ctx context.Context, lease *Lease) (int, error)
+	// Prune deletes what outlived its retention at now. Nil prunes nothing.
+	Prune func(ctx context.Context, now time.Time) error
+	Now   func() time.Time // nil is time.Now
+}
+
+// Loop makes a pass of its work every interval between Start and Stop, while this
+// replica holds the lease, and prunes after a pass at most once per PruneInterval.
+type Loop struct {
+	store Store
+	cfg   Config
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	pass      sync.Mutex // passes never overlap
+	lastPrune time.Time
+}
+
+// NewLoop returns a loop doing the work of the configuration under its lease.
+func NewLoop(leases Store, cfg Config) *Loop {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Loop{store: leases, cfg: cfg}
+}
+
+// Start makes a pass every interval until Stop.
+func (l *Loop) Start(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ctx, l.cancel = context.WithCancel(ctx)
+	l.done = make(chan struct{})
+	go l.loop(ctx, l.done)
+}
+
+// Stop stops the passes, waits for the pass in progress and frees the lease.
+func (l *Loop) Stop() {
+	l.mu.Lock()
+	cancel, done := l.cancel, l.done
+	l.cancel, l.done = nil, nil
+	l.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+
+	err := l.store.ReleaseJobLease(context.Background(), l.cfg.Name, l.cfg.Instance)
+	if err != nil && !errors.Is(err, store.ErrConflict) {
+		log.Printf("failed to release the %s lease: %v", l.cfg.Name, err)
+	}
+}
+
+func (l *Loop) loop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(l.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := l.Run(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("%s: %v", l.cfg.Name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run makes one pass and returns what the work returned. It does nothing while
+// another replica holds the lease.
+func (l *Loop) Run(ctx context.Context) (int, error) {
+	l.pass.Lock()
+	defer l.pass.Unlock()
+
+	lease := &Lease{loop: l}
+	err := lease.acquire(ctx)
+	if errors.Is(err, store.ErrConflict) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to take the lease: %w", err)
+	}
+
+	done, workErr := l.cfg.Work(ctx, lease)
+
+	if now := l.cfg.Now(); l.cfg.Prune != nil && now.Sub(l.lastPrune) >= PruneInterval {
+		if err := l.cfg.Prune(ctx, now); err != nil {
+			return done, errors.Join(workErr, err)
+		}
+		l.lastPrune = now
+	}
+	return done, workErr
+}
+
+// Lease is the lease a pass holds.
+type Lease struct {
+	loop    *Loop
+	renewAt time.Time
+}
+
+// Keep renews the lease once a third of TTL passed since it was taken, so that it
+// is held for the next step of the pass. The pass must stop when it fails.
+func (l *Lease) Keep(ctx context.Context) error {
+	if !l.loop.cfg.Now().After(l.renewAt) {
+		return nil
+	}
+	if err := l.acquire(ctx); err != nil {
+		return fmt.Errorf("failed to renew the lease: %w", err)
+	}
+	return nil
+}
+
+// acquire takes or renews the lease.
+func (l *Lease) acquire(ctx context.Context) error {
+	now := l.loop.cfg.Now()
+	if err := l.loop.store.AcquireJobLease(ctx, l.loop.cfg.Name, l.loop.cfg.Instance, now, now.Add(TTL)); err != nil {
+		return err
+	}
+	l.renewAt = now.Add(TTL / 3)
+	return nil
+}
@@ -0,0 +1,131 @@
+package lease
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gc2-yugo/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunTakesTurns(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	passes, prunes := 0, 0
+	loop := NewLoop(s, Config{
+		Name:     "test_loop",
+		Instance: "replica-1",
+		Interval: time.Second,
+		Work: func(ctx context.Context, l *Lease) (int, error) {
+			passes++
+			return 3, nil
+		},
+		Prune: func(ctx context.Context, at time.Time) error {
+			prunes++
+			return nil
+		},
+		Now: func() time.Time { return now },
+	})
+
+	// Another replica holds the lease
+	require.NoError(t, s.AcquireJobLease(ctx, "test_loop", "replica-2", now, now.Add(time.Minute)))
+	done, err := loop.Run(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, done)
+	assert.Zero(t, passes)
+
+	require.NoError(t, s.ReleaseJobLease(ctx, "test_loop", "replica-2"))
+	done, err = loop.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, done)
+	held, err := s.GetJobLease(ctx, "test_loop")
+	require.NoError(t, err)
+	assert.Equal(t, "replica-1", held.Holder)
+	assert.True(t, now.Add(TTL).Equal(held.ExpiresAt))
+
+	// Pruned once per interval
+	now = now.Add(time.Minute)
+	_, err = loop.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, passes)
+	assert.Equal(t, 1, prunes)
+	now = now.Add(PruneInterval)
+	_, err = loop.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, prunes)
+}
+
+func TestKeep(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	start := now
+
+	loop := NewLoop(s, Config{
+		Name:     "test_loop",
+		Instance: "replica-1",
+		Interval: time.Second,
+		Work: func(ctx context.Context, l *Lease) (int, error) {
+			// Steps of 10s, the lease is renewed before it runs out
+			for i := 0; i < 6; i++ {
+				if err := l.Keep(ctx); err != nil {
+					return i, err
+				}
+				now = now.Add(10 * time.Second)
+			}
+			return 6, nil
+		},
+		Now: func() time.Time { return now },
+	})
+
+	done, err := loop.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 6, done)
+	held, err := s.GetJobLease(ctx, "test_loop")
+	require.NoError(t, err)
+	assert.True(t, held.ExpiresAt.After(start.Add(50*time.Second)), "renewed during the pass")
+
+	// A lease taken over meanwhile stops the pass
+	require.NoError(t, s.ReleaseJobLease(ctx, "test_loop", "replica-1"))
+	require.NoError(t, s.AcquireJobLease(ctx, "test_loop", "replica-2", now, now.Add(time.Minute)))
+	now = now.Add(TTL)
+	done, err = loop.Run(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, done, "another replica holds the lease")
+	lease := &Lease{loop: loop, renewAt: now}
+	now = now.Add(time.Second)
+	assert.ErrorIs(t, lease.Keep(ctx), store.ErrConflict)
+}
+
+func TestStopReleasesLease(t *testing.T) {
+	s := store.NewMemoryStore()
+	ran := make(chan struct{}, 1)
+	loop := NewLoop(s, Config{
+		Name:     "test_loop",
+		Instance: "replica-1",
+		Interval: 10 * time.Millisecond,
+		Work: func(ctx context.Context, l *Lease) (int, error) {
+			select {
+			case ran <- struct{}{}:
+			default:
+			}
+			return 0, nil
+		},
+	})
+
+	loop.Start(context.Background())
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the loop made no pass")
+	}
+
+	loop.Stop()
+	_, err := s.GetJobLease(context.Background(), "test_loop")
+	assert.ErrorIs(t, err, store.ErrNotFound, "the lease is freed")
+}
@@ -0,0 +1,214 @@
+// Package notify sends notifications to library users by email, to a webhook or to
+// the server log.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gc2-yugo/config"
+	"gc2-yugo/entity"
+	"io"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// ErrNoAddress is returned by the email notifier for users without an email address.
+var ErrNoAddress = errors.New("the user has no email address")
+
+// Message is a rendered notification to a user.
+type Message struct {
+	Kind     string
+	UserID   string
+	Username string
+	Email    string // recipient of the email channel
+	Subject  string
+	Body     string
+}
+
+// Notifier delivers messages over one channel.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// New returns the notifiers of the available channels by channel name.
+func New(cfg config.NotificationConfig) map[string]Notifier {
+	notifiers := map[string]Notifier{
+		entity.ChannelLog: NewLogNotifier(log.Default()),
+	}
+	if cfg.SMTP.Address != "" {
+		notifiers[entity.ChannelEmail] = NewSMTPNotifier(cfg.SMTP)
+	}
+	if cfg.Webhook.URL != "" {
+		notifiers[entity.ChannelWebhook] = NewWebhookNotifier(cfg.Webhook)
+	}
+	return notifiers
+}
+
+// LogNotifier writes messages to a logger, for development.
+type LogNotifier struct {
+	logger *log.Logger
+}
+
+func NewLogNotifier(logger *log.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, msg Message) error {
+	n.logger.Printf("notification %s to %s: %s\n%s", msg.Kind, msg.Username, msg.Subject, msg.Body)
+	return nil
+}
+
+// SMTPNotifier emails messages to the user's address.
+type SMTPNotifier struct {
+	cfg config.SMTPConfig
+}
+
+func NewSMTPNotifier(cfg config.SMTPConfig) *SMTPNotifier {
+	return &SMTPNotifier{cfg: cfg}
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, msg Message) error {
+	if msg.Email == "" {
+		return ErrNoAddress
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", n.cfg.Address)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	host, _, _ := net.SplitHostPort(n.cfg.Address)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if n.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	from, err := mailAddress(n.cfg.From)
+	if err != nil {
+		return err
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.Email); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(n.format(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// format returns the email of the message, with its body quoted-printable.
+func (n *SMTPNotifier) format(msg Message) []byte {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", n.cfg.From)
+	header("To", msg.Email)
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n")))
+	qp.Close()
+	return buf.Bytes()
+}
+
+// mailAddress returns the bare address of "Name <address>".
+func mailAddress(value string) (string, error) {
+	addr, err := mail.ParseAddress(value)
+	if err != nil {
+		return "", err
+	}
+	return addr.Address, nil
+}
+
+// WebhookNotifier posts messages as JSON to a URL, such as an SMS or chat gateway.
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(cfg config.WebhookConfig) *WebhookNotifier {
+	return &WebhookNotifier{url: cfg.URL, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// webhookPayload is the body of webhook posts.
+type webhookPayload struct {
+	Kind     string `json:"kind"`
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Subject  string `json:"subject"`
+	Body     string `json:"body"`
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, msg Message) error {
+	payload, err := json.Marshal(webhookPayload{
+		Kind:     msg.Kind,
+		UserID:   msg.UserID,
+		Username: msg.Username,
+		Subject:  msg.Subject,
+		Body:     msg.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gc2-yugo/config"
+	"gc2-yugo/entity"
+	"gc2-yugo/notify/smtptest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSMTPNotifier(t *testing.T) {
+	server := smtptest.NewServer()
+	defer server.Close()
+
+	notifier := NewSMTPNotifier(config.SMTPConfig{
+		Address:  server.Addr,
+		From:     "Library <library@example.com>",
+		Username: "library",
+		Password: "secret",
+	})
+	ctx := context.Background()
+	msg := Message{
+		Kind:     entity.NotifyOverdue,
+		Username: "peter",
+		Email:    "peter@example.com",
+		Subject:  `"Café Society" is overdue`,
+		Body:     "Hello peter,\n.\nPlease return it.\n",
+	}
+	require.NoError(t, notifier.Notify(ctx, msg))
+
+	mails := server.Mails()
+	require.Len(t, mails, 1)
+	assert.Equal(t, "library@example.com", mails[0].From)
+	assert.Equal(t, []string{"peter@example.com"}, mails[0].To)
+	assert.Equal(t, "library", mails[0].Username)
+
+	parsed, err := mail.ReadMessage(strings.NewReader(mails[0].Data))
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, msg.Subject, subject)
+	assert.Equal(t, "Library <library@example.com>", parsed.Header.Get("From"))
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	require.NoError(t, err)
+	assert.Equal(t, strings.ReplaceAll(msg.Body, "\n", "\r\n"), string(body))
+
+	msg.Email = ""
+	assert.ErrorIs(t, notifier.Notify(ctx, msg), ErrNoAddress)
+
+	msg.Email = "peter@example.com"
+	server.RejectRecipients(true)
+	assert.ErrorContains(t, notifier.Notify(ctx, msg), "mailbox unavailable")
+	assert.Len(t, server.Mails(), 1)
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received webhookPayload
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(config.WebhookConfig{URL: server.URL, Timeout: time.Second})
+	msg := Message{Kind: entity.NotifyHoldReady, UserID: "42", Username: "peter", Subject: "ready", Body: "come by"}
+	require.NoError(t, notifier.Notify(context.Background(), msg))
+	assert.Equal(t, webhookPayload{Kind: entity.NotifyHoldReady, UserID: "42", Username: "peter", Subject: "ready", Body: "come by"}, received)
+
+	fail = true
+	assert.ErrorContains(t, notifier.Notify(context.Background(), msg), "502")
+}
+
+func TestLogNotifier(t *testing.T) {
+	var buf bytes.Buffer
+	notifier := NewLogNotifier(log.New(&buf, "", 0))
+
+	require.NoError(t, notifier.Notify(context.Background(), Message{Kind: entity.NotifyDueSoon, Username: "peter", Subject: "due", Body: "soon"}))
+	assert.Equal(t, "notification due_soon to peter: due\nsoon\n", buf.String())
+}
+
+func TestNew(t *testing.T) {
+	cfg := config.Default().Notifications
+	assert.Len(t, New(cfg), 1)
+
+	cfg.SMTP = config.SMTPConfig{Address: "localhost:25", From: "library@example.com"}
+	cfg.Webhook.URL = "https://hooks.example.com"
+	notifiers := New(cfg)
+	assert.IsType(t, &LogNotifier{}, notifiers[entity.ChannelLog])
+	assert.IsType(t, &SMTPNotifier{}, notifiers[entity.ChannelEmail])
+	assert.IsType(t, &WebhookNotifier{}, notifiers[entity.ChannelWebhook])
+}
+
+func TestTemplates(t *testing.T) {
+	templates, err := LoadTemplates("")
+	require.NoError(t, err)
+
+	subject, body, err := templates.Render(entity.NotifyDueSoon, Data{
+		Username: "peter", Title: "Dune", Author: "Frank Herbert", DueDate: "2024-01-03", Days: 2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `"Dune" is due on 2024-01-03`, subject)
+	assert.Contains(t, body, "Hello peter,")
+	assert.Contains(t, body, "due back in 2 days, on 2024-01-03")
+
+	_, _, err = templates.Render("unknown", Data{})
+	assert.Error(t, err)
+
+	// Files of the directory replace the built-in templates of their kind
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "overdue.tmpl"), []byte("Subject: Late: {{.Title}}\n\nBring it back.\n"), 0o600))
+	templates, err = LoadTemplates(dir)
+	require.NoError(t, err)
+	subject, body, err = templates.Render(entity.NotifyOverdue, Data{Title: "Dune"})
+	require.NoError(t, err)
+	assert.Equal(t, "Late: Dune", subject)
+	assert.Equal(t, "Bring it back.\n", body)
+	_, _, err = templates.Render(entity.NotifyHoldReady, Data{Title: "Dune"})
+	assert.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "overdue.tmpl"), []byte("Bring back {{.Title}}.\n"), 0o600))
+	_, err = LoadTemplates(dir)
+	assert.ErrorContains(t, err, "must start with a Subject line")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "overdue.tmpl"), []byte("Subject: {{.Book}}\n\nlate"), 0o600))
+	_, err = LoadTemplates(dir)
+	assert.ErrorContains(t, err, "Book")
+}
@@ -0,0 +1,172 @@
+// Package smtptest runs a local SMTP server that keeps the mail it receives, for
+// tests of code that sends email.
+package smtptest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// Mail is a message received by the server.
+type Mail struct {
+	From     string
+	To       []string
+	Data     string // headers and body, with CRLF line endings
+	Username string // of AUTH PLAIN, empty without authentication
+}
+
+// Server is a fake SMTP server listening on a local port. It accepts any
+// credentials and advertises neither STARTTLS nor other extensions than AUTH PLAIN.
+type Server struct {
+	Addr string // host:port
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu     sync.Mutex
+	mails  []Mail
+	reject bool
+}
+
+// NewServer starts a server on a local port. It panics if it cannot listen, as
+// httptest.NewServer does.
+func NewServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("smtptest: failed to listen: %v", err))
+	}
+
+	s := &Server{Addr: listener.Addr().String(), listener: listener}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Close stops the server and waits for its connections to end.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+// Mails returns the mail received so far, oldest first.
+func (s *Server) Mails() []Mail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Mail(nil), s.mails...)
+}
+
+// RejectRecipients makes the server refuse every recipient, as a full mailbox does.
+func (s *Server) RejectRecipients(reject bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reject = reject
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(textproto.NewConn(conn))
+		}()
+	}
+}
+
+func (s *Server) handle(conn *textproto.Conn) {
+	var mail Mail
+	var username string
+	reply := func(code int, text string) bool {
+		return conn.PrintfLine("%d %s", code, text) == nil
+	}
+
+	if !reply(220, "smtptest ready") {
+		return
+	}
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		ok := true
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			ok = conn.PrintfLine("250-smtptest") == nil && reply(250, "AUTH PLAIN")
+		case "HELO", "NOOP":
+			ok = reply(250, "OK")
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			decoded, err := base64.StdEncoding.DecodeString(initial)
+			parts := strings.Split(string(decoded), "\x00")
+			if strings.ToUpper(mechanism) != "PLAIN" || err != nil || len(parts) != 3 {
+				ok = reply(504, "only AUTH PLAIN with an initial response")
+				break
+			}
+			username = parts[1]
+			ok = reply(235, "authenticated")
+		case "MAIL":
+			mail = Mail{From: address(arg), Username: username}
+			ok = reply(250, "OK")
+		case "RCPT":
+			s.mu.Lock()
+			reject := s.reject
+			s.mu.Unlock()
+			if reject {
+				ok = reply(550, "mailbox unavailable")
+				break
+			}
+			mail.To = append(mail.To, address(arg))
+			ok = reply(250, "OK")
+		case "DATA":
+			if len(mail.To) == 0 {
+				ok = reply(554, "no valid recipients")
+				break
+			}
+			if !reply(354, "end data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			data, err := conn.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			mail.Data = strings.ReplaceAll(string(data), "\n", "\r\n")
+			s.mu.Lock()
+			s.mails = append(s.mails, mail)
+			s.mu.Unlock()
+			mail = Mail{}
+			ok = reply(250, "queued")
+		case "RSET":
+			mail = Mail{}
+			ok = reply(250, "OK")
+		case "QUIT":
+			reply(221, "bye")
+			return
+		default:
+			ok = reply(502, "command not implemented")
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// address returns the address of "FROM:<address> PARAMS" or "TO:<address>".
+func address(arg string) string {
+	start := strings.Index(arg, "<")
+	end := strings.Index(arg, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return arg[start+1 : end]
+}
@@ -0,0 +1,86 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"gc2-yugo/entity"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+// Kinds are the notification kinds, each one has a template named <kind>.tmpl.
+var Kinds = []string{entity.NotifyDueSoon, entity.NotifyOverdue, entity.NotifyHoldReady}
+
+// Data is what templates can show.
+type Data struct {
+	Username string
+	Title    string
+	Author   string
+	DueDate  string // YYYY-MM-DD
+	Days     int    // days until the due date
+	PickupBy string // when a ready hold expires
+}
+
+// Templates render the messages of every kind. A template starts with a
+// "Subject: " line and a blank line, the rest is the body.
+type Templates struct {
+	templates map[string]*template.Template
+}
+
+// LoadTemplates parses the built-in templates, replaced by the <kind>.tmpl files of
+// dir when it is not empty. Templates are checked by rendering them once.
+func LoadTemplates(dir string) (*Templates, error) {
+	t := &Templates{templates: map[string]*template.Template{}}
+	for _, kind := range Kinds {
+		name := kind + ".tmpl"
+		text, err := builtinTemplates.ReadFile("templates/" + name)
+		if err != nil {
+			return nil, err
+		}
+		if dir != "" {
+			custom, err := os.ReadFile(filepath.Join(dir, name))
+			if err == nil {
+				text = custom
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(string(text))
+		if err != nil {
+			return nil, err
+		}
+		t.templates[kind] = tmpl
+		if _, _, err := t.Render(kind, Data{}); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Render returns the subject and body of a message of the kind.
+func (t *Templates) Render(kind string, data Data) (subject, body string, err error) {
+	tmpl, ok := t.templates[kind]
+	if !ok {
+		return "", "", fmt.Errorf("no template for %q", kind)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", "", err
+	}
+
+	head, body, _ := strings.Cut(strings.ReplaceAll(buf.String(), "\r\n", "\n"), "\n\n")
+	subject, ok = strings.CutPrefix(head, "Subject: ")
+	if !ok || strings.Contains(subject, "\n") {
+		return "", "", fmt.Errorf("%s: must start with a Subject line and a blank line", tmpl.Name())
+	}
+	return strings.TrimSpace(subject), strings.TrimSpace(body) + "\n", nil
+}
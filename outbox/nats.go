@@ -0,0 +1,127 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"gc2-yugo/config"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATSPublisher publishes to a NATS server over the plain text client protocol,
+// without TLS or authentication. Each publish is followed by a PING and waits for
+// the PONG, so a returned nil means the server has the message. NATS does not
+// partition, the key is not sent.
+type NATSPublisher struct {
+	address string
+	timeout time.Duration
+
+	mu     sync.Mutex // one publish at a time on the connection
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func NewNATSPublisher(cfg config.NATSConfig) *NATSPublisher {
+	return &NATSPublisher{address: cfg.Address, timeout: cfg.Timeout}
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, subject, key string, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	deadline := time.Now().Add(p.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if p.conn == nil {
+		if err := p.connect(ctx, deadline); err != nil {
+			return fmt.Errorf("nats: %w", err)
+		}
+	}
+
+	err := p.publish(subject, data, deadline)
+	if err != nil {
+		// Start over on a new connection next time
+		p.conn.Close()
+		p.conn = nil
+		return fmt.Errorf("nats: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connection, the next publish opens a new one.
+func (p *NATSPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
+
+func (p *NATSPublisher) connect(ctx context.Context, deadline time.Time) error {
+	conn, err := (&net.Dialer{Deadline: deadline}).DialContext(ctx, "tcp", p.address)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(deadline)
+
+	// The server greets with its INFO
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+	}
+
+	_, err = conn.Write([]byte(`CONNECT {"verbose":false,"pedantic":false,"name":"gc2-yugo outbox"}` + "\r\n"))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	p.conn, p.reader = conn, reader
+	return nil
+}
+
+func (p *NATSPublisher) publish(subject string, data []byte, deadline time.Time) error {
+	p.conn.SetDeadline(deadline)
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "PUB %s %d\r\n", subject, len(data))
+	msg.Write(data)
+	msg.WriteString("\r\nPING\r\n")
+	if _, err := p.conn.Write([]byte(msg.String())); err != nil {
+		return err
+	}
+
+	for {
+		line, err := p.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := p.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		default:
+			// +OK and INFO updates
+		}
+	}
+}
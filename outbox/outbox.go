@@ -0,0 +1,208 @@
+// Package outbox relays the domain events the store keeps in its outbox to other
+// systems: subscribers in the server process, a webhook or a message broker.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gc2-yugo/config"
+	"gc2-yugo/entity"
+	"gc2-yugo/lease"
+	"gc2-yugo/store"
+	"time"
+)
+
+// LeaseName is the job lease the relaying replica holds.
+const LeaseName = "outbox_relay"
+
+// Event is an outbox event as sinks deliver it.
+type Event struct {
+	ID        string          `json:"id"` // the same for every delivery of the event
+	Seq       int64           `json:"seq"`
+	Type      string          `json:"type"`
+	BookID    string          `json:"book_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"` // BookData, LoanData, CopyData or HoldData
+}
+
+// BookData is the data of book.added and book.removed events, only the ID is set
+// for removed books.
+type BookData struct {
+	BookID        string `json:"book_id"`
+	Title         string `json:"title,omitempty"`
+	Author        string `json:"author,omitempty"`
+	ISBN          string `json:"isbn,omitempty"`
+	PublishedDate string `json:"published_date,omitempty"`
+	ItemType      string `json:"item_type,omitempty"`
+}
+
+// LoanData is the data of book.borrowed and book.returned events.
+type LoanData struct {
+	LoanID       string `json:"loan_id"`
+	BookID       string `json:"book_id"`
+	CopyID       string `json:"copy_id,omitempty"`
+	UserID       string `json:"user_id"`
+	BorrowedDate string `json:"borrowed_date"`
+	DueDate      string `json:"due_date"`
+	ReturnedAt   string `json:"returned_at,omitempty"` // RFC 3339
+}
+
+// CopyData is the data of book.status_changed events. Status is empty for a removed
+// copy, Previous for an added one.
+type CopyData struct {
+	CopyID   string `json:"copy_id"`
+	BookID   string `json:"book_id"`
+	Status   string `json:"status,omitempty"`
+	Previous string `json:"previous,omitempty"`
+}
+
+// HoldData is the data of hold.ready events, the book is the title held.
+type HoldData struct {
+	HoldID   string `json:"hold_id"`
+	BookID   string `json:"book_id"`
+	CopyID   string `json:"copy_id"`
+	UserID   string `json:"user_id"`
+	ReadyAt  string `json:"ready_at"`  // RFC 3339
+	PickupBy string `json:"pickup_by"` // RFC 3339
+}
+
+// NewEvent returns an outbox event of the type about the book, with the data as its
+// payload, to be stored with the change it describes.
+func NewEvent(kind, bookID string, data interface{}, at time.Time) entity.OutboxEvent {
+	// The data types are plain structs, encoding them cannot fail
+	payload, _ := json.Marshal(data)
+	return entity.OutboxEvent{Type: kind, BookID: bookID, Payload: payload, CreatedAt: at.UTC()}
+}
+
+// FromEntity returns the stored event as sinks deliver it.
+func FromEntity(event entity.OutboxEvent) Event {
+	return Event{
+		ID:        event.ID.Hex(),
+		Seq:       event.Seq,
+		Type:      event.Type,
+		BookID:    event.BookID,
+		CreatedAt: event.CreatedAt.UTC(),
+		Data:      json.RawMessage(event.Payload),
+	}
+}
+
+// Sink delivers events to another system. An event whose delivery failed is
+// delivered again later, so sinks can see an event more than once.
+type Sink interface {
+	Deliver(ctx context.Context, event Event) error
+}
+
+// NewSink returns the sink of the configuration. The bus is the bus sink.
+func NewSink(cfg config.OutboxConfig, bus *Bus) Sink {
+	switch cfg.Sink {
+	case config.SinkWebhook:
+		return NewWebhookSink(cfg.Webhook)
+	case config.SinkNATS:
+		return NewPublisherSink(NewNATSPublisher(cfg.NATS), cfg.NATS.SubjectPrefix)
+	default:
+		return bus
+	}
+}
+
+// Store is what the relay needs of the store: the outbox and the job leases.
+type Store interface {
+	store.OutboxStore
+	lease.Store
+}
+
+// Relay delivers the pending events of the outbox to a sink, at least once and in
+// order per book: an event that cannot be delivered holds back the later events of
+// its book until it is. Replicas sharing a store take turns through a lease, so one
+// relays at a time.
+type Relay struct {
+	store     Store
+	sink      Sink
+	batchSize int
+	retention time.Duration
+	now       func() time.Time
+	loop      *lease.Loop
+}
+
+// NewRelay returns a relay of the store's events to the sink with the settings of
+// the configuration. instance names the replica in the lease.
+func NewRelay(events Store, sink Sink, cfg config.OutboxConfig, instance string) *Relay {
+	r := &Relay{
+		store:     events,
+		sink:      sink,
+		batchSize: cfg.BatchSize,
+		retention: cfg.Retention,
+		now:       time.Now,
+	}
+	r.loop = lease.NewLoop(events, lease.Config{
+		Name:     LeaseName,
+		Instance: instance,
+		Interval: cfg.Interval,
+		Work:     r.relay,
+		Prune:    r.prune,
+		Now:      func() time.Time { return r.now() },
+	})
+	return r
+}
+
+// Start relays the events every interval until Stop.
+func (r *Relay) Start(ctx context.Context) {
+	r.loop.Start(ctx)
+}
+
+// Stop stops relaying, waits for the pass in progress and frees the lease.
+func (r *Relay) Stop() {
+	r.loop.Stop()
+}
+
+// RelayPending delivers a batch of pending events and returns how many it delivered.
+// It delivers nothing while another replica holds the lease.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	return r.loop.Run(ctx)
+}
+
+func (r *Relay) relay(ctx context.Context, l *lease.Lease) (int, error) {
+	events, err := r.store.ListOutboxEvents(ctx, store.OutboxFilter{Pending: true, Limit: r.batchSize})
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	var failures []error
+	held := map[string]bool{} // books with an undelivered event
+	for _, event := range events {
+		if held[event.BookID] {
+			continue
+		}
+		// A long batch renews the lease before another replica can take it over
+		if err := l.Keep(ctx); err != nil {
+			failures = append(failures, err)
+			break
+		}
+
+		if err := r.sink.Deliver(ctx, FromEntity(event)); err != nil {
+			held[event.BookID] = true
+			failures = append(failures, fmt.Errorf("%s event %d: %w", event.Type, event.Seq, err))
+			if err := r.store.RecordOutboxFailure(ctx, event.ID.Hex(), err.Error()); err != nil {
+				failures = append(failures, err)
+			}
+			continue
+		}
+		// An event that cannot be marked is delivered again by the next pass
+		if err := r.store.MarkOutboxEventDelivered(ctx, event.ID.Hex(), r.now().UTC()); err != nil {
+			held[event.BookID] = true
+			failures = append(failures, err)
+			continue
+		}
+		delivered++
+	}
+	return delivered, errors.Join(failures...)
+}
+
+func (r *Relay) prune(ctx context.Context, now time.Time) error {
+	if err := r.store.DeleteOutboxEvents(ctx, now.Add(-r.retention)); err != nil {
+		return fmt.Errorf("failed to prune delivered events: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gc2-yugo/config"
+	"gc2-yugo/entity"
+	"gc2-yugo/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recordingSink keeps the events it gets, failing those fail returns an error for.
+type recordingSink struct {
+	mu     sync.Mutex
+	events []Event
+	fail   func(event Event) error
+}
+
+func (s *recordingSink) Deliver(ctx context.Context, event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		if err := s.fail(event); err != nil {
+			return err
+		}
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *recordingSink) types() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var types []string
+	for _, event := range s.events {
+		types = append(types, event.Type+" "+event.BookID)
+	}
+	return types
+}
+
+// addEvents stores a title per book ID with an added event, then a borrowed event per book.
+func addEvents(t *testing.T, s store.Store, books ...string) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	for _, book := range books {
+		id, err := primitive.ObjectIDFromHex(book)
+		require.NoError(t, err)
+		title := entity.Title{ID: id, Title: "Dune", Author: "Frank Herbert"}
+		require.NoError(t, s.CreateTitle(ctx, &title, nil, NewEvent(entity.EventBookAdded, book, BookData{BookID: book, Title: "Dune"}, now)))
+	}
+	for _, book := range books {
+		loan := entity.BorrowedBooks{BookID: book, UserID: "peter", BorrowedDate: "2024-01-01", ReturnDate: "2024-01-08"}
+		require.NoError(t, s.CreateLoan(ctx, &loan, NewEvent(entity.EventBookBorrowed, book, LoanData{BookID: book}, now)))
+	}
+}
+
+func TestRelayOrderPerBook(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	dune, emma := primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()
+	addEvents(t, s, dune, emma)
+
+	// The first event of dune cannot be delivered, emma's go on
+	down := true
+	sink := &recordingSink{fail: func(event Event) error {
+		if down && event.BookID == dune {
+			return errors.New("connection refused")
+		}
+		return nil
+	}}
+	relay := NewRelay(s, sink, config.Default().Outbox, "replica-1")
+
+	delivered, err := relay.RelayPending(ctx)
+	assert.ErrorContains(t, err, "book.added event 1: connection refused")
+	assert.Equal(t, 2, delivered)
+	assert.Equal(t, []string{"book.added " + emma, "book.borrowed " + emma}, sink.types())
+
+	pending, err := s.ListOutboxEvents(ctx, store.OutboxFilter{Pending: true})
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, 1, pending[0].Attempts)
+	assert.Equal(t, "connection refused", pending[0].LastError)
+	assert.Equal(t, 0, pending[1].Attempts, "held back without an attempt")
+
+	down = false
+	delivered, err = relay.RelayPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, delivered)
+	assert.Equal(t, []string{"book.added " + emma, "book.borrowed " + emma, "book.added " + dune, "book.borrowed " + dune}, sink.types())
+
+	var data BookData
+	require.NoError(t, json.Unmarshal(sink.events[2].Data, &data))
+	assert.Equal(t, BookData{BookID: dune, Title: "Dune"}, data)
+
+	delivered, err = relay.RelayPending(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, delivered)
+}
+
+func TestRelayLease(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	addEvents(t, s, primitive.NewObjectID().Hex())
+
+	// Another replica relays
+	now := time.Now()
+	require.NoError(t, s.AcquireJobLease(ctx, LeaseName, "replica-2", now, now.Add(time.Minute)))
+	sink := &recordingSink{}
+	relay := NewRelay(s, sink, config.Default().Outbox, "replica-1")
+	delivered, err := relay.RelayPending(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, delivered)
+
+	require.NoError(t, s.ReleaseJobLease(ctx, LeaseName, "replica-2"))
+	delivered, err = relay.RelayPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, delivered)
+	lease, err := s.GetJobLease(ctx, LeaseName)
+	require.NoError(t, err)
+	assert.Equal(t, "replica-1", lease.Holder)
+}
+
+func TestRelayStartStop(t *testing.T) {
+	s := store.NewMemoryStore()
+	bus := NewBus()
+	received := make(chan Event, 10)
+	bus.Subscribe(func(ctx context.Context, event Event) error {
+		received <- event
+		return nil
+	})
+
+	cfg := config.Default().Outbox
+	cfg.Interval = 10 * time.Millisecond
+	relay := NewRelay(s, NewSink(cfg, bus), cfg, "replica-1")
+	relay.Start(context.Background())
+
+	book := primitive.NewObjectID().Hex()
+	addEvents(t, s, book)
+	for _, kind := range []string{entity.EventBookAdded, entity.EventBookBorrowed} {
+		select {
+		case event := <-received:
+			assert.Equal(t, kind, event.Type)
+			assert.Equal(t, book, event.BookID)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the relay did not deliver the events")
+		}
+	}
+
+	relay.Stop()
+	_, err := s.GetJobLease(context.Background(), LeaseName)
+	assert.ErrorIs(t, err, store.ErrNotFound, "the lease is freed")
+}
+
+func TestBus(t *testing.T) {
+	ctx := context.Background()
+	bus := NewBus()
+	var first, second []int64
+	unsubscribe := bus.Subscribe(func(ctx context.Context, event Event) error {
+		first = append(first, event.Seq)
+		return nil
+	})
+	bus.Subscribe(func(ctx context.Context, event Event) error {
+		second = append(second, event.Seq)
+		if event.Seq == 2 {
+			return errors.New("busy")
+		}
+		return nil
+	})
+
+	require.NoError(t, bus.Deliver(ctx, Event{Seq: 1}))
+	assert.ErrorContains(t, bus.Deliver(ctx, Event{Seq: 2}), "busy")
+	unsubscribe()
+	require.NoError(t, bus.Deliver(ctx, Event{Seq: 3}))
+	assert.Equal(t, []int64{1, 2}, first)
+	assert.Equal(t, []int64{1, 2, 3}, second)
+}
+
+func TestFanout(t *testing.T) {
+	ctx := context.Background()
+	first := &recordingSink{fail: func(event Event) error {
+		if event.Seq == 2 {
+			return errors.New("busy")
+		}
+		return nil
+	}}
+	second := &recordingSink{}
+	sink := Fanout(first, second)
+
+	require.NoError(t, sink.Deliver(ctx, Event{Seq: 1, Type: entity.EventBookAdded}))
+	assert.ErrorContains(t, sink.Deliver(ctx, Event{Seq: 2, Type: entity.EventHoldReady}), "busy")
+	assert.Len(t, first.events, 1)
+	assert.Len(t, second.events, 2, "every sink gets the event")
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received Event
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, entity.EventBookReturned, r.Header.Get("X-Event-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		assert.Equal(t, received.ID, r.Header.Get("X-Event-ID"))
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(config.WebhookConfig{URL: server.URL, Timeout: time.Second})
+	stored := NewEvent(entity.EventBookReturned, "book-1", LoanData{LoanID: "loan-1", BookID: "book-1", UserID: "peter"}, time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC))
+	stored.ID = primitive.NewObjectID()
+	stored.Seq = 7
+	event := FromEntity(stored)
+	require.NoError(t, sink.Deliver(context.Background(), event))
+	assert.Equal(t, event.ID, received.ID)
+	assert.Equal(t, int64(7), received.Seq)
+	assert.True(t, event.CreatedAt.Equal(received.CreatedAt))
+	assert.JSONEq(t, `{"loan_id":"loan-1","book_id":"book-1","user_id":"peter","borrowed_date":"","due_date":""}`, string(received.Data))
+
+	fail = true
+	assert.ErrorContains(t, sink.Deliver(context.Background(), event), "503")
+}
+
+// natsServer is a NATS server speaking just enough of the protocol to take
+// publishes, refusing subjects starting with denied.
+type natsServer struct {
+	listener net.Listener
+	denied   string
+
+	mu       sync.Mutex
+	messages []string // subject and payload
+}
+
+func newNATSServer(t *testing.T) *natsServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &natsServer{listener: listener, denied: "denied."}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.handle(conn)
+		}
+	}()
+	return server
+}
+
+func (s *natsServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	fmt.Fprint(conn, "INFO {\"server_id\":\"test\"}\r\n")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 3 && fields[0] == "PUB":
+			size, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			if strings.HasPrefix(fields[1], s.denied) {
+				fmt.Fprintf(conn, "-ERR 'Permissions Violation for Publish to %s'\r\n", fields[1])
+				continue
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, fields[1]+" "+string(payload[:size]))
+			s.mu.Unlock()
+		case len(fields) == 1 && fields[0] == "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		}
+	}
+}
+
+func (s *natsServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+func TestNATSPublisher(t *testing.T) {
+	server := newNATSServer(t)
+	publisher := NewNATSPublisher(config.NATSConfig{Address: server.listener.Addr().String(), Timeout: time.Second})
+	defer publisher.Close()
+	sink := NewPublisherSink(publisher, "library.events")
+
+	ctx := context.Background()
+	event := Event{ID: "1", Seq: 1, Type: entity.EventBookAdded, BookID: "book-1", Data: json.RawMessage(`{"book_id":"book-1"}`)}
+	require.NoError(t, sink.Deliver(ctx, event))
+	event.Seq, event.Type = 2, entity.EventBookRemoved
+	require.NoError(t, sink.Deliver(ctx, event))
+
+	received := server.received()
+	require.Len(t, received, 2)
+	subject, payload, _ := strings.Cut(received[0], " ")
+	assert.Equal(t, "library.events.book.added", subject)
+	var decoded Event
+	require.NoError(t, json.Unmarshal([]byte(payload), &decoded))
+	assert.Equal(t, int64(1), decoded.Seq)
+	assert.True(t, strings.HasPrefix(received[1], "library.events.book.removed "))
+
+	// Errors of the server fail the publish, the next one reconnects
+	assert.ErrorContains(t, publisher.Publish(ctx, "denied.subject", "book-1", []byte("{}")), "Permissions Violation")
+	require.NoError(t, publisher.Publish(ctx, "library.events.book.returned", "book-1", []byte("{}")))
+	assert.Len(t, server.received(), 3)
+
+	// A server that is gone fails the publish
+	server.listener.Close()
+	publisher.Close()
+	assert.Error(t, publisher.Publish(ctx, "library.events.book.added", "book-1", []byte("{}")))
+}
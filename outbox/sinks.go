@@ -0,0 +1,142 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gc2-yugo/config"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Handler receives the events of the bus.
+type Handler func(ctx context.Context, event Event) error
+
+// Bus hands events to subscribers in the server process, in the order of their
+// subscriptions. An error of any subscriber fails the delivery, and every
+// subscriber gets the event again.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []*Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe adds the handler and returns the function removing it again.
+func (b *Bus) Subscribe(handler Handler) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subscription := &handler
+	b.handlers = append(b.handlers, subscription)
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, h := range b.handlers {
+			if h == subscription {
+				b.handlers = append(b.handlers[:i:i], b.handlers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (b *Bus) Deliver(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	var failures []error
+	for _, handler := range handlers {
+		if err := (*handler)(ctx, event); err != nil {
+			failures = append(failures, err)
+		}
+	}
+	return errors.Join(failures...)
+}
+
+// Fanout returns a sink delivering each event to every sink, in order. An error
+// of any sink fails the delivery, and every sink gets the event again.
+func Fanout(sinks ...Sink) Sink {
+	return fanout(sinks)
+}
+
+type fanout []Sink
+
+func (f fanout) Deliver(ctx context.Context, event Event) error {
+	var failures []error
+	for _, sink := range f {
+		if err := sink.Deliver(ctx, event); err != nil {
+			failures = append(failures, err)
+		}
+	}
+	return errors.Join(failures...)
+}
+
+// WebhookSink posts each event as JSON to a URL. The X-Event-ID header lets the
+// receiver drop events it already got.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookSink(cfg config.WebhookConfig) *WebhookSink {
+	return &WebhookSink{url: cfg.URL, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+func (s *WebhookSink) Deliver(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", event.ID)
+	req.Header.Set("X-Event-Type", event.Type)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// Publisher publishes messages to a broker, such as NATS or Kafka. The key is the
+// book's ID: brokers partitioning by key, as Kafka does, keep a book's events in order.
+type Publisher interface {
+	Publish(ctx context.Context, subject, key string, data []byte) error
+}
+
+// PublisherSink publishes events as JSON on the subject made of the prefix and the
+// event's type, such as library.events.book.added.
+type PublisherSink struct {
+	publisher Publisher
+	prefix    string
+}
+
+func NewPublisherSink(publisher Publisher, prefix string) *PublisherSink {
+	return &PublisherSink{publisher: publisher, prefix: prefix}
+}
+
+func (s *PublisherSink) Deliver(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.publisher.Publish(ctx, s.prefix+"."+event.Type, event.BookID, payload)
+}
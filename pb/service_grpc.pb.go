@@ -19,14 +19,48 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	BookRentalService_RegisterUser_FullMethodName     = "/bookrental.BookRentalService/RegisterUser"
-	BookRentalService_LoginUser_FullMethodName        = "/bookrental.BookRentalService/LoginUser"
-	BookRentalService_AddBook_FullMethodName          = "/bookrental.BookRentalService/AddBook"
-	BookRentalService_RemoveBook_FullMethodName       = "/bookrental.BookRentalService/RemoveBook"
-	BookRentalService_BorrowBook_FullMethodName       = "/bookrental.BookRentalService/BorrowBook"
-	BookRentalService_ReturnBook_FullMethodName       = "/bookrental.BookRentalService/ReturnBook"
-	BookRentalService_GetBooks_FullMethodName         = "/bookrental.BookRentalService/GetBooks"
-	BookRentalService_GetBorrowedBooks_FullMethodName = "/bookrental.BookRentalService/GetBorrowedBooks"
+	BookRentalService_RegisterUser_FullMethodName                  = "/bookrental.BookRentalService/RegisterUser"
+	BookRentalService_LoginUser_FullMethodName                     = "/bookrental.BookRentalService/LoginUser"
+	BookRentalService_RefreshToken_FullMethodName                  = "/bookrental.BookRentalService/RefreshToken"
+	BookRentalService_Logout_FullMethodName                        = "/bookrental.BookRentalService/Logout"
+	BookRentalService_SetUserRole_FullMethodName                   = "/bookrental.BookRentalService/SetUserRole"
+	BookRentalService_SetUserCategory_FullMethodName               = "/bookrental.BookRentalService/SetUserCategory"
+	BookRentalService_UnlockAccount_FullMethodName                 = "/bookrental.BookRentalService/UnlockAccount"
+	BookRentalService_ListAuditEvents_FullMethodName               = "/bookrental.BookRentalService/ListAuditEvents"
+	BookRentalService_GetJWKS_FullMethodName                       = "/bookrental.BookRentalService/GetJWKS"
+	BookRentalService_AddBook_FullMethodName                       = "/bookrental.BookRentalService/AddBook"
+	BookRentalService_RemoveBook_FullMethodName                    = "/bookrental.BookRentalService/RemoveBook"
+	BookRentalService_BorrowBook_FullMethodName                    = "/bookrental.BookRentalService/BorrowBook"
+	BookRentalService_ReturnBook_FullMethodName                    = "/bookrental.BookRentalService/ReturnBook"
+	BookRentalService_GetBooks_FullMethodName                      = "/bookrental.BookRentalService/GetBooks"
+	BookRentalService_WatchBooks_FullMethodName                    = "/bookrental.BookRentalService/WatchBooks"
+	BookRentalService_AddCopy_FullMethodName                       = "/bookrental.BookRentalService/AddCopy"
+	BookRentalService_UpdateCopy_FullMethodName                    = "/bookrental.BookRentalService/UpdateCopy"
+	BookRentalService_RemoveCopy_FullMethodName                    = "/bookrental.BookRentalService/RemoveCopy"
+	BookRentalService_ListCopies_FullMethodName                    = "/bookrental.BookRentalService/ListCopies"
+	BookRentalService_PlaceHold_FullMethodName                     = "/bookrental.BookRentalService/PlaceHold"
+	BookRentalService_CancelHold_FullMethodName                    = "/bookrental.BookRentalService/CancelHold"
+	BookRentalService_ListHolds_FullMethodName                     = "/bookrental.BookRentalService/ListHolds"
+	BookRentalService_GetBorrowedBooks_FullMethodName              = "/bookrental.BookRentalService/GetBorrowedBooks"
+	BookRentalService_RenewLoan_FullMethodName                     = "/bookrental.BookRentalService/RenewLoan"
+	BookRentalService_GetFeeBalance_FullMethodName                 = "/bookrental.BookRentalService/GetFeeBalance"
+	BookRentalService_ListFeeTransactions_FullMethodName           = "/bookrental.BookRentalService/ListFeeTransactions"
+	BookRentalService_ChargeFee_FullMethodName                     = "/bookrental.BookRentalService/ChargeFee"
+	BookRentalService_RecordPayment_FullMethodName                 = "/bookrental.BookRentalService/RecordPayment"
+	BookRentalService_WaiveFee_FullMethodName                      = "/bookrental.BookRentalService/WaiveFee"
+	BookRentalService_ListJobs_FullMethodName                      = "/bookrental.BookRentalService/ListJobs"
+	BookRentalService_TriggerJob_FullMethodName                    = "/bookrental.BookRentalService/TriggerJob"
+	BookRentalService_PauseJob_FullMethodName                      = "/bookrental.BookRentalService/PauseJob"
+	BookRentalService_ResumeJob_FullMethodName                     = "/bookrental.BookRentalService/ResumeJob"
+	BookRentalService_ListJobRuns_FullMethodName                   = "/bookrental.BookRentalService/ListJobRuns"
+	BookRentalService_GetNotificationPreferences_FullMethodName    = "/bookrental.BookRentalService/GetNotificationPreferences"
+	BookRentalService_UpdateNotificationPreferences_FullMethodName = "/bookrental.BookRentalService/UpdateNotificationPreferences"
+	BookRentalService_ListNotifications_FullMethodName             = "/bookrental.BookRentalService/ListNotifications"
+	BookRentalService_CreateWebhookSubscription_FullMethodName     = "/bookrental.BookRentalService/CreateWebhookSubscription"
+	BookRentalService_ListWebhookSubscriptions_FullMethodName      = "/bookrental.BookRentalService/ListWebhookSubscriptions"
+	BookRentalService_DeleteWebhookSubscription_FullMethodName     = "/bookrental.BookRentalService/DeleteWebhookSubscription"
+	BookRentalService_ListWebhookDeliveries_FullMethodName         = "/bookrental.BookRentalService/ListWebhookDeliveries"
+	BookRentalService_SendTestWebhook_FullMethodName               = "/bookrental.BookRentalService/SendTestWebhook"
 )
 
 // BookRentalServiceClient is the client API for BookRentalService service.
@@ -38,14 +72,54 @@ type BookRentalServiceClient interface {
 	// User-related operations
 	RegisterUser(ctx context.Context, in *RegisterUserRequest, opts ...grpc.CallOption) (*RegisterUserResponse, error)
 	LoginUser(ctx context.Context, in *LoginUserRequest, opts ...grpc.CallOption) (*LoginUserResponse, error)
+	RefreshToken(ctx context.Context, in *RefreshTokenRequest, opts ...grpc.CallOption) (*RefreshTokenResponse, error)
+	Logout(ctx context.Context, in *LogoutRequest, opts ...grpc.CallOption) (*LogoutResponse, error)
+	SetUserRole(ctx context.Context, in *SetUserRoleRequest, opts ...grpc.CallOption) (*SetUserRoleResponse, error)
+	SetUserCategory(ctx context.Context, in *SetUserCategoryRequest, opts ...grpc.CallOption) (*SetUserCategoryResponse, error)
+	UnlockAccount(ctx context.Context, in *UnlockAccountRequest, opts ...grpc.CallOption) (*UnlockAccountResponse, error)
+	ListAuditEvents(ctx context.Context, in *ListAuditEventsRequest, opts ...grpc.CallOption) (*ListAuditEventsResponse, error)
+	GetJWKS(ctx context.Context, in *GetJWKSRequest, opts ...grpc.CallOption) (*GetJWKSResponse, error)
 	// Book-related operations
 	AddBook(ctx context.Context, in *AddBookRequest, opts ...grpc.CallOption) (*BookResponse, error)
 	RemoveBook(ctx context.Context, in *RemoveBookRequest, opts ...grpc.CallOption) (*BookResponse, error)
 	BorrowBook(ctx context.Context, in *BorrowBookRequest, opts ...grpc.CallOption) (*BorrowBookResponse, error)
 	ReturnBook(ctx context.Context, in *ReturnBookRequest, opts ...grpc.CallOption) (*ReturnBookResponse, error)
 	GetBooks(ctx context.Context, in *GetBooksRequest, opts ...grpc.CallOption) (*GetBooksResponse, error)
+	WatchBooks(ctx context.Context, in *WatchBooksRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BookEvent], error)
+	// Copy-related operations, librarians only except ListCopies
+	AddCopy(ctx context.Context, in *AddCopyRequest, opts ...grpc.CallOption) (*CopyResponse, error)
+	UpdateCopy(ctx context.Context, in *UpdateCopyRequest, opts ...grpc.CallOption) (*CopyResponse, error)
+	RemoveCopy(ctx context.Context, in *RemoveCopyRequest, opts ...grpc.CallOption) (*CopyResponse, error)
+	ListCopies(ctx context.Context, in *ListCopiesRequest, opts ...grpc.CallOption) (*ListCopiesResponse, error)
+	// Hold-related operations
+	PlaceHold(ctx context.Context, in *PlaceHoldRequest, opts ...grpc.CallOption) (*HoldResponse, error)
+	CancelHold(ctx context.Context, in *CancelHoldRequest, opts ...grpc.CallOption) (*HoldResponse, error)
+	ListHolds(ctx context.Context, in *ListHoldsRequest, opts ...grpc.CallOption) (*ListHoldsResponse, error)
 	// Borrow-related operations
 	GetBorrowedBooks(ctx context.Context, in *GetBorrowedBooksRequest, opts ...grpc.CallOption) (*GetBorrowedBooksResponse, error)
+	RenewLoan(ctx context.Context, in *RenewLoanRequest, opts ...grpc.CallOption) (*RenewLoanResponse, error)
+	// Fee-related operations, librarians only except the balance and the transactions
+	GetFeeBalance(ctx context.Context, in *GetFeeBalanceRequest, opts ...grpc.CallOption) (*GetFeeBalanceResponse, error)
+	ListFeeTransactions(ctx context.Context, in *ListFeeTransactionsRequest, opts ...grpc.CallOption) (*ListFeeTransactionsResponse, error)
+	ChargeFee(ctx context.Context, in *ChargeFeeRequest, opts ...grpc.CallOption) (*FeeTransactionResponse, error)
+	RecordPayment(ctx context.Context, in *RecordPaymentRequest, opts ...grpc.CallOption) (*FeeTransactionResponse, error)
+	WaiveFee(ctx context.Context, in *WaiveFeeRequest, opts ...grpc.CallOption) (*FeeTransactionResponse, error)
+	// Scheduled job operations, admins only
+	ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error)
+	TriggerJob(ctx context.Context, in *TriggerJobRequest, opts ...grpc.CallOption) (*TriggerJobResponse, error)
+	PauseJob(ctx context.Context, in *PauseJobRequest, opts ...grpc.CallOption) (*JobResponse, error)
+	ResumeJob(ctx context.Context, in *ResumeJobRequest, opts ...grpc.CallOption) (*JobResponse, error)
+	ListJobRuns(ctx context.Context, in *ListJobRunsRequest, opts ...grpc.CallOption) (*ListJobRunsResponse, error)
+	// Notification operations, on the caller's own preferences and notifications
+	GetNotificationPreferences(ctx context.Context, in *GetNotificationPreferencesRequest, opts ...grpc.CallOption) (*NotificationPreferencesResponse, error)
+	UpdateNotificationPreferences(ctx context.Context, in *UpdateNotificationPreferencesRequest, opts ...grpc.CallOption) (*NotificationPreferencesResponse, error)
+	ListNotifications(ctx context.Context, in *ListNotificationsRequest, opts ...grpc.CallOption) (*ListNotificationsResponse, error)
+	// Webhook subscription operations, admins only
+	CreateWebhookSubscription(ctx context.Context, in *CreateWebhookSubscriptionRequest, opts ...grpc.CallOption) (*WebhookSubscriptionResponse, error)
+	ListWebhookSubscriptions(ctx context.Context, in *ListWebhookSubscriptionsRequest, opts ...grpc.CallOption) (*ListWebhookSubscriptionsResponse, error)
+	DeleteWebhookSubscription(ctx context.Context, in *DeleteWebhookSubscriptionRequest, opts ...grpc.CallOption) (*WebhookSubscriptionResponse, error)
+	ListWebhookDeliveries(ctx context.Context, in *ListWebhookDeliveriesRequest, opts ...grpc.CallOption) (*ListWebhookDeliveriesResponse, error)
+	SendTestWebhook(ctx context.Context, in *SendTestWebhookRequest, opts ...grpc.CallOption) (*SendTestWebhookResponse, error)
 }
 
 type bookRentalServiceClient struct {
@@ -76,6 +150,76 @@ func (c *bookRentalServiceClient) LoginUser(ctx context.Context, in *LoginUserRe
 	return out, nil
 }
 
+func (c *bookRentalServiceClient) RefreshToken(ctx context.Context, in *RefreshTokenRequest, opts ...grpc.CallOption) (*RefreshTokenResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RefreshTokenResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_RefreshToken_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) Logout(ctx context.Context, in *LogoutRequest, opts ...grpc.CallOption) (*LogoutResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LogoutResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_Logout_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) SetUserRole(ctx context.Context, in *SetUserRoleRequest, opts ...grpc.CallOption) (*SetUserRoleResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetUserRoleResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_SetUserRole_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) SetUserCategory(ctx context.Context, in *SetUserCategoryRequest, opts ...grpc.CallOption) (*SetUserCategoryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetUserCategoryResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_SetUserCategory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) UnlockAccount(ctx context.Context, in *UnlockAccountRequest, opts ...grpc.CallOption) (*UnlockAccountResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UnlockAccountResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_UnlockAccount_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) ListAuditEvents(ctx context.Context, in *ListAuditEventsRequest, opts ...grpc.CallOption) (*ListAuditEventsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListAuditEventsResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_ListAuditEvents_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) GetJWKS(ctx context.Context, in *GetJWKSRequest, opts ...grpc.CallOption) (*GetJWKSResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetJWKSResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_GetJWKS_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *bookRentalServiceClient) AddBook(ctx context.Context, in *AddBookRequest, opts ...grpc.CallOption) (*BookResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(BookResponse)
@@ -83,271 +227,1297 @@ func (c *bookRentalServiceClient) AddBook(ctx context.Context, in *AddBookReques
 	if err != nil {
 		return nil, err
 	}
-	return out, nil
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) RemoveBook(ctx context.Context, in *RemoveBookRequest, opts ...grpc.CallOption) (*BookResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BookResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_RemoveBook_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) BorrowBook(ctx context.Context, in *BorrowBookRequest, opts ...grpc.CallOption) (*BorrowBookResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BorrowBookResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_BorrowBook_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) ReturnBook(ctx context.Context, in *ReturnBookRequest, opts ...grpc.CallOption) (*ReturnBookResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReturnBookResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_ReturnBook_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) GetBooks(ctx context.Context, in *GetBooksRequest, opts ...grpc.CallOption) (*GetBooksResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetBooksResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_GetBooks_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) WatchBooks(ctx context.Context, in *WatchBooksRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BookEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &BookRentalService_ServiceDesc.Streams[0], BookRentalService_WatchBooks_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchBooksRequest, BookEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type BookRentalService_WatchBooksClient = grpc.ServerStreamingClient[BookEvent]
+
+func (c *bookRentalServiceClient) AddCopy(ctx context.Context, in *AddCopyRequest, opts ...grpc.CallOption) (*CopyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CopyResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_AddCopy_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) UpdateCopy(ctx context.Context, in *UpdateCopyRequest, opts ...grpc.CallOption) (*CopyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CopyResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_UpdateCopy_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) RemoveCopy(ctx context.Context, in *RemoveCopyRequest, opts ...grpc.CallOption) (*CopyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CopyResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_RemoveCopy_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) ListCopies(ctx context.Context, in *ListCopiesRequest, opts ...grpc.CallOption) (*ListCopiesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListCopiesResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_ListCopies_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) PlaceHold(ctx context.Context, in *PlaceHoldRequest, opts ...grpc.CallOption) (*HoldResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HoldResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_PlaceHold_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) CancelHold(ctx context.Context, in *CancelHoldRequest, opts ...grpc.CallOption) (*HoldResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HoldResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_CancelHold_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) ListHolds(ctx context.Context, in *ListHoldsRequest, opts ...grpc.CallOption) (*ListHoldsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListHoldsResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_ListHolds_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) GetBorrowedBooks(ctx context.Context, in *GetBorrowedBooksRequest, opts ...grpc.CallOption) (*GetBorrowedBooksResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetBorrowedBooksResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_GetBorrowedBooks_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) RenewLoan(ctx context.Context, in *RenewLoanRequest, opts ...grpc.CallOption) (*RenewLoanResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RenewLoanResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_RenewLoan_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) GetFeeBalance(ctx context.Context, in *GetFeeBalanceRequest, opts ...grpc.CallOption) (*GetFeeBalanceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetFeeBalanceResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_GetFeeBalance_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) ListFeeTransactions(ctx context.Context, in *ListFeeTransactionsRequest, opts ...grpc.CallOption) (*ListFeeTransactionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListFeeTransactionsResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_ListFeeTransactions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) ChargeFee(ctx context.Context, in *ChargeFeeRequest, opts ...grpc.CallOption) (*FeeTransactionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FeeTransactionResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_ChargeFee_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) RecordPayment(ctx context.Context, in *RecordPaymentRequest, opts ...grpc.CallOption) (*FeeTransactionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FeeTransactionResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_RecordPayment_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) WaiveFee(ctx context.Context, in *WaiveFeeRequest, opts ...grpc.CallOption) (*FeeTransactionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FeeTransactionResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_WaiveFee_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListJobsResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_ListJobs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) TriggerJob(ctx context.Context, in *TriggerJobRequest, opts ...grpc.CallOption) (*TriggerJobResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TriggerJobResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_TriggerJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) PauseJob(ctx context.Context, in *PauseJobRequest, opts ...grpc.CallOption) (*JobResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(JobResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_PauseJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) ResumeJob(ctx context.Context, in *ResumeJobRequest, opts ...grpc.CallOption) (*JobResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(JobResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_ResumeJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) ListJobRuns(ctx context.Context, in *ListJobRunsRequest, opts ...grpc.CallOption) (*ListJobRunsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListJobRunsResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_ListJobRuns_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) GetNotificationPreferences(ctx context.Context, in *GetNotificationPreferencesRequest, opts ...grpc.CallOption) (*NotificationPreferencesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(NotificationPreferencesResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_GetNotificationPreferences_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) UpdateNotificationPreferences(ctx context.Context, in *UpdateNotificationPreferencesRequest, opts ...grpc.CallOption) (*NotificationPreferencesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(NotificationPreferencesResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_UpdateNotificationPreferences_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) ListNotifications(ctx context.Context, in *ListNotificationsRequest, opts ...grpc.CallOption) (*ListNotificationsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListNotificationsResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_ListNotifications_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) CreateWebhookSubscription(ctx context.Context, in *CreateWebhookSubscriptionRequest, opts ...grpc.CallOption) (*WebhookSubscriptionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WebhookSubscriptionResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_CreateWebhookSubscription_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) ListWebhookSubscriptions(ctx context.Context, in *ListWebhookSubscriptionsRequest, opts ...grpc.CallOption) (*ListWebhookSubscriptionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListWebhookSubscriptionsResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_ListWebhookSubscriptions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) DeleteWebhookSubscription(ctx context.Context, in *DeleteWebhookSubscriptionRequest, opts ...grpc.CallOption) (*WebhookSubscriptionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WebhookSubscriptionResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_DeleteWebhookSubscription_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) ListWebhookDeliveries(ctx context.Context, in *ListWebhookDeliveriesRequest, opts ...grpc.CallOption) (*ListWebhookDeliveriesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListWebhookDeliveriesResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_ListWebhookDeliveries_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bookRentalServiceClient) SendTestWebhook(ctx context.Context, in *SendTestWebhookRequest, opts ...grpc.CallOption) (*SendTestWebhookResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SendTestWebhookResponse)
+	err := c.cc.Invoke(ctx, BookRentalService_SendTestWebhook_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BookRentalServiceServer is the server API for BookRentalService service.
+// All implementations must embed UnimplementedBookRentalServiceServer
+// for forward compatibility.
+//
+// Define the gRPC service
+type BookRentalServiceServer interface {
+	// User-related operations
+	RegisterUser(context.Context, *RegisterUserRequest) (*RegisterUserResponse, error)
+	LoginUser(context.Context, *LoginUserRequest) (*LoginUserResponse, error)
+	RefreshToken(context.Context, *RefreshTokenRequest) (*RefreshTokenResponse, error)
+	Logout(context.Context, *LogoutRequest) (*LogoutResponse, error)
+	SetUserRole(context.Context, *SetUserRoleRequest) (*SetUserRoleResponse, error)
+	SetUserCategory(context.Context, *SetUserCategoryRequest) (*SetUserCategoryResponse, error)
+	UnlockAccount(context.Context, *UnlockAccountRequest) (*UnlockAccountResponse, error)
+	ListAuditEvents(context.Context, *ListAuditEventsRequest) (*ListAuditEventsResponse, error)
+	GetJWKS(context.Context, *GetJWKSRequest) (*GetJWKSResponse, error)
+	// Book-related operations
+	AddBook(context.Context, *AddBookRequest) (*BookResponse, error)
+	RemoveBook(context.Context, *RemoveBookRequest) (*BookResponse, error)
+	BorrowBook(context.Context, *BorrowBookRequest) (*BorrowBookResponse, error)
+	ReturnBook(context.Context, *ReturnBookRequest) (*ReturnBookResponse, error)
+	GetBooks(context.Context, *GetBooksRequest) (*GetBooksResponse, error)
+	WatchBooks(*WatchBooksRequest, grpc.ServerStreamingServer[BookEvent]) error
+	// Copy-related operations, librarians only except ListCopies
+	AddCopy(context.Context, *AddCopyRequest) (*CopyResponse, error)
+	UpdateCopy(context.Context, *UpdateCopyRequest) (*CopyResponse, error)
+	RemoveCopy(context.Context, *RemoveCopyRequest) (*CopyResponse, error)
+	ListCopies(context.Context, *ListCopiesRequest) (*ListCopiesResponse, error)
+	// Hold-related operations
+	PlaceHold(context.Context, *PlaceHoldRequest) (*HoldResponse, error)
+	CancelHold(context.Context, *CancelHoldRequest) (*HoldResponse, error)
+	ListHolds(context.Context, *ListHoldsRequest) (*ListHoldsResponse, error)
+	// Borrow-related operations
+	GetBorrowedBooks(context.Context, *GetBorrowedBooksRequest) (*GetBorrowedBooksResponse, error)
+	RenewLoan(context.Context, *RenewLoanRequest) (*RenewLoanResponse, error)
+	// Fee-related operations, librarians only except the balance and the transactions
+	GetFeeBalance(context.Context, *GetFeeBalanceRequest) (*GetFeeBalanceResponse, error)
+	ListFeeTransactions(context.Context, *ListFeeTransactionsRequest) (*ListFeeTransactionsResponse, error)
+	ChargeFee(context.Context, *ChargeFeeRequest) (*FeeTransactionResponse, error)
+	RecordPayment(context.Context, *RecordPaymentRequest) (*FeeTransactionResponse, error)
+	WaiveFee(context.Context, *WaiveFeeRequest) (*FeeTransactionResponse, error)
+	// Scheduled job operations, admins only
+	ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error)
+	TriggerJob(context.Context, *TriggerJobRequest) (*TriggerJobResponse, error)
+	PauseJob(context.Context, *PauseJobRequest) (*JobResponse, error)
+	ResumeJob(context.Context, *ResumeJobRequest) (*JobResponse, error)
+	ListJobRuns(context.Context, *ListJobRunsRequest) (*ListJobRunsResponse, error)
+	// Notification operations, on the caller's own preferences and notifications
+	GetNotificationPreferences(context.Context, *GetNotificationPreferencesRequest) (*NotificationPreferencesResponse, error)
+	UpdateNotificationPreferences(context.Context, *UpdateNotificationPreferencesRequest) (*NotificationPreferencesResponse, error)
+	ListNotifications(context.Context, *ListNotificationsRequest) (*ListNotificationsResponse, error)
+	// Webhook subscription operations, admins only
+	CreateWebhookSubscription(context.Context, *CreateWebhookSubscriptionRequest) (*WebhookSubscriptionResponse, error)
+	ListWebhookSubscriptions(context.Context, *ListWebhookSubscriptionsRequest) (*ListWebhookSubscriptionsResponse, error)
+	DeleteWebhookSubscription(context.Context, *DeleteWebhookSubscriptionRequest) (*WebhookSubscriptionResponse, error)
+	ListWebhookDeliveries(context.Context, *ListWebhookDeliveriesRequest) (*ListWebhookDeliveriesResponse, error)
+	SendTestWebhook(context.Context, *SendTestWebhookRequest) (*SendTestWebhookResponse, error)
+	mustEmbedUnimplementedBookRentalServiceServer()
+}
+
+// UnimplementedBookRentalServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedBookRentalServiceServer struct{}
+
+func (UnimplementedBookRentalServiceServer) RegisterUser(context.Context, *RegisterUserRequest) (*RegisterUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterUser not implemented")
+}
+func (UnimplementedBookRentalServiceServer) LoginUser(context.Context, *LoginUserRequest) (*LoginUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LoginUser not implemented")
+}
+func (UnimplementedBookRentalServiceServer) RefreshToken(context.Context, *RefreshTokenRequest) (*RefreshTokenResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RefreshToken not implemented")
+}
+func (UnimplementedBookRentalServiceServer) Logout(context.Context, *LogoutRequest) (*LogoutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Logout not implemented")
+}
+func (UnimplementedBookRentalServiceServer) SetUserRole(context.Context, *SetUserRoleRequest) (*SetUserRoleResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetUserRole not implemented")
+}
+func (UnimplementedBookRentalServiceServer) SetUserCategory(context.Context, *SetUserCategoryRequest) (*SetUserCategoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetUserCategory not implemented")
+}
+func (UnimplementedBookRentalServiceServer) UnlockAccount(context.Context, *UnlockAccountRequest) (*UnlockAccountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnlockAccount not implemented")
+}
+func (UnimplementedBookRentalServiceServer) ListAuditEvents(context.Context, *ListAuditEventsRequest) (*ListAuditEventsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAuditEvents not implemented")
+}
+func (UnimplementedBookRentalServiceServer) GetJWKS(context.Context, *GetJWKSRequest) (*GetJWKSResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJWKS not implemented")
+}
+func (UnimplementedBookRentalServiceServer) AddBook(context.Context, *AddBookRequest) (*BookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddBook not implemented")
+}
+func (UnimplementedBookRentalServiceServer) RemoveBook(context.Context, *RemoveBookRequest) (*BookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveBook not implemented")
+}
+func (UnimplementedBookRentalServiceServer) BorrowBook(context.Context, *BorrowBookRequest) (*BorrowBookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BorrowBook not implemented")
+}
+func (UnimplementedBookRentalServiceServer) ReturnBook(context.Context, *ReturnBookRequest) (*ReturnBookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReturnBook not implemented")
+}
+func (UnimplementedBookRentalServiceServer) GetBooks(context.Context, *GetBooksRequest) (*GetBooksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBooks not implemented")
+}
+func (UnimplementedBookRentalServiceServer) WatchBooks(*WatchBooksRequest, grpc.ServerStreamingServer[BookEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchBooks not implemented")
+}
+func (UnimplementedBookRentalServiceServer) AddCopy(context.Context, *AddCopyRequest) (*CopyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddCopy not implemented")
+}
+func (UnimplementedBookRentalServiceServer) UpdateCopy(context.Context, *UpdateCopyRequest) (*CopyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateCopy not implemented")
+}
+func (UnimplementedBookRentalServiceServer) RemoveCopy(context.Context, *RemoveCopyRequest) (*CopyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveCopy not implemented")
+}
+func (UnimplementedBookRentalServiceServer) ListCopies(context.Context, *ListCopiesRequest) (*ListCopiesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListCopies not implemented")
+}
+func (UnimplementedBookRentalServiceServer) PlaceHold(context.Context, *PlaceHoldRequest) (*HoldResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PlaceHold not implemented")
+}
+func (UnimplementedBookRentalServiceServer) CancelHold(context.Context, *CancelHoldRequest) (*HoldResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelHold not implemented")
+}
+func (UnimplementedBookRentalServiceServer) ListHolds(context.Context, *ListHoldsRequest) (*ListHoldsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListHolds not implemented")
+}
+func (UnimplementedBookRentalServiceServer) GetBorrowedBooks(context.Context, *GetBorrowedBooksRequest) (*GetBorrowedBooksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBorrowedBooks not implemented")
+}
+func (UnimplementedBookRentalServiceServer) RenewLoan(context.Context, *RenewLoanRequest) (*RenewLoanResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RenewLoan not implemented")
+}
+func (UnimplementedBookRentalServiceServer) GetFeeBalance(context.Context, *GetFeeBalanceRequest) (*GetFeeBalanceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFeeBalance not implemented")
+}
+func (UnimplementedBookRentalServiceServer) ListFeeTransactions(context.Context, *ListFeeTransactionsRequest) (*ListFeeTransactionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFeeTransactions not implemented")
+}
+func (UnimplementedBookRentalServiceServer) ChargeFee(context.Context, *ChargeFeeRequest) (*FeeTransactionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChargeFee not implemented")
+}
+func (UnimplementedBookRentalServiceServer) RecordPayment(context.Context, *RecordPaymentRequest) (*FeeTransactionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RecordPayment not implemented")
+}
+func (UnimplementedBookRentalServiceServer) WaiveFee(context.Context, *WaiveFeeRequest) (*FeeTransactionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WaiveFee not implemented")
+}
+func (UnimplementedBookRentalServiceServer) ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListJobs not implemented")
+}
+func (UnimplementedBookRentalServiceServer) TriggerJob(context.Context, *TriggerJobRequest) (*TriggerJobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TriggerJob not implemented")
+}
+func (UnimplementedBookRentalServiceServer) PauseJob(context.Context, *PauseJobRequest) (*JobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PauseJob not implemented")
+}
+func (UnimplementedBookRentalServiceServer) ResumeJob(context.Context, *ResumeJobRequest) (*JobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResumeJob not implemented")
+}
+func (UnimplementedBookRentalServiceServer) ListJobRuns(context.Context, *ListJobRunsRequest) (*ListJobRunsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListJobRuns not implemented")
+}
+func (UnimplementedBookRentalServiceServer) GetNotificationPreferences(context.Context, *GetNotificationPreferencesRequest) (*NotificationPreferencesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNotificationPreferences not implemented")
+}
+func (UnimplementedBookRentalServiceServer) UpdateNotificationPreferences(context.Context, *UpdateNotificationPreferencesRequest) (*NotificationPreferencesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateNotificationPreferences not implemented")
+}
+func (UnimplementedBookRentalServiceServer) ListNotifications(context.Context, *ListNotificationsRequest) (*ListNotificationsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListNotifications not implemented")
+}
+func (UnimplementedBookRentalServiceServer) CreateWebhookSubscription(context.Context, *CreateWebhookSubscriptionRequest) (*WebhookSubscriptionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateWebhookSubscription not implemented")
+}
+func (UnimplementedBookRentalServiceServer) ListWebhookSubscriptions(context.Context, *ListWebhookSubscriptionsRequest) (*ListWebhookSubscriptionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWebhookSubscriptions not implemented")
+}
+func (UnimplementedBookRentalServiceServer) DeleteWebhookSubscription(context.Context, *DeleteWebhookSubscriptionRequest) (*WebhookSubscriptionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteWebhookSubscription not implemented")
+}
+func (UnimplementedBookRentalServiceServer) ListWebhookDeliveries(context.Context, *ListWebhookDeliveriesRequest) (*ListWebhookDeliveriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWebhookDeliveries not implemented")
+}
+func (UnimplementedBookRentalServiceServer) SendTestWebhook(context.Context, *SendTestWebhookRequest) (*SendTestWebhookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendTestWebhook not implemented")
+}
+func (UnimplementedBookRentalServiceServer) mustEmbedUnimplementedBookRentalServiceServer() {}
+func (UnimplementedBookRentalServiceServer) testEmbeddedByValue()                           {}
+
+// UnsafeBookRentalServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BookRentalServiceServer will
+// result in compilation errors.
+type UnsafeBookRentalServiceServer interface {
+	mustEmbedUnimplementedBookRentalServiceServer()
+}
+
+func RegisterBookRentalServiceServer(s grpc.ServiceRegistrar, srv BookRentalServiceServer) {
+	// If the following call pancis, it indicates UnimplementedBookRentalServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&BookRentalService_ServiceDesc, srv)
+}
+
+func _BookRentalService_RegisterUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).RegisterUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_RegisterUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).RegisterUser(ctx, req.(*RegisterUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_LoginUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoginUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).LoginUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_LoginUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).LoginUser(ctx, req.(*LoginUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_RefreshToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RefreshTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).RefreshToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_RefreshToken_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).RefreshToken(ctx, req.(*RefreshTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_Logout_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LogoutRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).Logout(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_Logout_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).Logout(ctx, req.(*LogoutRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_SetUserRole_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetUserRoleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).SetUserRole(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_SetUserRole_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).SetUserRole(ctx, req.(*SetUserRoleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_SetUserCategory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetUserCategoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).SetUserCategory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_SetUserCategory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).SetUserCategory(ctx, req.(*SetUserCategoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_UnlockAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnlockAccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).UnlockAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_UnlockAccount_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).UnlockAccount(ctx, req.(*UnlockAccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_ListAuditEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAuditEventsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).ListAuditEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_ListAuditEvents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).ListAuditEvents(ctx, req.(*ListAuditEventsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_GetJWKS_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJWKSRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).GetJWKS(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_GetJWKS_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).GetJWKS(ctx, req.(*GetJWKSRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_AddBook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddBookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).AddBook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_AddBook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).AddBook(ctx, req.(*AddBookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_RemoveBook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveBookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).RemoveBook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_RemoveBook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).RemoveBook(ctx, req.(*RemoveBookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_BorrowBook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BorrowBookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).BorrowBook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_BorrowBook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).BorrowBook(ctx, req.(*BorrowBookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_ReturnBook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReturnBookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).ReturnBook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_ReturnBook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).ReturnBook(ctx, req.(*ReturnBookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_GetBooks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBooksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).GetBooks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_GetBooks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).GetBooks(ctx, req.(*GetBooksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_WatchBooks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchBooksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BookRentalServiceServer).WatchBooks(m, &grpc.GenericServerStream[WatchBooksRequest, BookEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type BookRentalService_WatchBooksServer = grpc.ServerStreamingServer[BookEvent]
+
+func _BookRentalService_AddCopy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddCopyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).AddCopy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_AddCopy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).AddCopy(ctx, req.(*AddCopyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_UpdateCopy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateCopyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).UpdateCopy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_UpdateCopy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).UpdateCopy(ctx, req.(*UpdateCopyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_RemoveCopy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveCopyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).RemoveCopy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_RemoveCopy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).RemoveCopy(ctx, req.(*RemoveCopyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_ListCopies_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListCopiesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).ListCopies(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_ListCopies_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).ListCopies(ctx, req.(*ListCopiesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_PlaceHold_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PlaceHoldRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).PlaceHold(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_PlaceHold_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).PlaceHold(ctx, req.(*PlaceHoldRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_CancelHold_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelHoldRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).CancelHold(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_CancelHold_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).CancelHold(ctx, req.(*CancelHoldRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_ListHolds_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListHoldsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).ListHolds(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_ListHolds_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).ListHolds(ctx, req.(*ListHoldsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_GetBorrowedBooks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBorrowedBooksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).GetBorrowedBooks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_GetBorrowedBooks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).GetBorrowedBooks(ctx, req.(*GetBorrowedBooksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_RenewLoan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenewLoanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).RenewLoan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_RenewLoan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).RenewLoan(ctx, req.(*RenewLoanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_GetFeeBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetFeeBalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).GetFeeBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_GetFeeBalance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).GetFeeBalance(ctx, req.(*GetFeeBalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_ListFeeTransactions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFeeTransactionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).ListFeeTransactions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_ListFeeTransactions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).ListFeeTransactions(ctx, req.(*ListFeeTransactionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_ChargeFee_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChargeFeeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).ChargeFee(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_ChargeFee_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).ChargeFee(ctx, req.(*ChargeFeeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_RecordPayment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecordPaymentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).RecordPayment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_RecordPayment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).RecordPayment(ctx, req.(*RecordPaymentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BookRentalService_WaiveFee_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WaiveFeeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).WaiveFee(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_WaiveFee_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).WaiveFee(ctx, req.(*WaiveFeeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (c *bookRentalServiceClient) RemoveBook(ctx context.Context, in *RemoveBookRequest, opts ...grpc.CallOption) (*BookResponse, error) {
-	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	out := new(BookResponse)
-	err := c.cc.Invoke(ctx, BookRentalService_RemoveBook_FullMethodName, in, out, cOpts...)
-	if err != nil {
+func _BookRentalService_ListJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListJobsRequest)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return out, nil
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).ListJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_ListJobs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).ListJobs(ctx, req.(*ListJobsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (c *bookRentalServiceClient) BorrowBook(ctx context.Context, in *BorrowBookRequest, opts ...grpc.CallOption) (*BorrowBookResponse, error) {
-	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	out := new(BorrowBookResponse)
-	err := c.cc.Invoke(ctx, BookRentalService_BorrowBook_FullMethodName, in, out, cOpts...)
-	if err != nil {
+func _BookRentalService_TriggerJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TriggerJobRequest)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return out, nil
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).TriggerJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_TriggerJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).TriggerJob(ctx, req.(*TriggerJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (c *bookRentalServiceClient) ReturnBook(ctx context.Context, in *ReturnBookRequest, opts ...grpc.CallOption) (*ReturnBookResponse, error) {
-	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	out := new(ReturnBookResponse)
-	err := c.cc.Invoke(ctx, BookRentalService_ReturnBook_FullMethodName, in, out, cOpts...)
-	if err != nil {
+func _BookRentalService_PauseJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PauseJobRequest)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return out, nil
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).PauseJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_PauseJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).PauseJob(ctx, req.(*PauseJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (c *bookRentalServiceClient) GetBooks(ctx context.Context, in *GetBooksRequest, opts ...grpc.CallOption) (*GetBooksResponse, error) {
-	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	out := new(GetBooksResponse)
-	err := c.cc.Invoke(ctx, BookRentalService_GetBooks_FullMethodName, in, out, cOpts...)
-	if err != nil {
+func _BookRentalService_ResumeJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResumeJobRequest)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return out, nil
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).ResumeJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_ResumeJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).ResumeJob(ctx, req.(*ResumeJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (c *bookRentalServiceClient) GetBorrowedBooks(ctx context.Context, in *GetBorrowedBooksRequest, opts ...grpc.CallOption) (*GetBorrowedBooksResponse, error) {
-	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	out := new(GetBorrowedBooksResponse)
-	err := c.cc.Invoke(ctx, BookRentalService_GetBorrowedBooks_FullMethodName, in, out, cOpts...)
-	if err != nil {
+func _BookRentalService_ListJobRuns_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListJobRunsRequest)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return out, nil
-}
-
-// BookRentalServiceServer is the server API for BookRentalService service.
-// All implementations must embed UnimplementedBookRentalServiceServer
-// for forward compatibility.
-//
-// Define the gRPC service
-type BookRentalServiceServer interface {
-	// User-related operations
-	RegisterUser(context.Context, *RegisterUserRequest) (*RegisterUserResponse, error)
-	LoginUser(context.Context, *LoginUserRequest) (*LoginUserResponse, error)
-	// Book-related operations
-	AddBook(context.Context, *AddBookRequest) (*BookResponse, error)
-	RemoveBook(context.Context, *RemoveBookRequest) (*BookResponse, error)
-	BorrowBook(context.Context, *BorrowBookRequest) (*BorrowBookResponse, error)
-	ReturnBook(context.Context, *ReturnBookRequest) (*ReturnBookResponse, error)
-	GetBooks(context.Context, *GetBooksRequest) (*GetBooksResponse, error)
-	// Borrow-related operations
-	GetBorrowedBooks(context.Context, *GetBorrowedBooksRequest) (*GetBorrowedBooksResponse, error)
-	mustEmbedUnimplementedBookRentalServiceServer()
-}
-
-// UnimplementedBookRentalServiceServer must be embedded to have
-// forward compatible implementations.
-//
-// NOTE: this should be embedded by value instead of pointer to avoid a nil
-// pointer dereference when methods are called.
-type UnimplementedBookRentalServiceServer struct{}
-
-func (UnimplementedBookRentalServiceServer) RegisterUser(context.Context, *RegisterUserRequest) (*RegisterUserResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method RegisterUser not implemented")
-}
-func (UnimplementedBookRentalServiceServer) LoginUser(context.Context, *LoginUserRequest) (*LoginUserResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method LoginUser not implemented")
-}
-func (UnimplementedBookRentalServiceServer) AddBook(context.Context, *AddBookRequest) (*BookResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method AddBook not implemented")
-}
-func (UnimplementedBookRentalServiceServer) RemoveBook(context.Context, *RemoveBookRequest) (*BookResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method RemoveBook not implemented")
-}
-func (UnimplementedBookRentalServiceServer) BorrowBook(context.Context, *BorrowBookRequest) (*BorrowBookResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method BorrowBook not implemented")
-}
-func (UnimplementedBookRentalServiceServer) ReturnBook(context.Context, *ReturnBookRequest) (*ReturnBookResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method ReturnBook not implemented")
-}
-func (UnimplementedBookRentalServiceServer) GetBooks(context.Context, *GetBooksRequest) (*GetBooksResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method GetBooks not implemented")
-}
-func (UnimplementedBookRentalServiceServer) GetBorrowedBooks(context.Context, *GetBorrowedBooksRequest) (*GetBorrowedBooksResponse, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method GetBorrowedBooks not implemented")
-}
-func (UnimplementedBookRentalServiceServer) mustEmbedUnimplementedBookRentalServiceServer() {}
-func (UnimplementedBookRentalServiceServer) testEmbeddedByValue()                           {}
-
-// UnsafeBookRentalServiceServer may be embedded to opt out of forward compatibility for this service.
-// Use of this interface is not recommended, as added methods to BookRentalServiceServer will
-// result in compilation errors.
-type UnsafeBookRentalServiceServer interface {
-	mustEmbedUnimplementedBookRentalServiceServer()
-}
-
-func RegisterBookRentalServiceServer(s grpc.ServiceRegistrar, srv BookRentalServiceServer) {
-	// If the following call pancis, it indicates UnimplementedBookRentalServiceServer was
-	// embedded by pointer and is nil.  This will cause panics if an
-	// unimplemented method is ever invoked, so we test this at initialization
-	// time to prevent it from happening at runtime later due to I/O.
-	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
-		t.testEmbeddedByValue()
+	if interceptor == nil {
+		return srv.(BookRentalServiceServer).ListJobRuns(ctx, in)
 	}
-	s.RegisterService(&BookRentalService_ServiceDesc, srv)
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BookRentalService_ListJobRuns_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BookRentalServiceServer).ListJobRuns(ctx, req.(*ListJobRunsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func _BookRentalService_RegisterUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(RegisterUserRequest)
+func _BookRentalService_GetNotificationPreferences_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetNotificationPreferencesRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(BookRentalServiceServer).RegisterUser(ctx, in)
+		return srv.(BookRentalServiceServer).GetNotificationPreferences(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: BookRentalService_RegisterUser_FullMethodName,
+		FullMethod: BookRentalService_GetNotificationPreferences_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(BookRentalServiceServer).RegisterUser(ctx, req.(*RegisterUserRequest))
+		return srv.(BookRentalServiceServer).GetNotificationPreferences(ctx, req.(*GetNotificationPreferencesRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _BookRentalService_LoginUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(LoginUserRequest)
+func _BookRentalService_UpdateNotificationPreferences_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateNotificationPreferencesRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(BookRentalServiceServer).LoginUser(ctx, in)
+		return srv.(BookRentalServiceServer).UpdateNotificationPreferences(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: BookRentalService_LoginUser_FullMethodName,
+		FullMethod: BookRentalService_UpdateNotificationPreferences_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(BookRentalServiceServer).LoginUser(ctx, req.(*LoginUserRequest))
+		return srv.(BookRentalServiceServer).UpdateNotificationPreferences(ctx, req.(*UpdateNotificationPreferencesRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _BookRentalService_AddBook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(AddBookRequest)
+func _BookRentalService_ListNotifications_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListNotificationsRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(BookRentalServiceServer).AddBook(ctx, in)
+		return srv.(BookRentalServiceServer).ListNotifications(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: BookRentalService_AddBook_FullMethodName,
+		FullMethod: BookRentalService_ListNotifications_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(BookRentalServiceServer).AddBook(ctx, req.(*AddBookRequest))
+		return srv.(BookRentalServiceServer).ListNotifications(ctx, req.(*ListNotificationsRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _BookRentalService_RemoveBook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(RemoveBookRequest)
+func _BookRentalService_CreateWebhookSubscription_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateWebhookSubscriptionRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(BookRentalServiceServer).RemoveBook(ctx, in)
+		return srv.(BookRentalServiceServer).CreateWebhookSubscription(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: BookRentalService_RemoveBook_FullMethodName,
+		FullMethod: BookRentalService_CreateWebhookSubscription_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(BookRentalServiceServer).RemoveBook(ctx, req.(*RemoveBookRequest))
+		return srv.(BookRentalServiceServer).CreateWebhookSubscription(ctx, req.(*CreateWebhookSubscriptionRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _BookRentalService_BorrowBook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(BorrowBookRequest)
+func _BookRentalService_ListWebhookSubscriptions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWebhookSubscriptionsRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(BookRentalServiceServer).BorrowBook(ctx, in)
+		return srv.(BookRentalServiceServer).ListWebhookSubscriptions(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: BookRentalService_BorrowBook_FullMethodName,
+		FullMethod: BookRentalService_ListWebhookSubscriptions_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(BookRentalServiceServer).BorrowBook(ctx, req.(*BorrowBookRequest))
+		return srv.(BookRentalServiceServer).ListWebhookSubscriptions(ctx, req.(*ListWebhookSubscriptionsRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _BookRentalService_ReturnBook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(ReturnBookRequest)
+func _BookRentalService_DeleteWebhookSubscription_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteWebhookSubscriptionRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(BookRentalServiceServer).ReturnBook(ctx, in)
+		return srv.(BookRentalServiceServer).DeleteWebhookSubscription(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: BookRentalService_ReturnBook_FullMethodName,
+		FullMethod: BookRentalService_DeleteWebhookSubscription_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(BookRentalServiceServer).ReturnBook(ctx, req.(*ReturnBookRequest))
+		return srv.(BookRentalServiceServer).DeleteWebhookSubscription(ctx, req.(*DeleteWebhookSubscriptionRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _BookRentalService_GetBooks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetBooksRequest)
+func _BookRentalService_ListWebhookDeliveries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWebhookDeliveriesRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(BookRentalServiceServer).GetBooks(ctx, in)
+		return srv.(BookRentalServiceServer).ListWebhookDeliveries(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: BookRentalService_GetBooks_FullMethodName,
+		FullMethod: BookRentalService_ListWebhookDeliveries_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(BookRentalServiceServer).GetBooks(ctx, req.(*GetBooksRequest))
+		return srv.(BookRentalServiceServer).ListWebhookDeliveries(ctx, req.(*ListWebhookDeliveriesRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _BookRentalService_GetBorrowedBooks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetBorrowedBooksRequest)
+func _BookRentalService_SendTestWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendTestWebhookRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(BookRentalServiceServer).GetBorrowedBooks(ctx, in)
+		return srv.(BookRentalServiceServer).SendTestWebhook(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: BookRentalService_GetBorrowedBooks_FullMethodName,
+		FullMethod: BookRentalService_SendTestWebhook_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(BookRentalServiceServer).GetBorrowedBooks(ctx, req.(*GetBorrowedBooksRequest))
+		return srv.(BookRentalServiceServer).SendTestWebhook(ctx, req.(*SendTestWebhookRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -367,6 +1537,34 @@ var BookRentalService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "LoginUser",
 			Handler:    _BookRentalService_LoginUser_Handler,
 		},
+		{
+			MethodName: "RefreshToken",
+			Handler:    _BookRentalService_RefreshToken_Handler,
+		},
+		{
+			MethodName: "Logout",
+			Handler:    _BookRentalService_Logout_Handler,
+		},
+		{
+			MethodName: "SetUserRole",
+			Handler:    _BookRentalService_SetUserRole_Handler,
+		},
+		{
+			MethodName: "SetUserCategory",
+			Handler:    _BookRentalService_SetUserCategory_Handler,
+		},
+		{
+			MethodName: "UnlockAccount",
+			Handler:    _BookRentalService_UnlockAccount_Handler,
+		},
+		{
+			MethodName: "ListAuditEvents",
+			Handler:    _BookRentalService_ListAuditEvents_Handler,
+		},
+		{
+			MethodName: "GetJWKS",
+			Handler:    _BookRentalService_GetJWKS_Handler,
+		},
 		{
 			MethodName: "AddBook",
 			Handler:    _BookRentalService_AddBook_Handler,
@@ -387,11 +1585,121 @@ var BookRentalService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetBooks",
 			Handler:    _BookRentalService_GetBooks_Handler,
 		},
+		{
+			MethodName: "AddCopy",
+			Handler:    _BookRentalService_AddCopy_Handler,
+		},
+		{
+			MethodName: "UpdateCopy",
+			Handler:    _BookRentalService_UpdateCopy_Handler,
+		},
+		{
+			MethodName: "RemoveCopy",
+			Handler:    _BookRentalService_RemoveCopy_Handler,
+		},
+		{
+			MethodName: "ListCopies",
+			Handler:    _BookRentalService_ListCopies_Handler,
+		},
+		{
+			MethodName: "PlaceHold",
+			Handler:    _BookRentalService_PlaceHold_Handler,
+		},
+		{
+			MethodName: "CancelHold",
+			Handler:    _BookRentalService_CancelHold_Handler,
+		},
+		{
+			MethodName: "ListHolds",
+			Handler:    _BookRentalService_ListHolds_Handler,
+		},
 		{
 			MethodName: "GetBorrowedBooks",
 			Handler:    _BookRentalService_GetBorrowedBooks_Handler,
 		},
+		{
+			MethodName: "RenewLoan",
+			Handler:    _BookRentalService_RenewLoan_Handler,
+		},
+		{
+			MethodName: "GetFeeBalance",
+			Handler:    _BookRentalService_GetFeeBalance_Handler,
+		},
+		{
+			MethodName: "ListFeeTransactions",
+			Handler:    _BookRentalService_ListFeeTransactions_Handler,
+		},
+		{
+			MethodName: "ChargeFee",
+			Handler:    _BookRentalService_ChargeFee_Handler,
+		},
+		{
+			MethodName: "RecordPayment",
+			Handler:    _BookRentalService_RecordPayment_Handler,
+		},
+		{
+			MethodName: "WaiveFee",
+			Handler:    _BookRentalService_WaiveFee_Handler,
+		},
+		{
+			MethodName: "ListJobs",
+			Handler:    _BookRentalService_ListJobs_Handler,
+		},
+		{
+			MethodName: "TriggerJob",
+			Handler:    _BookRentalService_TriggerJob_Handler,
+		},
+		{
+			MethodName: "PauseJob",
+			Handler:    _BookRentalService_PauseJob_Handler,
+		},
+		{
+			MethodName: "ResumeJob",
+			Handler:    _BookRentalService_ResumeJob_Handler,
+		},
+		{
+			MethodName: "ListJobRuns",
+			Handler:    _BookRentalService_ListJobRuns_Handler,
+		},
+		{
+			MethodName: "GetNotificationPreferences",
+			Handler:    _BookRentalService_GetNotificationPreferences_Handler,
+		},
+		{
+			MethodName: "UpdateNotificationPreferences",
+			Handler:    _BookRentalService_UpdateNotificationPreferences_Handler,
+		},
+		{
+			MethodName: "ListNotifications",
+			Handler:    _BookRentalService_ListNotifications_Handler,
+		},
+		{
+			MethodName: "CreateWebhookSubscription",
+			Handler:    _BookRentalService_CreateWebhookSubscription_Handler,
+		},
+		{
+			MethodName: "ListWebhookSubscriptions",
+			Handler:    _BookRentalService_ListWebhookSubscriptions_Handler,
+		},
+		{
+			MethodName: "DeleteWebhookSubscription",
+			Handler:    _BookRentalService_DeleteWebhookSubscription_Handler,
+		},
+		{
+			MethodName: "ListWebhookDeliveries",
+			Handler:    _BookRentalService_ListWebhookDeliveries_Handler,
+		},
+		{
+			MethodName: "SendTestWebhook",
+			Handler:    _BookRentalService_SendTestWebhook_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchBooks",
+			Handler:       _BookRentalService_WatchBooks_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/service.proto",
 }
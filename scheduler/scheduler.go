@@ -0,0 +1,468 @@
+// Package scheduler runs the server's background jobs on cron specs and keeps the
+// history of their runs in the store.
+//
+// Replicas sharing a store run each job once: an instance takes the job's lease in
+// the store before a run and renews it while the run goes on, and a job runs once
+// per scheduled time. The lease of an instance that died expires after the lease TTL
+// and another instance takes over.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"gc2-yugo/config"
+	"gc2-yugo/entity"
+	"gc2-yugo/store"
+
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	// ErrUnknownJob is returned for a job name that was not registered.
+	ErrUnknownJob = errors.New("unknown job")
+	// ErrLeaseHeld is returned when the job is running, on this or another instance.
+	ErrLeaseHeld = errors.New("the job is already running")
+	// ErrAlreadyRun is returned when the job already ran for the scheduled time.
+	ErrAlreadyRun = errors.New("the job already ran for this time")
+	// ErrLeaseLost is the cause of a run cancelled because another instance took the lease over.
+	ErrLeaseLost = errors.New("lost the job lease to another instance")
+)
+
+// Func does the work of one run. scheduled is the time the run was due. The result is
+// recorded even when the run fails, so a job should return what it did so far.
+type Func func(ctx context.Context, scheduled time.Time) (entity.JobResult, error)
+
+// Job describes a registered job.
+type Job struct {
+	Name    string
+	Spec    string           // empty when the job only runs when triggered
+	Next    time.Time        // next scheduled run, zero when none
+	State   *entity.JobState // nil when never paused or resumed
+	LastRun *entity.JobRun   // latest scheduled or triggered run, nil when none
+}
+
+// Paused reports whether the scheduled runs of the job are skipped.
+func (j Job) Paused() bool {
+	return j.State != nil && j.State.Paused
+}
+
+type job struct {
+	name     string
+	spec     string
+	schedule cron.Schedule // nil without a spec
+	run      Func
+	running  sync.Mutex // runs of a job never overlap
+}
+
+// Scheduler runs registered jobs and records each run.
+type Scheduler struct {
+	store     store.JobStore
+	instance  string
+	timeout   time.Duration
+	retention time.Duration
+	leaseTTL  time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	ctx     context.Context // of triggered runs, cancelled by Stop
+	cancel  context.CancelFunc
+	running sync.WaitGroup // loops and triggered runs
+}
+
+// New returns a scheduler recording runs and taking leases in the store, with the
+// settings of the configuration.
+func New(runs store.JobStore, cfg config.SchedulerConfig) *Scheduler {
+	instance := cfg.InstanceID
+	if instance == "" {
+		instance = defaultInstanceID()
+	}
+	return &Scheduler{
+		store:     runs,
+		instance:  instance,
+		timeout:   cfg.JobTimeout,
+		retention: cfg.RunRetention,
+		leaseTTL:  cfg.LeaseTTL,
+		now:       time.Now,
+		jobs:      map[string]*job{},
+		ctx:       context.Background(),
+	}
+}
+
+// defaultInstanceID names the process by its host name and pid.
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Instance returns the name of this instance in leases and run history.
+func (s *Scheduler) Instance() string {
+	return s.instance
+}
+
+// Register adds a job running on the cron spec, or only when started by hand if the
+// spec is empty. Jobs must be registered before Start.
+func (s *Scheduler) Register(name, spec string, run Func) error {
+	var schedule cron.Schedule
+	if spec != "" {
+		var err error
+		schedule, err = cron.ParseStandard(spec)
+		if err != nil {
+			return fmt.Errorf("job %s: invalid spec %q: %w", name, spec, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[name]; ok {
+		return fmt.Errorf("job %s is already registered", name)
+	}
+	s.jobs[name] = &job{name: name, spec: spec, schedule: schedule, run: run}
+	return nil
+}
+
+func (s *Scheduler) job(name string) (*job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.jobs[name]
+	if !ok {
+		return nil, ErrUnknownJob
+	}
+	return j, nil
+}
+
+// Jobs returns the registered jobs sorted by name, with their state and last run.
+func (s *Scheduler) Jobs(ctx context.Context) ([]Job, error) {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.jobs))
+	for name := range s.jobs {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+	sort.Strings(names)
+
+	jobs := make([]Job, 0, len(names))
+	for _, name := range names {
+		j, err := s.Job(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+// Job returns the registered job with its state and last run.
+func (s *Scheduler) Job(ctx context.Context, name string) (Job, error) {
+	j, err := s.job(name)
+	if err != nil {
+		return Job{}, err
+	}
+
+	info := Job{Name: j.name, Spec: j.spec}
+	if j.schedule != nil {
+		info.Next = j.schedule.Next(s.now())
+	}
+
+	info.State, err = s.store.GetJobState(ctx, name)
+	if errors.Is(err, store.ErrNotFound) {
+		info.State = nil
+	} else if err != nil {
+		return Job{}, err
+	}
+
+	runs, err := s.store.ListJobRuns(ctx, store.JobRunFilter{Job: name, Limit: 1})
+	if err != nil {
+		return Job{}, err
+	}
+	if len(runs) > 0 {
+		info.LastRun = &runs[0]
+	}
+	return info, nil
+}
+
+// History returns the latest runs of the job, newest first, only those in the
+// status unless it is empty.
+func (s *Scheduler) History(ctx context.Context, name, status string, limit int) ([]entity.JobRun, error) {
+	if _, err := s.job(name); err != nil {
+		return nil, err
+	}
+	return s.store.ListJobRuns(ctx, store.JobRunFilter{Job: name, Status: status, Limit: limit})
+}
+
+// Pause makes every instance skip the scheduled runs of the job until Resume. A run
+// in progress goes on, and the job can still be triggered.
+func (s *Scheduler) Pause(ctx context.Context, name, by string) error {
+	return s.setPaused(ctx, name, by, true)
+}
+
+// Resume schedules the runs of a paused job again. Runs missed meanwhile are skipped.
+func (s *Scheduler) Resume(ctx context.Context, name, by string) error {
+	return s.setPaused(ctx, name, by, false)
+}
+
+func (s *Scheduler) setPaused(ctx context.Context, name, by string, paused bool) error {
+	if _, err := s.job(name); err != nil {
+		return err
+	}
+	return s.store.SetJobState(ctx, entity.JobState{Job: name, Paused: paused, UpdatedBy: by, UpdatedAt: s.now().UTC()})
+}
+
+// Start runs every job with a spec on its schedule until Stop. A run that is still
+// going when the next one is due makes the scheduler skip the missed runs.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	for _, j := range s.jobs {
+		if j.schedule == nil {
+			continue
+		}
+		s.running.Add(1)
+		go s.loop(s.ctx, j)
+	}
+}
+
+// Stop stops scheduling runs and waits for the running ones, which are cancelled.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.running.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	defer s.running.Done()
+
+	var last time.Time
+	for {
+		from := s.now()
+		if from.Before(last) {
+			from = last
+		}
+		next := j.schedule.Next(from)
+
+		timer := time.NewTimer(next.Sub(s.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		last = next
+
+		state, err := s.store.GetJobState(ctx, j.name)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.Printf("job %s: failed to read the state, skipping the run: %v", j.name, err)
+			continue
+		}
+		if err == nil && state.Paused {
+			continue
+		}
+
+		run, err := s.Run(ctx, j.name, next)
+		switch {
+		case errors.Is(err, ErrLeaseHeld) || errors.Is(err, ErrAlreadyRun):
+			// Another instance runs it
+			continue
+		case err != nil:
+			log.Printf("job %s: %v", j.name, err)
+		case run.Status == entity.JobFailed:
+			log.Printf("job %s failed: %s", j.name, run.Error)
+		case run.Result.Summary != "":
+			log.Printf("job %s: %s", j.name, run.Result.Summary)
+		}
+
+		if err := s.store.DeleteJobRuns(ctx, s.now().Add(-s.retention)); err != nil && ctx.Err() == nil {
+			log.Printf("failed to prune the job history: %v", err)
+		}
+	}
+}
+
+// Run runs the job once, recording it as due at scheduled, and returns the finished
+// run. It waits for a run of the job in progress on this instance, and returns
+// ErrLeaseHeld if another instance is running the job and ErrAlreadyRun if the job
+// already ran for the scheduled time. Other errors report a failure to record the
+// run, the job's own failure is in the run.
+func (s *Scheduler) Run(ctx context.Context, name string, scheduled time.Time) (*entity.JobRun, error) {
+	j, err := s.job(name)
+	if err != nil {
+		return nil, err
+	}
+
+	j.running.Lock()
+	defer j.running.Unlock()
+
+	run, err := s.start(ctx, j, scheduled, "")
+	if err != nil {
+		return nil, err
+	}
+	return run, s.finish(ctx, j, run)
+}
+
+// Trigger starts a run of the job now, on behalf of the admin "by", and returns the
+// run as it started. The run goes on in the background until it ends or Stop. It
+// returns ErrLeaseHeld if the job is running.
+func (s *Scheduler) Trigger(ctx context.Context, name, by string) (*entity.JobRun, error) {
+	j, err := s.job(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !j.running.TryLock() {
+		return nil, ErrLeaseHeld
+	}
+	run, err := s.start(ctx, j, s.now(), by)
+	if err != nil {
+		j.running.Unlock()
+		return nil, err
+	}
+	started := *run
+
+	s.mu.Lock()
+	runCtx := s.ctx
+	s.running.Add(1)
+	s.mu.Unlock()
+	go func() {
+		defer s.running.Done()
+		defer j.running.Unlock()
+		if err := s.finish(runCtx, j, run); err != nil {
+			log.Printf("job %s: %v", j.name, err)
+		}
+	}()
+	return &started, nil
+}
+
+// start takes the job's lease and records the run as running.
+func (s *Scheduler) start(ctx context.Context, j *job, scheduled time.Time, by string) (*entity.JobRun, error) {
+	if err := s.acquireLease(ctx, j.name); err != nil {
+		return nil, err
+	}
+
+	run := &entity.JobRun{
+		Job:         j.name,
+		ScheduledAt: scheduled.UTC(),
+		StartedAt:   s.now().UTC(),
+		Status:      entity.JobRunning,
+		Instance:    s.instance,
+		TriggeredBy: by,
+	}
+	err := s.store.CreateJobRun(ctx, run)
+	if err != nil {
+		s.releaseLease(ctx, j.name)
+	}
+	if errors.Is(err, store.ErrAlreadyExists) {
+		return nil, ErrAlreadyRun
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record the run: %w", err)
+	}
+	return run, nil
+}
+
+// finish does the work of a started run while renewing the lease, records the
+// outcome and releases the lease.
+func (s *Scheduler) finish(ctx context.Context, j *job, run *entity.JobRun) error {
+	defer s.releaseLease(ctx, j.name)
+
+	runCtx, cancelTimeout := context.WithTimeout(ctx, s.timeout)
+	runCtx, cancel := context.WithCancelCause(runCtx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		s.renewLease(runCtx, j.name, cancel)
+	}()
+
+	result, err := call(runCtx, j.run, run.ScheduledAt)
+	if err != nil && errors.Is(context.Cause(runCtx), ErrLeaseLost) {
+		err = ErrLeaseLost
+	}
+	cancel(nil)
+	cancelTimeout()
+	<-renewed
+
+	finishedAt := s.now().UTC()
+	run.FinishedAt = &finishedAt
+	run.Result = result
+	run.Status = entity.JobSucceeded
+	if err != nil {
+		run.Status = entity.JobFailed
+		run.Error = err.Error()
+	}
+
+	// Record the outcome even when the scheduler is stopping
+	if err := s.store.FinishJobRun(context.WithoutCancel(ctx), run); err != nil {
+		return fmt.Errorf("failed to record the outcome of run %s: %w", run.ID.Hex(), err)
+	}
+	return nil
+}
+
+func (s *Scheduler) releaseLease(ctx context.Context, name string) {
+	err := s.store.ReleaseJobLease(context.WithoutCancel(ctx), name, s.instance)
+	if err != nil && !errors.Is(err, store.ErrConflict) {
+		log.Printf("job %s: failed to release the lease: %v", name, err)
+	}
+}
+
+func (s *Scheduler) acquireLease(ctx context.Context, name string) error {
+	now := s.now()
+	err := s.store.AcquireJobLease(ctx, name, s.instance, now, now.Add(s.leaseTTL))
+	if errors.Is(err, store.ErrConflict) {
+		return ErrLeaseHeld
+	}
+	if err != nil {
+		return fmt.Errorf("failed to acquire the lease: %w", err)
+	}
+	return nil
+}
+
+// renewLease extends the job's lease every third of its TTL until ctx is done, and
+// cancels the run with ErrLeaseLost if another instance took the lease over. A renewal
+// failing for another reason is retried on the next tick, while the lease lasts.
+func (s *Scheduler) renewLease(ctx context.Context, name string, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(s.leaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := s.acquireLease(ctx, name)
+		if errors.Is(err, ErrLeaseHeld) {
+			cancel(ErrLeaseLost)
+			return
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("job %s: %v", name, err)
+		}
+	}
+}
+
+// call runs the job, turning a panic into an error so it is recorded like a failure.
+func call(ctx context.Context, run Func, scheduled time.Time) (result entity.JobResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run(ctx, scheduled)
+}
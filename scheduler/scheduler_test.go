@@ -0,0 +1,388 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gc2-yugo/config"
+	"gc2-yugo/entity"
+	"gc2-yugo/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() config.SchedulerConfig {
+	cfg := config.Default().Scheduler
+	cfg.JobTimeout = time.Second
+	return cfg
+}
+
+func TestRegister(t *testing.T) {
+	s := New(store.NewMemoryStore(), testConfig())
+	noop := func(ctx context.Context, scheduled time.Time) (entity.JobResult, error) {
+		return entity.JobResult{}, nil
+	}
+
+	require.NoError(t, s.Register("late_books", "0 0 * * *", noop))
+	require.NoError(t, s.Register("manual", "", noop))
+	assert.Error(t, s.Register("late_books", "@hourly", noop), "registered twice")
+	assert.ErrorContains(t, s.Register("broken", "daily", noop), "invalid spec")
+
+	jobs, err := s.Jobs(context.Background())
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "late_books", jobs[0].Name)
+	assert.Equal(t, "0 0 * * *", jobs[0].Spec)
+	assert.False(t, jobs[0].Next.IsZero())
+	assert.Equal(t, Job{Name: "manual"}, jobs[1])
+}
+
+func TestRun(t *testing.T) {
+	runs := store.NewMemoryStore()
+	s := New(runs, testConfig())
+	ctx := context.Background()
+	scheduled := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, s.Register("counter", "", func(ctx context.Context, at time.Time) (entity.JobResult, error) {
+		assert.Equal(t, scheduled, at)
+		return entity.JobResult{Checked: 3, Changed: 2, Summary: "updated 2 records"}, nil
+	}))
+	require.NoError(t, s.Register("partial", "", func(ctx context.Context, at time.Time) (entity.JobResult, error) {
+		return entity.JobResult{Checked: 1}, errors.New("store unavailable")
+	}))
+	require.NoError(t, s.Register("panics", "", func(ctx context.Context, at time.Time) (entity.JobResult, error) {
+		panic("boom")
+	}))
+	require.NoError(t, s.Register("slow", "", func(ctx context.Context, at time.Time) (entity.JobResult, error) {
+		<-ctx.Done()
+		return entity.JobResult{}, ctx.Err()
+	}))
+
+	run, err := s.Run(ctx, "counter", scheduled)
+	require.NoError(t, err)
+	assert.Equal(t, entity.JobSucceeded, run.Status)
+	assert.Equal(t, entity.JobResult{Checked: 3, Changed: 2, Summary: "updated 2 records"}, run.Result)
+	assert.Equal(t, scheduled, run.ScheduledAt)
+	require.NotNil(t, run.FinishedAt)
+
+	stored, err := runs.GetJobRun(ctx, run.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, *run, *stored)
+
+	// Failed runs keep their partial result and the error
+	run, err = s.Run(ctx, "partial", scheduled)
+	require.NoError(t, err)
+	assert.Equal(t, entity.JobFailed, run.Status)
+	assert.Equal(t, "store unavailable", run.Error)
+	assert.Equal(t, 1, run.Result.Checked)
+
+	run, err = s.Run(ctx, "panics", scheduled)
+	require.NoError(t, err)
+	assert.Equal(t, entity.JobFailed, run.Status)
+	assert.Equal(t, "panic: boom", run.Error)
+
+	// Runs are cancelled after the timeout
+	run, err = s.Run(ctx, "slow", scheduled)
+	require.NoError(t, err)
+	assert.Equal(t, entity.JobFailed, run.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), run.Error)
+
+	_, err = s.Run(ctx, "missing", scheduled)
+	assert.ErrorIs(t, err, ErrUnknownJob)
+
+	history, err := runs.ListJobRuns(ctx, store.JobRunFilter{Status: entity.JobFailed})
+	require.NoError(t, err)
+	assert.Len(t, history, 3)
+}
+
+func TestStartStop(t *testing.T) {
+	runs := store.NewMemoryStore()
+	s := New(runs, testConfig())
+	ctx := context.Background()
+
+	var count atomic.Int32
+	require.NoError(t, s.Register("ticker", "@every 1s", func(ctx context.Context, at time.Time) (entity.JobResult, error) {
+		count.Add(1)
+		return entity.JobResult{Changed: 1, Summary: "ticked"}, nil
+	}))
+	require.NoError(t, s.Register("manual", "", func(ctx context.Context, at time.Time) (entity.JobResult, error) {
+		t.Error("jobs without a spec only run by hand")
+		return entity.JobResult{}, nil
+	}))
+
+	s.Start(ctx)
+	assert.Eventually(t, func() bool { return count.Load() > 0 }, 5*time.Second, 50*time.Millisecond)
+	s.Stop()
+	stopped := count.Load()
+
+	history, err := runs.ListJobRuns(ctx, store.JobRunFilter{Job: "ticker"})
+	require.NoError(t, err)
+	require.Len(t, history, int(stopped))
+	assert.Equal(t, entity.JobSucceeded, history[0].Status)
+	assert.Equal(t, history[0].ScheduledAt.Truncate(time.Second), history[0].ScheduledAt, "due on the schedule")
+
+	job, err := s.Job(ctx, "ticker")
+	require.NoError(t, err)
+	assert.False(t, job.Next.IsZero())
+	require.NotNil(t, job.LastRun)
+	assert.Equal(t, history[0], *job.LastRun)
+
+	time.Sleep(1500 * time.Millisecond)
+	assert.Equal(t, stopped, count.Load(), "no runs after Stop")
+}
+
+func TestPause(t *testing.T) {
+	runs := store.NewMemoryStore()
+	s := New(runs, testConfig())
+	ctx := context.Background()
+
+	var count atomic.Int32
+	require.NoError(t, s.Register("ticker", "@every 1s", func(ctx context.Context, at time.Time) (entity.JobResult, error) {
+		count.Add(1)
+		return entity.JobResult{}, nil
+	}))
+
+	require.NoError(t, s.Pause(ctx, "ticker", "admin"))
+	assert.ErrorIs(t, s.Pause(ctx, "missing", "admin"), ErrUnknownJob)
+	job, err := s.Job(ctx, "ticker")
+	require.NoError(t, err)
+	assert.True(t, job.Paused())
+	assert.Equal(t, "admin", job.State.UpdatedBy)
+
+	// Paused jobs skip their scheduled runs
+	s.Start(ctx)
+	defer s.Stop()
+	time.Sleep(1500 * time.Millisecond)
+	assert.Zero(t, count.Load())
+
+	require.NoError(t, s.Resume(ctx, "ticker", "admin"))
+	assert.Eventually(t, func() bool { return count.Load() > 0 }, 3*time.Second, 50*time.Millisecond)
+	job, err = s.Job(ctx, "ticker")
+	require.NoError(t, err)
+	assert.False(t, job.Paused())
+}
+
+func TestTrigger(t *testing.T) {
+	runs := store.NewMemoryStore()
+	s := New(runs, testConfig())
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	require.NoError(t, s.Register("manual", "", func(ctx context.Context, at time.Time) (entity.JobResult, error) {
+		<-release
+		return entity.JobResult{Changed: 1}, nil
+	}))
+
+	run, err := s.Trigger(ctx, "manual", "admin")
+	require.NoError(t, err)
+	assert.Equal(t, entity.JobRunning, run.Status)
+	assert.Equal(t, "admin", run.TriggeredBy)
+
+	// One run at a time
+	_, err = s.Trigger(ctx, "manual", "admin")
+	assert.ErrorIs(t, err, ErrLeaseHeld)
+	_, err = s.Trigger(ctx, "missing", "admin")
+	assert.ErrorIs(t, err, ErrUnknownJob)
+
+	close(release)
+	s.Stop()
+	finished, err := runs.GetJobRun(ctx, run.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, entity.JobSucceeded, finished.Status)
+	assert.Equal(t, 1, finished.Result.Changed)
+
+	history, err := s.History(ctx, "manual", entity.JobSucceeded, 10)
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+	_, err = s.History(ctx, "missing", "", 10)
+	assert.ErrorIs(t, err, ErrUnknownJob)
+}
+
+func newInstance(runs store.JobStore, instance string, leaseTTL time.Duration) *Scheduler {
+	cfg := testConfig()
+	cfg.InstanceID = instance
+	cfg.LeaseTTL = leaseTTL
+	return New(runs, cfg)
+}
+
+func TestLease(t *testing.T) {
+	runs := store.NewMemoryStore()
+	a := newInstance(runs, "a", time.Minute)
+	b := newInstance(runs, "b", time.Minute)
+	ctx := context.Background()
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	blocking := func(ctx context.Context, at time.Time) (entity.JobResult, error) {
+		if at.Equal(first) {
+			close(started)
+			<-release
+		}
+		return entity.JobResult{}, nil
+	}
+	require.NoError(t, a.Register("job", "", blocking))
+	require.NoError(t, b.Register("job", "", blocking))
+
+	done := make(chan *entity.JobRun)
+	go func() {
+		run, err := a.Run(ctx, "job", first)
+		assert.NoError(t, err)
+		done <- run
+	}()
+	<-started
+
+	// One instance runs a job at a time
+	lease, err := runs.GetJobLease(ctx, "job")
+	require.NoError(t, err)
+	assert.Equal(t, "a", lease.Holder)
+	_, err = b.Run(ctx, "job", second)
+	assert.ErrorIs(t, err, ErrLeaseHeld)
+
+	close(release)
+	run := <-done
+	assert.Equal(t, entity.JobSucceeded, run.Status)
+	assert.Equal(t, "a", run.Instance)
+	_, err = runs.GetJobLease(ctx, "job")
+	assert.ErrorIs(t, err, store.ErrNotFound, "released")
+
+	// And once per scheduled time
+	_, err = b.Run(ctx, "job", first)
+	assert.ErrorIs(t, err, ErrAlreadyRun)
+	run, err = b.Run(ctx, "job", second)
+	require.NoError(t, err)
+	assert.Equal(t, "b", run.Instance)
+}
+
+func TestLeaseTakeover(t *testing.T) {
+	runs := store.NewMemoryStore()
+	b := newInstance(runs, "b", time.Minute)
+	ctx := context.Background()
+	require.NoError(t, b.Register("job", "", func(ctx context.Context, at time.Time) (entity.JobResult, error) {
+		return entity.JobResult{}, nil
+	}))
+
+	// An instance died holding the lease
+	now := time.Now()
+	require.NoError(t, runs.AcquireJobLease(ctx, "job", "dead", now, now.Add(time.Minute)))
+	_, err := b.Run(ctx, "job", now)
+	assert.ErrorIs(t, err, ErrLeaseHeld)
+
+	b.now = func() time.Time { return time.Now().Add(time.Minute) }
+	run, err := b.Run(ctx, "job", now)
+	require.NoError(t, err)
+	assert.Equal(t, entity.JobSucceeded, run.Status)
+}
+
+func TestLeaseRenewal(t *testing.T) {
+	runs := store.NewMemoryStore()
+	a := newInstance(runs, "a", 300*time.Millisecond)
+	b := newInstance(runs, "b", 300*time.Millisecond)
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	require.NoError(t, a.Register("slow", "", func(ctx context.Context, at time.Time) (entity.JobResult, error) {
+		close(started)
+		select {
+		case <-time.After(800 * time.Millisecond):
+			return entity.JobResult{}, nil
+		case <-ctx.Done():
+			return entity.JobResult{}, ctx.Err()
+		}
+	}))
+	require.NoError(t, b.Register("slow", "", func(ctx context.Context, at time.Time) (entity.JobResult, error) {
+		return entity.JobResult{}, nil
+	}))
+
+	done := make(chan *entity.JobRun)
+	go func() {
+		run, err := a.Run(ctx, "slow", time.Now())
+		assert.NoError(t, err)
+		done <- run
+	}()
+	<-started
+
+	// The lease outlives its TTL while the run goes on
+	time.Sleep(600 * time.Millisecond)
+	_, err := b.Run(ctx, "slow", time.Now())
+	assert.ErrorIs(t, err, ErrLeaseHeld)
+
+	run := <-done
+	assert.Equal(t, entity.JobSucceeded, run.Status)
+}
+
+func TestLeaseLost(t *testing.T) {
+	runs := store.NewMemoryStore()
+	a := newInstance(runs, "a", 300*time.Millisecond)
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	require.NoError(t, a.Register("job", "", func(ctx context.Context, at time.Time) (entity.JobResult, error) {
+		close(started)
+		<-ctx.Done()
+		return entity.JobResult{Checked: 1}, ctx.Err()
+	}))
+
+	done := make(chan *entity.JobRun)
+	go func() {
+		run, err := a.Run(ctx, "job", time.Now())
+		assert.NoError(t, err)
+		done <- run
+	}()
+	<-started
+
+	// Another instance saw the lease expire, for instance after a long pause of this one
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, runs.AcquireJobLease(ctx, "job", "b", later, later.Add(time.Hour)))
+
+	run := <-done
+	assert.Equal(t, entity.JobFailed, run.Status)
+	assert.Equal(t, ErrLeaseLost.Error(), run.Error)
+	assert.Equal(t, 1, run.Result.Checked)
+
+	lease, err := runs.GetJobLease(ctx, "job")
+	require.NoError(t, err)
+	assert.Equal(t, "b", lease.Holder, "the new holder keeps the lease")
+}
+
+// Replicas on a shared store run every scheduled time once between them
+func TestReplicas(t *testing.T) {
+	runs := store.NewMemoryStore()
+	ctx := context.Background()
+
+	var count atomic.Int32
+	var replicas []*Scheduler
+	for _, instance := range []string{"a", "b", "c"} {
+		s := newInstance(runs, instance, time.Minute)
+		require.NoError(t, s.Register("ticker", "@every 1s", func(ctx context.Context, at time.Time) (entity.JobResult, error) {
+			count.Add(1)
+			return entity.JobResult{}, nil
+		}))
+		replicas = append(replicas, s)
+	}
+
+	for _, s := range replicas {
+		s.Start(ctx)
+	}
+	time.Sleep(2500 * time.Millisecond)
+	for _, s := range replicas {
+		s.Stop()
+	}
+
+	history, err := runs.ListJobRuns(ctx, store.JobRunFilter{Job: "ticker"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, history)
+	assert.Len(t, history, int(count.Load()))
+
+	scheduled := map[time.Time]string{}
+	for _, run := range history {
+		assert.Equal(t, entity.JobSucceeded, run.Status)
+		other, ok := scheduled[run.ScheduledAt]
+		assert.False(t, ok, "%s ran on %s and %s", run.ScheduledAt, run.Instance, other)
+		scheduled[run.ScheduledAt] = run.Instance
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gc2-yugo/auth"
+	"gc2-yugo/entity"
+	"gc2-yugo/pb"
+	"gc2-yugo/store"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type contextKey string
+
+const (
+	userIDKey contextKey = "user_id"
+	roleKey   contextKey = "role"
+	claimsKey contextKey = "claims"
+)
+
+// rolePublic marks methods that can be called without a token.
+const rolePublic = ""
+
+// methodRoles is the minimum role needed to call each method. Methods missing
+// from the table are denied to everyone.
+var methodRoles = map[string]string{
+	pb.BookRentalService_RegisterUser_FullMethodName:                  rolePublic,
+	pb.BookRentalService_LoginUser_FullMethodName:                     rolePublic,
+	pb.BookRentalService_GetJWKS_FullMethodName:                       rolePublic,
+	pb.BookRentalService_RefreshToken_FullMethodName:                  rolePublic,
+	pb.BookRentalService_Logout_FullMethodName:                        entity.RoleMember,
+	pb.BookRentalService_SetUserRole_FullMethodName:                   entity.RoleAdmin,
+	pb.BookRentalService_SetUserCategory_FullMethodName:               entity.RoleLibrarian,
+	pb.BookRentalService_UnlockAccount_FullMethodName:                 entity.RoleAdmin,
+	pb.BookRentalService_ListAuditEvents_FullMethodName:               entity.RoleAdmin,
+	pb.BookRentalService_AddBook_FullMethodName:                       entity.RoleLibrarian,
+	pb.BookRentalService_RemoveBook_FullMethodName:                    entity.RoleLibrarian,
+	pb.BookRentalService_BorrowBook_FullMethodName:                    entity.RoleMember,
+	pb.BookRentalService_ReturnBook_FullMethodName:                    entity.RoleMember,
+	pb.BookRentalService_GetBooks_FullMethodName:                      entity.RoleMember,
+	pb.BookRentalService_WatchBooks_FullMethodName:                    entity.RoleMember,
+	pb.BookRentalService_GetBorrowedBooks_FullMethodName:              entity.RoleMember,
+	pb.BookRentalService_AddCopy_FullMethodName:                       entity.RoleLibrarian,
+	pb.BookRentalService_UpdateCopy_FullMethodName:                    entity.RoleLibrarian,
+	pb.BookRentalService_RemoveCopy_FullMethodName:                    entity.RoleLibrarian,
+	pb.BookRentalService_ListCopies_FullMethodName:                    entity.RoleMember,
+	pb.BookRentalService_PlaceHold_FullMethodName:                     entity.RoleMember,
+	pb.BookRentalService_CancelHold_FullMethodName:                    entity.RoleMember,
+	pb.BookRentalService_ListHolds_FullMethodName:                     entity.RoleMember,
+	pb.BookRentalService_RenewLoan_FullMethodName:                     entity.RoleMember,
+	pb.BookRentalService_GetFeeBalance_FullMethodName:                 entity.RoleMember,
+	pb.BookRentalService_ListFeeTransactions_FullMethodName:           entity.RoleMember,
+	pb.BookRentalService_ChargeFee_FullMethodName:                     entity.RoleLibrarian,
+	pb.BookRentalService_RecordPayment_FullMethodName:                 entity.RoleLibrarian,
+	pb.BookRentalService_WaiveFee_FullMethodName:                      entity.RoleLibrarian,
+	pb.BookRentalService_ListJobs_FullMethodName:                      entity.RoleAdmin,
+	pb.BookRentalService_TriggerJob_FullMethodName:                    entity.RoleAdmin,
+	pb.BookRentalService_PauseJob_FullMethodName:                      entity.RoleAdmin,
+	pb.BookRentalService_ResumeJob_FullMethodName:                     entity.RoleAdmin,
+	pb.BookRentalService_ListJobRuns_FullMethodName:                   entity.RoleAdmin,
+	pb.BookRentalService_GetNotificationPreferences_FullMethodName:    entity.RoleMember,
+	pb.BookRentalService_UpdateNotificationPreferences_FullMethodName: entity.RoleMember,
+	pb.BookRentalService_ListNotifications_FullMethodName:             entity.RoleMember,
+	pb.BookRentalService_CreateWebhookSubscription_FullMethodName:     entity.RoleAdmin,
+	pb.BookRentalService_ListWebhookSubscriptions_FullMethodName:      entity.RoleAdmin,
+	pb.BookRentalService_DeleteWebhookSubscription_FullMethodName:     entity.RoleAdmin,
+	pb.BookRentalService_ListWebhookDeliveries_FullMethodName:         entity.RoleAdmin,
+	pb.BookRentalService_SendTestWebhook_FullMethodName:               entity.RoleAdmin,
+}
+
+// roleRanks orders the roles, a role has every permission of the lower ones.
+var roleRanks = map[string]int{
+	entity.RoleMember:    1,
+	entity.RoleLibrarian: 2,
+	entity.RoleAdmin:     3,
+}
+
+// hasRole reports whether role is at least required. Users stored before roles
+// existed have no role and count as members.
+func hasRole(role, required string) bool {
+	if role == "" {
+		role = entity.RoleMember
+	}
+	return roleRanks[role] >= roleRanks[required]
+}
+
+// callerRole returns the role of the authenticated caller.
+func callerRole(ctx context.Context) string {
+	role, _ := ctx.Value(roleKey).(string)
+	return role
+}
+
+func (s *BookRentalServiceServer) UnaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamAuthInterceptor checks the callers of streaming methods as UnaryAuthInterceptor
+// does for the others.
+func (s *BookRentalServiceServer) StreamAuthInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authorize(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+}
+
+// authenticatedStream carries the caller's identity in the context of the stream.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// authorize checks the caller may call the method and returns the context carrying
+// the caller's identity.
+func (s *BookRentalServiceServer) authorize(ctx context.Context, method string) (context.Context, error) {
+	fmt.Printf("Handling method: %s\n", method)
+
+	required, ok := methodRoles[method]
+	if !ok {
+		return nil, status.Errorf(codes.PermissionDenied, "method %s is not allowed", method)
+	}
+	if required == rolePublic {
+		return ctx, nil
+	}
+
+	ctx, err := s.AuthInterceptor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if role := callerRole(ctx); !hasRole(role, required) {
+		return nil, status.Errorf(codes.PermissionDenied, "%s requires the %s role", method, required)
+	}
+	return ctx, nil
+}
+
+func (s *BookRentalServiceServer) AuthInterceptor(ctx context.Context) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		fmt.Println("No metadata found")
+		return nil, status.Errorf(codes.Unauthenticated, "Unauthorized: No metadata found")
+	}
+
+	tokenList := md["authorization"]
+	if len(tokenList) == 0 {
+		fmt.Println("Invalid or missing token")
+		return nil, status.Errorf(codes.Unauthenticated, "Unauthorized: invalid or missing token")
+	}
+
+	token := strings.TrimPrefix(tokenList[0], "Bearer ")
+
+	claims, err := s.validateJWT(token)
+	if err != nil {
+		fmt.Printf("Token validation failed: %v\n", err)
+		return nil, status.Errorf(codes.Unauthenticated, "Unauthorized: %v", err)
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "Unauthorized: Invalid token claims")
+	}
+
+	// Tokens without a jti cannot be revoked, so they are not accepted
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return nil, status.Errorf(codes.Unauthenticated, "Unauthorized: token has no id, log in again")
+	}
+	revoked, err := s.store.IsAccessTokenRevoked(ctx, jti)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to check token revocation: %v", err)
+	}
+	if revoked {
+		return nil, status.Errorf(codes.Unauthenticated, "Unauthorized: token has been revoked")
+	}
+
+	// Tokens issued before roles existed carry no role claim
+	role, _ := claims["role"].(string)
+
+	ctx = context.WithValue(ctx, userIDKey, userID)
+	ctx = context.WithValue(ctx, roleKey, role)
+	ctx = context.WithValue(ctx, claimsKey, claims)
+
+	fmt.Println("Token validated successfully")
+	return ctx, nil
+}
+
+func (s *BookRentalServiceServer) generateJWT(userID, role string) (string, error) {
+	jti, err := auth.NewTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"jti":     jti,
+		"user_id": userID,
+		"role":    role,
+		"exp":     time.Now().Add(s.config.Auth.TokenTTL).Unix(),
+		"iat":     time.Now().Unix(),
+	}
+
+	return s.keys.Sign(claims)
+}
+
+func (s *BookRentalServiceServer) validateJWT(tokenString string) (jwt.MapClaims, error) {
+	return s.keys.Parse(tokenString)
+}
+
+// GetJWKS publishes the public keys so other services can verify our tokens.
+func (s *BookRentalServiceServer) GetJWKS(ctx context.Context, req *pb.GetJWKSRequest) (*pb.GetJWKSResponse, error) {
+	resp := &pb.GetJWKSResponse{}
+	for _, key := range s.keys.PublicKeys() {
+		resp.Keys = append(resp.Keys, &pb.JSONWebKey{
+			Kty: key.KeyType,
+			Kid: key.KeyID,
+			Use: key.Use,
+			Alg: key.Algorithm,
+			N:   key.N,
+			E:   key.E,
+			Crv: key.Curve,
+			X:   key.X,
+		})
+	}
+	return resp, nil
+}
+
+func (s *BookRentalServiceServer) SetUserRole(ctx context.Context, req *pb.SetUserRoleRequest) (*pb.SetUserRoleResponse, error) {
+	if _, ok := roleRanks[req.Role]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid role %q, expected member, librarian or admin", req.Role)
+	}
+
+	// Keep at least one admin able to manage roles
+	callerID, _ := ctx.Value(userIDKey).(string)
+	if req.UserId == callerID && req.Role != entity.RoleAdmin {
+		return nil, status.Errorf(codes.FailedPrecondition, "admins cannot remove their own admin role")
+	}
+
+	err := s.store.UpdateUserRole(ctx, req.UserId, req.Role)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to update role: %v", err)
+	}
+
+	return &pb.SetUserRoleResponse{
+		Message: "role updated, it applies to tokens issued from the next login or refresh",
+		UserId:  req.UserId,
+		Role:    req.Role,
+	}, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gc2-yugo/config"
+	"gc2-yugo/entity"
+	"gc2-yugo/pb"
+	"gc2-yugo/store"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Checks of the circulation rules, reported as the type of the precondition violation
+const (
+	checkMaxLoans       = "max_loans"
+	checkBlockOnOverdue = "block_on_overdue"
+	checkBlockOnFines   = "block_on_fines"
+	checkMaxRenewals    = "max_renewals"
+)
+
+// policyViolation returns a FailedPrecondition status naming the rule and the check that refused the loan
+// or its renewal.
+func policyViolation(policy config.Policy, check, message string) error {
+	violation := &errdetails.PreconditionFailure_Violation{
+		Type:        check,
+		Subject:     "rule/" + policy.Rule,
+		Description: message,
+	}
+	st, err := status.New(codes.FailedPrecondition, message).WithDetails(&errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{violation},
+	})
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "%s", message)
+	}
+	return st.Err()
+}
+
+// loanPolicy returns the circulation terms of the user borrowing the title.
+func (s *BookRentalServiceServer) loanPolicy(ctx context.Context, userID string, title *entity.Title) (config.Policy, error) {
+	user, err := s.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return config.Policy{}, err
+	}
+	return s.config.Loans.Policy(user.Category, title.ItemType), nil
+}
+
+// checkBorrowPolicy returns the terms of a new loan of the title, or refuses it when
+// the user's open loans do not leave room for it. Loans are counted against the limit
+// of the policy's item type, or all of them when the policy applies to every item type.
+// It also returns the user's loan version read before the loans were counted, which
+// the borrow must still find for the check to hold.
+func (s *BookRentalServiceServer) checkBorrowPolicy(ctx context.Context, userID string, title *entity.Title) (config.Policy, int, error) {
+	user, err := s.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return config.Policy{}, 0, status.Errorf(codes.Internal, "failed to fetch user: %v", err)
+	}
+	policy := s.config.Loans.Policy(user.Category, title.ItemType)
+
+	open, err := s.store.ListLoans(ctx, store.LoanFilter{UserID: userID, State: store.LoanOpen})
+	if err != nil {
+		return policy, 0, status.Errorf(codes.Internal, "failed to fetch loans: %v", err)
+	}
+
+	if policy.BlockOnOverdue {
+		today := time.Now().Format("2006-01-02")
+		overdue := 0
+		for _, loan := range open {
+			if loan.ReturnDate < today {
+				overdue++
+			}
+		}
+		if overdue > 0 {
+			return policy, 0, policyViolation(policy, checkBlockOnOverdue,
+				fmt.Sprintf("%d borrowed books are overdue, return them before borrowing more (rule %q)", overdue, policy.Rule))
+		}
+	}
+
+	if policy.BlockOnFines {
+		balance, err := s.store.FeeBalance(ctx, userID)
+		if err != nil {
+			return policy, 0, status.Errorf(codes.Internal, "failed to fetch balance: %v", err)
+		}
+		if balance > 0 {
+			return policy, 0, policyViolation(policy, checkBlockOnFines,
+				fmt.Sprintf("%s of fees are unpaid, pay them before borrowing more (rule %q)",
+					formatAmount(balance, s.config.Loans.Fines.Currency), policy.Rule))
+		}
+	}
+
+	counted := len(open)
+	if policy.ItemType != "" && len(open) > 0 {
+		titleIDs := make([]string, 0, len(open))
+		for _, loan := range open {
+			titleIDs = append(titleIDs, loan.BookID)
+		}
+		titles, err := s.store.ListTitles(ctx, store.TitleFilter{IDs: titleIDs})
+		if err != nil {
+			return policy, 0, status.Errorf(codes.Internal, "failed to fetch books: %v", err)
+		}
+		itemTypes := make(map[string]string, len(titles))
+		for _, title := range titles {
+			itemTypes[title.ID.Hex()] = title.ItemType
+		}
+
+		counted = 0
+		for _, loan := range open {
+			if itemTypes[loan.BookID] == policy.ItemType {
+				counted++
+			}
+		}
+	}
+	if counted >= policy.MaxLoans {
+		if policy.MaxLoans == 0 {
+			return policy, 0, policyViolation(policy, checkMaxLoans, fmt.Sprintf("the book cannot be borrowed (rule %q)", policy.Rule))
+		}
+		return policy, 0, policyViolation(policy, checkMaxLoans,
+			fmt.Sprintf("at most %d books can be borrowed at once, return one first (rule %q)", policy.MaxLoans, policy.Rule))
+	}
+
+	return policy, user.LoanVersion, nil
+}
+
+func (s *BookRentalServiceServer) SetUserCategory(ctx context.Context, req *pb.SetUserCategoryRequest) (*pb.SetUserCategoryResponse, error) {
+	category := strings.TrimSpace(req.Category)
+
+	err := s.store.UpdateUserCategory(ctx, req.UserId, category)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to update category: %v", err)
+	}
+
+	return &pb.SetUserCategoryResponse{
+		Message:  "category updated",
+		UserId:   req.UserId,
+		Category: category,
+	}, nil
+}
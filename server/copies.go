@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"gc2-yugo/entity"
+	"gc2-yugo/pb"
+	"gc2-yugo/store"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var copyConditions = map[string]bool{
+	entity.ConditionNew:     true,
+	entity.ConditionGood:    true,
+	entity.ConditionFair:    true,
+	entity.ConditionPoor:    true,
+	entity.ConditionDamaged: true,
+}
+
+// Statuses librarians can set by hand, borrowed is only set by loans
+var manualCopyStatuses = map[string]bool{
+	entity.CopyAvailable: true,
+	entity.CopyLost:      true,
+	entity.CopyWithdrawn: true,
+}
+
+func toPBCopy(item entity.Copy) *pb.Copy {
+	return &pb.Copy{
+		Id:        item.ID.Hex(),
+		BookId:    item.TitleID,
+		Barcode:   item.Barcode,
+		Status:    item.Status,
+		Condition: item.Condition,
+		Location:  item.Location,
+	}
+}
+
+// newCopy builds an available copy of the title. The barcode defaults to the copy's ID.
+func newCopy(titleID, barcode, condition, location string) (entity.Copy, error) {
+	if condition == "" {
+		condition = entity.ConditionNew
+	}
+	if !copyConditions[condition] {
+		return entity.Copy{}, status.Errorf(codes.InvalidArgument, "invalid condition %q, expected new, good, fair, poor or damaged", condition)
+	}
+
+	item := entity.Copy{
+		ID:        primitive.NewObjectID(),
+		TitleID:   titleID,
+		Barcode:   strings.TrimSpace(barcode),
+		Status:    entity.CopyAvailable,
+		Condition: condition,
+		Location:  location,
+	}
+	if item.Barcode == "" {
+		item.Barcode = item.ID.Hex()
+	}
+	return item, nil
+}
+
+func (s *BookRentalServiceServer) AddCopy(ctx context.Context, req *pb.AddCopyRequest) (*pb.CopyResponse, error) {
+	if _, err := primitive.ObjectIDFromHex(req.BookId); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid book ID format")
+	}
+
+	item, err := newCopy(req.BookId, req.Barcode, req.Condition, req.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.store.CreateCopy(ctx, &item, copyEvent(item.ID.Hex(), item.TitleID, "", item.Status))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "book not found")
+	}
+	if errors.Is(err, store.ErrAlreadyExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "barcode %q is already used", item.Barcode)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to add copy: %v", err)
+	}
+
+	// A new copy of a book with a queue goes to the first patron waiting
+	hold, err := s.releaseCopy(ctx, item.ID.Hex(), item.TitleID, entity.CopyAvailable)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to update copy status: %v", err)
+	}
+	if hold != nil {
+		item.Status = entity.CopyOnHold
+	}
+
+	return &pb.CopyResponse{Message: "copy added", Copy: toPBCopy(item)}, nil
+}
+
+func (s *BookRentalServiceServer) UpdateCopy(ctx context.Context, req *pb.UpdateCopyRequest) (*pb.CopyResponse, error) {
+	item, err := s.store.GetCopy(ctx, req.CopyId)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "copy not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch copy: %v", err)
+	}
+
+	if req.Status != "" && !manualCopyStatuses[req.Status] {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid status %q, expected Available, lost or withdrawn", req.Status)
+	}
+	if req.Status != "" && req.Status != item.Status {
+		if item.Status == entity.CopyBorrowed {
+			return nil, status.Errorf(codes.FailedPrecondition, "the copy is on loan, return it first")
+		}
+		if item.Status == entity.CopyOnHold {
+			return nil, status.Errorf(codes.FailedPrecondition, "the copy is kept for a hold, cancel the hold first")
+		}
+
+		// Compare-and-set, so a copy borrowed meanwhile is not changed. A copy back
+		// in circulation goes to the queue of its book first.
+		var err error
+		newStatus := req.Status
+		if req.Status == entity.CopyAvailable {
+			var hold *entity.Hold
+			hold, err = s.releaseCopy(ctx, item.ID.Hex(), item.TitleID, item.Status)
+			if hold != nil {
+				newStatus = entity.CopyOnHold
+			}
+		} else {
+			err = s.store.UpdateCopyStatus(ctx, item.ID.Hex(), item.Status, req.Status, copyEvent(item.ID.Hex(), item.TitleID, item.Status, req.Status))
+		}
+		if errors.Is(err, store.ErrConflict) {
+			return nil, status.Errorf(codes.Aborted, "the copy changed meanwhile, try again")
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to update copy status: %v", err)
+		}
+		item.Status = newStatus
+	}
+
+	if req.Condition != "" || req.Location != "" {
+		if req.Condition != "" {
+			if !copyConditions[req.Condition] {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid condition %q, expected new, good, fair, poor or damaged", req.Condition)
+			}
+			item.Condition = req.Condition
+		}
+		if req.Location != "" {
+			item.Location = req.Location
+		}
+		if err := s.store.UpdateCopyDetails(ctx, item.ID.Hex(), item.Condition, item.Location); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to update copy: %v", err)
+		}
+	}
+
+	return &pb.CopyResponse{Message: "copy updated", Copy: toPBCopy(*item)}, nil
+}
+
+func (s *BookRentalServiceServer) RemoveCopy(ctx context.Context, req *pb.RemoveCopyRequest) (*pb.CopyResponse, error) {
+	item, err := s.store.GetCopy(ctx, req.CopyId)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "copy not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch copy: %v", err)
+	}
+	if item.Status == entity.CopyBorrowed {
+		return nil, status.Errorf(codes.FailedPrecondition, "the copy is on loan, return it first")
+	}
+	if item.Status == entity.CopyOnHold {
+		return nil, status.Errorf(codes.FailedPrecondition, "the copy is kept for a hold, cancel the hold first")
+	}
+
+	err = s.store.DeleteCopy(ctx, item.ID.Hex(), copyEvent(item.ID.Hex(), item.TitleID, item.Status, ""))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "copy not found")
+	}
+	if errors.Is(err, store.ErrConflict) {
+		return nil, status.Errorf(codes.FailedPrecondition, "the copy has borrow records, mark it withdrawn instead")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to remove copy: %v", err)
+	}
+
+	return &pb.CopyResponse{Message: "copy removed", Copy: toPBCopy(*item)}, nil
+}
+
+func (s *BookRentalServiceServer) ListCopies(ctx context.Context, req *pb.ListCopiesRequest) (*pb.ListCopiesResponse, error) {
+	if _, err := s.store.GetTitle(ctx, req.BookId); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, status.Errorf(codes.NotFound, "book not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to fetch book: %v", err)
+	}
+
+	copies, err := s.store.ListCopies(ctx, store.CopyFilter{TitleID: req.BookId})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch copies: %v", err)
+	}
+
+	resp := &pb.ListCopiesResponse{}
+	for _, item := range copies {
+		resp.Copies = append(resp.Copies, toPBCopy(item))
+	}
+	return resp, nil
+}
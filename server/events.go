@@ -0,0 +1,43 @@
+package main
+
+import (
+	"gc2-yugo/entity"
+	"gc2-yugo/outbox"
+	"time"
+)
+
+// copyEvent returns the status changed event of a copy of the book going from one
+// status to another.
+func copyEvent(copyID, bookID, from, to string) entity.OutboxEvent {
+	data := outbox.CopyData{CopyID: copyID, BookID: bookID, Status: to, Previous: from}
+	return outbox.NewEvent(entity.EventBookStatusChanged, bookID, data, time.Now())
+}
+
+// holdReadyEvent returns the ready event of the hold, kept until pickupBy.
+func holdReadyEvent(hold entity.Hold, copyID string, readyAt, pickupBy time.Time) entity.OutboxEvent {
+	data := outbox.HoldData{
+		HoldID:   hold.ID.Hex(),
+		BookID:   hold.TitleID,
+		CopyID:   copyID,
+		UserID:   hold.UserID,
+		ReadyAt:  readyAt.UTC().Format(time.RFC3339),
+		PickupBy: pickupBy.UTC().Format(time.RFC3339),
+	}
+	return outbox.NewEvent(entity.EventHoldReady, hold.TitleID, data, readyAt)
+}
+
+// loanData returns the data of the borrowed and returned events of the loan.
+func loanData(loan entity.BorrowedBooks) outbox.LoanData {
+	data := outbox.LoanData{
+		LoanID:       loan.ID.Hex(),
+		BookID:       loan.BookID,
+		CopyID:       loan.CopyID,
+		UserID:       loan.UserID,
+		BorrowedDate: loan.BorrowedDate,
+		DueDate:      loan.ReturnDate,
+	}
+	if loan.ReturnedAt != nil {
+		data.ReturnedAt = loan.ReturnedAt.UTC().Format(time.RFC3339)
+	}
+	return data
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gc2-yugo/config"
+	"gc2-yugo/entity"
+	"gc2-yugo/pb"
+	"gc2-yugo/store"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Fees a librarian can charge by hand, overdue fines are charged by the server
+var manualFeeKinds = map[string]bool{
+	entity.FeeLost:    true,
+	entity.FeeDamaged: true,
+}
+
+// overdueFine returns how many days the loan is late on the day of "on" and its fine:
+// the daily fine for every day late once the grace days are over, up to the cap.
+func overdueFine(dueDate string, on time.Time, policy config.Policy) (int, int64, error) {
+	due, err := time.Parse("2006-01-02", dueDate)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Count whole calendar days, in UTC so daylight saving time does not matter
+	today := time.Date(on.Year(), on.Month(), on.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(today.Sub(due).Hours() / 24)
+	if days <= 0 {
+		return 0, 0, nil
+	}
+	if days <= policy.FineGraceDays {
+		return days, 0, nil
+	}
+
+	fine := int64(days) * int64(policy.DailyFine)
+	if policy.MaxFine > 0 && fine > int64(policy.MaxFine) {
+		fine = int64(policy.MaxFine)
+	}
+	return days, fine, nil
+}
+
+// formatAmount formats cents for messages, such as "2.50 EUR".
+func formatAmount(cents int64, currency string) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d %s", sign, cents/100, cents%100, currency)
+}
+
+// accrueFine charges the part of the loan's overdue fine on the day of "on" that is
+// not charged yet, and returns the loan's whole overdue fine and the amount it charged.
+// Each charge is keyed by the loan and the days late, so concurrent runs charge a day
+// only once.
+func (s *BookRentalServiceServer) accrueFine(ctx context.Context, loan entity.BorrowedBooks, on time.Time) (int64, int64, error) {
+	title, err := s.store.GetTitle(ctx, loan.BookID)
+	if errors.Is(err, store.ErrNotFound) {
+		title = &entity.Title{}
+	} else if err != nil {
+		return 0, 0, err
+	}
+	policy, err := s.loanPolicy(ctx, loan.UserID, title)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	days, fine, err := overdueFine(loan.ReturnDate, on, policy)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid due date %q: %w", loan.ReturnDate, err)
+	}
+
+	charges, err := s.store.ListFeeTransactions(ctx, store.FeeFilter{LoanID: loan.ID.Hex(), Kind: entity.FeeOverdue})
+	if err != nil {
+		return 0, 0, err
+	}
+	var charged int64
+	for _, charge := range charges {
+		charged += charge.Amount
+	}
+	if fine <= charged {
+		return charged, 0, nil
+	}
+
+	err = s.store.CreateFeeTransaction(ctx, &entity.FeeTransaction{
+		UserID:         loan.UserID,
+		Kind:           entity.FeeOverdue,
+		Amount:         fine - charged,
+		LoanID:         loan.ID.Hex(),
+		Note:           fmt.Sprintf("%d days overdue", days),
+		CreatedAt:      on,
+		IdempotencyKey: fmt.Sprintf("%s:%s:%d", entity.FeeOverdue, loan.ID.Hex(), days),
+	})
+	if errors.Is(err, store.ErrAlreadyExists) {
+		return fine, 0, nil
+	}
+	if err != nil {
+		return charged, 0, err
+	}
+	return fine, fine - charged, nil
+}
+
+// accrueFines brings the fines of every overdue loan up to date.
+func (s *BookRentalServiceServer) accrueFines(ctx context.Context, now time.Time) (entity.JobResult, error) {
+	var result entity.JobResult
+	loans, err := s.store.ListLoans(ctx, store.LoanFilter{State: store.LoanOpen, DueBefore: now.Format("2006-01-02")})
+	if err != nil {
+		return result, err
+	}
+
+	var total int64
+	for _, loan := range loans {
+		_, added, err := s.accrueFine(ctx, loan, now)
+		if err != nil {
+			return result, fmt.Errorf("loan %s: %w", loan.ID.Hex(), err)
+		}
+		result.Checked++
+		if added > 0 {
+			result.Changed++
+			total += added
+			result.Summary = fmt.Sprintf("charged %s to %d overdue loans", formatAmount(total, s.config.Loans.Fines.Currency), result.Changed)
+		}
+	}
+	return result, nil
+}
+
+// feeAccountUser returns the user whose fees the caller asks for, the caller by default.
+func feeAccountUser(ctx context.Context, userID string) (string, error) {
+	callerID, ok := ctx.Value(userIDKey).(string)
+	if !ok {
+		return "", status.Errorf(codes.Unauthenticated, "Invalid token claims")
+	}
+	if userID == "" {
+		return callerID, nil
+	}
+	if userID != callerID && !hasRole(callerRole(ctx), entity.RoleLibrarian) {
+		return "", status.Errorf(codes.PermissionDenied, "only librarians can view another user's fees")
+	}
+	return userID, nil
+}
+
+func toPBFeeTransaction(entry entity.FeeTransaction, balance int64) *pb.FeeTransaction {
+	return &pb.FeeTransaction{
+		Id:        entry.ID.Hex(),
+		UserId:    entry.UserID,
+		Kind:      entry.Kind,
+		Amount:    entry.Amount,
+		LoanId:    entry.LoanID,
+		ChargeId:  entry.ChargeID,
+		Note:      entry.Note,
+		CreatedBy: entry.CreatedBy,
+		CreatedAt: entry.CreatedAt.UTC().Format(time.RFC3339),
+		Balance:   balance,
+	}
+}
+
+// recordFee adds the entry to the ledger and returns it with the user's new balance.
+func (s *BookRentalServiceServer) recordFee(ctx context.Context, message string, entry *entity.FeeTransaction) (*pb.FeeTransactionResponse, error) {
+	err := s.store.CreateFeeTransaction(ctx, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := s.store.FeeBalance(ctx, entry.UserID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch balance: %v", err)
+	}
+	return &pb.FeeTransactionResponse{
+		Message:     message,
+		Transaction: toPBFeeTransaction(*entry, balance),
+		Balance:     balance,
+	}, nil
+}
+
+func (s *BookRentalServiceServer) GetFeeBalance(ctx context.Context, req *pb.GetFeeBalanceRequest) (*pb.GetFeeBalanceResponse, error) {
+	userID, err := feeAccountUser(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := s.store.FeeBalance(ctx, userID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch balance: %v", err)
+	}
+	return &pb.GetFeeBalanceResponse{UserId: userID, Balance: balance, Currency: s.config.Loans.Fines.Currency}, nil
+}
+
+func (s *BookRentalServiceServer) ListFeeTransactions(ctx context.Context, req *pb.ListFeeTransactionsRequest) (*pb.ListFeeTransactionsResponse, error) {
+	userID, err := feeAccountUser(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.store.ListFeeTransactions(ctx, store.FeeFilter{UserID: userID})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch transactions: %v", err)
+	}
+
+	resp := &pb.ListFeeTransactionsResponse{Currency: s.config.Loans.Fines.Currency}
+	for _, entry := range entries {
+		resp.Balance += entry.Amount
+		resp.Transactions = append(resp.Transactions, toPBFeeTransaction(entry, resp.Balance))
+	}
+	return resp, nil
+}
+
+func (s *BookRentalServiceServer) ChargeFee(ctx context.Context, req *pb.ChargeFeeRequest) (*pb.FeeTransactionResponse, error) {
+	callerID, _ := ctx.Value(userIDKey).(string)
+
+	if !manualFeeKinds[req.Kind] {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid kind %q, expected lost or damaged", req.Kind)
+	}
+	amount := req.Amount
+	if amount == 0 {
+		amount = int64(s.config.Loans.Fines.DamageFee)
+		if req.Kind == entity.FeeLost {
+			amount = int64(s.config.Loans.Fines.LostFee)
+		}
+	}
+	if amount <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "amount must be positive")
+	}
+
+	entry := &entity.FeeTransaction{
+		UserID:    req.UserId,
+		Kind:      req.Kind,
+		Amount:    amount,
+		Note:      strings.TrimSpace(req.Note),
+		CreatedBy: callerID,
+		CreatedAt: time.Now(),
+	}
+
+	var loan *entity.BorrowedBooks
+	if req.LoanId != "" {
+		var err error
+		loan, err = s.store.GetLoan(ctx, req.LoanId)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, status.Errorf(codes.NotFound, "borrow record not found")
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to fetch borrow record: %v", err)
+		}
+		if req.UserId != "" && req.UserId != loan.UserID {
+			return nil, status.Errorf(codes.InvalidArgument, "the borrow record belongs to another user")
+		}
+
+		// A loan is charged each fee once
+		entry.UserID = loan.UserID
+		entry.LoanID = loan.ID.Hex()
+		entry.IdempotencyKey = fmt.Sprintf("%s:%s", req.Kind, loan.ID.Hex())
+	} else if _, err := s.store.GetUserByID(ctx, req.UserId); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, status.Errorf(codes.NotFound, "user not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to fetch user: %v", err)
+	}
+
+	if req.Kind == entity.FeeLost {
+		if loan == nil {
+			return nil, status.Errorf(codes.InvalidArgument, "loan_id is required for lost copies")
+		}
+		if loan.ReturnedAt != nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "the book has already been returned")
+		}
+	}
+
+	resp, err := s.recordFee(ctx, "fee charged", entry)
+	if errors.Is(err, store.ErrAlreadyExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "the loan was already charged a %s fee", req.Kind)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to charge fee: %v", err)
+	}
+
+	// A lost copy ends the loan, with its overdue fine up to now
+	if req.Kind == entity.FeeLost {
+		if _, _, err := s.accrueFine(ctx, *loan, entry.CreatedAt); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to charge overdue fine: %v", err)
+		}
+		err := s.store.CloseLoan(ctx, loan.ID.Hex(), entry.CreatedAt)
+		if err != nil && !errors.Is(err, store.ErrConflict) {
+			return nil, status.Errorf(codes.Internal, "failed to close borrow record: %v", err)
+		}
+
+		copyID := loan.CopyID
+		if copyID == "" {
+			copyID = loan.BookID
+		}
+		err = s.store.UpdateCopyStatus(ctx, copyID, entity.CopyBorrowed, entity.CopyLost, copyEvent(copyID, loan.BookID, entity.CopyBorrowed, entity.CopyLost))
+		if err != nil && !errors.Is(err, store.ErrNotFound) && !errors.Is(err, store.ErrConflict) {
+			return nil, status.Errorf(codes.Internal, "failed to update copy status: %v", err)
+		}
+
+		if resp.Balance, err = s.store.FeeBalance(ctx, entry.UserID); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to fetch balance: %v", err)
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *BookRentalServiceServer) RecordPayment(ctx context.Context, req *pb.RecordPaymentRequest) (*pb.FeeTransactionResponse, error) {
+	callerID, _ := ctx.Value(userIDKey).(string)
+
+	if req.Amount <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "amount must be positive")
+	}
+	if _, err := s.store.GetUserByID(ctx, req.UserId); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, status.Errorf(codes.NotFound, "user not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to fetch user: %v", err)
+	}
+
+	balance, err := s.store.FeeBalance(ctx, req.UserId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch balance: %v", err)
+	}
+	if req.Amount > balance {
+		return nil, status.Errorf(codes.FailedPrecondition, "the payment is more than the balance of %s",
+			formatAmount(balance, s.config.Loans.Fines.Currency))
+	}
+
+	resp, err := s.recordFee(ctx, "payment recorded", &entity.FeeTransaction{
+		UserID:    req.UserId,
+		Kind:      entity.FeePayment,
+		Amount:    -req.Amount,
+		Note:      strings.TrimSpace(req.Note),
+		CreatedBy: callerID,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to record payment: %v", err)
+	}
+	return resp, nil
+}
+
+func (s *BookRentalServiceServer) WaiveFee(ctx context.Context, req *pb.WaiveFeeRequest) (*pb.FeeTransactionResponse, error) {
+	callerID, _ := ctx.Value(userIDKey).(string)
+
+	charge, err := s.store.GetFeeTransaction(ctx, req.TransactionId)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "transaction not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch transaction: %v", err)
+	}
+	if charge.Amount <= 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "only charges can be waived, not a %s", charge.Kind)
+	}
+
+	waivers, err := s.store.ListFeeTransactions(ctx, store.FeeFilter{ChargeID: charge.ID.Hex(), Kind: entity.FeeWaiver})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch waivers: %v", err)
+	}
+	var waived int64
+	for _, waiver := range waivers {
+		waived -= waiver.Amount
+	}
+	left := charge.Amount - waived
+
+	amount := req.Amount
+	if amount == 0 {
+		amount = left
+	}
+	if amount < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "amount must be positive")
+	}
+	if left == 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "the charge is already waived")
+	}
+	if amount > left {
+		return nil, status.Errorf(codes.FailedPrecondition, "only %s of the charge is left to waive",
+			formatAmount(left, s.config.Loans.Fines.Currency))
+	}
+
+	// Keyed by what was waived before, so concurrent waivers cannot exceed the charge
+	resp, err := s.recordFee(ctx, "fee waived", &entity.FeeTransaction{
+		UserID:         charge.UserID,
+		Kind:           entity.FeeWaiver,
+		Amount:         -amount,
+		LoanID:         charge.LoanID,
+		ChargeID:       charge.ID.Hex(),
+		Note:           strings.TrimSpace(req.Note),
+		CreatedBy:      callerID,
+		CreatedAt:      time.Now(),
+		IdempotencyKey: fmt.Sprintf("%s:%s:%d", entity.FeeWaiver, charge.ID.Hex(), waived),
+	})
+	if errors.Is(err, store.ErrAlreadyExists) {
+		return nil, status.Errorf(codes.Aborted, "the charge was waived meanwhile, try again")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to waive fee: %v", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gc2-yugo/entity"
+	"gc2-yugo/pb"
+	"gc2-yugo/store"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var activeHoldStatuses = []string{entity.HoldWaiting, entity.HoldReady}
+
+// releaseCopy hands a copy coming back into circulation to the first waiting hold on
+// its title, or makes it available when nobody is waiting. "from" is the copy's current
+// status, empty to overwrite any status. It returns the hold the copy is now kept for.
+func (s *BookRentalServiceServer) releaseCopy(ctx context.Context, copyID, titleID, from string) (*entity.Hold, error) {
+	waiting, err := s.store.ListHolds(ctx, store.HoldFilter{TitleID: titleID, Statuses: []string{entity.HoldWaiting}})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hold := range waiting {
+		if from != entity.CopyOnHold {
+			err := s.store.UpdateCopyStatus(ctx, copyID, from, entity.CopyOnHold, copyEvent(copyID, titleID, from, entity.CopyOnHold))
+			if err != nil {
+				return nil, err
+			}
+			from = entity.CopyOnHold
+		}
+
+		// The hold may have been cancelled since the listing, try the next one
+		readyAt := time.Now()
+		pickupBy := readyAt.Add(s.config.Loans.HoldPickup)
+		ready := holdReadyEvent(hold, copyID, readyAt, pickupBy)
+		err := s.store.ReadyHold(ctx, hold.ID.Hex(), copyID, readyAt, pickupBy, ready)
+		if errors.Is(err, store.ErrConflict) || errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		hold.Status = entity.HoldReady
+		hold.CopyID = copyID
+		hold.ReadyAt = &readyAt
+		hold.PickupBy = &pickupBy
+		return &hold, nil
+	}
+
+	// A new copy is already available, its status does not change
+	var events []entity.OutboxEvent
+	if from != entity.CopyAvailable {
+		events = append(events, copyEvent(copyID, titleID, from, entity.CopyAvailable))
+	}
+	return nil, s.store.UpdateCopyStatus(ctx, copyID, from, entity.CopyAvailable, events...)
+}
+
+// readyHold returns the user's ready hold matching the filter, whose copy is kept for
+// the user. It returns nil when the user has no such hold.
+func (s *BookRentalServiceServer) readyHold(ctx context.Context, userID string, filter store.HoldFilter) (*entity.Hold, error) {
+	filter.UserID = userID
+	filter.Statuses = []string{entity.HoldReady}
+	holds, err := s.store.ListHolds(ctx, filter)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch holds: %v", err)
+	}
+	if len(holds) == 0 {
+		return nil, nil
+	}
+	return &holds[0], nil
+}
+
+// expireHolds closes the ready holds whose pickup deadline passed before now and
+// passes their copies to the next patron in the queue.
+func (s *BookRentalServiceServer) expireHolds(ctx context.Context, now time.Time) (entity.JobResult, error) {
+	var result entity.JobResult
+	holds, err := s.store.ListHolds(ctx, store.HoldFilter{Statuses: []string{entity.HoldReady}, PickupBefore: now})
+	if err != nil {
+		return result, err
+	}
+
+	for _, hold := range holds {
+		result.Checked++
+		// The copy may have been picked up or the hold cancelled since the listing
+		err := s.store.CloseHold(ctx, hold.ID.Hex(), entity.HoldReady, entity.HoldExpired, now)
+		if errors.Is(err, store.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Changed++
+		result.Summary = fmt.Sprintf("expired %d holds", result.Changed)
+
+		if hold.CopyID == "" {
+			continue
+		}
+		_, err = s.releaseCopy(ctx, hold.CopyID, hold.TitleID, entity.CopyOnHold)
+		if err != nil && !errors.Is(err, store.ErrNotFound) && !errors.Is(err, store.ErrConflict) {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// toPBHolds converts the holds, with the queue position of waiting holds and the barcode of kept copies.
+func (s *BookRentalServiceServer) toPBHolds(ctx context.Context, holds []entity.Hold) ([]*pb.Hold, error) {
+	positions := map[string]int{}
+	queues := map[string]bool{}
+	for _, hold := range holds {
+		if hold.Status != entity.HoldWaiting || queues[hold.TitleID] {
+			continue
+		}
+		queues[hold.TitleID] = true
+
+		queue, err := s.store.ListHolds(ctx, store.HoldFilter{TitleID: hold.TitleID, Statuses: []string{entity.HoldWaiting}})
+		if err != nil {
+			return nil, err
+		}
+		for i, queued := range queue {
+			positions[queued.ID.Hex()] = i + 1
+		}
+	}
+
+	var result []*pb.Hold
+	for _, hold := range holds {
+		pbHold := &pb.Hold{
+			Id:        hold.ID.Hex(),
+			BookId:    hold.TitleID,
+			UserId:    hold.UserID,
+			Status:    hold.Status,
+			Position:  int32(positions[hold.ID.Hex()]),
+			CopyId:    hold.CopyID,
+			CreatedAt: hold.CreatedAt.UTC().Format(time.RFC3339),
+		}
+		if hold.PickupBy != nil {
+			pbHold.PickupBy = hold.PickupBy.UTC().Format(time.RFC3339)
+		}
+		if hold.CopyID != "" {
+			item, err := s.store.GetCopy(ctx, hold.CopyID)
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				return nil, err
+			}
+			if item != nil {
+				pbHold.Barcode = item.Barcode
+			}
+		}
+		result = append(result, pbHold)
+	}
+	return result, nil
+}
+
+func (s *BookRentalServiceServer) PlaceHold(ctx context.Context, req *pb.PlaceHoldRequest) (*pb.HoldResponse, error) {
+	userID, ok := ctx.Value(userIDKey).(string)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "Invalid token claims")
+	}
+
+	if _, err := primitive.ObjectIDFromHex(req.BookId); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid book ID format")
+	}
+	if _, err := s.store.GetTitle(ctx, req.BookId); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, status.Errorf(codes.NotFound, "book not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to fetch book: %v", err)
+	}
+
+	// Holds are for books nobody can take from the shelf right now
+	counts, err := s.store.CountCopies(ctx, []string{req.BookId})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to count copies: %v", err)
+	}
+	if counts[req.BookId].Total == 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "the book has no copies")
+	}
+	if counts[req.BookId].Available > 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "a copy of the book is available, borrow it instead")
+	}
+
+	loans, err := s.store.ListLoans(ctx, store.LoanFilter{UserID: userID, BookID: req.BookId, State: store.LoanOpen})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch loans: %v", err)
+	}
+	if len(loans) > 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "you already have this book on loan")
+	}
+
+	hold := entity.Hold{
+		TitleID:   req.BookId,
+		UserID:    userID,
+		Status:    entity.HoldWaiting,
+		CreatedAt: time.Now(),
+	}
+	err = s.store.CreateHold(ctx, &hold)
+	if errors.Is(err, store.ErrAlreadyExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "you already have a hold on this book")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to place hold: %v", err)
+	}
+
+	holds, err := s.toPBHolds(ctx, []entity.Hold{hold})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch holds: %v", err)
+	}
+	return &pb.HoldResponse{Message: "hold placed", Hold: holds[0]}, nil
+}
+
+func (s *BookRentalServiceServer) CancelHold(ctx context.Context, req *pb.CancelHoldRequest) (*pb.HoldResponse, error) {
+	userID, ok := ctx.Value(userIDKey).(string)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "Invalid token claims")
+	}
+
+	hold, err := s.store.GetHold(ctx, req.HoldId)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "hold not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch hold: %v", err)
+	}
+
+	if hold.UserID != userID && !hasRole(callerRole(ctx), entity.RoleLibrarian) {
+		return nil, status.Errorf(codes.PermissionDenied, "the hold belongs to another user")
+	}
+	if hold.Status != entity.HoldWaiting && hold.Status != entity.HoldReady {
+		return nil, status.Errorf(codes.FailedPrecondition, "the hold is already %s", hold.Status)
+	}
+
+	err = s.store.CloseHold(ctx, hold.ID.Hex(), hold.Status, entity.HoldCancelled, time.Now())
+	if errors.Is(err, store.ErrConflict) {
+		return nil, status.Errorf(codes.Aborted, "the hold changed meanwhile, try again")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to cancel hold: %v", err)
+	}
+
+	// A kept copy goes to the next patron in the queue
+	if hold.Status == entity.HoldReady && hold.CopyID != "" {
+		_, err := s.releaseCopy(ctx, hold.CopyID, hold.TitleID, entity.CopyOnHold)
+		if err != nil && !errors.Is(err, store.ErrNotFound) && !errors.Is(err, store.ErrConflict) {
+			return nil, status.Errorf(codes.Internal, "failed to release copy: %v", err)
+		}
+	}
+
+	hold.Status = entity.HoldCancelled
+	holds, err := s.toPBHolds(ctx, []entity.Hold{*hold})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch holds: %v", err)
+	}
+	return &pb.HoldResponse{Message: "hold cancelled", Hold: holds[0]}, nil
+}
+
+func (s *BookRentalServiceServer) ListHolds(ctx context.Context, req *pb.ListHoldsRequest) (*pb.ListHoldsResponse, error) {
+	callerID, ok := ctx.Value(userIDKey).(string)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "Invalid token claims")
+	}
+	librarian := hasRole(callerRole(ctx), entity.RoleLibrarian)
+
+	// Default to the caller's own holds, librarians can see the whole queue of a book
+	userID := req.UserId
+	if userID == "" && (req.BookId == "" || !librarian) {
+		userID = callerID
+	}
+	if userID != "" && userID != callerID && !librarian {
+		return nil, status.Errorf(codes.PermissionDenied, "only librarians can view another user's holds")
+	}
+
+	filter := store.HoldFilter{TitleID: req.BookId, UserID: userID}
+	if !req.IncludeClosed {
+		filter.Statuses = activeHoldStatuses
+	}
+	holds, err := s.store.ListHolds(ctx, filter)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch holds: %v", err)
+	}
+
+	pbHolds, err := s.toPBHolds(ctx, holds)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch holds: %v", err)
+	}
+	return &pb.ListHoldsResponse{Holds: pbHolds}, nil
+}
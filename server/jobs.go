@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gc2-yugo/config"
+	"gc2-yugo/entity"
+	"gc2-yugo/pb"
+	"gc2-yugo/scheduler"
+	"gc2-yugo/store"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// registerJobs adds the server's jobs to its scheduler on their configured specs.
+// Disabled jobs are registered too, so they can still be triggered.
+func (s *BookRentalServiceServer) registerJobs() error {
+	funcs := map[string]func(ctx context.Context, now time.Time) (entity.JobResult, error){
+		config.JobLateBooks:     s.checkLateBooks,
+		config.JobHoldExpiry:    s.expireHolds,
+		config.JobFineAccrual:   s.accrueFines,
+		config.JobNotifications: s.sendNotifications,
+	}
+
+	for _, job := range s.config.Scheduler.Jobs() {
+		run := funcs[job.Name]
+		// Jobs act on the current time, a late run catches up with the missed ones
+		err := s.jobs.Register(job.Name, job.Spec, func(ctx context.Context, scheduled time.Time) (entity.JobResult, error) {
+			return run(ctx, time.Now())
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkLateBooks reports the open loans that are past their due date.
+func (s *BookRentalServiceServer) checkLateBooks(ctx context.Context, now time.Time) (entity.JobResult, error) {
+	var result entity.JobResult
+	loans, err := s.store.ListLoans(ctx, store.LoanFilter{State: store.LoanOpen, DueBefore: now.Format("2006-01-02")})
+	if err != nil {
+		return result, err
+	}
+
+	users := map[string]bool{}
+	for _, loan := range loans {
+		users[loan.UserID] = true
+	}
+	result.Checked = len(loans)
+	if len(loans) > 0 {
+		result.Summary = fmt.Sprintf("%d loans of %d users are overdue", len(loans), len(users))
+	}
+	return result, nil
+}
+
+// jobError maps the scheduler's errors to gRPC statuses.
+func jobError(err error, action string) error {
+	switch {
+	case errors.Is(err, scheduler.ErrUnknownJob):
+		return status.Errorf(codes.NotFound, "job not found")
+	case errors.Is(err, scheduler.ErrLeaseHeld):
+		return status.Errorf(codes.FailedPrecondition, "the job is already running")
+	default:
+		return status.Errorf(codes.Internal, "failed to %s: %v", action, err)
+	}
+}
+
+func toPBJob(job scheduler.Job) *pb.Job {
+	resp := &pb.Job{Name: job.Name, Spec: job.Spec, Paused: job.Paused()}
+	if !job.Next.IsZero() {
+		resp.NextRun = job.Next.Format(time.RFC3339)
+	}
+	if job.Paused() {
+		resp.PausedBy = job.State.UpdatedBy
+		resp.PausedAt = job.State.UpdatedAt.Format(time.RFC3339)
+	}
+	if job.LastRun != nil {
+		resp.LastRun = toPBJobRun(job.LastRun)
+	}
+	return resp
+}
+
+func toPBJobRun(run *entity.JobRun) *pb.JobRun {
+	resp := &pb.JobRun{
+		Id:          run.ID.Hex(),
+		Job:         run.Job,
+		ScheduledAt: run.ScheduledAt.Format(time.RFC3339),
+		StartedAt:   run.StartedAt.Format(time.RFC3339),
+		Status:      run.Status,
+		Error:       run.Error,
+		Checked:     int32(run.Result.Checked),
+		Changed:     int32(run.Result.Changed),
+		Summary:     run.Result.Summary,
+		Instance:    run.Instance,
+		TriggeredBy: run.TriggeredBy,
+	}
+	if run.FinishedAt != nil {
+		resp.FinishedAt = run.FinishedAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+func (s *BookRentalServiceServer) ListJobs(ctx context.Context, req *pb.ListJobsRequest) (*pb.ListJobsResponse, error) {
+	jobs, err := s.jobs.Jobs(ctx)
+	if err != nil {
+		return nil, jobError(err, "list jobs")
+	}
+
+	resp := &pb.ListJobsResponse{}
+	for _, job := range jobs {
+		resp.Jobs = append(resp.Jobs, toPBJob(job))
+	}
+	return resp, nil
+}
+
+// TriggerJob starts a run of the job now, whether it has a spec or is paused. The run
+// goes on after the response, ListJobRuns reports its outcome.
+func (s *BookRentalServiceServer) TriggerJob(ctx context.Context, req *pb.TriggerJobRequest) (*pb.TriggerJobResponse, error) {
+	userID, _ := ctx.Value(userIDKey).(string)
+
+	run, err := s.jobs.Trigger(ctx, req.Name, userID)
+	if err != nil {
+		return nil, jobError(err, "trigger job")
+	}
+
+	return &pb.TriggerJobResponse{
+		Message: "job triggered",
+		Run:     toPBJobRun(run),
+	}, nil
+}
+
+// PauseJob makes every replica skip the scheduled runs of the job until ResumeJob.
+func (s *BookRentalServiceServer) PauseJob(ctx context.Context, req *pb.PauseJobRequest) (*pb.JobResponse, error) {
+	userID, _ := ctx.Value(userIDKey).(string)
+
+	if err := s.jobs.Pause(ctx, req.Name, userID); err != nil {
+		return nil, jobError(err, "pause job")
+	}
+	job, err := s.jobs.Job(ctx, req.Name)
+	if err != nil {
+		return nil, jobError(err, "fetch job")
+	}
+
+	return &pb.JobResponse{Message: "job paused", Job: toPBJob(job)}, nil
+}
+
+func (s *BookRentalServiceServer) ResumeJob(ctx context.Context, req *pb.ResumeJobRequest) (*pb.JobResponse, error) {
+	userID, _ := ctx.Value(userIDKey).(string)
+
+	if err := s.jobs.Resume(ctx, req.Name, userID); err != nil {
+		return nil, jobError(err, "resume job")
+	}
+	job, err := s.jobs.Job(ctx, req.Name)
+	if err != nil {
+		return nil, jobError(err, "fetch job")
+	}
+
+	return &pb.JobResponse{Message: "job resumed", Job: toPBJob(job)}, nil
+}
+
+func (s *BookRentalServiceServer) ListJobRuns(ctx context.Context, req *pb.ListJobRunsRequest) (*pb.ListJobRunsResponse, error) {
+	limit := int(req.Limit)
+	if limit < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must not be negative")
+	}
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	switch req.Status {
+	case "", entity.JobRunning, entity.JobSucceeded, entity.JobFailed:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "status must be %q, %q or %q",
+			entity.JobRunning, entity.JobSucceeded, entity.JobFailed)
+	}
+
+	runs, err := s.jobs.History(ctx, req.Name, req.Status, limit)
+	if err != nil {
+		return nil, jobError(err, "list job runs")
+	}
+
+	resp := &pb.ListJobRunsResponse{}
+	for i := range runs {
+		resp.Runs = append(resp.Runs, toPBJobRun(&runs[i]))
+	}
+	return resp, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gc2-yugo/entity"
+	"gc2-yugo/pb"
+	"gc2-yugo/store"
+	"log"
+	"net/netip"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// errInvalidLogin is returned for unknown usernames and wrong passwords alike,
+// so logins cannot be used to find out which usernames exist.
+var errInvalidLogin = status.Error(codes.Unauthenticated, "invalid username or password")
+
+// Failed logins are counted under these key prefixes
+const (
+	throttleUserPrefix = "user:"
+	throttleIPPrefix   = "ip:"
+)
+
+// clientIP returns the IP of the caller. The x-forwarded-for metadata is only
+// believed when the direct peer is a trusted proxy such as the gateway.
+func (s *BookRentalServiceServer) clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	addrPort, err := netip.ParseAddrPort(p.Addr.String())
+	if err != nil {
+		return ""
+	}
+	addr := addrPort.Addr().Unmap()
+
+	if !s.isTrustedProxy(addr) {
+		return addr.String()
+	}
+
+	// The nearest proxy appends last, earlier entries could be made up by the client
+	forwarded := metadata.ValueFromIncomingContext(ctx, "x-forwarded-for")
+	if len(forwarded) == 0 {
+		return addr.String()
+	}
+	hops := strings.Split(forwarded[len(forwarded)-1], ",")
+	client, err := netip.ParseAddr(strings.TrimSpace(hops[len(hops)-1]))
+	if err != nil {
+		return addr.String()
+	}
+	return client.Unmap().String()
+}
+
+func (s *BookRentalServiceServer) isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range s.config.Auth.Lockout.TrustedProxyPrefixes() {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// loginThrottles lists the counters of a login attempt with their limits.
+func (s *BookRentalServiceServer) loginThrottles(username, ip string) map[string]int {
+	throttles := map[string]int{throttleUserPrefix + username: s.config.Auth.Lockout.MaxFailures}
+	if ip != "" {
+		throttles[throttleIPPrefix+ip] = s.config.Auth.Lockout.IPMaxFailures
+	}
+	return throttles
+}
+
+// checkLockout returns a ResourceExhausted error while the username or the IP is locked.
+func (s *BookRentalServiceServer) checkLockout(ctx context.Context, username, ip string, now time.Time) error {
+	var lockedUntil time.Time
+	for key := range s.loginThrottles(username, ip) {
+		throttle, err := s.store.GetLoginThrottle(ctx, key)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to check login throttle: %v", err)
+		}
+		if throttle.LockedUntil != nil && throttle.LockedUntil.After(lockedUntil) {
+			lockedUntil = *throttle.LockedUntil
+		}
+	}
+	if !lockedUntil.After(now) {
+		return nil
+	}
+
+	s.audit(ctx, &entity.AuditEvent{
+		Type:      entity.AuditLoginBlocked,
+		Username:  username,
+		IP:        ip,
+		Detail:    fmt.Sprintf("locked until %s", lockedUntil.Format(time.RFC3339)),
+		CreatedAt: now,
+	})
+
+	// The same error whether the username exists or not
+	st, err := status.New(codes.ResourceExhausted, "too many failed logins, try again later").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(lockedUntil.Sub(now).Round(time.Second))})
+	if err != nil {
+		return status.Errorf(codes.ResourceExhausted, "too many failed logins, try again later")
+	}
+	return st.Err()
+}
+
+// recordLoginFailure counts the failure against the username and the IP and
+// locks whichever reached its limit.
+func (s *BookRentalServiceServer) recordLoginFailure(ctx context.Context, username, ip string, now time.Time) error {
+	lockout := s.config.Auth.Lockout
+	for key, maxFailures := range s.loginThrottles(username, ip) {
+		throttle, err := s.store.RecordLoginFailure(ctx, key, now, now.Add(-lockout.FailureWindow))
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to record login failure: %v", err)
+		}
+		if throttle.Failures < maxFailures {
+			continue
+		}
+
+		duration := lockoutDuration(throttle.Failures-maxFailures, lockout.BaseLockout, lockout.MaxLockout)
+		if err := s.store.LockLogin(ctx, key, now.Add(duration)); err != nil {
+			return status.Errorf(codes.Internal, "failed to lock login: %v", err)
+		}
+
+		s.audit(ctx, &entity.AuditEvent{
+			Type:      entity.AuditAccountLocked,
+			Username:  username,
+			IP:        ip,
+			Detail:    fmt.Sprintf("%s locked for %s after %d failed logins", key, duration, throttle.Failures),
+			CreatedAt: now,
+		})
+	}
+	return nil
+}
+
+// lockoutDuration doubles the base lockout for every failure past the limit.
+func lockoutDuration(extraFailures int, base, max time.Duration) time.Duration {
+	duration := base
+	for i := 0; i < extraFailures && duration < max; i++ {
+		duration *= 2
+	}
+	if duration > max {
+		return max
+	}
+	return duration
+}
+
+// audit records the event. Audit failures are logged but never fail the request.
+func (s *BookRentalServiceServer) audit(ctx context.Context, event *entity.AuditEvent) {
+	if err := s.store.CreateAuditEvent(ctx, event); err != nil {
+		log.Printf("Failed to record %s audit event: %v", event.Type, err)
+	}
+}
+
+func (s *BookRentalServiceServer) UnlockAccount(ctx context.Context, req *pb.UnlockAccountRequest) (*pb.UnlockAccountResponse, error) {
+	if req.Username == "" && req.Ip == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "username or ip is required")
+	}
+
+	var keys []string
+	if req.Username != "" {
+		keys = append(keys, throttleUserPrefix+req.Username)
+	}
+	if req.Ip != "" {
+		addr, err := netip.ParseAddr(req.Ip)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid ip: %v", err)
+		}
+		keys = append(keys, throttleIPPrefix+addr.Unmap().String())
+	}
+
+	for _, key := range keys {
+		if err := s.store.ClearLoginThrottle(ctx, key); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to unlock %s: %v", key, err)
+		}
+	}
+
+	actorID, _ := ctx.Value(userIDKey).(string)
+	s.audit(ctx, &entity.AuditEvent{
+		Type:      entity.AuditAccountUnlocked,
+		Username:  req.Username,
+		IP:        req.Ip,
+		ActorID:   actorID,
+		CreatedAt: time.Now().UTC(),
+	})
+
+	return &pb.UnlockAccountResponse{Message: "unlocked " + strings.Join(keys, ", ")}, nil
+}
+
+func (s *BookRentalServiceServer) ListAuditEvents(ctx context.Context, req *pb.ListAuditEventsRequest) (*pb.ListAuditEventsResponse, error) {
+	pageSize := int(req.PageSize)
+	if pageSize < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "page_size must not be negative")
+	}
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	events, err := s.store.ListAuditEvents(ctx, store.AuditFilter{
+		Username: req.Username,
+		Type:     req.Type,
+		Limit:    pageSize,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list audit events: %v", err)
+	}
+
+	resp := &pb.ListAuditEventsResponse{}
+	for _, event := range events {
+		resp.Events = append(resp.Events, &pb.AuditEvent{
+			Id:        event.ID.Hex(),
+			Type:      event.Type,
+			Username:  event.Username,
+			Ip:        event.IP,
+			ActorId:   event.ActorID,
+			Detail:    event.Detail,
+			CreatedAt: event.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return resp, nil
+}
@@ -2,52 +2,121 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"gc2-yugo/auth"
 	"gc2-yugo/config"
 	"gc2-yugo/entity"
+	"gc2-yugo/notify"
+	"gc2-yugo/outbox"
 	"gc2-yugo/pb"
+	"gc2-yugo/scheduler"
+	"gc2-yugo/store"
+	"gc2-yugo/utils"
+	"gc2-yugo/webhook"
 	"log"
 	"net"
+	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/golang-jwt/jwt/v4"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
 type BookRentalServiceServer struct {
 	pb.UnimplementedBookRentalServiceServer
-	usersCollection         *mongo.Collection
-	booksCollection         *mongo.Collection
-	borrowedBooksCollection *mongo.Collection
+	store  store.Store
+	config *config.Config
+	keys   *auth.KeySet
+	jobs   *scheduler.Scheduler
+	// events hands the outbox events to subscribers in the process when it is the
+	// relay's sink
+	events *outbox.Bus
+	relay  *outbox.Relay
+	// webhooks queues the relayed events for the partners subscribed to them and
+	// posts them
+	webhooks *webhook.Dispatcher
+	// notifiers by channel, only the configured channels have one
+	notifiers map[string]notify.Notifier
+	templates *notify.Templates
+	// dummyHash is compared with the password of unknown usernames
+	dummyHash func() string
 }
 
-type contextKey string
+func NewBookRentalServiceServer(st store.Store, cfg *config.Config, keys *auth.KeySet) *BookRentalServiceServer {
+	templates, err := notify.LoadTemplates(cfg.Notifications.TemplatesDir)
+	if err != nil {
+		log.Fatalf("Failed to load notification templates: %v", err)
+	}
+
+	jobs := scheduler.New(st, cfg.Scheduler)
+	events := outbox.NewBus()
+	webhooks := webhook.NewDispatcher(st, cfg.Webhooks, jobs.Instance())
+	sink := outbox.Fanout(webhooks, outbox.NewSink(cfg.Outbox, events))
+
+	return &BookRentalServiceServer{
+		store:     st,
+		config:    cfg,
+		keys:      keys,
+		jobs:      jobs,
+		events:    events,
+		relay:     outbox.NewRelay(st, sink, cfg.Outbox, jobs.Instance()),
+		webhooks:  webhooks,
+		notifiers: notify.New(cfg.Notifications),
+		templates: templates,
+		dummyHash: sync.OnceValue(func() string {
+			hash, err := utils.HashPassword("not a password", cfg.Auth.Passwords.BcryptCost)
+			if err != nil {
+				log.Fatalf("Failed to hash dummy password: %v", err)
+			}
+			return hash
+		}),
+	}
+}
 
-const userIDKey contextKey = "user_id"
+// Book statuses reported by GetBooks, a book is available while any of its copies is
+const (
+	bookStatusAvailable   = "Available"
+	bookStatusUnavailable = "Unavailable"
+)
 
 func (s *BookRentalServiceServer) RegisterUser(ctx context.Context, req *pb.RegisterUserRequest) (*pb.RegisterUserResponse, error) {
-	var existingUser entity.User
-	err := s.usersCollection.FindOne(ctx, bson.M{"username": req.Username}).Decode(&existingUser)
-	if err == nil {
-		return nil, status.Errorf(codes.AlreadyExists, "username already exists")
+	// Check the username and the password policy
+	var violations []*errdetails.BadRequest_FieldViolation
+	if strings.TrimSpace(req.Username) == "" {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: "username", Description: "must not be empty"})
+	}
+	for _, description := range utils.ValidatePassword(req.Password, s.config.Auth.Passwords) {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: "password", Description: description})
 	}
-	if err != mongo.ErrNoDocuments {
-		return nil, status.Errorf(codes.Internal, "failed to check existing user: %v", err)
+	if len(violations) > 0 {
+		return nil, invalidArgument("invalid registration", violations)
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password, s.config.Auth.Passwords.BcryptCost)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to hash password: %v", err)
 	}
 
 	newUser := entity.User{
 		Username: req.Username,
-		Password: req.Password,
+		Password: hashedPassword,
+		Role:     entity.RoleMember,
 	}
 
-	_, err = s.usersCollection.InsertOne(ctx, newUser)
+	err = s.store.CreateUser(ctx, &newUser)
+	if errors.Is(err, store.ErrAlreadyExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "username already exists")
+	}
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to register user: %v", err)
 	}
@@ -56,57 +125,157 @@ func (s *BookRentalServiceServer) RegisterUser(ctx context.Context, req *pb.Regi
 
 	return &pb.RegisterUserResponse{
 		Message: "User registered successfully",
+		UserId:  newUser.ID.Hex(),
 	}, nil
 }
 
 func (s *BookRentalServiceServer) LoginUser(ctx context.Context, req *pb.LoginUserRequest) (*pb.LoginUserResponse, error) {
-	var user entity.User
+	now := time.Now().UTC()
+	ip := s.clientIP(ctx)
 
-	err := s.usersCollection.FindOne(ctx, bson.M{"username": req.Username}).Decode(&user)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, status.Errorf(codes.NotFound, "username not found")
-		}
+	// Locked usernames and IPs are refused before the password is checked
+	if err := s.checkLockout(ctx, req.Username, ip, now); err != nil {
+		return nil, err
+	}
 
+	user, err := s.store.GetUserByUsername(ctx, req.Username)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
 		return nil, status.Errorf(codes.Internal, "failed to fetch user: %v", err)
 	}
 
-	if user.Password != req.Password {
-		return nil, status.Errorf(codes.Unauthenticated, "invalid password")
+	// Unknown usernames are checked against a dummy hash so they take as long as wrong passwords
+	storedPassword := s.dummyHash()
+	if user != nil {
+		storedPassword = user.Password
 	}
 
-	token, err := generateJWT(user.ID.Hex())
+	ok, needsRehash := utils.CheckPassword(storedPassword, req.Password, s.config.Auth.Passwords.BcryptCost)
+	if user == nil || !ok {
+		if err := s.recordLoginFailure(ctx, req.Username, ip, now); err != nil {
+			return nil, err
+		}
+		return nil, errInvalidLogin
+	}
+
+	// A successful login forgets the failures of the username, not those of the IP
+	if err := s.store.ClearLoginThrottle(ctx, throttleUserPrefix+req.Username); err != nil {
+		log.Printf("Failed to clear login throttle of %s: %v", req.Username, err)
+	}
+
+	// Upgrade plaintext passwords and hashes of an outdated cost, the login succeeds either way
+	if needsRehash {
+		if err := s.upgradePassword(ctx, user.ID.Hex(), req.Password); err != nil {
+			log.Printf("Failed to upgrade password of user %s: %v", user.ID.Hex(), err)
+		}
+	}
+
+	token, err := s.generateJWT(user.ID.Hex(), user.Role)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to generate token: %v", err)
 	}
 
+	// Each login starts a new family of refresh tokens
+	refreshToken, err := s.issueRefreshToken(ctx, user.ID.Hex(), primitive.NewObjectID().Hex())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to generate refresh token: %v", err)
+	}
+
 	return &pb.LoginUserResponse{
-		Token: token,
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.config.Auth.TokenTTL.Seconds()),
 	}, nil
 }
 
+func (s *BookRentalServiceServer) upgradePassword(ctx context.Context, userID, password string) error {
+	hashedPassword, err := utils.HashPassword(password, s.config.Auth.Passwords.BcryptCost)
+	if err != nil {
+		return err
+	}
+	return s.store.UpdateUserPassword(ctx, userID, hashedPassword)
+}
+
+// invalidArgument returns an InvalidArgument status listing every rejected field.
+func invalidArgument(message string, violations []*errdetails.BadRequest_FieldViolation) error {
+	st, err := status.New(codes.InvalidArgument, message).WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%s", message)
+	}
+	return st.Err()
+}
+
 func (s *BookRentalServiceServer) AddBook(ctx context.Context, req *pb.AddBookRequest) (*pb.BookResponse, error) {
 	publishedDate, err := time.Parse("2006-01-02", req.PublishedDate)
 	if err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "invalid published_date format: %v", err)
 	}
 
-	newBook := entity.Book{
+	newBook := entity.Title{
 		ID:            primitive.NewObjectID(),
 		Title:         req.Title,
 		Author:        req.Author,
+		ISBN:          req.Isbn,
 		PublishedDate: publishedDate,
-		Status:        "Available",
+		ItemType:      strings.TrimSpace(req.ItemType),
+	}
+
+	// Check the copies before anything is stored, a book starts with one new copy by default
+	newCopies := req.Copies
+	if len(newCopies) == 0 {
+		newCopies = []*pb.NewCopy{{}}
+	}
+	var copies []entity.Copy
+	barcodes := map[string]bool{}
+	for _, spec := range newCopies {
+		item, err := newCopy(newBook.ID.Hex(), spec.Barcode, spec.Condition, spec.Location)
+		if err != nil {
+			return nil, err
+		}
+		if barcodes[item.Barcode] {
+			return nil, status.Errorf(codes.InvalidArgument, "barcode %q is given more than once", item.Barcode)
+		}
+		barcodes[item.Barcode] = true
+		_, err = s.store.GetCopyByBarcode(ctx, item.Barcode)
+		if err == nil {
+			return nil, status.Errorf(codes.AlreadyExists, "barcode %q is already used", item.Barcode)
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			return nil, status.Errorf(codes.Internal, "failed to check barcode: %v", err)
+		}
+		copies = append(copies, item)
 	}
 
-	_, err = s.booksCollection.InsertOne(ctx, newBook)
+	added := outbox.BookData{
+		BookID:        newBook.ID.Hex(),
+		Title:         newBook.Title,
+		Author:        newBook.Author,
+		ISBN:          newBook.ISBN,
+		PublishedDate: req.PublishedDate,
+		ItemType:      newBook.ItemType,
+	}
+	events := []entity.OutboxEvent{outbox.NewEvent(entity.EventBookAdded, newBook.ID.Hex(), added, time.Now())}
+	for _, item := range copies {
+		events = append(events, copyEvent(item.ID.Hex(), item.TitleID, "", item.Status))
+	}
+
+	// The book and its copies are stored together, a barcode taken meanwhile stores nothing
+	err = s.store.CreateTitle(ctx, &newBook, copies, events...)
+	if errors.Is(err, store.ErrAlreadyExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "a barcode is already used, the book was not added")
+	}
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to add book: %v", err)
 	}
 
-	return &pb.BookResponse{
+	resp := &pb.BookResponse{
 		Message: "book succesfully added",
-	}, nil
+		BookId:  newBook.ID.Hex(),
+	}
+	for _, item := range copies {
+		resp.Copies = append(resp.Copies, toPBCopy(item))
+	}
+
+	return resp, nil
 }
 
 func (s *BookRentalServiceServer) RemoveBook(ctx context.Context, req *pb.RemoveBookRequest) (*pb.BookResponse, error) {
@@ -115,14 +284,26 @@ func (s *BookRentalServiceServer) RemoveBook(ctx context.Context, req *pb.Remove
 		return nil, status.Errorf(codes.InvalidArgument, "Invalid book ID format: %v", err)
 	}
 
-	result, err := s.booksCollection.DeleteOne(ctx, bson.M{"_id": bookID})
+	borrowed, err := s.store.ListCopies(ctx, store.CopyFilter{TitleID: bookID.Hex(), Status: entity.CopyBorrowed})
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Failed to delete book: %v", err)
+		return nil, status.Errorf(codes.Internal, "Failed to fetch copies: %v", err)
+	}
+	if len(borrowed) > 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "Book has %d copies on loan and cannot be removed", len(borrowed))
 	}
 
-	if result.DeletedCount == 0 {
+	// The copies are removed with the book
+	removed := outbox.BookData{BookID: bookID.Hex()}
+	err = s.store.DeleteTitle(ctx, bookID.Hex(), outbox.NewEvent(entity.EventBookRemoved, bookID.Hex(), removed, time.Now()))
+	if errors.Is(err, store.ErrNotFound) {
 		return nil, status.Errorf(codes.NotFound, "Book not found")
 	}
+	if errors.Is(err, store.ErrConflict) {
+		return nil, status.Errorf(codes.FailedPrecondition, "Book has borrow records and cannot be removed")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to delete book: %v", err)
+	}
 
 	return &pb.BookResponse{
 		Message: "Book successfully removed",
@@ -137,174 +318,529 @@ func (s *BookRentalServiceServer) BorrowBook(ctx context.Context, req *pb.Borrow
 		return nil, status.Errorf(codes.Unauthenticated, "Invalid token claims")
 	}
 
-	// Validate book ID
-	bookID, err := primitive.ObjectIDFromHex(req.BookId)
+	switch {
+	case req.BookId != "" && req.Barcode != "":
+		return nil, status.Errorf(codes.InvalidArgument, "set either book_id or barcode, not both")
+	case req.Barcode == "":
+		if _, err := primitive.ObjectIDFromHex(req.BookId); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid book ID format")
+		}
+	}
+
+	// A borrow that lost the copy, the hold or the user's loan count to a concurrent
+	// change starts over, checking the circulation rules again
+	for attempt := 0; attempt < borrowAttempts; attempt++ {
+		borrowedBook, item, err := s.lendCopy(ctx, userID, req)
+		if errors.Is(err, store.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return &pb.BorrowBookResponse{
+			Message:  "Book borrowed successfully",
+			BorrowId: borrowedBook.ID.Hex(),
+			Barcode:  item.Barcode,
+		}, nil
+	}
+	return nil, status.Errorf(codes.Aborted, "the book changed meanwhile, try again")
+}
+
+// borrowAttempts bounds how often BorrowBook starts over after losing a race.
+const borrowAttempts = 3
+
+// lendCopy checks the circulation rules and lends the copy asked for by barcode, or
+// a copy of the title: the one kept for the user's hold, else any available one. The
+// copy, the hold and the loan are written in one store transaction, which also makes
+// sure the user borrowed nothing since the rules were checked. It returns
+// store.ErrConflict when every candidate copy or the user's loans changed meanwhile.
+func (s *BookRentalServiceServer) lendCopy(ctx context.Context, userID string, req *pb.BorrowBookRequest) (*entity.BorrowedBooks, *entity.Copy, error) {
+	var policy config.Policy
+	var loanVersion int
+	var hold *entity.Hold
+	var candidates []entity.Copy
+	if req.Barcode != "" {
+		found, err := s.store.GetCopyByBarcode(ctx, req.Barcode)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil, status.Errorf(codes.NotFound, "copy not found")
+		}
+		if err != nil {
+			return nil, nil, status.Errorf(codes.Internal, "Failed to fetch copy")
+		}
+		title, err := s.store.GetTitle(ctx, found.TitleID)
+		if err != nil {
+			return nil, nil, status.Errorf(codes.Internal, "Failed to fetch book")
+		}
+		if policy, loanVersion, err = s.checkBorrowPolicy(ctx, userID, title); err != nil {
+			return nil, nil, err
+		}
+
+		switch found.Status {
+		case entity.CopyAvailable:
+		case entity.CopyOnHold:
+			if hold, err = s.readyHold(ctx, userID, store.HoldFilter{CopyID: found.ID.Hex()}); err != nil {
+				return nil, nil, err
+			}
+			if hold == nil {
+				return nil, nil, status.Errorf(codes.FailedPrecondition, "the copy is on hold for another patron")
+			}
+		default:
+			return nil, nil, status.Errorf(codes.FailedPrecondition, "the copy is not available")
+		}
+		candidates = []entity.Copy{*found}
+	} else {
+		title, err := s.store.GetTitle(ctx, req.BookId)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil, status.Errorf(codes.NotFound, "book not found")
+		}
+		if err != nil {
+			return nil, nil, status.Errorf(codes.Internal, "Failed to fetch book")
+		}
+		if policy, loanVersion, err = s.checkBorrowPolicy(ctx, userID, title); err != nil {
+			return nil, nil, err
+		}
+
+		// A copy kept for the user's hold comes first
+		if hold, err = s.readyHold(ctx, userID, store.HoldFilter{TitleID: req.BookId}); err != nil {
+			return nil, nil, err
+		}
+		if hold != nil {
+			item, err := s.store.GetCopy(ctx, hold.CopyID)
+			if err != nil {
+				return nil, nil, status.Errorf(codes.Internal, "Failed to fetch copy")
+			}
+			candidates = []entity.Copy{*item}
+		} else {
+			candidates, err = s.store.ListCopies(ctx, store.CopyFilter{TitleID: req.BookId, Status: entity.CopyAvailable})
+			if err != nil {
+				return nil, nil, status.Errorf(codes.Internal, "Failed to fetch copies")
+			}
+			if len(candidates) == 0 {
+				return nil, nil, status.Errorf(codes.FailedPrecondition, "no copy of the book is available, place a hold to join the queue")
+			}
+		}
+	}
+
+	from, holdID := entity.CopyAvailable, ""
+	if hold != nil {
+		from, holdID = entity.CopyOnHold, hold.ID.Hex()
+	}
+
+	// Another borrower may take a copy between the listing and the borrow, try the next one
+	now := time.Now()
+	for _, item := range candidates {
+		borrowedBook := entity.BorrowedBooks{
+			ID:           primitive.NewObjectID(),
+			BookID:       item.TitleID,
+			CopyID:       item.ID.Hex(),
+			UserID:       userID,
+			BorrowedDate: now.Format("2006-01-02"),                    // Format date as string (or use time.Time)
+			ReturnDate:   now.Add(policy.Period).Format("2006-01-02"), // Add the loan period of the rules to borrowedDate
+		}
+
+		borrowed := outbox.NewEvent(entity.EventBookBorrowed, item.TitleID, loanData(borrowedBook), now)
+		err := s.store.BorrowCopy(ctx, &borrowedBook, from, holdID, loanVersion, now, borrowed)
+		if errors.Is(err, store.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, status.Errorf(codes.Internal, "Failed to record borrowed book")
+		}
+		item.Status = entity.CopyBorrowed
+		return &borrowedBook, &item, nil
+	}
+	return nil, nil, store.ErrConflict
+}
+
+func (s *BookRentalServiceServer) ReturnBook(ctx context.Context, req *pb.ReturnBookRequest) (*pb.ReturnBookResponse, error) {
+	// Extract user ID from JWT claims
+	userID, ok := ctx.Value(userIDKey).(string)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "Invalid token claims")
+	}
+
+	// Validate borrow ID
+	borrowID, err := primitive.ObjectIDFromHex(req.BorrowId)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "Invalid book ID format")
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid borrow ID format")
 	}
 
-	// Find the book by ID
-	var book entity.Book
-	err = s.booksCollection.FindOne(ctx, bson.M{"_id": req.BookId}).Decode(&book)
+	// Find the borrow record by ID
+	borrowedBook, err := s.store.GetLoan(ctx, borrowID.Hex())
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, status.Errorf(codes.NotFound, "book not found")
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, status.Errorf(codes.NotFound, "borrow record not found")
 		}
-		return nil, status.Errorf(codes.Internal, "failed to fetch book: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to fetch borrow record: %v", err)
+	}
+
+	// Only the borrower can return the book
+	if borrowedBook.UserID != userID {
+		return nil, status.Errorf(codes.PermissionDenied, "the borrow record belongs to another user")
 	}
 
-	// Check if the book is already borrowed
-	if book.Status == "borrowed" {
-		return nil, status.Errorf(codes.InvalidArgument, "the book is already borrowed")
+	if borrowedBook.ReturnedAt != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "the book has already been returned")
 	}
 
-	// Update book status to "borrowed"
-	_, err = s.booksCollection.UpdateOne(ctx, bson.M{"_id": bookID}, bson.M{"$set": bson.M{"status": "borrowed"}})
+	// Charge the overdue fine before closing the borrow record: a failed charge leaves the
+	// loan open for a retry or the fine accrual job, and a retry does not charge the same
+	// days again
+	returnedAt := time.Now()
+	fine, _, err := s.accrueFine(ctx, *borrowedBook, returnedAt)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Failed to update book status")
+		return nil, status.Errorf(codes.Internal, "Failed to charge the overdue fine")
 	}
 
-	borrowedDate := time.Now().Format("2006-01-02")                       // Format date as string (or use time.Time)
-	returnDate := time.Now().Add(7 * 24 * time.Hour).Format("2006-01-02") // Add 7 days to borrowedDate
+	// Close the borrow record, only if it is still open
+	closed := *borrowedBook
+	closed.ReturnedAt = &returnedAt
+	returned := outbox.NewEvent(entity.EventBookReturned, borrowedBook.BookID, loanData(closed), returnedAt)
+	err = s.store.CloseLoan(ctx, borrowID.Hex(), returnedAt, returned)
+	if errors.Is(err, store.ErrConflict) {
+		return nil, status.Errorf(codes.FailedPrecondition, "the book has already been returned")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to close borrow record")
+	}
 
-	// Create a BorrowedBooks entry
-	borrowedBook := entity.BorrowedBooks{
-		ID:           primitive.NewObjectID(),
-		BookID:       bookID.Hex(),
-		UserID:       userID,
-		BorrowedDate: borrowedDate,
-		ReturnDate:   returnDate,
+	// Loans from before copies existed have no copy, their book became a copy with the same ID
+	copyID := borrowedBook.CopyID
+	if copyID == "" {
+		copyID = borrowedBook.BookID
 	}
 
-	_, err = s.borrowedBooksCollection.InsertOne(ctx, borrowedBook)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Failed to record borrowed book")
+	// Keep the copy for the next patron in the queue, or put it back on the shelf
+	hold, err := s.releaseCopy(ctx, copyID, borrowedBook.BookID, "")
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.Internal, "Failed to update copy status")
 	}
 
-	return &pb.BorrowBookResponse{
-		Message: "Book borrowed successfully",
+	return &pb.ReturnBookResponse{
+		Message: "Book returned successfully",
+		BookId:  borrowedBook.BookID,
+		CopyId:  copyID,
+		OnHold:  hold != nil,
+		Fine:    fine,
 	}, nil
 }
 
-func UnaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	fmt.Printf("Handling method: %s\n", info.FullMethod)
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
 
-	if info.FullMethod == "/bookrental.BookRentalService/RegisterUser" || info.FullMethod == "/bookrental.BookRentalService/LoginUser" {
-		return handler(ctx, req)
-	}
+// bookCursor is the position after the last book of a page, in (title, _id) order.
+type bookCursor struct {
+	Title string `json:"t"`
+	ID    string `json:"id"`
+}
 
-	ctx, err := AuthInterceptor(ctx)
+func encodeBookCursor(book entity.Title) string {
+	data, _ := json.Marshal(bookCursor{Title: book.Title, ID: book.ID.Hex()})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeBookCursor(token string) (bookCursor, error) {
+	var cursor bookCursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
 	if err != nil {
-		return nil, err
+		return cursor, err
 	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, err
+	}
+	if _, err := primitive.ObjectIDFromHex(cursor.ID); err != nil {
+		return cursor, err
+	}
+	return cursor, nil
+}
 
-	return handler(ctx, req)
+func toPBBook(book entity.Title, counts store.CopyCounts) *pb.Book {
+	bookStatus := bookStatusUnavailable
+	if counts.Available > 0 {
+		bookStatus = bookStatusAvailable
+	}
+
+	return &pb.Book{
+		Id:              book.ID.Hex(),
+		Title:           book.Title,
+		Author:          book.Author,
+		PublishedDate:   book.PublishedDate.Format("2006-01-02"),
+		Status:          bookStatus,
+		Isbn:            book.ISBN,
+		AvailableCopies: int32(counts.Available),
+		TotalCopies:     int32(counts.Total),
+		ItemType:        book.ItemType,
+	}
 }
 
-func AuthInterceptor(ctx context.Context) (context.Context, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		fmt.Println("No metadata found")
-		return nil, status.Errorf(codes.Unauthenticated, "Unauthorized: No metadata found")
+func (s *BookRentalServiceServer) GetBooks(ctx context.Context, req *pb.GetBooksRequest) (*pb.GetBooksResponse, error) {
+	pageSize := int(req.PageSize)
+	if pageSize < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "page_size must not be negative")
+	}
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
 	}
 
-	tokenList := md["authorization"]
-	if len(tokenList) == 0 {
-		fmt.Println("Invalid or missing token")
-		return nil, status.Errorf(codes.Unauthenticated, "Unauthorized: invalid or missing token")
+	// Build the filter from the optional request fields
+	filter := store.TitleFilter{
+		CopyStatus:  req.Status,
+		Author:      req.Author,
+		TitlePrefix: req.TitlePrefix,
+		// Fetch one extra book to know whether there is a next page
+		Limit: pageSize + 1,
 	}
 
-	token := strings.TrimPrefix(tokenList[0], "Bearer ")
+	if req.PublishedFrom != "" {
+		from, err := time.Parse("2006-01-02", req.PublishedFrom)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid published_from format: %v", err)
+		}
+		filter.PublishedFrom = from
+	}
+	if req.PublishedTo != "" {
+		to, err := time.Parse("2006-01-02", req.PublishedTo)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid published_to format: %v", err)
+		}
+		filter.PublishedTo = to
+	}
+
+	// Restrict to the books currently borrowed by the given user, only librarians can
+	// see another user's loans
+	if req.UserId != "" {
+		callerID, _ := ctx.Value(userIDKey).(string)
+		if req.UserId != callerID && !hasRole(callerRole(ctx), entity.RoleLibrarian) {
+			return nil, status.Errorf(codes.PermissionDenied, "only librarians can view another user's loans")
+		}
+		borrowedBooks, err := s.store.ListLoans(ctx, store.LoanFilter{UserID: req.UserId, State: store.LoanOpen})
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to fetch borrowed books: %v", err)
+		}
 
-	claims, err := validateJWT(token)
+		filter.IDs = []string{}
+		for _, borrowedBook := range borrowedBooks {
+			filter.IDs = append(filter.IDs, borrowedBook.BookID)
+		}
+	}
+
+	// Resume after the last book of the previous page
+	if req.PageToken != "" {
+		after, err := decodeBookCursor(req.PageToken)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid page_token")
+		}
+		filter.AfterTitle = after.Title
+		filter.AfterID = after.ID
+	}
+
+	books, err := s.store.ListTitles(ctx, filter)
 	if err != nil {
-		fmt.Printf("Token validation failed: %v\n", err)
-		return nil, status.Errorf(codes.Unauthenticated, "Unauthorized: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to fetch books: %v", err)
 	}
 
-	userID, ok := claims["user_id"].(string)
-	if !ok {
-		return nil, status.Errorf(codes.Unauthenticated, "Unauthorized: Invalid token claims")
+	resp := &pb.GetBooksResponse{}
+	if len(books) > pageSize {
+		books = books[:pageSize]
+		resp.NextPageToken = encodeBookCursor(books[len(books)-1])
 	}
 
-	ctx = context.WithValue(ctx, userIDKey, userID)
+	bookIDs := []string{}
+	for _, book := range books {
+		bookIDs = append(bookIDs, book.ID.Hex())
+	}
+	counts, err := s.store.CountCopies(ctx, bookIDs)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to count copies: %v", err)
+	}
 
-	fmt.Println("Token validated successfully")
-	return ctx, nil
+	for _, book := range books {
+		resp.Books = append(resp.Books, toPBBook(book, counts[book.ID.Hex()]))
+	}
+
+	return resp, nil
 }
 
-func generateJWT(userID string) (string, error) {
-	secretKey := []byte("12345")
+// Loan history filters accepted by GetBorrowedBooks
+const (
+	loanFilterActive   = "active"
+	loanFilterReturned = "returned"
+	loanFilterOverdue  = "overdue"
+)
 
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
-		"iat":     time.Now().Unix(),
+func (s *BookRentalServiceServer) GetBorrowedBooks(ctx context.Context, req *pb.GetBorrowedBooksRequest) (*pb.GetBorrowedBooksResponse, error) {
+	// Extract user ID from JWT claims
+	callerID, ok := ctx.Value(userIDKey).(string)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "Invalid token claims")
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	return token.SignedString(secretKey)
-}
+	// Default to the caller's own history, only admins can see other users
+	userID := req.UserId
+	if userID == "" {
+		userID = callerID
+	}
+	if userID != callerID && !hasRole(callerRole(ctx), entity.RoleAdmin) {
+		return nil, status.Errorf(codes.PermissionDenied, "only admins can view another user's loans")
+	}
 
-func validateJWT(tokenString string) (jwt.MapClaims, error) {
-	secretKey := []byte("12345")
+	today := time.Now().Format("2006-01-02")
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return secretKey, nil
-	})
+	filter := store.LoanFilter{UserID: userID}
+	switch req.Filter {
+	case "":
+	case loanFilterActive:
+		filter.State = store.LoanOpen
+	case loanFilterReturned:
+		filter.State = store.LoanClosed
+	case loanFilterOverdue:
+		filter.State = store.LoanOpen
+		filter.DueBefore = today
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid filter %q, expected active, returned or overdue", req.Filter)
+	}
 
+	borrowedBooks, err := s.store.ListLoans(ctx, filter)
 	if err != nil {
-		return nil, err
+		return nil, status.Errorf(codes.Internal, "failed to fetch borrowed books: %v", err)
+	}
+
+	// Join the loans with their books' title and author
+	bookIDs := []string{}
+	for _, borrowedBook := range borrowedBooks {
+		bookIDs = append(bookIDs, borrowedBook.BookID)
+	}
+
+	books := map[string]entity.Title{}
+	if len(bookIDs) > 0 {
+		found, err := s.store.ListTitles(ctx, store.TitleFilter{IDs: bookIDs})
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to fetch books: %v", err)
+		}
+		for _, book := range found {
+			books[book.ID.Hex()] = book
+		}
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+	resp := &pb.GetBorrowedBooksResponse{}
+	for _, borrowedBook := range borrowedBooks {
+		book := books[borrowedBook.BookID]
+
+		loan := &pb.BorrowedBook{
+			Id:           borrowedBook.ID.Hex(),
+			BookId:       borrowedBook.BookID,
+			CopyId:       borrowedBook.CopyID,
+			UserId:       borrowedBook.UserID,
+			BorrowedDate: borrowedBook.BorrowedDate,
+			DueDate:      borrowedBook.ReturnDate,
+			Title:        book.Title,
+			Author:       book.Author,
+			Renewals:     toPBRenewals(borrowedBook.Renewals),
+		}
+		if borrowedBook.ReturnedAt != nil {
+			loan.ReturnDate = borrowedBook.ReturnedAt.Format(time.RFC3339)
+		} else {
+			loan.Overdue = borrowedBook.ReturnDate < today
+		}
 
-		return claims, nil
+		resp.BorrowedBooks = append(resp.BorrowedBooks, loan)
 	}
 
-	return nil, fmt.Errorf("invalid token")
+	return resp, nil
 }
 
 func main() {
 	ctx := context.Background()
 
-	usersCollection, err := config.ConnectionDatabaseUsers(ctx)
+	cfg, args, err := config.Load(os.Args[1:])
 	if err != nil {
-		log.Fatalf("failed to connect users database: %v", err)
+		log.Fatalf("failed to load configuration: %v", err)
+	}
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			err = runMigrate(ctx, cfg.Storage, args[1:])
+		case "role":
+			err = runRole(ctx, cfg.Storage, args[1:])
+		default:
+			log.Fatalf("unknown command %q, expected migrate or role", args[0])
+		}
+		if err != nil {
+			log.Fatalf("%s: %v", args[0], err)
+		}
+		return
+	}
+
+	if len(cfg.Auth.Keys) == 0 && cfg.Auth.JWTSecret == config.DefaultJWTSecret {
+		log.Println("WARNING: using the default JWT secret, set JWT_SECRET or auth.keys outside of local development")
 	}
 
-	booksCollection, err := config.ConnectionDatabaseBooks(ctx)
+	keys, err := auth.NewKeySet(cfg.Auth)
 	if err != nil {
-		log.Fatalf("failed to connect books database: %v", err)
+		log.Fatalf("failed to load signing keys: %v", err)
 	}
 
-	borrowedBooksCollection, err := config.ConnectionDatabaseBorrowedBooks(ctx)
+	bookStore, closeStore, err := openStore(ctx, cfg.Storage)
 	if err != nil {
-		log.Fatalf("failed to connect borrowed_books database: %v", err)
+		log.Fatalf("failed to open %s storage: %v", cfg.Storage.Backend, err)
 	}
 
+	bookRentalService := NewBookRentalServiceServer(bookStore, cfg, keys)
+
+	if err := bookRentalService.registerJobs(); err != nil {
+		log.Fatalf("failed to register the scheduled jobs: %v", err)
+	}
+	if cfg.Scheduler.Enabled {
+		log.Printf("Running the scheduled jobs as instance %s", bookRentalService.jobs.Instance())
+		bookRentalService.jobs.Start(ctx)
+	}
+	bookRentalService.relay.Start(ctx)
+	bookRentalService.webhooks.Start(ctx)
+
 	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(UnaryAuthInterceptor),
+		grpc.UnaryInterceptor(bookRentalService.UnaryAuthInterceptor),
+		grpc.StreamInterceptor(bookRentalService.StreamAuthInterceptor),
 	)
-	bookRentalService := &BookRentalServiceServer{
-		usersCollection:         usersCollection,
-		booksCollection:         booksCollection,
-		borrowedBooksCollection: borrowedBooksCollection,
-	}
 
 	pb.RegisterBookRentalServiceServer(grpcServer, bookRentalService)
 
-	listen, err := net.Listen("tcp", ":50051")
+	pruneCtx, stopPruning := context.WithCancel(ctx)
+	go bookRentalService.pruneSessions(pruneCtx, time.Hour)
+
+	listen, err := net.Listen("tcp", cfg.Server.Address)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	log.Println("Server is running on port 50051 . . .")
+
+	// Stop serving on SIGINT/SIGTERM so the storage connection is released cleanly
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Println("Shutting down . . .")
+		grpcServer.GracefulStop()
+	}()
+
+	log.Printf("Server is running on %s . . .", cfg.Server.Address)
 
 	if err := grpcServer.Serve(listen); err != nil {
 		log.Fatalf("Failed to serve: %v", err)
 	}
+	stopPruning()
+	bookRentalService.jobs.Stop()
+	bookRentalService.relay.Stop()
+	bookRentalService.webhooks.Stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := closeStore(shutdownCtx); err != nil {
+		log.Printf("failed to close storage: %v", err)
+	}
 }
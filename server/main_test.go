@@ -0,0 +1,2068 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gc2-yugo/auth"
+	"gc2-yugo/config"
+	"gc2-yugo/entity"
+	"gc2-yugo/notify/smtptest"
+	"gc2-yugo/outbox"
+	"gc2-yugo/pb"
+	"gc2-yugo/store"
+	"gc2-yugo/webhook"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// The default configuration with the cheapest bcrypt cost, to keep the tests fast
+func testConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Auth.Passwords.BcryptCost = bcrypt.MinCost
+	return cfg
+}
+
+func newTestService(t *testing.T, memoryStore *store.MemoryStore) *BookRentalServiceServer {
+	return newTestServiceWithConfig(t, memoryStore, testConfig())
+}
+
+func newTestServiceWithConfig(t *testing.T, memoryStore *store.MemoryStore, cfg *config.Config) *BookRentalServiceServer {
+	keys, err := auth.NewKeySet(cfg.Auth)
+	require.NoError(t, err)
+	service := NewBookRentalServiceServer(memoryStore, cfg, keys)
+	require.NoError(t, service.registerJobs())
+	t.Cleanup(service.jobs.Stop)
+	return service
+}
+
+// Start the real service on an in-memory store and an in-memory listener
+func setupTestServer(t *testing.T) (pb.BookRentalServiceClient, *store.MemoryStore) {
+	return setupTestServerWithConfig(t, testConfig())
+}
+
+func setupTestServerWithConfig(t *testing.T, cfg *config.Config) (pb.BookRentalServiceClient, *store.MemoryStore) {
+	memoryStore := store.NewMemoryStore()
+	service := newTestServiceWithConfig(t, memoryStore, cfg)
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(service.UnaryAuthInterceptor),
+		grpc.StreamInterceptor(service.StreamAuthInterceptor),
+	)
+	pb.RegisterBookRentalServiceServer(server, service)
+
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			log.Printf("Server stopped: %v", err)
+		}
+	}()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		conn.Close()
+		server.Stop()
+	})
+
+	return pb.NewBookRentalServiceClient(conn), memoryStore
+}
+
+// Create a user directly in the store and return a context carrying its token
+func createUser(t *testing.T, memoryStore *store.MemoryStore, username, role string) (string, context.Context) {
+	user := entity.User{Username: username, Password: "secret", Role: role}
+	require.NoError(t, memoryStore.CreateUser(context.Background(), &user))
+
+	token, err := newTestService(t, memoryStore).generateJWT(user.ID.Hex(), user.Role)
+	require.NoError(t, err)
+
+	md := metadata.Pairs("authorization", "Bearer "+token)
+	return user.ID.Hex(), metadata.NewOutgoingContext(context.Background(), md)
+}
+
+func addBook(t *testing.T, client pb.BookRentalServiceClient, ctx context.Context, title, author, publishedDate string) string {
+	resp, err := client.AddBook(ctx, &pb.AddBookRequest{Title: title, Author: author, PublishedDate: publishedDate})
+	require.NoError(t, err)
+	return resp.BookId
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	ctx := context.Background()
+
+	resp, err := client.RegisterUser(ctx, &pb.RegisterUserRequest{Username: "peter", Password: "Klewear123"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.UserId)
+
+	// New users are members and only the hash of their password is stored
+	user, err := memoryStore.GetUserByID(ctx, resp.UserId)
+	require.NoError(t, err)
+	assert.Equal(t, entity.RoleMember, user.Role)
+	assert.NotEqual(t, "Klewear123", user.Password)
+	cost, err := bcrypt.Cost([]byte(user.Password))
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.MinCost, cost)
+
+	// Usernames are unique
+	_, err = client.RegisterUser(ctx, &pb.RegisterUserRequest{Username: "peter", Password: "Other1234"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	// Wrong passwords and unknown usernames get the same error
+	_, err = client.LoginUser(ctx, &pb.LoginUserRequest{Username: "peter", Password: "wrong"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, unknownErr := client.LoginUser(ctx, &pb.LoginUserRequest{Username: "paul", Password: "wrong"})
+	assert.Equal(t, status.Convert(err).Proto(), status.Convert(unknownErr).Proto())
+
+	login, err := client.LoginUser(ctx, &pb.LoginUserRequest{Username: "peter", Password: "Klewear123"})
+	require.NoError(t, err)
+
+	claims, err := newTestService(t, memoryStore).validateJWT(login.Token)
+	require.NoError(t, err)
+	assert.Equal(t, resp.UserId, claims["user_id"])
+	assert.Equal(t, entity.RoleMember, claims["role"])
+}
+
+func TestLoginLockout(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	ctx := context.Background()
+	_, adminCtx := createUser(t, memoryStore, "admin", entity.RoleAdmin)
+
+	_, err := client.RegisterUser(ctx, &pb.RegisterUserRequest{Username: "peter", Password: "Klewear123"})
+	require.NoError(t, err)
+
+	// The fifth failure locks the username
+	for i := 0; i < 5; i++ {
+		_, err = client.LoginUser(ctx, &pb.LoginUserRequest{Username: "peter", Password: "wrong"})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+
+	_, err = client.LoginUser(ctx, &pb.LoginUserRequest{Username: "peter", Password: "Klewear123"})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	details := status.Convert(err).Details()
+	require.Len(t, details, 1)
+	retry, ok := details[0].(*errdetails.RetryInfo)
+	require.True(t, ok)
+	assert.InDelta(t, time.Minute.Seconds(), retry.RetryDelay.AsDuration().Seconds(), 2)
+
+	// Unknown usernames are locked the same way
+	for i := 0; i < 6; i++ {
+		_, err = client.LoginUser(ctx, &pb.LoginUserRequest{Username: "paul", Password: "wrong"})
+	}
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	locked, err := client.ListAuditEvents(adminCtx, &pb.ListAuditEventsRequest{Type: entity.AuditAccountLocked})
+	require.NoError(t, err)
+	require.Len(t, locked.Events, 2)
+	assert.Equal(t, "paul", locked.Events[0].Username)
+	assert.Equal(t, "peter", locked.Events[1].Username)
+
+	// Members cannot unlock accounts
+	_, memberCtx := createUser(t, memoryStore, "mary", entity.RoleMember)
+	_, err = client.UnlockAccount(memberCtx, &pb.UnlockAccountRequest{Username: "peter"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.UnlockAccount(adminCtx, &pb.UnlockAccountRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.UnlockAccount(adminCtx, &pb.UnlockAccountRequest{Username: "peter"})
+	require.NoError(t, err)
+	_, err = client.LoginUser(ctx, &pb.LoginUserRequest{Username: "peter", Password: "Klewear123"})
+	require.NoError(t, err)
+
+	events, err := client.ListAuditEvents(adminCtx, &pb.ListAuditEventsRequest{Username: "peter"})
+	require.NoError(t, err)
+	require.NotEmpty(t, events.Events)
+	assert.Equal(t, entity.AuditAccountUnlocked, events.Events[0].Type)
+	assert.NotEmpty(t, events.Events[0].ActorId)
+
+	blocked, err := client.ListAuditEvents(adminCtx, &pb.ListAuditEventsRequest{Type: entity.AuditLoginBlocked, PageSize: 1})
+	require.NoError(t, err)
+	assert.Len(t, blocked.Events, 1)
+}
+
+func TestLoginBackoff(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	service := newTestService(t, memoryStore)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	// Every failure past the limit doubles the lockout
+	for i := 0; i < 4; i++ {
+		require.NoError(t, service.recordLoginFailure(ctx, "peter", "", now))
+	}
+	_, err := memoryStore.GetLoginThrottle(ctx, "user:peter")
+	require.NoError(t, err)
+
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		require.NoError(t, service.recordLoginFailure(ctx, "peter", "", now))
+		throttle, err := memoryStore.GetLoginThrottle(ctx, "user:peter")
+		require.NoError(t, err)
+		require.NotNil(t, throttle.LockedUntil)
+		assert.Equal(t, want, throttle.LockedUntil.Sub(now))
+	}
+
+	assert.Equal(t, time.Hour, lockoutDuration(20, time.Minute, time.Hour))
+	assert.Equal(t, time.Hour, lockoutDuration(1000, time.Minute, time.Hour))
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	service := newTestService(t, memoryStore)
+	service.config.Auth.Lockout.IPMaxFailures = 3
+
+	// Failures spread over many usernames still lock the IP
+	attacker := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 4000}})
+	for _, username := range []string{"a", "b", "c"} {
+		_, err := service.LoginUser(attacker, &pb.LoginUserRequest{Username: username, Password: "wrong"})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+	_, err := service.LoginUser(attacker, &pb.LoginUserRequest{Username: "d", Password: "wrong"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// Other clients are not affected
+	other := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.8"), Port: 4000}})
+	_, err = service.LoginUser(other, &pb.LoginUserRequest{Username: "d", Password: "wrong"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestClientIP(t *testing.T) {
+	service := newTestService(t, store.NewMemoryStore())
+
+	withPeer := func(ip string, forwarded ...string) context.Context {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 4000}})
+		if len(forwarded) > 0 {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", forwarded[0]))
+		}
+		return ctx
+	}
+
+	assert.Equal(t, "", service.clientIP(context.Background()))
+	assert.Equal(t, "203.0.113.7", service.clientIP(withPeer("203.0.113.7")))
+	// Only trusted proxies may name the client
+	assert.Equal(t, "203.0.113.7", service.clientIP(withPeer("203.0.113.7", "198.51.100.1")))
+	assert.Equal(t, "198.51.100.1", service.clientIP(withPeer("127.0.0.1", "198.51.100.1")))
+	assert.Equal(t, "198.51.100.1", service.clientIP(withPeer("::1", "10.0.0.1, 198.51.100.1")))
+	assert.Equal(t, "127.0.0.1", service.clientIP(withPeer("127.0.0.1", "not an ip")))
+}
+
+func TestRegisterPasswordPolicy(t *testing.T) {
+	client, _ := setupTestServer(t)
+
+	_, err := client.RegisterUser(context.Background(), &pb.RegisterUserRequest{Username: " ", Password: "short"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Every broken rule is reported as a field violation
+	var fields []string
+	for _, detail := range status.Convert(err).Details() {
+		badRequest, ok := detail.(*errdetails.BadRequest)
+		require.True(t, ok)
+		for _, violation := range badRequest.FieldViolations {
+			fields = append(fields, violation.Field+": "+violation.Description)
+		}
+	}
+	assert.ElementsMatch(t, []string{
+		"username: must not be empty",
+		"password: must be at least 8 characters long",
+		"password: must contain an upper case letter",
+		"password: must contain a digit",
+	}, fields)
+}
+
+// Plaintext passwords from before hashing still work and are hashed on login
+func TestLoginUpgradesLegacyPassword(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	ctx := context.Background()
+
+	user := entity.User{Username: "peter", Password: "klewear123"}
+	require.NoError(t, memoryStore.CreateUser(ctx, &user))
+
+	_, err := client.LoginUser(ctx, &pb.LoginUserRequest{Username: "peter", Password: "klewear12"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.LoginUser(ctx, &pb.LoginUserRequest{Username: "peter", Password: "klewear123"})
+	require.NoError(t, err)
+
+	upgraded, err := memoryStore.GetUserByID(ctx, user.ID.Hex())
+	require.NoError(t, err)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(upgraded.Password), []byte("klewear123")))
+
+	_, err = client.LoginUser(ctx, &pb.LoginUserRequest{Username: "peter", Password: "klewear123"})
+	assert.NoError(t, err)
+}
+
+// Every RPC must have an entry in the policy table
+func TestMethodRolesCoverService(t *testing.T) {
+	for _, method := range pb.BookRentalService_ServiceDesc.Methods {
+		fullMethod := "/" + pb.BookRentalService_ServiceDesc.ServiceName + "/" + method.MethodName
+		_, ok := methodRoles[fullMethod]
+		assert.True(t, ok, "no role policy for %s", fullMethod)
+	}
+	for _, stream := range pb.BookRentalService_ServiceDesc.Streams {
+		fullMethod := "/" + pb.BookRentalService_ServiceDesc.ServiceName + "/" + stream.StreamName
+		_, ok := methodRoles[fullMethod]
+		assert.True(t, ok, "no role policy for %s", fullMethod)
+	}
+}
+
+func TestRolePolicy(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	memberID, memberCtx := createUser(t, memoryStore, "peter", entity.RoleMember)
+	_, legacyCtx := createUser(t, memoryStore, "mary", "")
+	_, librarianCtx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+	adminID, adminCtx := createUser(t, memoryStore, "admin", entity.RoleAdmin)
+
+	// Members and users without a role can read but not manage the catalogue
+	for _, ctx := range []context.Context{memberCtx, legacyCtx} {
+		_, err := client.AddBook(ctx, &pb.AddBookRequest{Title: "Dune", PublishedDate: "1965-08-01"})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		_, err = client.GetBooks(ctx, &pb.GetBooksRequest{})
+		assert.NoError(t, err)
+	}
+
+	bookID := addBook(t, client, librarianCtx, "Dune", "Frank Herbert", "1965-08-01")
+	_, err := client.RemoveBook(memberCtx, &pb.RemoveBookRequest{BookId: bookID})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.RemoveBook(adminCtx, &pb.RemoveBookRequest{BookId: bookID})
+	assert.NoError(t, err)
+
+	// Only admins manage roles
+	_, err = client.SetUserRole(librarianCtx, &pb.SetUserRoleRequest{UserId: memberID, Role: entity.RoleAdmin})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = client.SetUserRole(adminCtx, &pb.SetUserRoleRequest{UserId: memberID, Role: "owner"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.SetUserRole(adminCtx, &pb.SetUserRoleRequest{UserId: "60c72b2f9e15b92bbcf68f2b", Role: entity.RoleLibrarian})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.SetUserRole(adminCtx, &pb.SetUserRoleRequest{UserId: adminID, Role: entity.RoleMember})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	resp, err := client.SetUserRole(adminCtx, &pb.SetUserRoleRequest{UserId: memberID, Role: entity.RoleLibrarian})
+	require.NoError(t, err)
+	assert.Equal(t, entity.RoleLibrarian, resp.Role)
+
+	user, err := memoryStore.GetUserByID(context.Background(), memberID)
+	require.NoError(t, err)
+	assert.Equal(t, entity.RoleLibrarian, user.Role)
+}
+
+func TestLoginEmbedsRole(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	ctx := context.Background()
+
+	resp, err := client.RegisterUser(ctx, &pb.RegisterUserRequest{Username: "peter", Password: "Klewear123"})
+	require.NoError(t, err)
+	require.NoError(t, memoryStore.UpdateUserRole(ctx, resp.UserId, entity.RoleLibrarian))
+
+	login, err := client.LoginUser(ctx, &pb.LoginUserRequest{Username: "peter", Password: "Klewear123"})
+	require.NoError(t, err)
+
+	librarianCtx := metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", "Bearer "+login.Token))
+	_, err = client.AddBook(librarianCtx, &pb.AddBookRequest{Title: "Dune", PublishedDate: "1965-08-01"})
+	assert.NoError(t, err)
+}
+
+// The key set is public, the HMAC secret of the default configuration is not in it
+func TestGetJWKS(t *testing.T) {
+	client, _ := setupTestServer(t)
+
+	resp, err := client.GetJWKS(context.Background(), &pb.GetJWKSRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, resp.Keys)
+}
+
+func withToken(token string) context.Context {
+	return metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	ctx := context.Background()
+
+	user, err := client.RegisterUser(ctx, &pb.RegisterUserRequest{Username: "peter", Password: "Klewear123"})
+	require.NoError(t, err)
+	login, err := client.LoginUser(ctx, &pb.LoginUserRequest{Username: "peter", Password: "Klewear123"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, login.RefreshToken)
+	assert.Equal(t, int64(15*60), login.ExpiresIn)
+
+	// Role changes apply from the next refresh
+	require.NoError(t, memoryStore.UpdateUserRole(ctx, user.UserId, entity.RoleLibrarian))
+
+	refreshed, err := client.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: login.RefreshToken})
+	require.NoError(t, err)
+	assert.NotEqual(t, login.RefreshToken, refreshed.RefreshToken)
+	_, err = client.AddBook(withToken(refreshed.Token), &pb.AddBookRequest{Title: "Dune", PublishedDate: "1965-08-01"})
+	assert.NoError(t, err)
+
+	// Presenting a used refresh token ends the whole login
+	_, err = client.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: login.RefreshToken})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: refreshed.RefreshToken})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: "unknown"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.RefreshToken(ctx, &pb.RefreshTokenRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestLogout(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	ctx := context.Background()
+
+	_, err := client.RegisterUser(ctx, &pb.RegisterUserRequest{Username: "peter", Password: "Klewear123"})
+	require.NoError(t, err)
+	login, err := client.LoginUser(ctx, &pb.LoginUserRequest{Username: "peter", Password: "Klewear123"})
+	require.NoError(t, err)
+	other, err := client.LoginUser(ctx, &pb.LoginUserRequest{Username: "peter", Password: "Klewear123"})
+	require.NoError(t, err)
+
+	// Users cannot end someone else's login
+	_, maryCtx := createUser(t, memoryStore, "mary", entity.RoleMember)
+	_, err = client.Logout(maryCtx, &pb.LogoutRequest{RefreshToken: login.RefreshToken})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = client.Logout(withToken(login.Token), &pb.LogoutRequest{RefreshToken: login.RefreshToken})
+	require.NoError(t, err)
+
+	// The access token and the refresh token stop working at once
+	_, err = client.GetBooks(withToken(login.Token), &pb.GetBooksRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: login.RefreshToken})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Other logins of the same user are not affected
+	_, err = client.GetBooks(withToken(other.Token), &pb.GetBooksRequest{})
+	assert.NoError(t, err)
+	_, err = client.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: other.RefreshToken})
+	assert.NoError(t, err)
+}
+
+// Tokens issued before revocation existed have no jti and are refused
+func TestTokenWithoutID(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	userID, _ := createUser(t, memoryStore, "peter", entity.RoleMember)
+
+	keys, err := auth.NewKeySet(testConfig().Auth)
+	require.NoError(t, err)
+	token, err := keys.Sign(jwt.MapClaims{"user_id": userID, "exp": time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+
+	_, err = client.GetBooks(withToken(token), &pb.GetBooksRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestMissingToken(t *testing.T) {
+	client, _ := setupTestServer(t)
+
+	_, err := client.AddBook(context.Background(), &pb.AddBookRequest{Title: "Test Book", PublishedDate: "2020-01-01"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestBorrowAndReturnBook(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	_, ctx := createUser(t, memoryStore, "peter", "")
+	_, otherCtx := createUser(t, memoryStore, "mary", "")
+	_, librarianCtx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+
+	bookID := addBook(t, client, librarianCtx, "Test Book", "Test Author", "2020-01-01")
+
+	borrow, err := client.BorrowBook(ctx, &pb.BorrowBookRequest{BookId: bookID})
+	require.NoError(t, err)
+	assert.NotEmpty(t, borrow.BorrowId)
+
+	// The book cannot be borrowed twice
+	_, err = client.BorrowBook(otherCtx, &pb.BorrowBookRequest{BookId: bookID})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// Only the borrower can return it
+	_, err = client.ReturnBook(otherCtx, &pb.ReturnBookRequest{BorrowId: borrow.BorrowId})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	returned, err := client.ReturnBook(ctx, &pb.ReturnBookRequest{BorrowId: borrow.BorrowId})
+	require.NoError(t, err)
+	assert.Equal(t, bookID, returned.BookId)
+	assert.NotEmpty(t, returned.CopyId)
+
+	_, err = client.ReturnBook(ctx, &pb.ReturnBookRequest{BorrowId: borrow.BorrowId})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	item, err := memoryStore.GetCopy(context.Background(), returned.CopyId)
+	require.NoError(t, err)
+	assert.Equal(t, entity.CopyAvailable, item.Status)
+	assert.Equal(t, bookID, item.TitleID)
+
+	loan, err := memoryStore.GetLoan(context.Background(), borrow.BorrowId)
+	require.NoError(t, err)
+	assert.NotNil(t, loan.ReturnedAt)
+}
+
+func TestBorrowBookNotFound(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	_, ctx := createUser(t, memoryStore, "peter", "")
+
+	_, err := client.BorrowBook(ctx, &pb.BorrowBookRequest{BookId: "60c72b2f9e15b92bbcf68f2b"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// Fire parallel BorrowBook calls for the same book, only one may win
+func TestBorrowBookConcurrent(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	_, ctx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+
+	bookID := addBook(t, client, ctx, "Test Book", "Test Author", "2020-01-01")
+
+	const borrowers = 20
+
+	contexts := make([]context.Context, borrowers)
+	for i := range contexts {
+		_, contexts[i] = createUser(t, memoryStore, "user"+string(rune('a'+i)), "")
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, borrowers)
+	for i := 0; i < borrowers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = client.BorrowBook(contexts[i], &pb.BorrowBookRequest{BookId: bookID})
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	}
+	assert.Equal(t, 1, succeeded)
+
+	// Exactly one loan must have been recorded
+	loans, err := memoryStore.ListLoans(context.Background(), store.LoanFilter{BookID: bookID})
+	require.NoError(t, err)
+	assert.Len(t, loans, 1)
+}
+
+// loanBarrierStore holds back the results of the first ListLoans calls until all of them
+// arrived, so concurrent borrows all count the user's loans before any of them is recorded
+type loanBarrierStore struct {
+	*store.MemoryStore
+	mu      sync.Mutex
+	waiting int
+	release chan struct{}
+}
+
+func (s *loanBarrierStore) ListLoans(ctx context.Context, filter store.LoanFilter) ([]entity.BorrowedBooks, error) {
+	loans, err := s.MemoryStore.ListLoans(ctx, filter)
+
+	s.mu.Lock()
+	if s.waiting > 0 {
+		s.waiting--
+		if s.waiting == 0 {
+			close(s.release)
+		}
+	}
+	s.mu.Unlock()
+	<-s.release
+	return loans, err
+}
+
+// Parallel borrows of different titles by the same user must not pass the loan limit together
+func TestBorrowBookConcurrentLimit(t *testing.T) {
+	cfg := testConfig()
+	cfg.Loans.MaxLoans = 1
+	client, memoryStore := setupTestServerWithConfig(t, cfg)
+	_, librarianCtx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+	userID, _ := createUser(t, memoryStore, "peter", "")
+
+	bookIDs := []string{
+		addBook(t, client, librarianCtx, "Dune", "Frank Herbert", "1965-08-01"),
+		addBook(t, client, librarianCtx, "Neuromancer", "William Gibson", "1984-07-01"),
+	}
+
+	keys, err := auth.NewKeySet(cfg.Auth)
+	require.NoError(t, err)
+	barrier := &loanBarrierStore{MemoryStore: memoryStore, waiting: len(bookIDs), release: make(chan struct{})}
+	service := NewBookRentalServiceServer(barrier, cfg, keys)
+	ctx := context.WithValue(context.Background(), userIDKey, userID)
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(bookIDs))
+	for i, bookID := range bookIDs {
+		wg.Add(1)
+		go func(i int, bookID string) {
+			defer wg.Done()
+			_, errs[i] = service.BorrowBook(ctx, &pb.BorrowBookRequest{BookId: bookID})
+		}(i, bookID)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		check, _ := policyViolationOf(t, err)
+		assert.Equal(t, "max_loans", check)
+	}
+	assert.Equal(t, 1, succeeded)
+
+	loans, err := memoryStore.ListLoans(context.Background(), store.LoanFilter{UserID: userID})
+	require.NoError(t, err)
+	assert.Len(t, loans, 1)
+}
+
+func TestBorrowCopies(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	_, ctx := createUser(t, memoryStore, "peter", "")
+	_, otherCtx := createUser(t, memoryStore, "mary", "")
+	_, librarianCtx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+
+	added, err := client.AddBook(librarianCtx, &pb.AddBookRequest{
+		Title:         "Dune",
+		Author:        "Frank Herbert",
+		PublishedDate: "1965-08-01",
+		Isbn:          "9780441172719",
+		Copies: []*pb.NewCopy{
+			{Barcode: "DUNE-1", Location: "A1"},
+			{Barcode: "DUNE-2", Condition: entity.ConditionFair},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, added.Copies, 2)
+	assert.Equal(t, entity.ConditionNew, added.Copies[0].Condition)
+	assert.Equal(t, entity.CopyAvailable, added.Copies[1].Status)
+
+	// Borrowing by barcode takes that copy
+	byBarcode, err := client.BorrowBook(ctx, &pb.BorrowBookRequest{Barcode: "DUNE-2"})
+	require.NoError(t, err)
+	assert.Equal(t, "DUNE-2", byBarcode.Barcode)
+	_, err = client.BorrowBook(otherCtx, &pb.BorrowBookRequest{Barcode: "DUNE-2"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	books, err := client.GetBooks(ctx, &pb.GetBooksRequest{})
+	require.NoError(t, err)
+	require.Len(t, books.Books, 1)
+	assert.Equal(t, "9780441172719", books.Books[0].Isbn)
+	assert.Equal(t, int32(1), books.Books[0].AvailableCopies)
+	assert.Equal(t, int32(2), books.Books[0].TotalCopies)
+	assert.Equal(t, bookStatusAvailable, books.Books[0].Status)
+
+	// Borrowing by book takes any available copy
+	byTitle, err := client.BorrowBook(otherCtx, &pb.BorrowBookRequest{BookId: added.BookId})
+	require.NoError(t, err)
+	assert.Equal(t, "DUNE-1", byTitle.Barcode)
+	_, err = client.BorrowBook(ctx, &pb.BorrowBookRequest{BookId: added.BookId})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	books, err = client.GetBooks(ctx, &pb.GetBooksRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), books.Books[0].AvailableCopies)
+	assert.Equal(t, bookStatusUnavailable, books.Books[0].Status)
+
+	// The status filter matches books with a copy in that status
+	books, err = client.GetBooks(ctx, &pb.GetBooksRequest{Status: entity.CopyAvailable})
+	require.NoError(t, err)
+	assert.Empty(t, books.Books)
+
+	loans, err := client.GetBorrowedBooks(ctx, &pb.GetBorrowedBooksRequest{})
+	require.NoError(t, err)
+	require.Len(t, loans.BorrowedBooks, 1)
+	assert.Equal(t, added.Copies[1].Id, loans.BorrowedBooks[0].CopyId)
+
+	// A book with copies on loan cannot be removed
+	_, err = client.RemoveBook(librarianCtx, &pb.RemoveBookRequest{BookId: added.BookId})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.BorrowBook(ctx, &pb.BorrowBookRequest{BookId: added.BookId, Barcode: "DUNE-1"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.BorrowBook(ctx, &pb.BorrowBookRequest{Barcode: "UNKNOWN"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestAddBookBarcodes(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	_, librarianCtx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+
+	_, err := client.AddBook(librarianCtx, &pb.AddBookRequest{
+		Title: "Dune", Author: "Frank Herbert", PublishedDate: "1965-08-01",
+		Copies: []*pb.NewCopy{{Barcode: "DUNE-1"}},
+	})
+	require.NoError(t, err)
+
+	// A taken or repeated barcode adds neither the book nor any of its copies
+	_, err = client.AddBook(librarianCtx, &pb.AddBookRequest{
+		Title: "Emma", Author: "Jane Austen", PublishedDate: "1815-12-23",
+		Copies: []*pb.NewCopy{{Barcode: "EMMA-1"}, {Barcode: "DUNE-1"}},
+	})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = client.AddBook(librarianCtx, &pb.AddBookRequest{
+		Title: "Emma", Author: "Jane Austen", PublishedDate: "1815-12-23",
+		Copies: []*pb.NewCopy{{Barcode: "EMMA-1"}, {Barcode: "EMMA-1"}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	titles, err := memoryStore.ListTitles(context.Background(), store.TitleFilter{})
+	require.NoError(t, err)
+	assert.Len(t, titles, 1)
+	_, err = memoryStore.GetCopyByBarcode(context.Background(), "EMMA-1")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestManageCopies(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	_, ctx := createUser(t, memoryStore, "peter", "")
+	_, librarianCtx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+
+	bookID := addBook(t, client, librarianCtx, "Dune", "Frank Herbert", "1965-08-01")
+
+	// Members can list copies but not manage them
+	_, err := client.AddCopy(ctx, &pb.AddCopyRequest{BookId: bookID, Barcode: "DUNE-2"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	added, err := client.AddCopy(librarianCtx, &pb.AddCopyRequest{BookId: bookID, Barcode: "DUNE-2", Location: "B2"})
+	require.NoError(t, err)
+	assert.Equal(t, "DUNE-2", added.Copy.Barcode)
+
+	_, err = client.AddCopy(librarianCtx, &pb.AddCopyRequest{BookId: bookID, Barcode: "DUNE-2"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = client.AddCopy(librarianCtx, &pb.AddCopyRequest{BookId: bookID, Condition: "shredded"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.AddCopy(librarianCtx, &pb.AddCopyRequest{BookId: "60c72b2f9e15b92bbcf68f2b"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	copies, err := client.ListCopies(ctx, &pb.ListCopiesRequest{BookId: bookID})
+	require.NoError(t, err)
+	assert.Len(t, copies.Copies, 2)
+
+	// A lost copy cannot be borrowed
+	updated, err := client.UpdateCopy(librarianCtx, &pb.UpdateCopyRequest{CopyId: added.Copy.Id, Status: entity.CopyLost, Condition: entity.ConditionPoor})
+	require.NoError(t, err)
+	assert.Equal(t, entity.CopyLost, updated.Copy.Status)
+	assert.Equal(t, entity.ConditionPoor, updated.Copy.Condition)
+	assert.Equal(t, "B2", updated.Copy.Location)
+	_, err = client.BorrowBook(ctx, &pb.BorrowBookRequest{Barcode: "DUNE-2"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// The status of a borrowed copy only changes through a return
+	borrow, err := client.BorrowBook(ctx, &pb.BorrowBookRequest{BookId: bookID})
+	require.NoError(t, err)
+	borrowed, err := memoryStore.GetCopyByBarcode(context.Background(), borrow.Barcode)
+	require.NoError(t, err)
+	_, err = client.UpdateCopy(librarianCtx, &pb.UpdateCopyRequest{CopyId: borrowed.ID.Hex(), Status: entity.CopyWithdrawn})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = client.UpdateCopy(librarianCtx, &pb.UpdateCopyRequest{CopyId: borrowed.ID.Hex(), Status: entity.CopyBorrowed})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.RemoveCopy(librarianCtx, &pb.RemoveCopyRequest{CopyId: borrowed.ID.Hex()})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.RemoveCopy(librarianCtx, &pb.RemoveCopyRequest{CopyId: added.Copy.Id})
+	require.NoError(t, err)
+	_, err = client.RemoveCopy(librarianCtx, &pb.RemoveCopyRequest{CopyId: added.Copy.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestHoldQueue(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	_, peterCtx := createUser(t, memoryStore, "peter", "")
+	maryID, maryCtx := createUser(t, memoryStore, "mary", "")
+	_, paulCtx := createUser(t, memoryStore, "paul", "")
+	_, librarianCtx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+
+	bookID := addBook(t, client, librarianCtx, "Dune", "Frank Herbert", "1965-08-01")
+
+	// No hold while a copy is on the shelf
+	_, err := client.PlaceHold(maryCtx, &pb.PlaceHoldRequest{BookId: bookID})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	borrow, err := client.BorrowBook(peterCtx, &pb.BorrowBookRequest{BookId: bookID})
+	require.NoError(t, err)
+
+	// The borrower cannot queue for the book they have
+	_, err = client.PlaceHold(peterCtx, &pb.PlaceHoldRequest{BookId: bookID})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	maryHold, err := client.PlaceHold(maryCtx, &pb.PlaceHoldRequest{BookId: bookID})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), maryHold.Hold.Position)
+	_, err = client.PlaceHold(maryCtx, &pb.PlaceHoldRequest{BookId: bookID})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	paulHold, err := client.PlaceHold(paulCtx, &pb.PlaceHoldRequest{BookId: bookID})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), paulHold.Hold.Position)
+
+	// Members only see their own holds, librarians see the queue
+	_, err = client.ListHolds(paulCtx, &pb.ListHoldsRequest{UserId: maryID})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	own, err := client.ListHolds(paulCtx, &pb.ListHoldsRequest{BookId: bookID})
+	require.NoError(t, err)
+	require.Len(t, own.Holds, 1)
+	queue, err := client.ListHolds(librarianCtx, &pb.ListHoldsRequest{BookId: bookID})
+	require.NoError(t, err)
+	require.Len(t, queue.Holds, 2)
+	assert.Equal(t, maryHold.Hold.Id, queue.Holds[0].Id)
+
+	// The returned copy is kept for the first patron in the queue
+	returned, err := client.ReturnBook(peterCtx, &pb.ReturnBookRequest{BorrowId: borrow.BorrowId})
+	require.NoError(t, err)
+	assert.True(t, returned.OnHold)
+
+	item, err := memoryStore.GetCopy(context.Background(), returned.CopyId)
+	require.NoError(t, err)
+	assert.Equal(t, entity.CopyOnHold, item.Status)
+
+	holds, err := client.ListHolds(maryCtx, &pb.ListHoldsRequest{})
+	require.NoError(t, err)
+	require.Len(t, holds.Holds, 1)
+	assert.Equal(t, entity.HoldReady, holds.Holds[0].Status)
+	assert.Equal(t, item.Barcode, holds.Holds[0].Barcode)
+	assert.NotEmpty(t, holds.Holds[0].PickupBy)
+
+	holds, err = client.ListHolds(paulCtx, &pb.ListHoldsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), holds.Holds[0].Position)
+
+	// Nobody else can take the kept copy
+	_, err = client.BorrowBook(peterCtx, &pb.BorrowBookRequest{Barcode: item.Barcode})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = client.BorrowBook(paulCtx, &pb.BorrowBookRequest{BookId: bookID})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	picked, err := client.BorrowBook(maryCtx, &pb.BorrowBookRequest{BookId: bookID})
+	require.NoError(t, err)
+	assert.Equal(t, item.Barcode, picked.Barcode)
+
+	closed, err := client.ListHolds(maryCtx, &pb.ListHoldsRequest{IncludeClosed: true})
+	require.NoError(t, err)
+	require.Len(t, closed.Holds, 1)
+	assert.Equal(t, entity.HoldFulfilled, closed.Holds[0].Status)
+
+	// Cancelling is for the patron or a librarian
+	_, err = client.CancelHold(peterCtx, &pb.CancelHoldRequest{HoldId: paulHold.Hold.Id})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	cancelled, err := client.CancelHold(librarianCtx, &pb.CancelHoldRequest{HoldId: paulHold.Hold.Id})
+	require.NoError(t, err)
+	assert.Equal(t, entity.HoldCancelled, cancelled.Hold.Status)
+	_, err = client.CancelHold(paulCtx, &pb.CancelHoldRequest{HoldId: paulHold.Hold.Id})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// With the queue empty the copy goes back on the shelf
+	returned, err = client.ReturnBook(maryCtx, &pb.ReturnBookRequest{BorrowId: picked.BorrowId})
+	require.NoError(t, err)
+	assert.False(t, returned.OnHold)
+}
+
+func TestHoldExpiry(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	_, peterCtx := createUser(t, memoryStore, "peter", "")
+	_, maryCtx := createUser(t, memoryStore, "mary", "")
+	_, paulCtx := createUser(t, memoryStore, "paul", "")
+	_, librarianCtx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+
+	bookID := addBook(t, client, librarianCtx, "Dune", "Frank Herbert", "1965-08-01")
+	borrow, err := client.BorrowBook(peterCtx, &pb.BorrowBookRequest{BookId: bookID})
+	require.NoError(t, err)
+	maryHold, err := client.PlaceHold(maryCtx, &pb.PlaceHoldRequest{BookId: bookID})
+	require.NoError(t, err)
+	paulHold, err := client.PlaceHold(paulCtx, &pb.PlaceHoldRequest{BookId: bookID})
+	require.NoError(t, err)
+
+	returned, err := client.ReturnBook(peterCtx, &pb.ReturnBookRequest{BorrowId: borrow.BorrowId})
+	require.NoError(t, err)
+
+	service := newTestService(t, memoryStore)
+	ctx := context.Background()
+
+	// Nothing expires before the pickup deadline
+	expired, err := service.expireHolds(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, expired.Changed)
+
+	// After it the copy passes to the next patron
+	expired, err = service.expireHolds(ctx, time.Now().Add(testConfig().Loans.HoldPickup+time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, entity.JobResult{Checked: 1, Changed: 1, Summary: "expired 1 holds"}, expired)
+
+	hold, err := memoryStore.GetHold(ctx, maryHold.Hold.Id)
+	require.NoError(t, err)
+	assert.Equal(t, entity.HoldExpired, hold.Status)
+	hold, err = memoryStore.GetHold(ctx, paulHold.Hold.Id)
+	require.NoError(t, err)
+	assert.Equal(t, entity.HoldReady, hold.Status)
+	assert.Equal(t, returned.CopyId, hold.CopyID)
+
+	// The last hold lapsing puts the copy back on the shelf
+	expired, err = service.expireHolds(ctx, time.Now().Add(2*testConfig().Loans.HoldPickup))
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired.Changed)
+
+	item, err := memoryStore.GetCopy(ctx, returned.CopyId)
+	require.NoError(t, err)
+	assert.Equal(t, entity.CopyAvailable, item.Status)
+
+	// A ready hold that is cancelled also passes the copy on
+	borrow, err = client.BorrowBook(peterCtx, &pb.BorrowBookRequest{BookId: bookID})
+	require.NoError(t, err)
+	maryHold, err = client.PlaceHold(maryCtx, &pb.PlaceHoldRequest{BookId: bookID})
+	require.NoError(t, err)
+	_, err = client.ReturnBook(peterCtx, &pb.ReturnBookRequest{BorrowId: borrow.BorrowId})
+	require.NoError(t, err)
+	_, err = client.CancelHold(maryCtx, &pb.CancelHoldRequest{HoldId: maryHold.Hold.Id})
+	require.NoError(t, err)
+
+	item, err = memoryStore.GetCopy(ctx, returned.CopyId)
+	require.NoError(t, err)
+	assert.Equal(t, entity.CopyAvailable, item.Status)
+}
+
+func TestRenewLoan(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	peterID, peterCtx := createUser(t, memoryStore, "peter", "")
+	_, maryCtx := createUser(t, memoryStore, "mary", "")
+	_, librarianCtx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+
+	bookID := addBook(t, client, librarianCtx, "Dune", "Frank Herbert", "1965-08-01")
+	borrow, err := client.BorrowBook(peterCtx, &pb.BorrowBookRequest{BookId: bookID})
+	require.NoError(t, err)
+	loan, err := memoryStore.GetLoan(context.Background(), borrow.BorrowId)
+	require.NoError(t, err)
+
+	// Only the borrower or a librarian can renew
+	_, err = client.RenewLoan(maryCtx, &pb.RenewLoanRequest{BorrowId: borrow.BorrowId})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	renewed, err := client.RenewLoan(peterCtx, &pb.RenewLoanRequest{BorrowId: borrow.BorrowId})
+	require.NoError(t, err)
+	want, err := renewedDueDate(loan.ReturnDate, testConfig().Loans.Period)
+	require.NoError(t, err)
+	assert.Equal(t, want, renewed.DueDate)
+	assert.Equal(t, int32(1), renewed.Renewals)
+	assert.Equal(t, int32(1), renewed.RenewalsLeft)
+
+	renewed, err = client.RenewLoan(librarianCtx, &pb.RenewLoanRequest{BorrowId: borrow.BorrowId})
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), renewed.RenewalsLeft)
+
+	// The default policy allows two renewals
+	_, err = client.RenewLoan(peterCtx, &pb.RenewLoanRequest{BorrowId: borrow.BorrowId})
+	check, _ := policyViolationOf(t, err)
+	assert.Equal(t, "max_renewals", check)
+
+	loans, err := client.GetBorrowedBooks(peterCtx, &pb.GetBorrowedBooksRequest{})
+	require.NoError(t, err)
+	require.Len(t, loans.BorrowedBooks, 1)
+	assert.Equal(t, renewed.DueDate, loans.BorrowedBooks[0].DueDate)
+	require.Len(t, loans.BorrowedBooks[0].Renewals, 2)
+	assert.Equal(t, loan.ReturnDate, loans.BorrowedBooks[0].Renewals[0].PreviousDueDate)
+	assert.Equal(t, loans.BorrowedBooks[0].Renewals[0].DueDate, loans.BorrowedBooks[0].Renewals[1].PreviousDueDate)
+
+	// A patron waiting for the book blocks renewals
+	other, err := client.AddBook(librarianCtx, &pb.AddBookRequest{Title: "Neuromancer", PublishedDate: "1984-07-01"})
+	require.NoError(t, err)
+	borrow, err = client.BorrowBook(peterCtx, &pb.BorrowBookRequest{BookId: other.BookId})
+	require.NoError(t, err)
+	_, err = client.PlaceHold(maryCtx, &pb.PlaceHoldRequest{BookId: other.BookId})
+	require.NoError(t, err)
+	_, err = client.RenewLoan(peterCtx, &pb.RenewLoanRequest{BorrowId: borrow.BorrowId})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.ReturnBook(peterCtx, &pb.ReturnBookRequest{BorrowId: borrow.BorrowId})
+	require.NoError(t, err)
+	_, err = client.RenewLoan(peterCtx, &pb.RenewLoanRequest{BorrowId: borrow.BorrowId})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// Overdue loans are returned, not renewed, also by librarians
+	overdue := entity.BorrowedBooks{BookID: bookID, UserID: peterID, BorrowedDate: "2024-01-01", ReturnDate: "2024-01-08"}
+	require.NoError(t, memoryStore.CreateLoan(context.Background(), &overdue))
+	_, err = client.RenewLoan(peterCtx, &pb.RenewLoanRequest{BorrowId: overdue.ID.Hex()})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = client.RenewLoan(librarianCtx, &pb.RenewLoanRequest{BorrowId: overdue.ID.Hex()})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	stored, err := memoryStore.GetLoan(context.Background(), overdue.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-08", stored.ReturnDate)
+	assert.Empty(t, stored.Renewals)
+}
+
+// policyViolationOf returns the check and the rule named by a refused loan.
+func policyViolationOf(t *testing.T, err error) (string, string) {
+	t.Helper()
+	require.Equal(t, codes.FailedPrecondition, status.Code(err), "%v", err)
+	for _, detail := range status.Convert(err).Details() {
+		if failure, ok := detail.(*errdetails.PreconditionFailure); ok && len(failure.Violations) == 1 {
+			return failure.Violations[0].Type, failure.Violations[0].Subject
+		}
+	}
+	t.Fatalf("no precondition failure in %v", err)
+	return "", ""
+}
+
+func TestCirculationPolicy(t *testing.T) {
+	one, two, none := 1, 2, 0
+	day := 24 * time.Hour
+	cfg := testConfig()
+	cfg.Loans.MaxLoans = 3
+	cfg.Loans.Rules = []config.CirculationRule{
+		{Name: "students", UserCategory: "student", MaxLoans: &two},
+		{Name: "reference", ItemType: "reference", MaxLoans: &none},
+		{Name: "dvds", ItemType: "dvd", MaxLoans: &one, Period: &day, MaxRenewals: &none},
+	}
+	client, memoryStore := setupTestServerWithConfig(t, cfg)
+	peterID, peterCtx := createUser(t, memoryStore, "peter", "")
+	maryID, maryCtx := createUser(t, memoryStore, "mary", "")
+	_, librarianCtx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+
+	// Librarians put users in a category
+	_, err := client.SetUserCategory(peterCtx, &pb.SetUserCategoryRequest{UserId: peterID, Category: "student"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	category, err := client.SetUserCategory(librarianCtx, &pb.SetUserCategoryRequest{UserId: peterID, Category: " student "})
+	require.NoError(t, err)
+	assert.Equal(t, "student", category.Category)
+
+	addCopies := func(title, itemType string) string {
+		resp, err := client.AddBook(librarianCtx, &pb.AddBookRequest{
+			Title: title, PublishedDate: "2000-01-01", ItemType: itemType,
+			Copies: []*pb.NewCopy{{}, {}},
+		})
+		require.NoError(t, err)
+		return resp.BookId
+	}
+	atlasID := addCopies("Atlas", "reference")
+	duneID := addCopies("Dune", "book")
+	alienID := addCopies("Alien", "dvd")
+	matrixID := addCopies("The Matrix", "dvd")
+
+	books, err := client.GetBooks(peterCtx, &pb.GetBooksRequest{TitlePrefix: "atlas"})
+	require.NoError(t, err)
+	require.Len(t, books.Books, 1)
+	assert.Equal(t, "reference", books.Books[0].ItemType)
+
+	// Reference books stay in the library, except for students whose rule wins over the item type's
+	_, err = client.BorrowBook(maryCtx, &pb.BorrowBookRequest{BookId: atlasID})
+	check, rule := policyViolationOf(t, err)
+	assert.Equal(t, "max_loans", check)
+	assert.Equal(t, "rule/reference", rule)
+
+	_, err = client.BorrowBook(peterCtx, &pb.BorrowBookRequest{BookId: atlasID})
+	require.NoError(t, err)
+	_, err = client.BorrowBook(peterCtx, &pb.BorrowBookRequest{BookId: duneID})
+	require.NoError(t, err)
+	_, err = client.BorrowBook(peterCtx, &pb.BorrowBookRequest{BookId: duneID})
+	check, rule = policyViolationOf(t, err)
+	assert.Equal(t, "max_loans", check)
+	assert.Equal(t, "rule/students", rule)
+
+	// DVDs are lent for a day, one at a time and without renewals. Other loans do not
+	// count against the DVD limit.
+	_, err = client.BorrowBook(maryCtx, &pb.BorrowBookRequest{BookId: duneID})
+	require.NoError(t, err)
+	borrow, err := client.BorrowBook(maryCtx, &pb.BorrowBookRequest{BookId: alienID})
+	require.NoError(t, err)
+	loan, err := memoryStore.GetLoan(context.Background(), borrow.BorrowId)
+	require.NoError(t, err)
+	assert.Equal(t, time.Now().Add(day).Format("2006-01-02"), loan.ReturnDate)
+
+	_, err = client.BorrowBook(maryCtx, &pb.BorrowBookRequest{BookId: matrixID})
+	check, rule = policyViolationOf(t, err)
+	assert.Equal(t, "max_loans", check)
+	assert.Equal(t, "rule/dvds", rule)
+
+	_, err = client.RenewLoan(maryCtx, &pb.RenewLoanRequest{BorrowId: borrow.BorrowId})
+	check, rule = policyViolationOf(t, err)
+	assert.Equal(t, "max_renewals", check)
+	assert.Equal(t, "rule/dvds", rule)
+	_, err = client.ReturnBook(maryCtx, &pb.ReturnBookRequest{BorrowId: borrow.BorrowId})
+	require.NoError(t, err)
+
+	// An overdue book blocks new loans until it is returned, also by barcode
+	overdue := entity.BorrowedBooks{BookID: duneID, UserID: maryID, BorrowedDate: "2024-01-01", ReturnDate: "2024-01-08"}
+	require.NoError(t, memoryStore.CreateLoan(context.Background(), &overdue))
+	copies, err := client.ListCopies(maryCtx, &pb.ListCopiesRequest{BookId: matrixID})
+	require.NoError(t, err)
+	_, err = client.BorrowBook(maryCtx, &pb.BorrowBookRequest{Barcode: copies.Copies[0].Barcode})
+	check, rule = policyViolationOf(t, err)
+	assert.Equal(t, "block_on_overdue", check)
+	assert.Equal(t, "rule/dvds", rule)
+
+	// Then its fine blocks them until it is paid
+	returned, err := client.ReturnBook(maryCtx, &pb.ReturnBookRequest{BorrowId: overdue.ID.Hex()})
+	require.NoError(t, err)
+	assert.Equal(t, int64(cfg.Loans.Fines.MaxFine), returned.Fine)
+	_, err = client.BorrowBook(maryCtx, &pb.BorrowBookRequest{Barcode: copies.Copies[0].Barcode})
+	check, _ = policyViolationOf(t, err)
+	assert.Equal(t, "block_on_fines", check)
+
+	_, err = client.RecordPayment(librarianCtx, &pb.RecordPaymentRequest{UserId: maryID, Amount: returned.Fine})
+	require.NoError(t, err)
+	_, err = client.BorrowBook(maryCtx, &pb.BorrowBookRequest{Barcode: copies.Copies[0].Barcode})
+	require.NoError(t, err)
+}
+
+func TestRenewedDueDate(t *testing.T) {
+	// Extended from the due date, also across a daylight saving time change
+	due, err := renewedDueDate("2024-03-12", 7*24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-03-19", due)
+	due, err = renewedDueDate("2024-03-29", 3*24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-04-01", due)
+
+	_, err = renewedDueDate("soon", time.Hour)
+	assert.Error(t, err)
+}
+
+func TestOverdueFine(t *testing.T) {
+	policy := config.Policy{DailyFine: 25, FineGraceDays: 2, MaxFine: 200}
+	tests := []struct {
+		on   string
+		days int
+		fine int64
+	}{
+		{"2024-03-05", 0, 0},
+		{"2024-03-10", 0, 0}, // the due date
+		{"2024-03-12", 2, 0}, // within the grace days
+		{"2024-03-13", 3, 75},
+		{"2024-03-31", 21, 200}, // capped, across a daylight saving time change
+	}
+	for _, test := range tests {
+		on, err := time.ParseInLocation("2006-01-02 15:04", test.on+" 23:30", time.Local)
+		require.NoError(t, err)
+		days, fine, err := overdueFine("2024-03-10", on, policy)
+		require.NoError(t, err)
+		assert.Equal(t, test.days, days, test.on)
+		assert.Equal(t, test.fine, fine, test.on)
+	}
+
+	policy.MaxFine = 0
+	_, fine, err := overdueFine("2024-03-10", time.Date(2024, 4, 9, 0, 0, 0, 0, time.UTC), policy)
+	require.NoError(t, err)
+	assert.Equal(t, int64(750), fine, "no cap")
+}
+
+// feeFailingStore refuses new fee transactions while fail is set
+type feeFailingStore struct {
+	*store.MemoryStore
+	fail atomic.Bool
+}
+
+func (s *feeFailingStore) CreateFeeTransaction(ctx context.Context, entry *entity.FeeTransaction) error {
+	if s.fail.Load() {
+		return errors.New("ledger unavailable")
+	}
+	return s.MemoryStore.CreateFeeTransaction(ctx, entry)
+}
+
+// A fine that cannot be charged at return keeps the loan open, so the job charges it later
+func TestReturnBookFineFailure(t *testing.T) {
+	cfg := testConfig()
+	client, memoryStore := setupTestServerWithConfig(t, cfg)
+	_, librarianCtx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+	userID, _ := createUser(t, memoryStore, "peter", "")
+
+	keys, err := auth.NewKeySet(cfg.Auth)
+	require.NoError(t, err)
+	failing := &feeFailingStore{MemoryStore: memoryStore}
+	service := NewBookRentalServiceServer(failing, cfg, keys)
+	ctx := context.WithValue(context.Background(), userIDKey, userID)
+
+	bookID := addBook(t, client, librarianCtx, "Dune", "Frank Herbert", "1965-08-01")
+	copies, err := memoryStore.ListCopies(ctx, store.CopyFilter{TitleID: bookID})
+	require.NoError(t, err)
+	overdue := entity.BorrowedBooks{
+		BookID: bookID, CopyID: copies[0].ID.Hex(), UserID: userID,
+		BorrowedDate: time.Now().AddDate(0, 0, -10).Format("2006-01-02"),
+		ReturnDate:   time.Now().AddDate(0, 0, -3).Format("2006-01-02"),
+	}
+	require.NoError(t, memoryStore.CreateLoan(ctx, &overdue))
+	borrowID := overdue.ID.Hex()
+
+	failing.fail.Store(true)
+	_, err = service.ReturnBook(ctx, &pb.ReturnBookRequest{BorrowId: borrowID})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	loan, err := memoryStore.GetLoan(ctx, borrowID)
+	require.NoError(t, err)
+	assert.Nil(t, loan.ReturnedAt, "the loan stays open")
+
+	failing.fail.Store(false)
+	accrued, err := service.accrueFines(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, accrued.Changed)
+	fine := 3 * int64(cfg.Loans.Fines.DailyFine)
+	balance, err := memoryStore.FeeBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, fine, balance)
+
+	// The retried return reports the fine without charging it again
+	returned, err := service.ReturnBook(ctx, &pb.ReturnBookRequest{BorrowId: borrowID})
+	require.NoError(t, err)
+	assert.Equal(t, fine, returned.Fine)
+	balance, err = memoryStore.FeeBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, fine, balance)
+}
+
+func TestFeeLedger(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	peterID, peterCtx := createUser(t, memoryStore, "peter", "")
+	_, maryCtx := createUser(t, memoryStore, "mary", "")
+	_, librarianCtx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+	service := newTestService(t, memoryStore)
+	ctx := context.Background()
+	fines := testConfig().Loans.Fines
+
+	bookID := addBook(t, client, librarianCtx, "Dune", "Frank Herbert", "1965-08-01")
+	borrow, err := client.BorrowBook(peterCtx, &pb.BorrowBookRequest{BookId: bookID})
+	require.NoError(t, err)
+
+	balanceOf := func() int64 {
+		t.Helper()
+		balance, err := client.GetFeeBalance(peterCtx, &pb.GetFeeBalanceRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, "EUR", balance.Currency)
+		return balance.Balance
+	}
+
+	// Fines accrue daily once the loan is late, each day is charged once
+	due := time.Now().Add(testConfig().Loans.Period)
+	accrued, err := service.accrueFines(ctx, due.AddDate(0, 0, 3))
+	require.NoError(t, err)
+	assert.Equal(t, entity.JobResult{Checked: 1, Changed: 1, Summary: "charged 0.75 EUR to 1 overdue loans"}, accrued)
+	assert.Equal(t, 3*int64(fines.DailyFine), balanceOf())
+
+	accrued, err = service.accrueFines(ctx, due.AddDate(0, 0, 3))
+	require.NoError(t, err)
+	assert.Equal(t, 0, accrued.Changed)
+	assert.Equal(t, 3*int64(fines.DailyFine), balanceOf())
+
+	_, err = service.accrueFines(ctx, due.AddDate(0, 0, 10))
+	require.NoError(t, err)
+	assert.Equal(t, 10*int64(fines.DailyFine), balanceOf())
+
+	_, err = service.accrueFines(ctx, due.AddDate(0, 0, 60))
+	require.NoError(t, err)
+	assert.Equal(t, int64(fines.MaxFine), balanceOf(), "capped")
+
+	// Returning the book reports its fine without charging it again
+	returned, err := client.ReturnBook(peterCtx, &pb.ReturnBookRequest{BorrowId: borrow.BorrowId})
+	require.NoError(t, err)
+	assert.Equal(t, int64(fines.MaxFine), returned.Fine)
+	assert.Equal(t, int64(fines.MaxFine), balanceOf())
+
+	// Librarians charge lost copies, which ends the loan
+	borrow, err = client.BorrowBook(peterCtx, &pb.BorrowBookRequest{BookId: bookID})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "unpaid fines")
+	_, err = client.RecordPayment(librarianCtx, &pb.RecordPaymentRequest{UserId: peterID, Amount: int64(fines.MaxFine) + 1})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = client.RecordPayment(peterCtx, &pb.RecordPaymentRequest{UserId: peterID, Amount: 100})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	paid, err := client.RecordPayment(librarianCtx, &pb.RecordPaymentRequest{UserId: peterID, Amount: int64(fines.MaxFine), Note: "cash"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), paid.Balance)
+	assert.Equal(t, -int64(fines.MaxFine), paid.Transaction.Amount)
+
+	borrow, err = client.BorrowBook(peterCtx, &pb.BorrowBookRequest{BookId: bookID})
+	require.NoError(t, err)
+	_, err = client.ChargeFee(librarianCtx, &pb.ChargeFeeRequest{UserId: peterID, Kind: entity.FeeLost})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "lost needs a loan")
+	_, err = client.ChargeFee(librarianCtx, &pb.ChargeFeeRequest{LoanId: borrow.BorrowId, Kind: "stolen"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	lost, err := client.ChargeFee(librarianCtx, &pb.ChargeFeeRequest{LoanId: borrow.BorrowId, Kind: entity.FeeLost})
+	require.NoError(t, err)
+	assert.Equal(t, int64(fines.LostFee), lost.Transaction.Amount)
+	assert.Equal(t, peterID, lost.Transaction.UserId)
+	assert.Equal(t, int64(fines.LostFee), lost.Balance)
+
+	loan, err := memoryStore.GetLoan(ctx, borrow.BorrowId)
+	require.NoError(t, err)
+	assert.NotNil(t, loan.ReturnedAt)
+	item, err := memoryStore.GetCopy(ctx, loan.CopyID)
+	require.NoError(t, err)
+	assert.Equal(t, entity.CopyLost, item.Status)
+
+	_, err = client.ChargeFee(librarianCtx, &pb.ChargeFeeRequest{LoanId: borrow.BorrowId, Kind: entity.FeeLost})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "the loan is closed")
+	damaged, err := client.ChargeFee(librarianCtx, &pb.ChargeFeeRequest{LoanId: borrow.BorrowId, Kind: entity.FeeDamaged, Amount: 300})
+	require.NoError(t, err)
+	_, err = client.ChargeFee(librarianCtx, &pb.ChargeFeeRequest{LoanId: borrow.BorrowId, Kind: entity.FeeDamaged})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	// Waivers cancel a charge, in parts or whole
+	_, err = client.WaiveFee(librarianCtx, &pb.WaiveFeeRequest{TransactionId: paid.Transaction.Id})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "payments cannot be waived")
+	_, err = client.WaiveFee(librarianCtx, &pb.WaiveFeeRequest{TransactionId: damaged.Transaction.Id, Amount: 100, Note: "first damage"})
+	require.NoError(t, err)
+	_, err = client.WaiveFee(librarianCtx, &pb.WaiveFeeRequest{TransactionId: damaged.Transaction.Id, Amount: 300})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	waived, err := client.WaiveFee(librarianCtx, &pb.WaiveFeeRequest{TransactionId: damaged.Transaction.Id})
+	require.NoError(t, err)
+	assert.Equal(t, int64(-200), waived.Transaction.Amount)
+	assert.Equal(t, damaged.Transaction.Id, waived.Transaction.ChargeId)
+	_, err = client.WaiveFee(librarianCtx, &pb.WaiveFeeRequest{TransactionId: damaged.Transaction.Id})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// The history keeps every entry with the running balance
+	history, err := client.ListFeeTransactions(peterCtx, &pb.ListFeeTransactionsRequest{})
+	require.NoError(t, err)
+	var kinds []string
+	for _, entry := range history.Transactions {
+		kinds = append(kinds, entry.Kind)
+	}
+	assert.Equal(t, []string{
+		entity.FeeOverdue, entity.FeeOverdue, entity.FeeOverdue, entity.FeePayment,
+		entity.FeeLost, entity.FeeDamaged, entity.FeeWaiver, entity.FeeWaiver,
+	}, kinds)
+	assert.Equal(t, int64(fines.LostFee), history.Balance)
+	assert.Equal(t, history.Balance, history.Transactions[len(history.Transactions)-1].Balance)
+	assert.Equal(t, int64(0), history.Transactions[3].Balance)
+
+	_, err = client.ListFeeTransactions(maryCtx, &pb.ListFeeTransactionsRequest{UserId: peterID})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	other, err := client.GetFeeBalance(librarianCtx, &pb.GetFeeBalanceRequest{UserId: peterID})
+	require.NoError(t, err)
+	assert.Equal(t, history.Balance, other.Balance)
+}
+
+func TestScheduledJobs(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	peterID, _ := createUser(t, memoryStore, "peter", "")
+	maryID, _ := createUser(t, memoryStore, "mary", "")
+	ctx := context.Background()
+
+	cfg := testConfig()
+	cfg.Scheduler.FineAccrualSpec = "" // disabled, still runs by hand
+	jobs := newTestServiceWithConfig(t, memoryStore, cfg).jobs
+
+	registered, err := jobs.Jobs(ctx)
+	require.NoError(t, err)
+	var names []string
+	for _, job := range registered {
+		names = append(names, job.Name+" "+job.Spec)
+	}
+	assert.Equal(t, []string{"fine_accrual ", "hold_expiry */15 * * * *", "late_books 0 0 * * *", "notifications */15 * * * *"}, names)
+
+	lastWeek := time.Now().AddDate(0, 0, -7).Format("2006-01-02")
+	nextWeek := time.Now().AddDate(0, 0, 7).Format("2006-01-02")
+	for _, loan := range []entity.BorrowedBooks{
+		{UserID: peterID, BookID: "a", ReturnDate: lastWeek},
+		{UserID: peterID, BookID: "b", ReturnDate: lastWeek},
+		{UserID: maryID, BookID: "c", ReturnDate: lastWeek},
+		{UserID: maryID, BookID: "d", ReturnDate: nextWeek},
+	} {
+		require.NoError(t, memoryStore.CreateLoan(ctx, &loan))
+	}
+
+	scheduled := time.Now().Truncate(time.Minute)
+	run, err := jobs.Run(ctx, config.JobLateBooks, scheduled)
+	require.NoError(t, err)
+	assert.Equal(t, entity.JobSucceeded, run.Status)
+	assert.Equal(t, entity.JobResult{Checked: 3, Summary: "3 loans of 2 users are overdue"}, run.Result)
+
+	run, err = jobs.Run(ctx, config.JobFineAccrual, scheduled)
+	require.NoError(t, err)
+	assert.Equal(t, entity.JobSucceeded, run.Status)
+	assert.Equal(t, 3, run.Result.Changed)
+
+	history, err := memoryStore.ListJobRuns(ctx, store.JobRunFilter{Job: config.JobLateBooks})
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, scheduled.UTC(), history[0].ScheduledAt)
+}
+
+func TestJobAdmin(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	adminID, adminCtx := createUser(t, memoryStore, "admin", entity.RoleAdmin)
+	_, memberCtx := createUser(t, memoryStore, "peter", "")
+
+	_, err := client.ListJobs(memberCtx, &pb.ListJobsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.TriggerJob(memberCtx, &pb.TriggerJobRequest{Name: config.JobLateBooks})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	jobs, err := client.ListJobs(adminCtx, &pb.ListJobsRequest{})
+	require.NoError(t, err)
+	require.Len(t, jobs.Jobs, 4)
+	assert.Equal(t, config.JobFineAccrual, jobs.Jobs[0].Name)
+	assert.NotEmpty(t, jobs.Jobs[0].NextRun)
+	assert.Nil(t, jobs.Jobs[0].LastRun)
+
+	// Triggered runs go on in the background
+	triggered, err := client.TriggerJob(adminCtx, &pb.TriggerJobRequest{Name: config.JobLateBooks})
+	require.NoError(t, err)
+	assert.Equal(t, entity.JobRunning, triggered.Run.Status)
+	assert.Equal(t, adminID, triggered.Run.TriggeredBy)
+	assert.Eventually(t, func() bool {
+		runs, err := client.ListJobRuns(adminCtx, &pb.ListJobRunsRequest{Name: config.JobLateBooks, Status: entity.JobSucceeded})
+		return err == nil && len(runs.Runs) == 1 && runs.Runs[0].Id == triggered.Run.Id
+	}, 5*time.Second, 20*time.Millisecond)
+
+	_, err = client.TriggerJob(adminCtx, &pb.TriggerJobRequest{Name: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	paused, err := client.PauseJob(adminCtx, &pb.PauseJobRequest{Name: config.JobHoldExpiry})
+	require.NoError(t, err)
+	assert.True(t, paused.Job.Paused)
+	assert.Equal(t, adminID, paused.Job.PausedBy)
+	assert.NotEmpty(t, paused.Job.PausedAt)
+
+	jobs, err = client.ListJobs(adminCtx, &pb.ListJobsRequest{})
+	require.NoError(t, err)
+	for _, job := range jobs.Jobs {
+		assert.Equal(t, job.Name == config.JobHoldExpiry, job.Paused, job.Name)
+		if job.Name == config.JobLateBooks {
+			require.NotNil(t, job.LastRun)
+			assert.Equal(t, triggered.Run.Id, job.LastRun.Id)
+		}
+	}
+
+	resumed, err := client.ResumeJob(adminCtx, &pb.ResumeJobRequest{Name: config.JobHoldExpiry})
+	require.NoError(t, err)
+	assert.False(t, resumed.Job.Paused)
+	assert.Empty(t, resumed.Job.PausedBy)
+	_, err = client.PauseJob(adminCtx, &pb.PauseJobRequest{Name: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// The last N runs, newest first
+	for i := 0; i < 3; i++ {
+		scheduled := time.Now().Add(time.Duration(-i) * time.Hour)
+		require.NoError(t, memoryStore.CreateJobRun(context.Background(), &entity.JobRun{
+			Job: config.JobFineAccrual, ScheduledAt: scheduled, StartedAt: scheduled, Status: entity.JobRunning,
+		}))
+	}
+	runs, err := client.ListJobRuns(adminCtx, &pb.ListJobRunsRequest{Name: config.JobFineAccrual, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, runs.Runs, 2)
+	assert.Greater(t, runs.Runs[0].ScheduledAt, runs.Runs[1].ScheduledAt)
+
+	_, err = client.ListJobRuns(adminCtx, &pb.ListJobRunsRequest{Name: config.JobFineAccrual, Limit: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.ListJobRuns(adminCtx, &pb.ListJobRunsRequest{Name: config.JobFineAccrual, Status: "done"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.ListJobRuns(adminCtx, &pb.ListJobRunsRequest{Name: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestSendNotifications(t *testing.T) {
+	smtpServer := smtptest.NewServer()
+	defer smtpServer.Close()
+
+	memoryStore := store.NewMemoryStore()
+	peterID, _ := createUser(t, memoryStore, "peter", "")
+	maryID, _ := createUser(t, memoryStore, "mary", "")
+	paulID, _ := createUser(t, memoryStore, "paul", "") // no email, notified on nothing
+	ctx := context.Background()
+
+	cfg := testConfig()
+	cfg.Notifications.SMTP = config.SMTPConfig{Address: smtpServer.Addr, From: "Library <library@example.com>"}
+	cfg.Notifications.Channels = []string{entity.ChannelEmail}
+	service := newTestServiceWithConfig(t, memoryStore, cfg)
+
+	require.NoError(t, memoryStore.SetNotificationPreferences(ctx, entity.NotificationPreferences{UserID: peterID, Email: "peter@example.com"}))
+	require.NoError(t, memoryStore.SetNotificationPreferences(ctx, entity.NotificationPreferences{
+		UserID: maryID, Email: "mary@example.com", Muted: []string{entity.NotifyDueSoon},
+	}))
+
+	dune := entity.Title{Title: "Dune", Author: "Frank Herbert"}
+	require.NoError(t, memoryStore.CreateTitle(ctx, &dune, nil))
+	now := time.Now()
+	day := func(days int) string { return now.AddDate(0, 0, days).Format("2006-01-02") }
+	for _, loan := range []entity.BorrowedBooks{
+		{UserID: peterID, BookID: dune.ID.Hex(), ReturnDate: day(2)},  // due soon
+		{UserID: peterID, BookID: dune.ID.Hex(), ReturnDate: day(-3)}, // overdue
+		{UserID: peterID, BookID: dune.ID.Hex(), ReturnDate: day(5)},  // not yet
+		{UserID: maryID, BookID: dune.ID.Hex(), ReturnDate: day(1)},   // muted
+		{UserID: maryID, BookID: dune.ID.Hex(), ReturnDate: day(-1)},  // overdue
+		{UserID: paulID, BookID: dune.ID.Hex(), ReturnDate: day(-1)},
+	} {
+		require.NoError(t, memoryStore.CreateLoan(ctx, &loan))
+	}
+	hold := entity.Hold{TitleID: dune.ID.Hex(), UserID: peterID, Status: entity.HoldWaiting, CreatedAt: now}
+	require.NoError(t, memoryStore.CreateHold(ctx, &hold))
+	require.NoError(t, memoryStore.ReadyHold(ctx, hold.ID.Hex(), "copy", now, now.Add(72*time.Hour)))
+
+	result, err := service.sendNotifications(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 6, result.Checked)
+	assert.Equal(t, 4, result.Changed)
+	assert.Equal(t, "sent 4 notifications", result.Summary)
+
+	subjects := map[string][]string{}
+	for _, mail := range smtpServer.Mails() {
+		for _, line := range strings.Split(mail.Data, "\r\n") {
+			if subject, ok := strings.CutPrefix(line, "Subject: "); ok {
+				subjects[mail.To[0]] = append(subjects[mail.To[0]], subject)
+			}
+		}
+	}
+	assert.ElementsMatch(t, []string{
+		`"Dune" is due on ` + day(2),
+		`"Dune" is overdue`,
+		`"Dune" is ready for pickup`,
+	}, subjects["peter@example.com"])
+	assert.Equal(t, []string{`"Dune" is overdue`}, subjects["mary@example.com"])
+
+	sent, err := memoryStore.ListNotifications(ctx, store.NotificationFilter{UserID: peterID})
+	require.NoError(t, err)
+	require.Len(t, sent, 3)
+	assert.Equal(t, []string{entity.ChannelEmail}, sent[0].Channels)
+
+	// Reminders are never sent twice
+	result, err = service.sendNotifications(ctx, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, result.Changed)
+	assert.Len(t, smtpServer.Mails(), 4)
+
+	// Undelivered notifications are sent by the next run
+	late := entity.BorrowedBooks{UserID: maryID, BookID: dune.ID.Hex(), ReturnDate: day(-2)}
+	require.NoError(t, memoryStore.CreateLoan(ctx, &late))
+	smtpServer.RejectRecipients(true)
+	result, err = service.sendNotifications(ctx, now)
+	assert.ErrorContains(t, err, "overdue notification to mary")
+	assert.Zero(t, result.Changed)
+
+	smtpServer.RejectRecipients(false)
+	result, err = service.sendNotifications(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Changed)
+	assert.Len(t, smtpServer.Mails(), 5)
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	cfg := testConfig()
+	cfg.Notifications.SMTP = config.SMTPConfig{Address: "localhost:25", From: "library@example.com"}
+	client, memoryStore := setupTestServerWithConfig(t, cfg)
+	peterID, ctx := createUser(t, memoryStore, "peter", "")
+
+	prefs, err := client.GetNotificationPreferences(ctx, &pb.GetNotificationPreferencesRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{entity.ChannelLog}, prefs.Preferences.Channels)
+	assert.True(t, prefs.Preferences.DefaultChannels)
+	assert.Equal(t, []string{entity.ChannelLog, entity.ChannelEmail}, prefs.Preferences.AvailableChannels)
+	assert.Empty(t, prefs.Preferences.UpdatedAt)
+
+	_, err = client.UpdateNotificationPreferences(ctx, &pb.UpdateNotificationPreferencesRequest{Channels: []string{entity.ChannelEmail}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "email without an address")
+	_, err = client.UpdateNotificationPreferences(ctx, &pb.UpdateNotificationPreferencesRequest{Channels: []string{entity.ChannelWebhook}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "webhook is not configured")
+	_, err = client.UpdateNotificationPreferences(ctx, &pb.UpdateNotificationPreferencesRequest{Email: "peter"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.UpdateNotificationPreferences(ctx, &pb.UpdateNotificationPreferencesRequest{Muted: []string{"fines"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	updated, err := client.UpdateNotificationPreferences(ctx, &pb.UpdateNotificationPreferencesRequest{
+		Email:    "Peter <peter@example.com>",
+		Channels: []string{entity.ChannelEmail, entity.ChannelEmail},
+		Muted:    []string{entity.NotifyDueSoon},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "peter@example.com", updated.Preferences.Email)
+	assert.Equal(t, []string{entity.ChannelEmail}, updated.Preferences.Channels)
+	assert.False(t, updated.Preferences.DefaultChannels)
+	assert.Equal(t, []string{entity.NotifyDueSoon}, updated.Preferences.Muted)
+
+	prefs, err = client.GetNotificationPreferences(ctx, &pb.GetNotificationPreferencesRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, updated.Preferences, prefs.Preferences)
+
+	// Users only see their own notifications
+	_, otherCtx := createUser(t, memoryStore, "mary", "")
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, kind := range []string{entity.NotifyOverdue, entity.NotifyHoldReady} {
+		require.NoError(t, memoryStore.CreateNotification(context.Background(), &entity.Notification{
+			UserID: peterID, Kind: kind, Key: kind, Channels: []string{entity.ChannelEmail},
+			Subject: kind, SentAt: now.Add(time.Duration(i) * time.Minute),
+		}))
+	}
+	list, err := client.ListNotifications(ctx, &pb.ListNotificationsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Notifications, 2)
+	assert.Equal(t, entity.NotifyHoldReady, list.Notifications[0].Kind)
+	assert.Equal(t, now.Add(time.Minute).Format(time.RFC3339), list.Notifications[0].SentAt)
+
+	list, err = client.ListNotifications(ctx, &pb.ListNotificationsRequest{Kind: entity.NotifyOverdue})
+	require.NoError(t, err)
+	assert.Len(t, list.Notifications, 1)
+	_, err = client.ListNotifications(ctx, &pb.ListNotificationsRequest{Kind: "fines"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	list, err = client.ListNotifications(otherCtx, &pb.ListNotificationsRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, list.Notifications)
+}
+
+func TestGetBooksPagination(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	_, ctx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+
+	addBook(t, client, ctx, "Dune", "Frank Herbert", "1965-08-01")
+	addBook(t, client, ctx, "Dune Messiah", "Frank Herbert", "1969-10-15")
+	addBook(t, client, ctx, "Children of Dune", "Frank Herbert", "1976-04-01")
+	addBook(t, client, ctx, "Neuromancer", "William Gibson", "1984-07-01")
+	addBook(t, client, ctx, "Count Zero", "William Gibson", "1986-03-01")
+
+	// Walk through all pages
+	var titles []string
+	pageToken := ""
+	for {
+		resp, err := client.GetBooks(ctx, &pb.GetBooksRequest{PageSize: 2, PageToken: pageToken})
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(resp.Books), 2)
+
+		for _, book := range resp.Books {
+			titles = append(titles, book.Title)
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		pageToken = resp.NextPageToken
+	}
+	assert.Equal(t, []string{"Children of Dune", "Count Zero", "Dune", "Dune Messiah", "Neuromancer"}, titles)
+
+	resp, err := client.GetBooks(ctx, &pb.GetBooksRequest{Author: "Frank Herbert", TitlePrefix: "dune"})
+	require.NoError(t, err)
+	assert.Len(t, resp.Books, 2)
+
+	resp, err = client.GetBooks(ctx, &pb.GetBooksRequest{PublishedFrom: "1970-01-01", PublishedTo: "1984-12-31"})
+	require.NoError(t, err)
+	require.Len(t, resp.Books, 2)
+	assert.Equal(t, "Children of Dune", resp.Books[0].Title)
+	assert.Equal(t, "Neuromancer", resp.Books[1].Title)
+
+	_, err = client.GetBooks(ctx, &pb.GetBooksRequest{PageToken: "not-a-token"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGetBooksByBorrower(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	_, librarianCtx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+	peterID, peterCtx := createUser(t, memoryStore, "peter", "")
+	_, maryCtx := createUser(t, memoryStore, "mary", "")
+
+	duneID := addBook(t, client, librarianCtx, "Dune", "Frank Herbert", "1965-08-01")
+	addBook(t, client, librarianCtx, "Neuromancer", "William Gibson", "1984-07-01")
+	_, err := client.BorrowBook(peterCtx, &pb.BorrowBookRequest{BookId: duneID})
+	require.NoError(t, err)
+
+	// Members see their own loans only, librarians anyone's
+	resp, err := client.GetBooks(peterCtx, &pb.GetBooksRequest{UserId: peterID})
+	require.NoError(t, err)
+	require.Len(t, resp.Books, 1)
+	assert.Equal(t, duneID, resp.Books[0].Id)
+
+	_, err = client.GetBooks(maryCtx, &pb.GetBooksRequest{UserId: peterID})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	resp, err = client.GetBooks(librarianCtx, &pb.GetBooksRequest{UserId: peterID})
+	require.NoError(t, err)
+	assert.Len(t, resp.Books, 1)
+}
+
+func TestGetBorrowedBooks(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	userID, ctx := createUser(t, memoryStore, "peter", "")
+	_, otherCtx := createUser(t, memoryStore, "mary", "")
+	_, adminCtx := createUser(t, memoryStore, "admin", entity.RoleAdmin)
+
+	firstID := addBook(t, client, adminCtx, "Dune", "Frank Herbert", "1965-08-01")
+	secondID := addBook(t, client, adminCtx, "Neuromancer", "William Gibson", "1984-07-01")
+
+	first, err := client.BorrowBook(ctx, &pb.BorrowBookRequest{BookId: firstID})
+	require.NoError(t, err)
+	_, err = client.BorrowBook(ctx, &pb.BorrowBookRequest{BookId: secondID})
+	require.NoError(t, err)
+	_, err = client.ReturnBook(ctx, &pb.ReturnBookRequest{BorrowId: first.BorrowId})
+	require.NoError(t, err)
+
+	// Make the second loan overdue
+	overdue := entity.BorrowedBooks{
+		BookID:       secondID,
+		UserID:       userID,
+		BorrowedDate: time.Now().AddDate(0, 0, -10).Format("2006-01-02"),
+		ReturnDate:   time.Now().AddDate(0, 0, -3).Format("2006-01-02"),
+	}
+	require.NoError(t, memoryStore.CreateLoan(context.Background(), &overdue))
+
+	all, err := client.GetBorrowedBooks(ctx, &pb.GetBorrowedBooksRequest{})
+	require.NoError(t, err)
+	assert.Len(t, all.BorrowedBooks, 3)
+
+	returned, err := client.GetBorrowedBooks(ctx, &pb.GetBorrowedBooksRequest{Filter: "returned"})
+	require.NoError(t, err)
+	require.Len(t, returned.BorrowedBooks, 1)
+	assert.Equal(t, "Dune", returned.BorrowedBooks[0].Title)
+	assert.NotEmpty(t, returned.BorrowedBooks[0].ReturnDate)
+
+	overdueLoans, err := client.GetBorrowedBooks(ctx, &pb.GetBorrowedBooksRequest{Filter: "overdue"})
+	require.NoError(t, err)
+	require.Len(t, overdueLoans.BorrowedBooks, 1)
+	assert.Equal(t, overdue.ID.Hex(), overdueLoans.BorrowedBooks[0].Id)
+	assert.True(t, overdueLoans.BorrowedBooks[0].Overdue)
+	assert.Equal(t, "William Gibson", overdueLoans.BorrowedBooks[0].Author)
+
+	active, err := client.GetBorrowedBooks(ctx, &pb.GetBorrowedBooksRequest{Filter: "active"})
+	require.NoError(t, err)
+	assert.Len(t, active.BorrowedBooks, 2)
+
+	// Only admins can see another user's loans
+	_, err = client.GetBorrowedBooks(otherCtx, &pb.GetBorrowedBooksRequest{UserId: userID})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	byAdmin, err := client.GetBorrowedBooks(adminCtx, &pb.GetBorrowedBooksRequest{UserId: userID})
+	require.NoError(t, err)
+	assert.Len(t, byAdmin.BorrowedBooks, 3)
+
+	_, err = client.GetBorrowedBooks(ctx, &pb.GetBorrowedBooksRequest{Filter: "lost"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestOutboxEvents(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	peterID, ctx := createUser(t, memoryStore, "peter", "")
+	_, librarianCtx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+
+	bookID := addBook(t, client, librarianCtx, "Dune", "Frank Herbert", "1965-08-01")
+	borrow, err := client.BorrowBook(ctx, &pb.BorrowBookRequest{BookId: bookID})
+	require.NoError(t, err)
+	_, err = client.ReturnBook(ctx, &pb.ReturnBookRequest{BorrowId: borrow.BorrowId})
+	require.NoError(t, err)
+	_, err = client.RemoveBook(librarianCtx, &pb.RemoveBookRequest{BookId: bookID})
+	require.NoError(t, err)
+
+	// Failed changes add no events
+	_, err = client.ReturnBook(ctx, &pb.ReturnBookRequest{BorrowId: borrow.BorrowId})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = client.RemoveBook(librarianCtx, &pb.RemoveBookRequest{BookId: bookID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// The relay hands them to the bus in order
+	bus := outbox.NewBus()
+	var events []outbox.Event
+	bus.Subscribe(func(ctx context.Context, event outbox.Event) error {
+		events = append(events, event)
+		return nil
+	})
+	relay := outbox.NewRelay(memoryStore, bus, testConfig().Outbox, "test")
+	delivered, err := relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 6, delivered)
+
+	require.Len(t, events, 6)
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+		assert.Equal(t, bookID, event.BookID)
+	}
+	assert.Equal(t, []string{
+		entity.EventBookAdded, entity.EventBookStatusChanged, entity.EventBookBorrowed,
+		entity.EventBookReturned, entity.EventBookStatusChanged, entity.EventBookRemoved,
+	}, types)
+
+	var added outbox.BookData
+	require.NoError(t, json.Unmarshal(events[0].Data, &added))
+	assert.Equal(t, outbox.BookData{BookID: bookID, Title: "Dune", Author: "Frank Herbert", PublishedDate: "1965-08-01"}, added)
+
+	var copyAdded outbox.CopyData
+	require.NoError(t, json.Unmarshal(events[1].Data, &copyAdded))
+	assert.Equal(t, entity.CopyAvailable, copyAdded.Status)
+	assert.Empty(t, copyAdded.Previous)
+
+	var borrowed, returned outbox.LoanData
+	require.NoError(t, json.Unmarshal(events[2].Data, &borrowed))
+	assert.Equal(t, borrow.BorrowId, borrowed.LoanID)
+	assert.Equal(t, peterID, borrowed.UserID)
+	assert.NotEmpty(t, borrowed.CopyID)
+	assert.NotEmpty(t, borrowed.DueDate)
+	assert.Empty(t, borrowed.ReturnedAt)
+	assert.Equal(t, copyAdded.CopyID, borrowed.CopyID)
+	require.NoError(t, json.Unmarshal(events[3].Data, &returned))
+	assert.Equal(t, borrow.BorrowId, returned.LoanID)
+	assert.NotEmpty(t, returned.ReturnedAt)
+}
+
+// recvBookEvents receives n events of the stream and returns their types and book IDs.
+func recvBookEvents(t *testing.T, stream pb.BookRentalService_WatchBooksClient, n int) []*pb.BookEvent {
+	var events []*pb.BookEvent
+	for i := 0; i < n; i++ {
+		event, err := stream.Recv()
+		require.NoError(t, err)
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestWatchBooks(t *testing.T) {
+	cfg := testConfig()
+	cfg.Outbox.Interval = 10 * time.Millisecond
+	client, memoryStore := setupTestServerWithConfig(t, cfg)
+	_, ctx := createUser(t, memoryStore, "peter", "")
+	_, librarianCtx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+
+	duneID := addBook(t, client, librarianCtx, "Dune", "Frank Herbert", "1965-08-01")
+	emmaID := addBook(t, client, librarianCtx, "Emma", "Jane Austen", "1815-12-23")
+
+	watchCtx, stopWatching := context.WithTimeout(ctx, 5*time.Second)
+	stream, err := client.WatchBooks(watchCtx, &pb.WatchBooksRequest{})
+	require.NoError(t, err)
+
+	// The snapshot, in title order, then the changes
+	events := recvBookEvents(t, stream, 3)
+	assert.Equal(t, "snapshot", events[0].Type)
+	assert.Equal(t, duneID, events[0].BookId)
+	assert.Equal(t, bookStatusAvailable, events[0].Book.Status)
+	assert.Empty(t, events[0].ResumeToken)
+	assert.Equal(t, emmaID, events[1].BookId)
+	assert.Equal(t, "synced", events[2].Type)
+	synced := events[2].ResumeToken
+	assert.NotEmpty(t, synced)
+
+	borrow, err := client.BorrowBook(ctx, &pb.BorrowBookRequest{BookId: duneID})
+	require.NoError(t, err)
+	events = recvBookEvents(t, stream, 1)
+	assert.Equal(t, "borrowed", events[0].Type)
+	assert.Equal(t, duneID, events[0].BookId)
+	assert.Equal(t, bookStatusUnavailable, events[0].Book.Status)
+	assert.Equal(t, int32(0), events[0].Book.AvailableCopies)
+	assert.NotEmpty(t, events[0].OccurredAt)
+	afterBorrow := events[0].ResumeToken
+	stopWatching()
+
+	// A resumed stream gets the changes it missed
+	_, err = client.ReturnBook(ctx, &pb.ReturnBookRequest{BorrowId: borrow.BorrowId})
+	require.NoError(t, err)
+	_, err = client.RemoveBook(librarianCtx, &pb.RemoveBookRequest{BookId: emmaID})
+	require.NoError(t, err)
+
+	watchCtx, stopWatching = context.WithTimeout(ctx, 5*time.Second)
+	defer stopWatching()
+	stream, err = client.WatchBooks(watchCtx, &pb.WatchBooksRequest{ResumeToken: afterBorrow})
+	require.NoError(t, err)
+	events = recvBookEvents(t, stream, 4)
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type+" "+event.BookId)
+	}
+	assert.Equal(t, []string{"returned " + duneID, "status_changed " + duneID, "removed " + emmaID, "synced "}, types)
+	assert.Equal(t, bookStatusAvailable, events[0].Book.Status)
+	assert.Nil(t, events[2].Book)
+	assert.Equal(t, events[2].ResumeToken, events[3].ResumeToken)
+
+	// Resuming from before the borrow replays it
+	stream, err = client.WatchBooks(watchCtx, &pb.WatchBooksRequest{ResumeToken: synced, BookIds: []string{duneID}})
+	require.NoError(t, err)
+	events = recvBookEvents(t, stream, 4)
+	assert.Equal(t, []string{"borrowed", "returned", "status_changed", "synced"},
+		[]string{events[0].Type, events[1].Type, events[2].Type, events[3].Type})
+
+	// Tokens of pruned changes are refused
+	pending, err := memoryStore.ListOutboxEvents(context.Background(), store.OutboxFilter{})
+	require.NoError(t, err)
+	for _, event := range pending {
+		require.NoError(t, memoryStore.MarkOutboxEventDelivered(context.Background(), event.ID.Hex(), time.Now()))
+	}
+	require.NoError(t, memoryStore.DeleteOutboxEvents(context.Background(), time.Now().Add(time.Minute)))
+	stream, err = client.WatchBooks(watchCtx, &pb.WatchBooksRequest{ResumeToken: synced})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.OutOfRange, status.Code(err))
+
+	for _, req := range []*pb.WatchBooksRequest{
+		{ResumeToken: "not a token"},
+		{ResumeToken: encodeWatchToken(1000)},
+		{Status: "borrowed"},
+		{BookIds: []string{"dune"}},
+	} {
+		stream, err = client.WatchBooks(watchCtx, req)
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "%v", req)
+	}
+
+	stream, err = client.WatchBooks(context.Background(), &pb.WatchBooksRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestWatchBooksStatus(t *testing.T) {
+	cfg := testConfig()
+	cfg.Outbox.Interval = 10 * time.Millisecond
+	client, memoryStore := setupTestServerWithConfig(t, cfg)
+	_, ctx := createUser(t, memoryStore, "peter", "")
+	_, librarianCtx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+
+	duneID := addBook(t, client, librarianCtx, "Dune", "Frank Herbert", "1965-08-01")
+	emmaID := addBook(t, client, librarianCtx, "Emma", "Jane Austen", "1815-12-23")
+	_, err := client.BorrowBook(ctx, &pb.BorrowBookRequest{BookId: emmaID})
+	require.NoError(t, err)
+
+	watchCtx, stopWatching := context.WithTimeout(ctx, 5*time.Second)
+	defer stopWatching()
+	stream, err := client.WatchBooks(watchCtx, &pb.WatchBooksRequest{Status: bookStatusAvailable})
+	require.NoError(t, err)
+	events := recvBookEvents(t, stream, 2)
+	assert.Equal(t, "snapshot", events[0].Type)
+	assert.Equal(t, duneID, events[0].BookId)
+	assert.Equal(t, "synced", events[1].Type)
+
+	// Dune leaves the filter with one last event, then is not sent anymore
+	borrow, err := client.BorrowBook(ctx, &pb.BorrowBookRequest{BookId: duneID})
+	require.NoError(t, err)
+	events = recvBookEvents(t, stream, 1)
+	assert.Equal(t, "borrowed", events[0].Type)
+	assert.Equal(t, duneID, events[0].BookId)
+	assert.Equal(t, bookStatusUnavailable, events[0].Book.Status)
+
+	// A copy added to Emma makes it enter the filter
+	_, err = client.AddCopy(librarianCtx, &pb.AddCopyRequest{BookId: emmaID})
+	require.NoError(t, err)
+	_, err = client.ReturnBook(ctx, &pb.ReturnBookRequest{BorrowId: borrow.BorrowId})
+	require.NoError(t, err)
+	events = recvBookEvents(t, stream, 3)
+	assert.Equal(t, "status_changed", events[0].Type)
+	assert.Equal(t, emmaID, events[0].BookId)
+	assert.Equal(t, int32(1), events[0].Book.AvailableCopies)
+	assert.Equal(t, "returned", events[1].Type)
+	assert.Equal(t, duneID, events[1].BookId)
+	assert.Equal(t, bookStatusAvailable, events[1].Book.Status)
+	assert.Equal(t, "status_changed", events[2].Type)
+	assert.Equal(t, duneID, events[2].BookId)
+}
+
+func TestWebhookSubscriptions(t *testing.T) {
+	client, memoryStore := setupTestServer(t)
+	_, adminCtx := createUser(t, memoryStore, "admin", entity.RoleAdmin)
+	_, librarianCtx := createUser(t, memoryStore, "librarian", entity.RoleLibrarian)
+	peterID, peterCtx := createUser(t, memoryStore, "peter", "")
+	_, maryCtx := createUser(t, memoryStore, "mary", "")
+
+	var mu sync.Mutex
+	var posts []*http.Request
+	var bodies [][]byte
+	partner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		mu.Lock()
+		defer mu.Unlock()
+		posts = append(posts, r)
+		bodies = append(bodies, body)
+	}))
+	defer partner.Close()
+
+	// Admins only, with known event types and an http URL
+	request := &pb.CreateWebhookSubscriptionRequest{Url: partner.URL, EventTypes: []string{entity.EventHoldReady, entity.EventHoldReady}}
+	_, err := client.CreateWebhookSubscription(librarianCtx, request)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.CreateWebhookSubscription(adminCtx, &pb.CreateWebhookSubscriptionRequest{Url: partner.URL, EventTypes: []string{"book.lost"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.CreateWebhookSubscription(adminCtx, &pb.CreateWebhookSubscriptionRequest{Url: "ftp://partner.example", EventTypes: []string{entity.EventBookAdded}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.CreateWebhookSubscription(adminCtx, &pb.CreateWebhookSubscriptionRequest{Url: partner.URL})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	created, err := client.CreateWebhookSubscription(adminCtx, request)
+	require.NoError(t, err)
+	sub := created.Subscription
+	assert.Equal(t, []string{entity.EventHoldReady}, sub.EventTypes)
+	assert.True(t, strings.HasPrefix(sub.Secret, "whsec_"))
+
+	// The secret is not shown again
+	list, err := client.ListWebhookSubscriptions(adminCtx, &pb.ListWebhookSubscriptionsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Subscriptions, 1)
+	assert.Equal(t, sub.Id, list.Subscriptions[0].Id)
+	assert.Empty(t, list.Subscriptions[0].Secret)
+
+	// The test event is signed with the secret
+	tested, err := client.SendTestWebhook(adminCtx, &pb.SendTestWebhookRequest{SubscriptionId: sub.Id})
+	require.NoError(t, err)
+	assert.Equal(t, entity.DeliveryDelivered, tested.Delivery.Status)
+	assert.Equal(t, int32(http.StatusOK), tested.Delivery.ResponseCode)
+	require.Len(t, posts, 1)
+	assert.Equal(t, webhook.EventTest, posts[0].Header.Get(webhook.HeaderEventType))
+	require.NoError(t, webhook.Verify(sub.Secret, posts[0].Header.Get(webhook.HeaderSignature), bodies[0], time.Now(), time.Minute))
+	_, err = client.SendTestWebhook(adminCtx, &pb.SendTestWebhookRequest{SubscriptionId: primitive.NewObjectID().Hex()})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// A copy coming back for a waiting hold is posted to the partner
+	bookID := addBook(t, client, librarianCtx, "Dune", "Frank Herbert", "1965-08-01")
+	borrow, err := client.BorrowBook(maryCtx, &pb.BorrowBookRequest{BookId: bookID})
+	require.NoError(t, err)
+	hold, err := client.PlaceHold(peterCtx, &pb.PlaceHoldRequest{BookId: bookID})
+	require.NoError(t, err)
+	_, err = client.ReturnBook(maryCtx, &pb.ReturnBookRequest{BorrowId: borrow.BorrowId})
+	require.NoError(t, err)
+
+	dispatcher := webhook.NewDispatcher(memoryStore, testConfig().Webhooks, "test")
+	relay := outbox.NewRelay(memoryStore, dispatcher, testConfig().Outbox, "test")
+	_, err = relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	delivered, err := dispatcher.DeliverDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+
+	require.Len(t, posts, 2)
+	assert.Equal(t, entity.EventHoldReady, posts[1].Header.Get(webhook.HeaderEventType))
+	require.NoError(t, webhook.Verify(sub.Secret, posts[1].Header.Get(webhook.HeaderSignature), bodies[1], time.Now(), time.Minute))
+	var event outbox.Event
+	require.NoError(t, json.Unmarshal(bodies[1], &event))
+	var ready outbox.HoldData
+	require.NoError(t, json.Unmarshal(event.Data, &ready))
+	assert.Equal(t, hold.Hold.Id, ready.HoldID)
+	assert.Equal(t, bookID, ready.BookID)
+	assert.Equal(t, peterID, ready.UserID)
+	assert.NotEmpty(t, ready.CopyID)
+	assert.NotEmpty(t, ready.PickupBy)
+
+	// The log has both deliveries, newest first
+	deliveries, err := client.ListWebhookDeliveries(adminCtx, &pb.ListWebhookDeliveriesRequest{SubscriptionId: sub.Id})
+	require.NoError(t, err)
+	require.Len(t, deliveries.Deliveries, 2)
+	assert.Equal(t, entity.EventHoldReady, deliveries.Deliveries[0].EventType)
+	assert.Equal(t, entity.DeliveryDelivered, deliveries.Deliveries[0].Status)
+	assert.NotEmpty(t, deliveries.Deliveries[0].DeliveredAt)
+	assert.Equal(t, webhook.EventTest, deliveries.Deliveries[1].EventType)
+	_, err = client.ListWebhookDeliveries(adminCtx, &pb.ListWebhookDeliveriesRequest{SubscriptionId: sub.Id, Status: "failed"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.ListWebhookDeliveries(adminCtx, &pb.ListWebhookDeliveriesRequest{SubscriptionId: "nope"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.DeleteWebhookSubscription(adminCtx, &pb.DeleteWebhookSubscriptionRequest{Id: sub.Id})
+	require.NoError(t, err)
+	_, err = client.DeleteWebhookSubscription(adminCtx, &pb.DeleteWebhookSubscriptionRequest{Id: sub.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	list, err = client.ListWebhookSubscriptions(adminCtx, &pb.ListWebhookSubscriptionsRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, list.Subscriptions)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gc2-yugo/config"
+	"gc2-yugo/store"
+	"strconv"
+)
+
+const migrateUsage = "usage: server [flags] migrate [up | down [steps] | status]"
+
+// runMigrate implements the migrate subcommand.
+func runMigrate(ctx context.Context, cfg config.StorageConfig, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	if cfg.Backend == "mongo" {
+		return runMongoMigrate(ctx, cfg.Mongo, args)
+	}
+	if cfg.Backend != store.DriverPostgres && cfg.Backend != store.DriverSQLite {
+		return fmt.Errorf("unknown storage backend %q, expected mongo, postgres or sqlite", cfg.Backend)
+	}
+
+	db, err := config.ConnectionDatabaseSQL(ctx, cfg.Backend, cfg.SQL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := store.MigrateUp(ctx, db)
+		for _, version := range applied {
+			fmt.Printf("applied migration %04d\n", version)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("database schema is up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+
+		reverted, err := store.MigrateDown(ctx, db, steps)
+		for _, version := range reverted {
+			fmt.Printf("reverted migration %04d\n", version)
+		}
+		if err != nil {
+			return err
+		}
+
+	case "status":
+		current, err := store.SchemaVersion(ctx, db)
+		if err != nil {
+			return err
+		}
+		latest, err := store.LatestSchemaVersion()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("database schema version %d, latest %d\n", current, latest)
+
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
+
+// runMongoMigrate implements the migrate subcommand for MongoDB, whose migrations
+// cannot be reverted.
+func runMongoMigrate(ctx context.Context, cfg config.MongoConfig, args []string) error {
+	client, err := config.ConnectMongo(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer client.Disconnect(ctx)
+	db := client.Database(cfg.Database)
+
+	switch args[0] {
+	case "up":
+		applied, err := store.MigrateMongoUp(ctx, db)
+		for _, version := range applied {
+			fmt.Printf("applied migration %04d\n", version)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("database schema is up to date")
+		}
+
+	case "down":
+		return errors.New("MongoDB migrations cannot be reverted")
+
+	case "status":
+		current, err := store.MongoSchemaVersion(ctx, db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("database schema version %d, latest %d\n", current, store.LatestMongoSchemaVersion())
+
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gc2-yugo/entity"
+	"gc2-yugo/notify"
+	"gc2-yugo/pb"
+	"gc2-yugo/store"
+	"log"
+	"net/mail"
+	"slices"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sendNotifications reminds the borrowers of loans due soon, tells them about overdue
+// loans and tells patrons that their hold is ready for pickup. Each notification is
+// sent once, one that could not be delivered on any channel is sent by the next run.
+func (s *BookRentalServiceServer) sendNotifications(ctx context.Context, now time.Time) (entity.JobResult, error) {
+	var result entity.JobResult
+	today := now.Format("2006-01-02")
+	// Loans due up to and including the last day of the reminder window
+	horizon := now.Add(s.config.Notifications.DueSoon).AddDate(0, 0, 1).Format("2006-01-02")
+
+	loans, err := s.store.ListLoans(ctx, store.LoanFilter{State: store.LoanOpen, DueBefore: horizon})
+	if err != nil {
+		return result, err
+	}
+	holds, err := s.store.ListHolds(ctx, store.HoldFilter{Statuses: []string{entity.HoldReady}})
+	if err != nil {
+		return result, err
+	}
+
+	titleIDs := make([]string, 0, len(loans)+len(holds))
+	for _, loan := range loans {
+		titleIDs = append(titleIDs, loan.BookID)
+	}
+	for _, hold := range holds {
+		titleIDs = append(titleIDs, hold.TitleID)
+	}
+	titles := map[string]entity.Title{}
+	if len(titleIDs) > 0 {
+		list, err := s.store.ListTitles(ctx, store.TitleFilter{IDs: titleIDs})
+		if err != nil {
+			return result, err
+		}
+		for _, title := range list {
+			titles[title.ID.Hex()] = title
+		}
+	}
+
+	var failures []error
+	send := func(userID, kind, key string, data notify.Data) {
+		result.Checked++
+		sent, err := s.notifyUser(ctx, userID, kind, key, data, now)
+		if err != nil {
+			failures = append(failures, err)
+			return
+		}
+		if sent {
+			result.Changed++
+			result.Summary = fmt.Sprintf("sent %d notifications", result.Changed)
+		}
+	}
+
+	todayDate, _ := time.Parse("2006-01-02", today)
+	for _, loan := range loans {
+		title := titles[loan.BookID]
+		data := notify.Data{Title: title.Title, Author: title.Author, DueDate: loan.ReturnDate}
+		// A renewed loan is reminded again for its new due date
+		key := loan.ID.Hex() + "/" + loan.ReturnDate
+		if loan.ReturnDate < today {
+			send(loan.UserID, entity.NotifyOverdue, key, data)
+			continue
+		}
+		if due, err := time.Parse("2006-01-02", loan.ReturnDate); err == nil {
+			data.Days = int(due.Sub(todayDate).Hours() / 24)
+		}
+		send(loan.UserID, entity.NotifyDueSoon, key, data)
+	}
+	for _, hold := range holds {
+		title := titles[hold.TitleID]
+		data := notify.Data{Title: title.Title, Author: title.Author}
+		if hold.PickupBy != nil {
+			data.PickupBy = hold.PickupBy.UTC().Format("Mon 2 Jan 2006 15:04 MST")
+		}
+		send(hold.UserID, entity.NotifyHoldReady, hold.ID.Hex(), data)
+	}
+	return result, errors.Join(failures...)
+}
+
+// notifyUser sends the notification of the kind and key to the user on their
+// channels, unless they muted the kind or already got it. It reports whether it
+// sent the notification.
+func (s *BookRentalServiceServer) notifyUser(ctx context.Context, userID, kind, key string, data notify.Data, now time.Time) (bool, error) {
+	user, err := s.store.GetUserByID(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	prefs, _, err := s.notificationPreferences(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if slices.Contains(prefs.Muted, kind) {
+		return false, nil
+	}
+
+	var channels []string
+	for _, channel := range prefs.Channels {
+		if s.notifiers[channel] == nil || (channel == entity.ChannelEmail && prefs.Email == "") {
+			continue
+		}
+		channels = append(channels, channel)
+	}
+	if len(channels) == 0 {
+		return false, nil
+	}
+
+	data.Username = user.Username
+	subject, body, err := s.templates.Render(kind, data)
+	if err != nil {
+		return false, err
+	}
+
+	// Claim the notification first, so that it is never sent twice
+	notification := &entity.Notification{
+		UserID:   userID,
+		Kind:     kind,
+		Key:      key,
+		Channels: channels,
+		Subject:  subject,
+		SentAt:   now.UTC(),
+	}
+	err = s.store.CreateNotification(ctx, notification)
+	if errors.Is(err, store.ErrAlreadyExists) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	msg := notify.Message{
+		Kind:     kind,
+		UserID:   userID,
+		Username: user.Username,
+		Email:    prefs.Email,
+		Subject:  subject,
+		Body:     body,
+	}
+	var failures []error
+	for _, channel := range channels {
+		if err := s.notifiers[channel].Notify(ctx, msg); err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", channel, err))
+		}
+	}
+	if len(failures) == len(channels) {
+		// Nothing was delivered, forget the notification so the next run sends it again
+		if err := s.store.DeleteNotification(context.WithoutCancel(ctx), notification.ID.Hex()); err != nil {
+			failures = append(failures, err)
+		}
+		return false, fmt.Errorf("%s notification to %s: %w", kind, user.Username, errors.Join(failures...))
+	}
+	if len(failures) > 0 {
+		log.Printf("%s notification to %s: %v", kind, user.Username, errors.Join(failures...))
+	}
+	return true, nil
+}
+
+// notificationPreferences returns the preferences of the user, with the default
+// channels when the user chose none, and reports whether the channels are the defaults.
+func (s *BookRentalServiceServer) notificationPreferences(ctx context.Context, userID string) (entity.NotificationPreferences, bool, error) {
+	prefs := entity.NotificationPreferences{UserID: userID}
+	stored, err := s.store.GetNotificationPreferences(ctx, userID)
+	if err == nil {
+		prefs = *stored
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return prefs, false, err
+	}
+
+	if len(prefs.Channels) > 0 {
+		return prefs, false, nil
+	}
+	prefs.Channels = s.config.Notifications.Channels
+	return prefs, true, nil
+}
+
+func (s *BookRentalServiceServer) toPBNotificationPreferences(prefs entity.NotificationPreferences, defaults bool) *pb.NotificationPreferences {
+	resp := &pb.NotificationPreferences{
+		Email:             prefs.Email,
+		Channels:          prefs.Channels,
+		DefaultChannels:   defaults,
+		Muted:             prefs.Muted,
+		AvailableChannels: s.config.Notifications.Available(),
+	}
+	if !prefs.UpdatedAt.IsZero() {
+		resp.UpdatedAt = prefs.UpdatedAt.UTC().Format(time.RFC3339)
+	}
+	return resp
+}
+
+func (s *BookRentalServiceServer) GetNotificationPreferences(ctx context.Context, req *pb.GetNotificationPreferencesRequest) (*pb.NotificationPreferencesResponse, error) {
+	userID, ok := ctx.Value(userIDKey).(string)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "Invalid token claims")
+	}
+
+	prefs, defaults, err := s.notificationPreferences(ctx, userID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch preferences: %v", err)
+	}
+
+	return &pb.NotificationPreferencesResponse{
+		Message:     "notification preferences",
+		Preferences: s.toPBNotificationPreferences(prefs, defaults),
+	}, nil
+}
+
+// UpdateNotificationPreferences replaces the caller's preferences. The email channel
+// needs an email address.
+func (s *BookRentalServiceServer) UpdateNotificationPreferences(ctx context.Context, req *pb.UpdateNotificationPreferencesRequest) (*pb.NotificationPreferencesResponse, error) {
+	userID, ok := ctx.Value(userIDKey).(string)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "Invalid token claims")
+	}
+
+	prefs := entity.NotificationPreferences{UserID: userID, UpdatedAt: time.Now().UTC()}
+	if req.Email != "" {
+		addr, err := mail.ParseAddress(req.Email)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid email address: %v", err)
+		}
+		prefs.Email = addr.Address
+	}
+
+	available := s.config.Notifications.Available()
+	for _, channel := range req.Channels {
+		if !slices.Contains(available, channel) {
+			return nil, status.Errorf(codes.InvalidArgument, "channel %q is not available, use one of %v", channel, available)
+		}
+		if !slices.Contains(prefs.Channels, channel) {
+			prefs.Channels = append(prefs.Channels, channel)
+		}
+	}
+	if slices.Contains(prefs.Channels, entity.ChannelEmail) && prefs.Email == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "the email channel needs an email address")
+	}
+	for _, kind := range req.Muted {
+		if !slices.Contains(notify.Kinds, kind) {
+			return nil, status.Errorf(codes.InvalidArgument, "kind must be one of %v, got %q", notify.Kinds, kind)
+		}
+		if !slices.Contains(prefs.Muted, kind) {
+			prefs.Muted = append(prefs.Muted, kind)
+		}
+	}
+
+	if err := s.store.SetNotificationPreferences(ctx, prefs); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to update preferences: %v", err)
+	}
+
+	defaults := len(prefs.Channels) == 0
+	if defaults {
+		prefs.Channels = s.config.Notifications.Channels
+	}
+	return &pb.NotificationPreferencesResponse{
+		Message:     "notification preferences updated",
+		Preferences: s.toPBNotificationPreferences(prefs, defaults),
+	}, nil
+}
+
+func (s *BookRentalServiceServer) ListNotifications(ctx context.Context, req *pb.ListNotificationsRequest) (*pb.ListNotificationsResponse, error) {
+	userID, ok := ctx.Value(userIDKey).(string)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "Invalid token claims")
+	}
+
+	pageSize := int(req.PageSize)
+	if pageSize < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "page_size must not be negative")
+	}
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	if req.Kind != "" && !slices.Contains(notify.Kinds, req.Kind) {
+		return nil, status.Errorf(codes.InvalidArgument, "kind must be one of %v, got %q", notify.Kinds, req.Kind)
+	}
+
+	notifications, err := s.store.ListNotifications(ctx, store.NotificationFilter{UserID: userID, Kind: req.Kind, Limit: pageSize})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list notifications: %v", err)
+	}
+
+	resp := &pb.ListNotificationsResponse{}
+	for _, notification := range notifications {
+		resp.Notifications = append(resp.Notifications, &pb.Notification{
+			Id:       notification.ID.Hex(),
+			Kind:     notification.Kind,
+			Channels: notification.Channels,
+			Subject:  notification.Subject,
+			SentAt:   notification.SentAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return resp, nil
+}
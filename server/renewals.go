@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gc2-yugo/entity"
+	"gc2-yugo/pb"
+	"gc2-yugo/store"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// renewedDueDate extends the due date by the loan period.
+func renewedDueDate(dueDate string, period time.Duration) (string, error) {
+	due, err := time.Parse("2006-01-02", dueDate)
+	if err != nil {
+		return "", err
+	}
+	return due.Add(period).Format("2006-01-02"), nil
+}
+
+func toPBRenewals(renewals []entity.LoanRenewal) []*pb.LoanRenewal {
+	var result []*pb.LoanRenewal
+	for _, renewal := range renewals {
+		result = append(result, &pb.LoanRenewal{
+			RenewedAt:       renewal.RenewedAt.UTC().Format(time.RFC3339),
+			RenewedBy:       renewal.RenewedBy,
+			PreviousDueDate: renewal.PreviousDueDate,
+			DueDate:         renewal.DueDate,
+		})
+	}
+	return result
+}
+
+func (s *BookRentalServiceServer) RenewLoan(ctx context.Context, req *pb.RenewLoanRequest) (*pb.RenewLoanResponse, error) {
+	callerID, ok := ctx.Value(userIDKey).(string)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "Invalid token claims")
+	}
+
+	if _, err := primitive.ObjectIDFromHex(req.BorrowId); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid borrow ID format")
+	}
+
+	loan, err := s.store.GetLoan(ctx, req.BorrowId)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "borrow record not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch borrow record: %v", err)
+	}
+
+	// The borrower renews their own loans, librarians renew any loan
+	if loan.UserID != callerID && !hasRole(callerRole(ctx), entity.RoleLibrarian) {
+		return nil, status.Errorf(codes.PermissionDenied, "the borrow record belongs to another user")
+	}
+	if loan.ReturnedAt != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "the book has already been returned")
+	}
+
+	// Renewing would skip the overdue fine, the book has to come back first
+	now := time.Now()
+	if loan.ReturnDate < now.Format("2006-01-02") {
+		return nil, status.Errorf(codes.FailedPrecondition, "the loan is overdue since %s, return the book instead", loan.ReturnDate)
+	}
+
+	// The borrower's circulation rules apply, also when a librarian renews
+	title, err := s.store.GetTitle(ctx, loan.BookID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch book: %v", err)
+	}
+	policy, err := s.loanPolicy(ctx, loan.UserID, title)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch user: %v", err)
+	}
+	if len(loan.Renewals) >= policy.MaxRenewals {
+		return nil, policyViolation(policy, checkMaxRenewals,
+			fmt.Sprintf("the loan has reached the maximum of %d renewals (rule %q)", policy.MaxRenewals, policy.Rule))
+	}
+
+	waiting, err := s.store.ListHolds(ctx, store.HoldFilter{TitleID: loan.BookID, Statuses: []string{entity.HoldWaiting}})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch holds: %v", err)
+	}
+	if len(waiting) > 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "another patron is waiting for this book, return it by %s", loan.ReturnDate)
+	}
+
+	dueDate, err := renewedDueDate(loan.ReturnDate, policy.Period)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "invalid due date %q: %v", loan.ReturnDate, err)
+	}
+
+	renewal := entity.LoanRenewal{
+		RenewedAt:       now,
+		RenewedBy:       callerID,
+		PreviousDueDate: loan.ReturnDate,
+		DueDate:         dueDate,
+	}
+	err = s.store.RenewLoan(ctx, loan.ID.Hex(), len(loan.Renewals), renewal)
+	if errors.Is(err, store.ErrConflict) {
+		return nil, status.Errorf(codes.Aborted, "the loan changed meanwhile, try again")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to renew loan: %v", err)
+	}
+
+	renewals := len(loan.Renewals) + 1
+	return &pb.RenewLoanResponse{
+		Message:      "Loan renewed successfully",
+		DueDate:      dueDate,
+		Renewals:     int32(renewals),
+		RenewalsLeft: int32(policy.MaxRenewals - renewals),
+	}, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gc2-yugo/config"
+)
+
+const roleUsage = "usage: server [flags] role <username> <member | librarian | admin>"
+
+// runRole implements the role subcommand, used to appoint the first admin
+// before anyone can call SetUserRole.
+func runRole(ctx context.Context, cfg config.StorageConfig, args []string) error {
+	if len(args) != 2 {
+		return errors.New(roleUsage)
+	}
+	username, role := args[0], args[1]
+	if _, ok := roleRanks[role]; !ok {
+		return errors.New(roleUsage)
+	}
+
+	bookStore, closeStore, err := openStore(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore(ctx)
+
+	user, err := bookStore.GetUserByUsername(ctx, username)
+	if err != nil {
+		return fmt.Errorf("failed to find user %q: %w", username, err)
+	}
+	if err := bookStore.UpdateUserRole(ctx, user.ID.Hex(), role); err != nil {
+		return err
+	}
+
+	fmt.Printf("user %s is now %s\n", username, role)
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"gc2-yugo/auth"
+	"gc2-yugo/entity"
+	"gc2-yugo/pb"
+	"gc2-yugo/store"
+	"log"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// issueRefreshToken stores a new refresh token of the family and returns it.
+func (s *BookRentalServiceServer) issueRefreshToken(ctx context.Context, userID, familyID string) (string, error) {
+	token, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	err = s.store.CreateRefreshToken(ctx, &entity.RefreshToken{
+		TokenHash: hash,
+		UserID:    userID,
+		FamilyID:  familyID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.config.Auth.RefreshTokenTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new refresh
+// token. Each refresh token works once; presenting it again means it was stolen,
+// so the whole family is revoked and the user has to log in again.
+func (s *BookRentalServiceServer) RefreshToken(ctx context.Context, req *pb.RefreshTokenRequest) (*pb.RefreshTokenResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "refresh_token is required")
+	}
+
+	current, err := s.store.GetRefreshToken(ctx, auth.HashRefreshToken(req.RefreshToken))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid refresh token")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch refresh token: %v", err)
+	}
+
+	now := time.Now().UTC()
+	if !now.Before(current.ExpiresAt) {
+		return nil, status.Errorf(codes.Unauthenticated, "refresh token has expired")
+	}
+
+	// Revoking is the compare-and-set that lets only one exchange win
+	if current.RevokedAt == nil {
+		err = s.store.RevokeRefreshToken(ctx, current.ID.Hex(), now)
+	}
+	if current.RevokedAt != nil || errors.Is(err, store.ErrConflict) {
+		log.Printf("Refresh token reused for user %s, revoking its family", current.UserID)
+		if err := s.store.RevokeRefreshTokenFamily(ctx, current.FamilyID, now); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to revoke refresh tokens: %v", err)
+		}
+		return nil, status.Errorf(codes.Unauthenticated, "refresh token has already been used, log in again")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to revoke refresh token: %v", err)
+	}
+
+	// Read the user again so role changes apply from the next refresh
+	user, err := s.store.GetUserByID(ctx, current.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.Unauthenticated, "user no longer exists")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch user: %v", err)
+	}
+
+	token, err := s.generateJWT(user.ID.Hex(), user.Role)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to generate token: %v", err)
+	}
+
+	refreshToken, err := s.issueRefreshToken(ctx, user.ID.Hex(), current.FamilyID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to generate refresh token: %v", err)
+	}
+
+	return &pb.RefreshTokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.config.Auth.TokenTTL.Seconds()),
+	}, nil
+}
+
+// Logout revokes the access token of the call and, when given, the refresh token
+// family it came from.
+func (s *BookRentalServiceServer) Logout(ctx context.Context, req *pb.LogoutRequest) (*pb.LogoutResponse, error) {
+	// Extract user ID and token claims from the context
+	userID, ok := ctx.Value(userIDKey).(string)
+	claims, claimsOK := ctx.Value(claimsKey).(jwt.MapClaims)
+	if !ok || !claimsOK {
+		return nil, status.Errorf(codes.Unauthenticated, "Invalid token claims")
+	}
+
+	now := time.Now().UTC()
+
+	if req.RefreshToken != "" {
+		refreshToken, err := s.store.GetRefreshToken(ctx, auth.HashRefreshToken(req.RefreshToken))
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return nil, status.Errorf(codes.Internal, "failed to fetch refresh token: %v", err)
+		}
+		if err == nil {
+			if refreshToken.UserID != userID {
+				return nil, status.Errorf(codes.PermissionDenied, "refresh token belongs to another user")
+			}
+			if err := s.store.RevokeRefreshTokenFamily(ctx, refreshToken.FamilyID, now); err != nil {
+				return nil, status.Errorf(codes.Internal, "failed to revoke refresh tokens: %v", err)
+			}
+		}
+	}
+
+	// The revocation only needs to outlive the token
+	jti, _ := claims["jti"].(string)
+	expiresAt := now.Add(s.config.Auth.TokenTTL)
+	if exp, ok := claims["exp"].(float64); ok {
+		expiresAt = time.Unix(int64(exp), 0)
+	}
+	if err := s.store.RevokeAccessToken(ctx, jti, expiresAt); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to revoke token: %v", err)
+	}
+
+	return &pb.LogoutResponse{
+		Message: "logged out",
+	}, nil
+}
+
+// pruneSessions deletes expired refresh tokens and revocations every interval until ctx is done.
+func (s *BookRentalServiceServer) pruneSessions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.store.DeleteExpiredSessions(ctx, now.UTC()); err != nil {
+				log.Printf("failed to delete expired sessions: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"gc2-yugo/config"
+	"gc2-yugo/store"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// openStore connects to the configured storage backend.
+// The returned function releases the connection on shutdown.
+func openStore(ctx context.Context, cfg config.StorageConfig) (store.Store, func(context.Context) error, error) {
+	switch cfg.Backend {
+	case "mongo":
+		client, err := config.ConnectMongo(ctx, cfg.Mongo)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+		}
+
+		if err := store.RequireMongoReplicaSet(ctx, client); err != nil {
+			client.Disconnect(ctx)
+			return nil, nil, err
+		}
+		db := client.Database(cfg.Mongo.Database)
+		if err := checkMongoSchemaVersion(ctx, db); err != nil {
+			client.Disconnect(ctx)
+			return nil, nil, err
+		}
+		return store.NewMongoStore(db), client.Disconnect, nil
+
+	case store.DriverPostgres, store.DriverSQLite:
+		db, err := config.ConnectionDatabaseSQL(ctx, cfg.Backend, cfg.SQL)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := checkSchemaVersion(ctx, db); err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+
+		closeDB := func(context.Context) error {
+			return db.Close()
+		}
+		return store.NewSQLStore(db), closeDB, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unknown storage backend %q, expected mongo, postgres or sqlite", cfg.Backend)
+	}
+}
+
+// checkSchemaVersion refuses to start on a database that has pending migrations.
+func checkSchemaVersion(ctx context.Context, db *sql.DB) error {
+	current, err := store.SchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	latest, err := store.LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if current != latest {
+		return fmt.Errorf("database schema is at version %d, expected %d: run `server migrate up`", current, latest)
+	}
+	return nil
+}
+
+// checkMongoSchemaVersion refuses to start on a MongoDB database that has pending
+// migrations, such as the indexes keeping usernames unique.
+func checkMongoSchemaVersion(ctx context.Context, db *mongo.Database) error {
+	current, err := store.MongoSchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	if latest := store.LatestMongoSchemaVersion(); current != latest {
+		return fmt.Errorf("database schema is at version %d, expected %d: run `server migrate up`", current, latest)
+	}
+	return nil
+}
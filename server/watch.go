@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"gc2-yugo/entity"
+	"gc2-yugo/pb"
+	"gc2-yugo/store"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// WatchBooks event types besides the changes
+const (
+	bookEventSnapshot = "snapshot"
+	bookEventSynced   = "synced"
+)
+
+// watchEventTypes are the WatchBooks event types of the outbox events. Events of
+// other types are not sent.
+var watchEventTypes = map[string]string{
+	entity.EventBookAdded:         "added",
+	entity.EventBookRemoved:       "removed",
+	entity.EventBookBorrowed:      "borrowed",
+	entity.EventBookReturned:      "returned",
+	entity.EventBookStatusChanged: "status_changed",
+}
+
+// encodeWatchToken returns the resume token of the position after the outbox event
+// with the sequence number.
+func encodeWatchToken(seq int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(seq, 10)))
+}
+
+func decodeWatchToken(token string) (int64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, err
+	}
+	seq, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if seq < 0 {
+		return 0, errors.New("negative position")
+	}
+	return seq, nil
+}
+
+// bookWatch is the state of a WatchBooks stream. The stream follows the outbox of
+// the store, so it sees the changes of every replica.
+type bookWatch struct {
+	s      *BookRentalServiceServer
+	stream pb.BookRentalService_WatchBooksServer
+	ids    map[string]bool // nil to watch every book
+	status string
+	// visible tells whether the last event sent about a book matched the status
+	// filter. The client of a resumed stream may still show any book, so books
+	// missing from it count as visible then.
+	visible map[string]bool
+	resumed bool
+	after   int64 // sequence number of the last outbox event handled
+}
+
+// WatchBooks sends the matching books, then their changes until the client goes away.
+// The changes are read from the outbox as often as the relay reads it.
+func (s *BookRentalServiceServer) WatchBooks(req *pb.WatchBooksRequest, stream pb.BookRentalService_WatchBooksServer) error {
+	ctx := stream.Context()
+	if req.Status != "" && req.Status != bookStatusAvailable && req.Status != bookStatusUnavailable {
+		return status.Errorf(codes.InvalidArgument, "invalid status %q, expected Available or Unavailable", req.Status)
+	}
+
+	w := &bookWatch{s: s, stream: stream, status: req.Status, visible: map[string]bool{}}
+	if len(req.BookIds) > 0 {
+		w.ids = map[string]bool{}
+		for _, id := range req.BookIds {
+			if _, err := primitive.ObjectIDFromHex(id); err != nil {
+				return status.Errorf(codes.InvalidArgument, "invalid book ID format: %q", id)
+			}
+			w.ids[id] = true
+		}
+	}
+
+	var err error
+	if req.ResumeToken != "" {
+		err = w.resume(ctx, req.ResumeToken)
+	} else {
+		err = w.snapshot(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(s.config.Outbox.Interval)
+	defer ticker.Stop()
+	synced := false
+	for {
+		caughtUp, err := w.sendChanges(ctx)
+		if err != nil {
+			return err
+		}
+		if !caughtUp {
+			continue
+		}
+
+		// The client has every change up to now
+		if !synced {
+			err := stream.Send(&pb.BookEvent{Type: bookEventSynced, ResumeToken: encodeWatchToken(w.after)})
+			if err != nil {
+				return err
+			}
+			synced = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// snapshot sends the matching books as they are now. The changes made while they
+// are sent are sent again afterwards.
+func (w *bookWatch) snapshot(ctx context.Context) error {
+	seq, err := w.s.store.LastOutboxSeq(ctx)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to read the position of the changes: %v", err)
+	}
+	w.after = seq
+
+	filter := store.TitleFilter{Limit: maxPageSize}
+	if w.ids != nil {
+		filter.IDs = []string{}
+		for id := range w.ids {
+			filter.IDs = append(filter.IDs, id)
+		}
+	}
+	for {
+		titles, err := w.s.store.ListTitles(ctx, filter)
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to fetch books: %v", err)
+		}
+		books, err := w.books(ctx, titles)
+		if err != nil {
+			return err
+		}
+
+		for _, title := range titles {
+			book := books[title.ID.Hex()]
+			if !w.show(book.Id, book) {
+				continue
+			}
+			if err := w.stream.Send(&pb.BookEvent{Type: bookEventSnapshot, BookId: book.Id, Book: book}); err != nil {
+				return err
+			}
+		}
+
+		if len(titles) < maxPageSize {
+			return nil
+		}
+		last := titles[len(titles)-1]
+		filter.AfterTitle = last.Title
+		filter.AfterID = last.ID.Hex()
+	}
+}
+
+// resume continues after the position of the token, as long as the changes since
+// are still kept.
+func (w *bookWatch) resume(ctx context.Context, token string) error {
+	after, err := decodeWatchToken(token)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid resume_token")
+	}
+	last, err := w.s.store.LastOutboxSeq(ctx)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to read the position of the changes: %v", err)
+	}
+	if after > last {
+		return status.Errorf(codes.InvalidArgument, "invalid resume_token")
+	}
+
+	if after < last {
+		next, err := w.s.store.ListOutboxEvents(ctx, store.OutboxFilter{AfterSeq: after, Limit: 1})
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to fetch changes: %v", err)
+		}
+		if len(next) == 0 || next[0].Seq != after+1 {
+			return status.Errorf(codes.OutOfRange, "the changes since the resume_token were pruned, watch again without a token")
+		}
+	}
+
+	w.after = after
+	w.resumed = true
+	return nil
+}
+
+// sendChanges sends the changes of a batch of outbox events and reports whether
+// it was the last one.
+func (w *bookWatch) sendChanges(ctx context.Context) (bool, error) {
+	limit := w.s.config.Outbox.BatchSize
+	events, err := w.s.store.ListOutboxEvents(ctx, store.OutboxFilter{AfterSeq: w.after, Limit: limit})
+	if err != nil {
+		return false, status.Errorf(codes.Internal, "failed to fetch changes: %v", err)
+	}
+
+	// Books are sent as they are now, fetched once for the batch
+	ids := []string{}
+	for _, event := range events {
+		if watchEventTypes[event.Type] != "" && w.watches(event.BookID) {
+			ids = append(ids, event.BookID)
+		}
+	}
+	var titles []entity.Title
+	if len(ids) > 0 {
+		titles, err = w.s.store.ListTitles(ctx, store.TitleFilter{IDs: ids})
+		if err != nil {
+			return false, status.Errorf(codes.Internal, "failed to fetch books: %v", err)
+		}
+	}
+	books, err := w.books(ctx, titles)
+	if err != nil {
+		return false, err
+	}
+
+	for _, event := range events {
+		kind := watchEventTypes[event.Type]
+		if kind != "" && w.watches(event.BookID) && w.show(event.BookID, books[event.BookID]) {
+			err := w.stream.Send(&pb.BookEvent{
+				Type:        kind,
+				BookId:      event.BookID,
+				Book:        books[event.BookID],
+				ResumeToken: encodeWatchToken(event.Seq),
+				OccurredAt:  event.CreatedAt.UTC().Format(time.RFC3339),
+			})
+			if err != nil {
+				return false, err
+			}
+		}
+		w.after = event.Seq
+	}
+	return len(events) < limit, nil
+}
+
+// books returns the titles with their copy counts, by ID.
+func (w *bookWatch) books(ctx context.Context, titles []entity.Title) (map[string]*pb.Book, error) {
+	ids := []string{}
+	for _, title := range titles {
+		ids = append(ids, title.ID.Hex())
+	}
+	counts, err := w.s.store.CountCopies(ctx, ids)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to count copies: %v", err)
+	}
+
+	books := map[string]*pb.Book{}
+	for _, title := range titles {
+		books[title.ID.Hex()] = toPBBook(title, counts[title.ID.Hex()])
+	}
+	return books, nil
+}
+
+func (w *bookWatch) watches(bookID string) bool {
+	return w.ids == nil || w.ids[bookID]
+}
+
+// show reports whether to send an event about the book, nil when it was removed.
+// A book leaving the status filter is sent one last time, so the client drops it.
+func (w *bookWatch) show(bookID string, book *pb.Book) bool {
+	if w.status == "" {
+		return true
+	}
+	matches := book != nil && book.Status == w.status
+	wasVisible, known := w.visible[bookID]
+	if !known {
+		wasVisible = w.resumed
+	}
+	w.visible[bookID] = matches
+	return matches || wasVisible
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"gc2-yugo/entity"
+	"gc2-yugo/pb"
+	"gc2-yugo/store"
+	"gc2-yugo/webhook"
+	"net/url"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var deliveryStatuses = []string{entity.DeliveryPending, entity.DeliveryDelivered, entity.DeliveryDead}
+
+// CreateWebhookSubscription subscribes the URL to the event types. The response has
+// the secret the posts are signed with, it cannot be read again.
+func (s *BookRentalServiceServer) CreateWebhookSubscription(ctx context.Context, req *pb.CreateWebhookSubscriptionRequest) (*pb.WebhookSubscriptionResponse, error) {
+	userID, _ := ctx.Value(userIDKey).(string)
+
+	target, err := url.Parse(req.Url)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "url must be an absolute http or https URL, got %q", req.Url)
+	}
+	if len(req.EventTypes) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "event_types must not be empty")
+	}
+	var types []string
+	for _, kind := range req.EventTypes {
+		if !slices.Contains(webhook.EventTypes, kind) {
+			return nil, status.Errorf(codes.InvalidArgument, "event type must be one of %v, got %q", webhook.EventTypes, kind)
+		}
+		if !slices.Contains(types, kind) {
+			types = append(types, kind)
+		}
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to generate the secret: %v", err)
+	}
+	sub := entity.WebhookSubscription{
+		URL:        target.String(),
+		EventTypes: types,
+		Secret:     secret,
+		CreatedBy:  userID,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := s.store.CreateWebhookSubscription(ctx, &sub); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to create webhook subscription: %v", err)
+	}
+
+	resp := toPBWebhookSubscription(sub)
+	resp.Secret = sub.Secret
+	return &pb.WebhookSubscriptionResponse{Message: "webhook subscription created", Subscription: resp}, nil
+}
+
+func (s *BookRentalServiceServer) ListWebhookSubscriptions(ctx context.Context, req *pb.ListWebhookSubscriptionsRequest) (*pb.ListWebhookSubscriptionsResponse, error) {
+	subs, err := s.store.ListWebhookSubscriptions(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list webhook subscriptions: %v", err)
+	}
+
+	resp := &pb.ListWebhookSubscriptionsResponse{}
+	for _, sub := range subs {
+		resp.Subscriptions = append(resp.Subscriptions, toPBWebhookSubscription(sub))
+	}
+	return resp, nil
+}
+
+// DeleteWebhookSubscription removes the subscription with its delivery log, the
+// pending deliveries are not sent.
+func (s *BookRentalServiceServer) DeleteWebhookSubscription(ctx context.Context, req *pb.DeleteWebhookSubscriptionRequest) (*pb.WebhookSubscriptionResponse, error) {
+	sub, err := s.webhookSubscription(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.store.DeleteWebhookSubscription(ctx, req.Id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "webhook subscription not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to delete webhook subscription: %v", err)
+	}
+	return &pb.WebhookSubscriptionResponse{Message: "webhook subscription deleted", Subscription: toPBWebhookSubscription(*sub)}, nil
+}
+
+func (s *BookRentalServiceServer) ListWebhookDeliveries(ctx context.Context, req *pb.ListWebhookDeliveriesRequest) (*pb.ListWebhookDeliveriesResponse, error) {
+	pageSize := int(req.PageSize)
+	if pageSize < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "page_size must not be negative")
+	}
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	if req.Status != "" && !slices.Contains(deliveryStatuses, req.Status) {
+		return nil, status.Errorf(codes.InvalidArgument, "status must be one of %v, got %q", deliveryStatuses, req.Status)
+	}
+	if _, err := s.webhookSubscription(ctx, req.SubscriptionId); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := s.store.ListWebhookDeliveries(ctx, store.WebhookDeliveryFilter{
+		SubscriptionID: req.SubscriptionId,
+		Status:         req.Status,
+		Limit:          pageSize,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list webhook deliveries: %v", err)
+	}
+
+	resp := &pb.ListWebhookDeliveriesResponse{}
+	for _, delivery := range deliveries {
+		resp.Deliveries = append(resp.Deliveries, toPBWebhookDelivery(delivery))
+	}
+	return resp, nil
+}
+
+// SendTestWebhook posts a test event to the subscription and waits for the outcome.
+// A receiver failing the test is not an error of the call, the delivery tells.
+func (s *BookRentalServiceServer) SendTestWebhook(ctx context.Context, req *pb.SendTestWebhookRequest) (*pb.SendTestWebhookResponse, error) {
+	sub, err := s.webhookSubscription(ctx, req.SubscriptionId)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err := s.webhooks.SendTest(ctx, *sub)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "webhook subscription not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to send test event: %v", err)
+	}
+
+	message := "test event delivered"
+	if delivery.Status != entity.DeliveryDelivered {
+		message = "test event failed: " + delivery.LastError
+	}
+	return &pb.SendTestWebhookResponse{Message: message, Delivery: toPBWebhookDelivery(delivery)}, nil
+}
+
+// webhookSubscription fetches the subscription, mapping the errors to gRPC statuses.
+func (s *BookRentalServiceServer) webhookSubscription(ctx context.Context, id string) (*entity.WebhookSubscription, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid webhook subscription ID format")
+	}
+	sub, err := s.store.GetWebhookSubscription(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "webhook subscription not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to fetch webhook subscription: %v", err)
+	}
+	return sub, nil
+}
+
+// toPBWebhookSubscription returns the subscription without its secret.
+func toPBWebhookSubscription(sub entity.WebhookSubscription) *pb.WebhookSubscription {
+	return &pb.WebhookSubscription{
+		Id:         sub.ID.Hex(),
+		Url:        sub.URL,
+		EventTypes: sub.EventTypes,
+		CreatedBy:  sub.CreatedBy,
+		CreatedAt:  sub.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func toPBWebhookDelivery(delivery entity.WebhookDelivery) *pb.WebhookDelivery {
+	resp := &pb.WebhookDelivery{
+		Id:             delivery.ID.Hex(),
+		SubscriptionId: delivery.SubscriptionID,
+		EventId:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Status:         delivery.Status,
+		Attempts:       int32(delivery.Attempts),
+		LastError:      delivery.LastError,
+		ResponseCode:   int32(delivery.ResponseCode),
+		CreatedAt:      delivery.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if delivery.Status == entity.DeliveryPending {
+		resp.NextAttemptAt = delivery.NextAttemptAt.UTC().Format(time.RFC3339)
+	}
+	if delivery.DeliveredAt != nil {
+		resp.DeliveredAt = delivery.DeliveredAt.UTC().Format(time.RFC3339)
+	}
+	return resp
+}
@@ -0,0 +1,409 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore keeps everything in memory. It is safe for concurrent use
+// and is meant for tests and local development.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	users         map[string]entity.User
+	titles        map[string]entity.Title
+	copies        map[string]entity.Copy
+	loans         map[string]entity.BorrowedBooks
+	holds         map[string]entity.Hold
+	refreshTokens map[string]entity.RefreshToken
+	revokedTokens map[string]time.Time // expiry by jti
+	throttles     map[string]entity.LoginThrottle
+	auditEvents   []entity.AuditEvent
+	fees          []entity.FeeTransaction // in insertion order
+	jobRuns       map[string]entity.JobRun
+	jobLeases     map[string]entity.JobLease
+	jobStates     map[string]entity.JobState
+	notifications map[string]entity.Notification
+	notifyPrefs   map[string]entity.NotificationPreferences // by user id
+	outbox        []entity.OutboxEvent                      // in sequence order
+	outboxSeq     int64                                     // of the last event added
+	webhooks      map[string]entity.WebhookSubscription
+	deliveries    map[string]entity.WebhookDelivery
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:         map[string]entity.User{},
+		titles:        map[string]entity.Title{},
+		copies:        map[string]entity.Copy{},
+		loans:         map[string]entity.BorrowedBooks{},
+		holds:         map[string]entity.Hold{},
+		refreshTokens: map[string]entity.RefreshToken{},
+		revokedTokens: map[string]time.Time{},
+		throttles:     map[string]entity.LoginThrottle{},
+		jobRuns:       map[string]entity.JobRun{},
+		jobLeases:     map[string]entity.JobLease{},
+		jobStates:     map[string]entity.JobState{},
+		notifications: map[string]entity.Notification{},
+		notifyPrefs:   map[string]entity.NotificationPreferences{},
+		webhooks:      map[string]entity.WebhookSubscription{},
+		deliveries:    map[string]entity.WebhookDelivery{},
+	}
+}
+
+func (s *MemoryStore) CreateUser(ctx context.Context, user *entity.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.users {
+		if existing.Username == user.Username {
+			return ErrAlreadyExists
+		}
+	}
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	s.users[user.ID.Hex()] = *user
+	return nil
+}
+
+func (s *MemoryStore) GetUserByID(ctx context.Context, id string) (*entity.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *MemoryStore) GetUserByUsername(ctx context.Context, username string) (*entity.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) UpdateUserPassword(ctx context.Context, id, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Password = password
+	s.users[id] = user
+	return nil
+}
+
+func (s *MemoryStore) UpdateUserRole(ctx context.Context, id, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Role = role
+	s.users[id] = user
+	return nil
+}
+
+func (s *MemoryStore) UpdateUserCategory(ctx context.Context, id, category string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Category = category
+	s.users[id] = user
+	return nil
+}
+
+func (s *MemoryStore) CreateTitle(ctx context.Context, title *entity.Title, copies []entity.Copy, events ...entity.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if title.ID.IsZero() {
+		title.ID = primitive.NewObjectID()
+	}
+	if _, ok := s.titles[title.ID.Hex()]; ok {
+		return ErrAlreadyExists
+	}
+
+	// Check every copy before storing anything
+	barcodes := map[string]bool{}
+	for _, existing := range s.copies {
+		barcodes[existing.Barcode] = true
+	}
+	for i := range copies {
+		copies[i].TitleID = title.ID.Hex()
+		if copies[i].ID.IsZero() {
+			copies[i].ID = primitive.NewObjectID()
+		}
+		if _, ok := s.copies[copies[i].ID.Hex()]; ok || barcodes[copies[i].Barcode] {
+			return ErrAlreadyExists
+		}
+		barcodes[copies[i].Barcode] = true
+	}
+
+	s.titles[title.ID.Hex()] = *title
+	for _, item := range copies {
+		s.copies[item.ID.Hex()] = item
+	}
+	s.addOutboxEvents(events)
+	return nil
+}
+
+func (s *MemoryStore) GetTitle(ctx context.Context, id string) (*entity.Title, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	title, ok := s.titles[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &title, nil
+}
+
+func (s *MemoryStore) DeleteTitle(ctx context.Context, id string, events ...entity.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.titles[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.titles, id)
+	for copyID, item := range s.copies {
+		if item.TitleID == id {
+			delete(s.copies, copyID)
+		}
+	}
+	for holdID, hold := range s.holds {
+		if hold.TitleID == id {
+			delete(s.holds, holdID)
+		}
+	}
+	s.addOutboxEvents(events)
+	return nil
+}
+
+func (s *MemoryStore) ListTitles(ctx context.Context, filter TitleFilter) ([]entity.Title, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids map[string]bool
+	if filter.IDs != nil {
+		ids = map[string]bool{}
+		for _, id := range filter.IDs {
+			ids[id] = true
+		}
+	}
+
+	var withStatus map[string]bool
+	if filter.CopyStatus != "" {
+		withStatus = map[string]bool{}
+		for _, item := range s.copies {
+			if item.Status == filter.CopyStatus {
+				withStatus[item.TitleID] = true
+			}
+		}
+	}
+
+	var titles []entity.Title
+	for _, title := range s.titles {
+		if ids != nil && !ids[title.ID.Hex()] {
+			continue
+		}
+		if withStatus != nil && !withStatus[title.ID.Hex()] {
+			continue
+		}
+		if matchTitle(title, filter) {
+			titles = append(titles, title)
+		}
+	}
+
+	sort.Slice(titles, func(i, j int) bool {
+		if titles[i].Title != titles[j].Title {
+			return titles[i].Title < titles[j].Title
+		}
+		return titles[i].ID.Hex() < titles[j].ID.Hex()
+	})
+
+	if filter.Limit > 0 && len(titles) > filter.Limit {
+		titles = titles[:filter.Limit]
+	}
+	return titles, nil
+}
+
+func matchTitle(title entity.Title, filter TitleFilter) bool {
+	if filter.Author != "" && title.Author != filter.Author {
+		return false
+	}
+	if filter.TitlePrefix != "" && !strings.HasPrefix(strings.ToLower(title.Title), strings.ToLower(filter.TitlePrefix)) {
+		return false
+	}
+	if !filter.PublishedFrom.IsZero() && title.PublishedDate.Before(filter.PublishedFrom) {
+		return false
+	}
+	if !filter.PublishedTo.IsZero() && title.PublishedDate.After(filter.PublishedTo) {
+		return false
+	}
+	if filter.AfterID != "" {
+		if title.Title < filter.AfterTitle {
+			return false
+		}
+		if title.Title == filter.AfterTitle && title.ID.Hex() <= filter.AfterID {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *MemoryStore) CreateLoan(ctx context.Context, loan *entity.BorrowedBooks, events ...entity.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if loan.ID.IsZero() {
+		loan.ID = primitive.NewObjectID()
+	}
+	if _, ok := s.loans[loan.ID.Hex()]; ok {
+		return ErrAlreadyExists
+	}
+	s.loans[loan.ID.Hex()] = *loan
+	s.addOutboxEvents(events)
+	return nil
+}
+
+func (s *MemoryStore) BorrowCopy(ctx context.Context, loan *entity.BorrowedBooks, from, holdID string, loanVersion int, borrowedAt time.Time, events ...entity.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.copies[loan.CopyID]
+	if !ok || item.Status != from {
+		return ErrConflict
+	}
+	hold, ok := s.holds[holdID]
+	if holdID != "" && (!ok || hold.Status != entity.HoldReady || hold.UserID != loan.UserID || hold.CopyID != loan.CopyID) {
+		return ErrConflict
+	}
+	user, ok := s.users[loan.UserID]
+	if !ok || user.LoanVersion != loanVersion {
+		return ErrConflict
+	}
+	if loan.ID.IsZero() {
+		loan.ID = primitive.NewObjectID()
+	}
+	if _, ok := s.loans[loan.ID.Hex()]; ok {
+		return ErrAlreadyExists
+	}
+
+	user.LoanVersion++
+	s.users[loan.UserID] = user
+	item.Status = entity.CopyBorrowed
+	s.copies[loan.CopyID] = item
+	if holdID != "" {
+		hold.Status = entity.HoldFulfilled
+		hold.ClosedAt = &borrowedAt
+		s.holds[holdID] = hold
+	}
+	s.loans[loan.ID.Hex()] = *loan
+	s.addOutboxEvents(events)
+	return nil
+}
+
+func (s *MemoryStore) GetLoan(ctx context.Context, id string) (*entity.BorrowedBooks, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	loan, ok := s.loans[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &loan, nil
+}
+
+func (s *MemoryStore) ListLoans(ctx context.Context, filter LoanFilter) ([]entity.BorrowedBooks, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var loans []entity.BorrowedBooks
+	for _, loan := range s.loans {
+		if filter.UserID != "" && loan.UserID != filter.UserID {
+			continue
+		}
+		if filter.BookID != "" && loan.BookID != filter.BookID {
+			continue
+		}
+		if filter.State == LoanOpen && loan.ReturnedAt != nil {
+			continue
+		}
+		if filter.State == LoanClosed && loan.ReturnedAt == nil {
+			continue
+		}
+		if filter.DueBefore != "" && loan.ReturnDate >= filter.DueBefore {
+			continue
+		}
+		loans = append(loans, loan)
+	}
+
+	sort.Slice(loans, func(i, j int) bool {
+		if loans[i].BorrowedDate != loans[j].BorrowedDate {
+			return loans[i].BorrowedDate > loans[j].BorrowedDate
+		}
+		return loans[i].ID.Hex() > loans[j].ID.Hex()
+	})
+	return loans, nil
+}
+
+func (s *MemoryStore) CloseLoan(ctx context.Context, id string, returnedAt time.Time, events ...entity.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loan, ok := s.loans[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if loan.ReturnedAt != nil {
+		return ErrConflict
+	}
+	loan.ReturnedAt = &returnedAt
+	s.loans[id] = loan
+	s.addOutboxEvents(events)
+	return nil
+}
+
+func (s *MemoryStore) RenewLoan(ctx context.Context, id string, renewals int, renewal entity.LoanRenewal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loan, ok := s.loans[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if loan.ReturnedAt != nil || len(loan.Renewals) != renewals {
+		return ErrConflict
+	}
+
+	// Copy the history, the previous slice may be shared with loans handed out before
+	loan.Renewals = append(append([]entity.LoanRenewal{}, loan.Renewals...), renewal)
+	loan.ReturnDate = renewal.DueDate
+	s.loans[id] = loan
+	return nil
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"sort"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *MemoryStore) CreateCopy(ctx context.Context, item *entity.Copy, events ...entity.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.titles[item.TitleID]; !ok {
+		return ErrNotFound
+	}
+	if item.ID.IsZero() {
+		item.ID = primitive.NewObjectID()
+	}
+	if _, ok := s.copies[item.ID.Hex()]; ok {
+		return ErrAlreadyExists
+	}
+	for _, existing := range s.copies {
+		if existing.Barcode == item.Barcode {
+			return ErrAlreadyExists
+		}
+	}
+	s.copies[item.ID.Hex()] = *item
+	s.addOutboxEvents(events)
+	return nil
+}
+
+func (s *MemoryStore) GetCopy(ctx context.Context, id string) (*entity.Copy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, ok := s.copies[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &item, nil
+}
+
+func (s *MemoryStore) GetCopyByBarcode(ctx context.Context, barcode string) (*entity.Copy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, item := range s.copies {
+		if item.Barcode == barcode {
+			return &item, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) ListCopies(ctx context.Context, filter CopyFilter) ([]entity.Copy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var copies []entity.Copy
+	for _, item := range s.copies {
+		if filter.TitleID != "" && item.TitleID != filter.TitleID {
+			continue
+		}
+		if filter.Status != "" && item.Status != filter.Status {
+			continue
+		}
+		copies = append(copies, item)
+	}
+
+	sort.Slice(copies, func(i, j int) bool { return copies[i].Barcode < copies[j].Barcode })
+	return copies, nil
+}
+
+func (s *MemoryStore) CountCopies(ctx context.Context, titleIDs []string) (map[string]CopyCounts, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := map[string]bool{}
+	for _, id := range titleIDs {
+		wanted[id] = true
+	}
+
+	counts := map[string]CopyCounts{}
+	for _, item := range s.copies {
+		if !wanted[item.TitleID] {
+			continue
+		}
+		count := counts[item.TitleID]
+		count.Total++
+		if item.Status == entity.CopyAvailable {
+			count.Available++
+		}
+		counts[item.TitleID] = count
+	}
+	return counts, nil
+}
+
+func (s *MemoryStore) UpdateCopyStatus(ctx context.Context, id, from, to string, events ...entity.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.copies[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if from != "" && item.Status != from {
+		return ErrConflict
+	}
+	item.Status = to
+	s.copies[id] = item
+	s.addOutboxEvents(events)
+	return nil
+}
+
+func (s *MemoryStore) UpdateCopyDetails(ctx context.Context, id, condition, location string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.copies[id]
+	if !ok {
+		return ErrNotFound
+	}
+	item.Condition = condition
+	item.Location = location
+	s.copies[id] = item
+	return nil
+}
+
+func (s *MemoryStore) DeleteCopy(ctx context.Context, id string, events ...entity.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.copies[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.copies, id)
+	s.addOutboxEvents(events)
+	return nil
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *MemoryStore) CreateFeeTransaction(ctx context.Context, entry *entity.FeeTransaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry.IdempotencyKey != "" {
+		for _, existing := range s.fees {
+			if existing.IdempotencyKey == entry.IdempotencyKey {
+				return ErrAlreadyExists
+			}
+		}
+	}
+
+	if entry.ID.IsZero() {
+		entry.ID = primitive.NewObjectID()
+	}
+	s.fees = append(s.fees, *entry)
+	return nil
+}
+
+func (s *MemoryStore) GetFeeTransaction(ctx context.Context, id string) (*entity.FeeTransaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, entry := range s.fees {
+		if entry.ID.Hex() == id {
+			return &entry, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) ListFeeTransactions(ctx context.Context, filter FeeFilter) ([]entity.FeeTransaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []entity.FeeTransaction
+	for _, entry := range s.fees {
+		if filter.UserID != "" && entry.UserID != filter.UserID {
+			continue
+		}
+		if filter.LoanID != "" && entry.LoanID != filter.LoanID {
+			continue
+		}
+		if filter.ChargeID != "" && entry.ChargeID != filter.ChargeID {
+			continue
+		}
+		if filter.Kind != "" && entry.Kind != filter.Kind {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (s *MemoryStore) FeeBalance(ctx context.Context, userID string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var balance int64
+	for _, entry := range s.fees {
+		if entry.UserID == userID {
+			balance += entry.Amount
+		}
+	}
+	return balance, nil
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func activeHold(hold entity.Hold) bool {
+	return hold.Status == entity.HoldWaiting || hold.Status == entity.HoldReady
+}
+
+func (s *MemoryStore) CreateHold(ctx context.Context, hold *entity.Hold) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.holds {
+		if existing.TitleID == hold.TitleID && existing.UserID == hold.UserID && activeHold(existing) {
+			return ErrAlreadyExists
+		}
+	}
+
+	if hold.ID.IsZero() {
+		hold.ID = primitive.NewObjectID()
+	}
+	s.holds[hold.ID.Hex()] = *hold
+	return nil
+}
+
+func (s *MemoryStore) GetHold(ctx context.Context, id string) (*entity.Hold, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hold, ok := s.holds[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &hold, nil
+}
+
+func (s *MemoryStore) ListHolds(ctx context.Context, filter HoldFilter) ([]entity.Hold, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	statuses := map[string]bool{}
+	for _, status := range filter.Statuses {
+		statuses[status] = true
+	}
+
+	var holds []entity.Hold
+	for _, hold := range s.holds {
+		if filter.TitleID != "" && hold.TitleID != filter.TitleID {
+			continue
+		}
+		if filter.UserID != "" && hold.UserID != filter.UserID {
+			continue
+		}
+		if filter.CopyID != "" && hold.CopyID != filter.CopyID {
+			continue
+		}
+		if len(statuses) > 0 && !statuses[hold.Status] {
+			continue
+		}
+		if !filter.PickupBefore.IsZero() && (hold.PickupBy == nil || !hold.PickupBy.Before(filter.PickupBefore)) {
+			continue
+		}
+		holds = append(holds, hold)
+	}
+
+	sort.Slice(holds, func(i, j int) bool {
+		if !holds[i].CreatedAt.Equal(holds[j].CreatedAt) {
+			return holds[i].CreatedAt.Before(holds[j].CreatedAt)
+		}
+		return holds[i].ID.Hex() < holds[j].ID.Hex()
+	})
+	return holds, nil
+}
+
+func (s *MemoryStore) ReadyHold(ctx context.Context, id, copyID string, readyAt, pickupBy time.Time, events ...entity.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hold, ok := s.holds[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if hold.Status != entity.HoldWaiting {
+		return ErrConflict
+	}
+
+	hold.Status = entity.HoldReady
+	hold.CopyID = copyID
+	hold.ReadyAt = &readyAt
+	hold.PickupBy = &pickupBy
+	s.holds[id] = hold
+	s.addOutboxEvents(events)
+	return nil
+}
+
+func (s *MemoryStore) CloseHold(ctx context.Context, id, from, to string, closedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hold, ok := s.holds[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if hold.Status != from {
+		return ErrConflict
+	}
+
+	hold.Status = to
+	hold.ClosedAt = &closedAt
+	s.holds[id] = hold
+	return nil
+}
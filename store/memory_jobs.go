@@ -0,0 +1,152 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *MemoryStore) CreateJobRun(ctx context.Context, run *entity.JobRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.jobRuns {
+		if existing.Job == run.Job && existing.ScheduledAt.Equal(run.ScheduledAt) {
+			return ErrAlreadyExists
+		}
+	}
+
+	if run.ID.IsZero() {
+		run.ID = primitive.NewObjectID()
+	}
+	s.jobRuns[run.ID.Hex()] = *run
+	return nil
+}
+
+func (s *MemoryStore) FinishJobRun(ctx context.Context, run *entity.JobRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.jobRuns[run.ID.Hex()]
+	if !ok {
+		return ErrNotFound
+	}
+	if existing.Status != entity.JobRunning {
+		return ErrConflict
+	}
+
+	existing.Status = run.Status
+	existing.Error = run.Error
+	existing.Result = run.Result
+	existing.FinishedAt = run.FinishedAt
+	s.jobRuns[run.ID.Hex()] = existing
+	return nil
+}
+
+func (s *MemoryStore) GetJobRun(ctx context.Context, id string) (*entity.JobRun, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	run, ok := s.jobRuns[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &run, nil
+}
+
+func (s *MemoryStore) ListJobRuns(ctx context.Context, filter JobRunFilter) ([]entity.JobRun, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var runs []entity.JobRun
+	for _, run := range s.jobRuns {
+		if filter.Job != "" && run.Job != filter.Job {
+			continue
+		}
+		if filter.Status != "" && run.Status != filter.Status {
+			continue
+		}
+		runs = append(runs, run)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].ScheduledAt.Equal(runs[j].ScheduledAt) {
+			return runs[i].ScheduledAt.After(runs[j].ScheduledAt)
+		}
+		return runs[i].ID.Hex() > runs[j].ID.Hex()
+	})
+	if filter.Limit > 0 && len(runs) > filter.Limit {
+		runs = runs[:filter.Limit]
+	}
+	return runs, nil
+}
+
+func (s *MemoryStore) DeleteJobRuns(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, run := range s.jobRuns {
+		if run.FinishedAt != nil && run.FinishedAt.Before(before) {
+			delete(s.jobRuns, id)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) AcquireJobLease(ctx context.Context, job, holder string, now, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease, ok := s.jobLeases[job]
+	if ok && lease.Holder != holder && lease.ExpiresAt.After(now) {
+		return ErrConflict
+	}
+	s.jobLeases[job] = entity.JobLease{Job: job, Holder: holder, ExpiresAt: until}
+	return nil
+}
+
+func (s *MemoryStore) ReleaseJobLease(ctx context.Context, job, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease, ok := s.jobLeases[job]
+	if !ok || lease.Holder != holder {
+		return ErrConflict
+	}
+	delete(s.jobLeases, job)
+	return nil
+}
+
+func (s *MemoryStore) GetJobLease(ctx context.Context, job string) (*entity.JobLease, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lease, ok := s.jobLeases[job]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &lease, nil
+}
+
+func (s *MemoryStore) SetJobState(ctx context.Context, state entity.JobState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobStates[state.Job] = state
+	return nil
+}
+
+func (s *MemoryStore) GetJobState(ctx context.Context, job string) (*entity.JobState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state, ok := s.jobStates[job]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &state, nil
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *MemoryStore) CreateNotification(ctx context.Context, notification *entity.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.notifications {
+		if existing.UserID == notification.UserID && existing.Kind == notification.Kind && existing.Key == notification.Key {
+			return ErrAlreadyExists
+		}
+	}
+
+	if notification.ID.IsZero() {
+		notification.ID = primitive.NewObjectID()
+	}
+	stored := *notification
+	stored.Channels = slices.Clone(notification.Channels)
+	s.notifications[notification.ID.Hex()] = stored
+	return nil
+}
+
+func (s *MemoryStore) DeleteNotification(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.notifications[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.notifications, id)
+	return nil
+}
+
+func (s *MemoryStore) ListNotifications(ctx context.Context, filter NotificationFilter) ([]entity.Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var notifications []entity.Notification
+	for _, notification := range s.notifications {
+		if filter.UserID != "" && notification.UserID != filter.UserID {
+			continue
+		}
+		if filter.Kind != "" && notification.Kind != filter.Kind {
+			continue
+		}
+		notification.Channels = slices.Clone(notification.Channels)
+		notifications = append(notifications, notification)
+	}
+
+	sort.Slice(notifications, func(i, j int) bool {
+		if !notifications[i].SentAt.Equal(notifications[j].SentAt) {
+			return notifications[i].SentAt.After(notifications[j].SentAt)
+		}
+		return notifications[i].ID.Hex() > notifications[j].ID.Hex()
+	})
+	if filter.Limit > 0 && len(notifications) > filter.Limit {
+		notifications = notifications[:filter.Limit]
+	}
+	return notifications, nil
+}
+
+func (s *MemoryStore) SetNotificationPreferences(ctx context.Context, prefs entity.NotificationPreferences) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefs.Channels = slices.Clone(prefs.Channels)
+	prefs.Muted = slices.Clone(prefs.Muted)
+	s.notifyPrefs[prefs.UserID] = prefs
+	return nil
+}
+
+func (s *MemoryStore) GetNotificationPreferences(ctx context.Context, userID string) (*entity.NotificationPreferences, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	prefs, ok := s.notifyPrefs[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	prefs.Channels = slices.Clone(prefs.Channels)
+	prefs.Muted = slices.Clone(prefs.Muted)
+	return &prefs, nil
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// addOutboxEvents appends the events to the outbox. The caller holds the write lock.
+func (s *MemoryStore) addOutboxEvents(events []entity.OutboxEvent) {
+	for _, event := range events {
+		if event.ID.IsZero() {
+			event.ID = primitive.NewObjectID()
+		}
+		s.outboxSeq++
+		event.Seq = s.outboxSeq
+		event.Payload = slices.Clone(event.Payload)
+		s.outbox = append(s.outbox, event)
+	}
+}
+
+func (s *MemoryStore) ListOutboxEvents(ctx context.Context, filter OutboxFilter) ([]entity.OutboxEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []entity.OutboxEvent
+	for _, event := range s.outbox {
+		if filter.Pending && event.DeliveredAt != nil {
+			continue
+		}
+		if event.Seq <= filter.AfterSeq {
+			continue
+		}
+		event.Payload = slices.Clone(event.Payload)
+		events = append(events, event)
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+func (s *MemoryStore) MarkOutboxEventDelivered(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.outboxIndex(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.outbox[i].DeliveredAt = &at
+	return nil
+}
+
+func (s *MemoryStore) RecordOutboxFailure(ctx context.Context, id, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.outboxIndex(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.outbox[i].Attempts++
+	s.outbox[i].LastError = message
+	return nil
+}
+
+func (s *MemoryStore) DeleteOutboxEvents(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.outbox = slices.DeleteFunc(s.outbox, func(event entity.OutboxEvent) bool {
+		return event.DeliveredAt != nil && event.DeliveredAt.Before(before)
+	})
+	return nil
+}
+
+func (s *MemoryStore) outboxIndex(id string) int {
+	return slices.IndexFunc(s.outbox, func(event entity.OutboxEvent) bool {
+		return event.ID.Hex() == id
+	})
+}
+
+func (s *MemoryStore) LastOutboxSeq(ctx context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.outboxSeq, nil
+}
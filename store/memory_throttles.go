@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *MemoryStore) GetLoginThrottle(ctx context.Context, key string) (*entity.LoginThrottle, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	throttle, ok := s.throttles[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &throttle, nil
+}
+
+func (s *MemoryStore) RecordLoginFailure(ctx context.Context, key string, at, resetBefore time.Time) (*entity.LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	throttle, ok := s.throttles[key]
+	lockedSince := throttle.LockedUntil != nil && !throttle.LockedUntil.Before(resetBefore)
+	if !ok || (throttle.LastFailure.Before(resetBefore) && !lockedSince) {
+		throttle = entity.LoginThrottle{Key: key}
+	}
+	throttle.Failures++
+	throttle.LastFailure = at
+	s.throttles[key] = throttle
+	return &throttle, nil
+}
+
+func (s *MemoryStore) LockLogin(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	throttle, ok := s.throttles[key]
+	if !ok {
+		return ErrNotFound
+	}
+	throttle.LockedUntil = &until
+	s.throttles[key] = throttle
+	return nil
+}
+
+func (s *MemoryStore) ClearLoginThrottle(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.throttles, key)
+	return nil
+}
+
+func (s *MemoryStore) CreateAuditEvent(ctx context.Context, event *entity.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event.ID.IsZero() {
+		event.ID = primitive.NewObjectID()
+	}
+	s.auditEvents = append(s.auditEvents, *event)
+	return nil
+}
+
+func (s *MemoryStore) ListAuditEvents(ctx context.Context, filter AuditFilter) ([]entity.AuditEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []entity.AuditEvent
+	for _, event := range s.auditEvents {
+		if filter.Username != "" && event.Username != filter.Username {
+			continue
+		}
+		if filter.Type != "" && event.Type != filter.Type {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].CreatedAt.After(events[j].CreatedAt)
+	})
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[:filter.Limit]
+	}
+	return events, nil
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *MemoryStore) CreateWebhookSubscription(ctx context.Context, sub *entity.WebhookSubscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sub.ID.IsZero() {
+		sub.ID = primitive.NewObjectID()
+	}
+	if _, ok := s.webhooks[sub.ID.Hex()]; ok {
+		return ErrAlreadyExists
+	}
+	stored := *sub
+	stored.EventTypes = slices.Clone(sub.EventTypes)
+	s.webhooks[sub.ID.Hex()] = stored
+	return nil
+}
+
+func (s *MemoryStore) GetWebhookSubscription(ctx context.Context, id string) (*entity.WebhookSubscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sub, ok := s.webhooks[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	sub.EventTypes = slices.Clone(sub.EventTypes)
+	return &sub, nil
+}
+
+func (s *MemoryStore) ListWebhookSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var subs []entity.WebhookSubscription
+	for _, sub := range s.webhooks {
+		sub.EventTypes = slices.Clone(sub.EventTypes)
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		if !subs[i].CreatedAt.Equal(subs[j].CreatedAt) {
+			return subs[i].CreatedAt.Before(subs[j].CreatedAt)
+		}
+		return subs[i].ID.Hex() < subs[j].ID.Hex()
+	})
+	return subs, nil
+}
+
+func (s *MemoryStore) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.webhooks, id)
+	for deliveryID, delivery := range s.deliveries {
+		if delivery.SubscriptionID == id {
+			delete(s.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) CreateWebhookDelivery(ctx context.Context, delivery *entity.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[delivery.SubscriptionID]; !ok {
+		return ErrNotFound
+	}
+	for _, existing := range s.deliveries {
+		if existing.SubscriptionID == delivery.SubscriptionID && existing.EventID == delivery.EventID {
+			return ErrAlreadyExists
+		}
+	}
+
+	if delivery.ID.IsZero() {
+		delivery.ID = primitive.NewObjectID()
+	}
+	stored := *delivery
+	stored.Payload = slices.Clone(delivery.Payload)
+	s.deliveries[delivery.ID.Hex()] = stored
+	return nil
+}
+
+func (s *MemoryStore) ListWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter) ([]entity.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var deliveries []entity.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if filter.SubscriptionID != "" && delivery.SubscriptionID != filter.SubscriptionID {
+			continue
+		}
+		if filter.Status != "" && delivery.Status != filter.Status {
+			continue
+		}
+		if !filter.DueBy.IsZero() && (delivery.Status != entity.DeliveryPending || delivery.NextAttemptAt.After(filter.DueBy)) {
+			continue
+		}
+		delivery.Payload = slices.Clone(delivery.Payload)
+		deliveries = append(deliveries, delivery)
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		a, b := deliveries[i], deliveries[j]
+		if !filter.DueBy.IsZero() {
+			if !a.NextAttemptAt.Equal(b.NextAttemptAt) {
+				return a.NextAttemptAt.Before(b.NextAttemptAt)
+			}
+			return a.ID.Hex() < b.ID.Hex()
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID.Hex() > b.ID.Hex()
+	})
+	if filter.Limit > 0 && len(deliveries) > filter.Limit {
+		deliveries = deliveries[:filter.Limit]
+	}
+	return deliveries, nil
+}
+
+func (s *MemoryStore) UpdateWebhookDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.deliveries[delivery.ID.Hex()]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Status = delivery.Status
+	stored.Attempts = delivery.Attempts
+	stored.LastError = delivery.LastError
+	stored.ResponseCode = delivery.ResponseCode
+	stored.NextAttemptAt = delivery.NextAttemptAt
+	stored.DeliveredAt = delivery.DeliveredAt
+	s.deliveries[delivery.ID.Hex()] = stored
+	return nil
+}
+
+func (s *MemoryStore) DeleteWebhookDeliveries(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, delivery := range s.deliveries {
+		if delivery.Status != entity.DeliveryPending && delivery.CreatedAt.Before(before) {
+			delete(s.deliveries, id)
+		}
+	}
+	return nil
+}
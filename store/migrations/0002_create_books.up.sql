@@ -0,0 +1,10 @@
+CREATE TABLE books (
+    id             TEXT PRIMARY KEY,
+    title          TEXT NOT NULL,
+    author         TEXT NOT NULL,
+    published_date TIMESTAMP NOT NULL,
+    status         TEXT NOT NULL
+);
+
+CREATE INDEX books_title_id_idx ON books (title, id);
+CREATE INDEX books_status_idx ON books (status);
@@ -0,0 +1 @@
+DROP TABLE borrowed_books;
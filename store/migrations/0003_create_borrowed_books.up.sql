@@ -0,0 +1,11 @@
+CREATE TABLE borrowed_books (
+    id            TEXT PRIMARY KEY,
+    book_id       TEXT NOT NULL REFERENCES books (id) ON DELETE RESTRICT,
+    user_id       TEXT NOT NULL REFERENCES users (id) ON DELETE RESTRICT,
+    borrowed_date TEXT NOT NULL,
+    return_date   TEXT NOT NULL,
+    returned_at   TIMESTAMP
+);
+
+CREATE INDEX borrowed_books_user_id_idx ON borrowed_books (user_id, borrowed_date);
+CREATE INDEX borrowed_books_book_id_idx ON borrowed_books (book_id);
@@ -0,0 +1,27 @@
+-- A book is available if any of its copies is
+ALTER TABLE books ADD COLUMN status TEXT NOT NULL DEFAULT 'Available';
+UPDATE books SET status = COALESCE((
+    SELECT status FROM copies WHERE copies.title_id = books.id
+    ORDER BY CASE WHEN status = 'Available' THEN 0 ELSE 1 END
+    LIMIT 1
+), 'Available');
+CREATE INDEX books_status_idx ON books (status);
+ALTER TABLE books DROP COLUMN isbn;
+
+-- SQLite cannot drop a column with a foreign key, so the loans table is rebuilt
+CREATE TABLE borrowed_books_0005 (
+    id            TEXT PRIMARY KEY,
+    book_id       TEXT NOT NULL REFERENCES books (id) ON DELETE RESTRICT,
+    user_id       TEXT NOT NULL REFERENCES users (id) ON DELETE RESTRICT,
+    borrowed_date TEXT NOT NULL,
+    return_date   TEXT NOT NULL,
+    returned_at   TIMESTAMP
+);
+INSERT INTO borrowed_books_0005 (id, book_id, user_id, borrowed_date, return_date, returned_at)
+SELECT id, book_id, user_id, borrowed_date, return_date, returned_at FROM borrowed_books;
+DROP TABLE borrowed_books;
+ALTER TABLE borrowed_books_0005 RENAME TO borrowed_books;
+CREATE INDEX borrowed_books_user_id_idx ON borrowed_books (user_id, borrowed_date);
+CREATE INDEX borrowed_books_book_id_idx ON borrowed_books (book_id);
+
+DROP TABLE copies;
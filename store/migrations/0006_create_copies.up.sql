@@ -0,0 +1,22 @@
+CREATE TABLE copies (
+    id        TEXT PRIMARY KEY,
+    title_id  TEXT NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    barcode   TEXT NOT NULL UNIQUE,
+    status    TEXT NOT NULL,
+    condition TEXT NOT NULL,
+    location  TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX copies_title_id_idx ON copies (title_id, status);
+
+-- Every book becomes a title with a single copy, which keeps the book's id as its id and barcode
+INSERT INTO copies (id, title_id, barcode, status, condition, location)
+SELECT id, id, id, status, 'good', '' FROM books;
+
+ALTER TABLE borrowed_books ADD COLUMN copy_id TEXT REFERENCES copies (id) ON DELETE RESTRICT;
+UPDATE borrowed_books SET copy_id = book_id;
+CREATE INDEX borrowed_books_copy_id_idx ON borrowed_books (copy_id);
+
+DROP INDEX books_status_idx;
+ALTER TABLE books DROP COLUMN status;
+ALTER TABLE books ADD COLUMN isbn TEXT NOT NULL DEFAULT '';
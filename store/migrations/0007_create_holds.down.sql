@@ -0,0 +1,2 @@
+UPDATE copies SET status = 'Available' WHERE status = 'on_hold';
+DROP TABLE holds;
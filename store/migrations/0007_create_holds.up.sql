@@ -0,0 +1,18 @@
+CREATE TABLE holds (
+    id         TEXT PRIMARY KEY,
+    title_id   TEXT NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    user_id    TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    status     TEXT NOT NULL,
+    copy_id    TEXT REFERENCES copies (id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL,
+    ready_at   TIMESTAMP,
+    pickup_by  TIMESTAMP,
+    closed_at  TIMESTAMP
+);
+
+CREATE INDEX holds_title_id_idx ON holds (title_id, status, created_at);
+CREATE INDEX holds_user_id_idx ON holds (user_id, created_at);
+CREATE INDEX holds_pickup_by_idx ON holds (pickup_by);
+
+-- A patron has at most one open hold per title
+CREATE UNIQUE INDEX holds_active_idx ON holds (title_id, user_id) WHERE status IN ('waiting', 'ready');
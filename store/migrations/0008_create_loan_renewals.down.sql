@@ -0,0 +1,2 @@
+DROP TABLE loan_renewals;
+ALTER TABLE borrowed_books DROP COLUMN renewals;
@@ -0,0 +1,12 @@
+ALTER TABLE borrowed_books ADD COLUMN renewals INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE loan_renewals (
+    id                TEXT PRIMARY KEY,
+    loan_id           TEXT NOT NULL REFERENCES borrowed_books (id) ON DELETE CASCADE,
+    renewed_at        TIMESTAMP NOT NULL,
+    renewed_by        TEXT NOT NULL DEFAULT '',
+    previous_due_date TEXT NOT NULL,
+    due_date          TEXT NOT NULL
+);
+
+CREATE INDEX loan_renewals_loan_id_idx ON loan_renewals (loan_id, renewed_at);
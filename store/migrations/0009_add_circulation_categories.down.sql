@@ -0,0 +1,2 @@
+ALTER TABLE books DROP COLUMN item_type;
+ALTER TABLE users DROP COLUMN category;
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN category TEXT NOT NULL DEFAULT '';
+ALTER TABLE books ADD COLUMN item_type TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+DROP TABLE fee_transactions;
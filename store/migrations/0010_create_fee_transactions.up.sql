@@ -0,0 +1,15 @@
+CREATE TABLE fee_transactions (
+    id              TEXT PRIMARY KEY,
+    user_id         TEXT NOT NULL REFERENCES users (id) ON DELETE RESTRICT,
+    kind            TEXT NOT NULL,
+    amount          BIGINT NOT NULL,
+    loan_id         TEXT REFERENCES borrowed_books (id) ON DELETE RESTRICT,
+    charge_id       TEXT REFERENCES fee_transactions (id) ON DELETE RESTRICT,
+    note            TEXT NOT NULL DEFAULT '',
+    created_by      TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMP NOT NULL,
+    idempotency_key TEXT UNIQUE
+);
+
+CREATE INDEX fee_transactions_user_id_idx ON fee_transactions (user_id, created_at);
+CREATE INDEX fee_transactions_loan_id_idx ON fee_transactions (loan_id);
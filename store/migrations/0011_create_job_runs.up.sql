@@ -0,0 +1,15 @@
+CREATE TABLE job_runs (
+    id           TEXT PRIMARY KEY,
+    job          TEXT NOT NULL,
+    scheduled_at TIMESTAMP NOT NULL,
+    started_at   TIMESTAMP NOT NULL,
+    finished_at  TIMESTAMP,
+    status       TEXT NOT NULL,
+    error        TEXT NOT NULL DEFAULT '',
+    checked      INTEGER NOT NULL DEFAULT 0,
+    changed      INTEGER NOT NULL DEFAULT 0,
+    summary      TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX job_runs_job_idx ON job_runs (job, scheduled_at);
+CREATE INDEX job_runs_finished_at_idx ON job_runs (finished_at);
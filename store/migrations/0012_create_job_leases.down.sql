@@ -0,0 +1,5 @@
+DROP INDEX job_runs_job_idx;
+CREATE INDEX job_runs_job_idx ON job_runs (job, scheduled_at);
+
+ALTER TABLE job_runs DROP COLUMN instance;
+DROP TABLE job_leases;
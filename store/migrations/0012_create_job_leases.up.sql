@@ -0,0 +1,11 @@
+CREATE TABLE job_leases (
+    job        TEXT PRIMARY KEY,
+    holder     TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE job_runs ADD COLUMN instance TEXT NOT NULL DEFAULT '';
+
+-- A job runs once per scheduled time, whichever instance runs it
+DROP INDEX job_runs_job_idx;
+CREATE UNIQUE INDEX job_runs_job_idx ON job_runs (job, scheduled_at);
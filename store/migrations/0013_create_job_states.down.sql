@@ -0,0 +1,2 @@
+ALTER TABLE job_runs DROP COLUMN triggered_by;
+DROP TABLE job_states;
@@ -0,0 +1,8 @@
+CREATE TABLE job_states (
+    job        TEXT PRIMARY KEY,
+    paused     BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_by TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE job_runs ADD COLUMN triggered_by TEXT NOT NULL DEFAULT '';
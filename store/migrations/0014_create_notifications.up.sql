@@ -0,0 +1,20 @@
+CREATE TABLE notifications (
+    id        TEXT PRIMARY KEY,
+    user_id   TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    kind      TEXT NOT NULL,
+    dedup_key TEXT NOT NULL,
+    channels  TEXT NOT NULL DEFAULT '',
+    subject   TEXT NOT NULL DEFAULT '',
+    sent_at   TIMESTAMP NOT NULL,
+    UNIQUE (user_id, kind, dedup_key)
+);
+
+CREATE INDEX notifications_sent_at_idx ON notifications (sent_at);
+
+CREATE TABLE notification_preferences (
+    user_id    TEXT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    email      TEXT NOT NULL DEFAULT '',
+    channels   TEXT NOT NULL DEFAULT '',
+    muted      TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL
+);
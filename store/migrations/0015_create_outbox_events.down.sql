@@ -0,0 +1,2 @@
+DROP TABLE outbox_sequence;
+DROP TABLE outbox_events;
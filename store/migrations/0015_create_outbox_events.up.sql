@@ -0,0 +1,22 @@
+CREATE TABLE outbox_events (
+    id           TEXT PRIMARY KEY,
+    seq          BIGINT NOT NULL UNIQUE,
+    type         TEXT NOT NULL,
+    book_id      TEXT NOT NULL,
+    payload      TEXT NOT NULL,
+    created_at   TIMESTAMP NOT NULL,
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    last_error   TEXT NOT NULL DEFAULT '',
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX outbox_events_delivered_at_idx ON outbox_events (delivered_at);
+
+-- One row counting the events; updating it in the event's transaction locks it until
+-- the commit, so sequence numbers are handed out in commit order
+CREATE TABLE outbox_sequence (
+    id    INTEGER PRIMARY KEY,
+    value BIGINT NOT NULL
+);
+
+INSERT INTO outbox_sequence (id, value) VALUES (1, 0);
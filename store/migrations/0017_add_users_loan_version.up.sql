@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN loan_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,468 @@
+package store
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore stores everything in MongoDB collections.
+type MongoStore struct {
+	client                  *mongo.Client
+	usersCollection         *mongo.Collection
+	booksCollection         *mongo.Collection // titles
+	copiesCollection        *mongo.Collection
+	borrowedBooksCollection *mongo.Collection
+	holdsCollection         *mongo.Collection
+	refreshTokensCollection *mongo.Collection
+	revokedTokensCollection *mongo.Collection
+	throttlesCollection     *mongo.Collection
+	auditEventsCollection   *mongo.Collection
+	feesCollection          *mongo.Collection
+	jobRunsCollection       *mongo.Collection
+	jobLeasesCollection     *mongo.Collection
+	jobStatesCollection     *mongo.Collection
+	notificationsCollection *mongo.Collection
+	notifyPrefsCollection   *mongo.Collection
+	outboxCollection        *mongo.Collection
+	outboxSeqCollection     *mongo.Collection
+	webhooksCollection      *mongo.Collection
+	deliveriesCollection    *mongo.Collection
+}
+
+// NewMongoStore uses the users, books, copies, borrowed_books, holds, refresh_tokens,
+// revoked_tokens, login_throttles, audit_events, fee_transactions, job_runs, job_leases,
+// job_states, notifications, notification_preferences, outbox_events, outbox_sequence,
+// webhook_subscriptions and webhook_deliveries collections of the database. The
+// database must be migrated with MigrateMongoUp: the store relies on its unique indexes.
+// It must also be served by a replica set, see RequireMongoReplicaSet.
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{
+		client:                  db.Client(),
+		usersCollection:         db.Collection("users"),
+		booksCollection:         db.Collection("books"),
+		copiesCollection:        db.Collection("copies"),
+		borrowedBooksCollection: db.Collection("borrowed_books"),
+		holdsCollection:         db.Collection("holds"),
+		refreshTokensCollection: db.Collection("refresh_tokens"),
+		revokedTokensCollection: db.Collection("revoked_tokens"),
+		throttlesCollection:     db.Collection("login_throttles"),
+		auditEventsCollection:   db.Collection("audit_events"),
+		feesCollection:          db.Collection("fee_transactions"),
+		jobRunsCollection:       db.Collection("job_runs"),
+		jobLeasesCollection:     db.Collection("job_leases"),
+		jobStatesCollection:     db.Collection("job_states"),
+		notificationsCollection: db.Collection("notifications"),
+		notifyPrefsCollection:   db.Collection("notification_preferences"),
+		outboxCollection:        db.Collection("outbox_events"),
+		outboxSeqCollection:     db.Collection("outbox_sequence"),
+		webhooksCollection:      db.Collection("webhook_subscriptions"),
+		deliveriesCollection:    db.Collection("webhook_deliveries"),
+	}
+}
+
+func (s *MongoStore) CreateUser(ctx context.Context, user *entity.User) error {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	// The unique index on username refuses a taken one
+	_, err := s.usersCollection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+func (s *MongoStore) GetUserByID(ctx context.Context, id string) (*entity.User, error) {
+	userID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return s.findUser(ctx, bson.M{"_id": userID})
+}
+
+func (s *MongoStore) GetUserByUsername(ctx context.Context, username string) (*entity.User, error) {
+	return s.findUser(ctx, bson.M{"username": username})
+}
+
+func (s *MongoStore) findUser(ctx context.Context, filter bson.M) (*entity.User, error) {
+	var user entity.User
+	err := s.usersCollection.FindOne(ctx, filter).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *MongoStore) UpdateUserPassword(ctx context.Context, id, password string) error {
+	return s.updateUser(ctx, id, bson.M{"password": password})
+}
+
+func (s *MongoStore) UpdateUserRole(ctx context.Context, id, role string) error {
+	return s.updateUser(ctx, id, bson.M{"role": role})
+}
+
+func (s *MongoStore) UpdateUserCategory(ctx context.Context, id, category string) error {
+	return s.updateUser(ctx, id, bson.M{"category": category})
+}
+
+func (s *MongoStore) updateUser(ctx context.Context, id string, set bson.M) error {
+	userID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	result, err := s.usersCollection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) CreateTitle(ctx context.Context, title *entity.Title, copies []entity.Copy, events ...entity.OutboxEvent) error {
+	if title.ID.IsZero() {
+		title.ID = primitive.NewObjectID()
+	}
+	var documents []interface{}
+	for i := range copies {
+		copies[i].TitleID = title.ID.Hex()
+		if copies[i].ID.IsZero() {
+			copies[i].ID = primitive.NewObjectID()
+		}
+		documents = append(documents, copies[i])
+	}
+
+	return s.withOutbox(ctx, events, func(ctx context.Context) error {
+		_, err := s.booksCollection.InsertOne(ctx, title)
+		if err == nil && len(documents) > 0 {
+			_, err = s.copiesCollection.InsertMany(ctx, documents)
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	})
+}
+
+func (s *MongoStore) GetTitle(ctx context.Context, id string) (*entity.Title, error) {
+	titleID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var title entity.Title
+	err = s.booksCollection.FindOne(ctx, bson.M{"_id": titleID}).Decode(&title)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &title, nil
+}
+
+func (s *MongoStore) DeleteTitle(ctx context.Context, id string, events ...entity.OutboxEvent) error {
+	titleID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	return s.withOutbox(ctx, events, func(ctx context.Context) error {
+		result, err := s.booksCollection.DeleteOne(ctx, bson.M{"_id": titleID})
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount == 0 {
+			return ErrNotFound
+		}
+
+		_, err = s.copiesCollection.DeleteMany(ctx, bson.M{"title_id": id})
+		if err != nil {
+			return err
+		}
+		_, err = s.holdsCollection.DeleteMany(ctx, bson.M{"title_id": id})
+		return err
+	})
+}
+
+func (s *MongoStore) ListTitles(ctx context.Context, filter TitleFilter) ([]entity.Title, error) {
+	filters := bson.A{}
+	if filter.CopyStatus != "" {
+		titleIDs, err := s.copiesCollection.Distinct(ctx, "title_id", bson.M{"status": filter.CopyStatus})
+		if err != nil {
+			return nil, err
+		}
+		ids := []string{}
+		for _, id := range titleIDs {
+			if id, ok := id.(string); ok {
+				ids = append(ids, id)
+			}
+		}
+		filters = append(filters, bson.M{"_id": bson.M{"$in": objectIDs(ids)}})
+	}
+	if filter.Author != "" {
+		filters = append(filters, bson.M{"author": filter.Author})
+	}
+	if filter.TitlePrefix != "" {
+		filters = append(filters, bson.M{"title": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(filter.TitlePrefix), Options: "i"}})
+	}
+
+	published := bson.M{}
+	if !filter.PublishedFrom.IsZero() {
+		published["$gte"] = filter.PublishedFrom
+	}
+	if !filter.PublishedTo.IsZero() {
+		published["$lte"] = filter.PublishedTo
+	}
+	if len(published) > 0 {
+		filters = append(filters, bson.M{"published_date": published})
+	}
+
+	if filter.IDs != nil {
+		filters = append(filters, bson.M{"_id": bson.M{"$in": objectIDs(filter.IDs)}})
+	}
+
+	if filter.AfterID != "" {
+		afterID, err := primitive.ObjectIDFromHex(filter.AfterID)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, bson.M{"$or": bson.A{
+			bson.M{"title": bson.M{"$gt": filter.AfterTitle}},
+			bson.M{"title": filter.AfterTitle, "_id": bson.M{"$gt": afterID}},
+		}})
+	}
+
+	query := bson.M{}
+	if len(filters) > 0 {
+		query["$and"] = filters
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "title", Value: 1}, {Key: "_id", Value: 1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+
+	cursor, err := s.booksCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var titles []entity.Title
+	if err := cursor.All(ctx, &titles); err != nil {
+		return nil, err
+	}
+	return titles, nil
+}
+
+func (s *MongoStore) CreateLoan(ctx context.Context, loan *entity.BorrowedBooks, events ...entity.OutboxEvent) error {
+	if loan.ID.IsZero() {
+		loan.ID = primitive.NewObjectID()
+	}
+	return s.withOutbox(ctx, events, func(ctx context.Context) error {
+		_, err := s.borrowedBooksCollection.InsertOne(ctx, loan)
+		return err
+	})
+}
+
+func (s *MongoStore) BorrowCopy(ctx context.Context, loan *entity.BorrowedBooks, from, holdID string, loanVersion int, borrowedAt time.Time, events ...entity.OutboxEvent) error {
+	copyID, err := primitive.ObjectIDFromHex(loan.CopyID)
+	if err != nil {
+		return ErrConflict
+	}
+	userID, err := primitive.ObjectIDFromHex(loan.UserID)
+	if err != nil {
+		return ErrConflict
+	}
+	var holdFilter bson.M
+	if holdID != "" {
+		id, err := primitive.ObjectIDFromHex(holdID)
+		if err != nil {
+			return ErrConflict
+		}
+		holdFilter = bson.M{"_id": id, "status": entity.HoldReady, "user_id": loan.UserID, "copy_id": loan.CopyID}
+	}
+	if loan.ID.IsZero() {
+		loan.ID = primitive.NewObjectID()
+	}
+
+	return s.withTransaction(ctx, func(ctx context.Context) error {
+		result, err := s.copiesCollection.UpdateOne(ctx,
+			bson.M{"_id": copyID, "status": from},
+			bson.M{"$set": bson.M{"status": entity.CopyBorrowed}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrConflict
+		}
+
+		if holdFilter != nil {
+			result, err := s.holdsCollection.UpdateOne(ctx, holdFilter,
+				bson.M{"$set": bson.M{"status": entity.HoldFulfilled, "closed_at": borrowedAt}},
+			)
+			if err != nil {
+				return err
+			}
+			if result.MatchedCount == 0 {
+				return ErrConflict
+			}
+		}
+
+		result, err = s.usersCollection.UpdateOne(ctx,
+			bson.M{"_id": userID, "loan_version": loanVersion},
+			bson.M{"$inc": bson.M{"loan_version": 1}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrConflict
+		}
+
+		if _, err := s.borrowedBooksCollection.InsertOne(ctx, loan); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrAlreadyExists
+			}
+			return err
+		}
+		return s.addOutboxEvents(ctx, events)
+	})
+}
+
+func (s *MongoStore) GetLoan(ctx context.Context, id string) (*entity.BorrowedBooks, error) {
+	loanID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var loan entity.BorrowedBooks
+	err = s.borrowedBooksCollection.FindOne(ctx, bson.M{"_id": loanID}).Decode(&loan)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
+func (s *MongoStore) ListLoans(ctx context.Context, filter LoanFilter) ([]entity.BorrowedBooks, error) {
+	query := bson.M{}
+	if filter.UserID != "" {
+		query["user_id"] = filter.UserID
+	}
+	if filter.BookID != "" {
+		query["book_id"] = filter.BookID
+	}
+	switch filter.State {
+	case LoanOpen:
+		query["returned_at"] = nil
+	case LoanClosed:
+		query["returned_at"] = bson.M{"$ne": nil}
+	}
+	if filter.DueBefore != "" {
+		query["return_date"] = bson.M{"$lt": filter.DueBefore}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "borrowed_date", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := s.borrowedBooksCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var loans []entity.BorrowedBooks
+	if err := cursor.All(ctx, &loans); err != nil {
+		return nil, err
+	}
+	return loans, nil
+}
+
+func (s *MongoStore) CloseLoan(ctx context.Context, id string, returnedAt time.Time, events ...entity.OutboxEvent) error {
+	loanID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	return s.withOutbox(ctx, events, func(ctx context.Context) error {
+		// Only close the loan if it is still open
+		result, err := s.borrowedBooksCollection.UpdateOne(ctx,
+			bson.M{"_id": loanID, "returned_at": nil},
+			bson.M{"$set": bson.M{"returned_at": returnedAt}},
+		)
+		if err != nil {
+			return err
+		}
+
+		if result.MatchedCount == 0 {
+			count, err := s.borrowedBooksCollection.CountDocuments(ctx, bson.M{"_id": loanID})
+			if err != nil {
+				return err
+			}
+			if count == 0 {
+				return ErrNotFound
+			}
+			return ErrConflict
+		}
+		return nil
+	})
+}
+
+func (s *MongoStore) RenewLoan(ctx context.Context, id string, renewals int, renewal entity.LoanRenewal) error {
+	loanID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	// Only renew an open loan whose history still has the length the caller saw
+	result, err := s.borrowedBooksCollection.UpdateOne(ctx,
+		bson.M{
+			"_id":         loanID,
+			"returned_at": nil,
+			"$expr":       bson.M{"$eq": bson.A{bson.M{"$size": bson.M{"$ifNull": bson.A{"$renewals", bson.A{}}}}, renewals}},
+		},
+		bson.M{
+			"$set":  bson.M{"return_date": renewal.DueDate},
+			"$push": bson.M{"renewals": renewal},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		count, err := s.borrowedBooksCollection.CountDocuments(ctx, bson.M{"_id": loanID})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+		return ErrConflict
+	}
+	return nil
+}
+
+func objectIDs(ids []string) bson.A {
+	result := bson.A{}
+	for _, id := range ids {
+		if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+			result = append(result, objectID)
+		}
+	}
+	return result
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *MongoStore) CreateCopy(ctx context.Context, item *entity.Copy, events ...entity.OutboxEvent) error {
+	titleID, err := primitive.ObjectIDFromHex(item.TitleID)
+	if err != nil {
+		return ErrNotFound
+	}
+	count, err := s.booksCollection.CountDocuments(ctx, bson.M{"_id": titleID})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	if item.ID.IsZero() {
+		item.ID = primitive.NewObjectID()
+	}
+	return s.withOutbox(ctx, events, func(ctx context.Context) error {
+		_, err := s.copiesCollection.InsertOne(ctx, item)
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	})
+}
+
+func (s *MongoStore) GetCopy(ctx context.Context, id string) (*entity.Copy, error) {
+	copyID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return s.findCopy(ctx, bson.M{"_id": copyID})
+}
+
+func (s *MongoStore) GetCopyByBarcode(ctx context.Context, barcode string) (*entity.Copy, error) {
+	return s.findCopy(ctx, bson.M{"barcode": barcode})
+}
+
+func (s *MongoStore) findCopy(ctx context.Context, filter bson.M) (*entity.Copy, error) {
+	var item entity.Copy
+	err := s.copiesCollection.FindOne(ctx, filter).Decode(&item)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *MongoStore) ListCopies(ctx context.Context, filter CopyFilter) ([]entity.Copy, error) {
+	query := bson.M{}
+	if filter.TitleID != "" {
+		query["title_id"] = filter.TitleID
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	cursor, err := s.copiesCollection.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "barcode", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var copies []entity.Copy
+	if err := cursor.All(ctx, &copies); err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
+
+func (s *MongoStore) CountCopies(ctx context.Context, titleIDs []string) (map[string]CopyCounts, error) {
+	cursor, err := s.copiesCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"title_id": bson.M{"$in": titleIDs}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$title_id",
+			"total": bson.M{"$sum": 1},
+			"available": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$status", entity.CopyAvailable}}, 1, 0,
+			}}},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		TitleID   string `bson:"_id"`
+		Total     int    `bson:"total"`
+		Available int    `bson:"available"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	counts := map[string]CopyCounts{}
+	for _, row := range rows {
+		counts[row.TitleID] = CopyCounts{Total: row.Total, Available: row.Available}
+	}
+	return counts, nil
+}
+
+func (s *MongoStore) UpdateCopyStatus(ctx context.Context, id, from, to string, events ...entity.OutboxEvent) error {
+	copyID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	// The status is part of the filter, so the update is a single compare-and-set
+	filter := bson.M{"_id": copyID}
+	if from != "" {
+		filter["status"] = from
+	}
+	return s.withOutbox(ctx, events, func(ctx context.Context) error {
+		result, err := s.copiesCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"status": to}})
+		if err != nil {
+			return err
+		}
+
+		if result.MatchedCount == 0 {
+			count, err := s.copiesCollection.CountDocuments(ctx, bson.M{"_id": copyID})
+			if err != nil {
+				return err
+			}
+			if count == 0 {
+				return ErrNotFound
+			}
+			return ErrConflict
+		}
+		return nil
+	})
+}
+
+func (s *MongoStore) UpdateCopyDetails(ctx context.Context, id, condition, location string) error {
+	copyID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	result, err := s.copiesCollection.UpdateOne(ctx, bson.M{"_id": copyID},
+		bson.M{"$set": bson.M{"condition": condition, "location": location}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) DeleteCopy(ctx context.Context, id string, events ...entity.OutboxEvent) error {
+	copyID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	return s.withOutbox(ctx, events, func(ctx context.Context) error {
+		result, err := s.copiesCollection.DeleteOne(ctx, bson.M{"_id": copyID})
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *MongoStore) CreateFeeTransaction(ctx context.Context, entry *entity.FeeTransaction) error {
+	if entry.ID.IsZero() {
+		entry.ID = primitive.NewObjectID()
+	}
+
+	// The unique index on the idempotency key rejects an entry recorded twice
+	_, err := s.feesCollection.InsertOne(ctx, entry)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+func (s *MongoStore) GetFeeTransaction(ctx context.Context, id string) (*entity.FeeTransaction, error) {
+	entryID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var entry entity.FeeTransaction
+	err = s.feesCollection.FindOne(ctx, bson.M{"_id": entryID}).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (s *MongoStore) ListFeeTransactions(ctx context.Context, filter FeeFilter) ([]entity.FeeTransaction, error) {
+	query := bson.M{}
+	if filter.UserID != "" {
+		query["user_id"] = filter.UserID
+	}
+	if filter.LoanID != "" {
+		query["loan_id"] = filter.LoanID
+	}
+	if filter.ChargeID != "" {
+		query["charge_id"] = filter.ChargeID
+	}
+	if filter.Kind != "" {
+		query["kind"] = filter.Kind
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := s.feesCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []entity.FeeTransaction
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (s *MongoStore) FeeBalance(ctx context.Context, userID string) (int64, error) {
+	cursor, err := s.feesCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "balance": bson.M{"$sum": "$amount"}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var rows []struct {
+		Balance int64 `bson:"balance"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	return rows[0].Balance, nil
+}
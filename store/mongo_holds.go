@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var activeHoldStatuses = []string{entity.HoldWaiting, entity.HoldReady}
+
+func (s *MongoStore) CreateHold(ctx context.Context, hold *entity.Hold) error {
+	if hold.ID.IsZero() {
+		hold.ID = primitive.NewObjectID()
+	}
+	_, err := s.holdsCollection.InsertOne(ctx, hold)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+func (s *MongoStore) GetHold(ctx context.Context, id string) (*entity.Hold, error) {
+	holdID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var hold entity.Hold
+	err = s.holdsCollection.FindOne(ctx, bson.M{"_id": holdID}).Decode(&hold)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+func (s *MongoStore) ListHolds(ctx context.Context, filter HoldFilter) ([]entity.Hold, error) {
+	query := bson.M{}
+	if filter.TitleID != "" {
+		query["title_id"] = filter.TitleID
+	}
+	if filter.UserID != "" {
+		query["user_id"] = filter.UserID
+	}
+	if filter.CopyID != "" {
+		query["copy_id"] = filter.CopyID
+	}
+	if len(filter.Statuses) > 0 {
+		query["status"] = bson.M{"$in": filter.Statuses}
+	}
+	if !filter.PickupBefore.IsZero() {
+		query["pickup_by"] = bson.M{"$lt": filter.PickupBefore}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := s.holdsCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var holds []entity.Hold
+	if err := cursor.All(ctx, &holds); err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+func (s *MongoStore) ReadyHold(ctx context.Context, id, copyID string, readyAt, pickupBy time.Time, events ...entity.OutboxEvent) error {
+	return s.withOutbox(ctx, events, func(ctx context.Context) error {
+		return s.updateHold(ctx, id, entity.HoldWaiting, bson.M{
+			"status":    entity.HoldReady,
+			"copy_id":   copyID,
+			"ready_at":  readyAt,
+			"pickup_by": pickupBy,
+		})
+	})
+}
+
+func (s *MongoStore) CloseHold(ctx context.Context, id, from, to string, closedAt time.Time) error {
+	return s.updateHold(ctx, id, from, bson.M{"status": to, "closed_at": closedAt})
+}
+
+// updateHold sets the fields only if the hold is still in the "from" status.
+func (s *MongoStore) updateHold(ctx context.Context, id, from string, set bson.M) error {
+	holdID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	result, err := s.holdsCollection.UpdateOne(ctx, bson.M{"_id": holdID, "status": from}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		count, err := s.holdsCollection.CountDocuments(ctx, bson.M{"_id": holdID})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+		return ErrConflict
+	}
+	return nil
+}
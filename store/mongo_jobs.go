@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *MongoStore) CreateJobRun(ctx context.Context, run *entity.JobRun) error {
+	if run.ID.IsZero() {
+		run.ID = primitive.NewObjectID()
+	}
+
+	// The unique index rejects a second run of the job scheduled at the same time
+	_, err := s.jobRunsCollection.InsertOne(ctx, run)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+func (s *MongoStore) FinishJobRun(ctx context.Context, run *entity.JobRun) error {
+	result, err := s.jobRunsCollection.UpdateOne(ctx,
+		bson.M{"_id": run.ID, "status": entity.JobRunning},
+		bson.M{"$set": bson.M{
+			"status":      run.Status,
+			"error":       run.Error,
+			"result":      run.Result,
+			"finished_at": run.FinishedAt,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		count, err := s.jobRunsCollection.CountDocuments(ctx, bson.M{"_id": run.ID})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *MongoStore) GetJobRun(ctx context.Context, id string) (*entity.JobRun, error) {
+	runID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var run entity.JobRun
+	err = s.jobRunsCollection.FindOne(ctx, bson.M{"_id": runID}).Decode(&run)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (s *MongoStore) ListJobRuns(ctx context.Context, filter JobRunFilter) ([]entity.JobRun, error) {
+	query := bson.M{}
+	if filter.Job != "" {
+		query["job"] = filter.Job
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "scheduled_at", Value: -1}, {Key: "_id", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+	cursor, err := s.jobRunsCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []entity.JobRun
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+func (s *MongoStore) DeleteJobRuns(ctx context.Context, before time.Time) error {
+	_, err := s.jobRunsCollection.DeleteMany(ctx, bson.M{"finished_at": bson.M{"$lt": before}})
+	return err
+}
+
+func (s *MongoStore) AcquireJobLease(ctx context.Context, job, holder string, now, until time.Time) error {
+	// A lease held by someone else does not match, and the upsert then fails on its _id
+	_, err := s.jobLeasesCollection.UpdateOne(ctx,
+		bson.M{"_id": job, "$or": bson.A{bson.M{"holder": holder}, bson.M{"expires_at": bson.M{"$lte": now}}}},
+		bson.M{"$set": bson.M{"holder": holder, "expires_at": until}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s *MongoStore) ReleaseJobLease(ctx context.Context, job, holder string) error {
+	result, err := s.jobLeasesCollection.DeleteOne(ctx, bson.M{"_id": job, "holder": holder})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *MongoStore) GetJobLease(ctx context.Context, job string) (*entity.JobLease, error) {
+	var lease entity.JobLease
+	err := s.jobLeasesCollection.FindOne(ctx, bson.M{"_id": job}).Decode(&lease)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+func (s *MongoStore) SetJobState(ctx context.Context, state entity.JobState) error {
+	_, err := s.jobStatesCollection.ReplaceOne(ctx, bson.M{"_id": state.Job}, state, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoStore) GetJobState(ctx context.Context, job string) (*entity.JobState, error) {
+	var state entity.JobState
+	err := s.jobStatesCollection.FindOne(ctx, bson.M{"_id": job}).Decode(&state)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
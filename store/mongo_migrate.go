@@ -0,0 +1,225 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoMigration is one versioned change of the MongoDB backend, such as the
+// indexes its uniqueness rules rely on. MongoDB migrations are not reverted.
+type MongoMigration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+}
+
+// mongoMigrations are the MongoDB migrations, ordered by version.
+var mongoMigrations = []MongoMigration{
+	{Version: 1, Name: "create_users_username_index", Up: func(ctx context.Context, db *mongo.Database) error {
+		return createIndexes(ctx, db.Collection("users"), mongo.IndexModel{
+			Keys:    bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		})
+	}},
+	{Version: 2, Name: "create_refresh_tokens_hash_index", Up: func(ctx context.Context, db *mongo.Database) error {
+		return createIndexes(ctx, db.Collection("refresh_tokens"), mongo.IndexModel{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		})
+	}},
+	{Version: 3, Name: "create_copies", Up: func(ctx context.Context, db *mongo.Database) error {
+		err := createIndexes(ctx, db.Collection("copies"),
+			mongo.IndexModel{Keys: bson.D{{Key: "barcode", Value: 1}}, Options: options.Index().SetUnique(true)},
+			mongo.IndexModel{Keys: bson.D{{Key: "title_id", Value: 1}, {Key: "status", Value: 1}}},
+		)
+		if err != nil {
+			return err
+		}
+		return migrateBooksToCopies(ctx, db)
+	}},
+	{Version: 4, Name: "create_holds_indexes", Up: func(ctx context.Context, db *mongo.Database) error {
+		return createIndexes(ctx, db.Collection("holds"),
+			// A patron has at most one open hold per title
+			mongo.IndexModel{
+				Keys: bson.D{{Key: "title_id", Value: 1}, {Key: "user_id", Value: 1}},
+				Options: options.Index().SetUnique(true).SetName("holds_active_idx").
+					SetPartialFilterExpression(bson.M{"status": bson.M{"$in": activeHoldStatuses}}),
+			},
+			mongo.IndexModel{Keys: bson.D{{Key: "title_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+			mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}}},
+			mongo.IndexModel{Keys: bson.D{{Key: "pickup_by", Value: 1}}},
+		)
+	}},
+	{Version: 5, Name: "create_fee_transactions_indexes", Up: func(ctx context.Context, db *mongo.Database) error {
+		return createIndexes(ctx, db.Collection("fee_transactions"),
+			// Entries without a key are left out of the index
+			mongo.IndexModel{Keys: bson.D{{Key: "idempotency_key", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+			mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}}},
+			mongo.IndexModel{Keys: bson.D{{Key: "loan_id", Value: 1}}},
+		)
+	}},
+	{Version: 6, Name: "create_job_runs_index", Up: func(ctx context.Context, db *mongo.Database) error {
+		// A job runs once per scheduled time, whichever instance runs it
+		return createIndexes(ctx, db.Collection("job_runs"), mongo.IndexModel{
+			Keys:    bson.D{{Key: "job", Value: 1}, {Key: "scheduled_at", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		})
+	}},
+	{Version: 7, Name: "create_notifications_indexes", Up: func(ctx context.Context, db *mongo.Database) error {
+		return createIndexes(ctx, db.Collection("notifications"),
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "kind", Value: 1}, {Key: "key", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			mongo.IndexModel{Keys: bson.D{{Key: "sent_at", Value: 1}}},
+		)
+	}},
+	{Version: 8, Name: "create_webhook_deliveries_indexes", Up: func(ctx context.Context, db *mongo.Database) error {
+		return createIndexes(ctx, db.Collection("webhook_deliveries"),
+			mongo.IndexModel{
+				Keys:    bson.D{{Key: "subscription_id", Value: 1}, {Key: "event_id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			mongo.IndexModel{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+			mongo.IndexModel{Keys: bson.D{{Key: "created_at", Value: 1}}},
+		)
+	}},
+	{Version: 9, Name: "create_outbox_events_indexes", Up: func(ctx context.Context, db *mongo.Database) error {
+		return createIndexes(ctx, db.Collection("outbox_events"),
+			mongo.IndexModel{Keys: bson.D{{Key: "seq", Value: 1}}, Options: options.Index().SetUnique(true)},
+			mongo.IndexModel{Keys: bson.D{{Key: "delivered_at", Value: 1}}},
+		)
+	}},
+	{Version: 10, Name: "add_users_loan_version", Up: func(ctx context.Context, db *mongo.Database) error {
+		// Borrows compare the version, so it must be set on every user
+		_, err := db.Collection("users").UpdateMany(ctx,
+			bson.M{"loan_version": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"loan_version": 0}},
+		)
+		return err
+	}},
+}
+
+// MongoMigrations returns the MongoDB migrations, ordered by version.
+func MongoMigrations() []MongoMigration {
+	return mongoMigrations
+}
+
+// LatestMongoSchemaVersion returns the version of the newest MongoDB migration.
+func LatestMongoSchemaVersion() int {
+	return mongoMigrations[len(mongoMigrations)-1].Version
+}
+
+// MongoSchemaVersion returns the version of the last migration applied to the
+// database, 0 if none.
+func MongoSchemaVersion(ctx context.Context, db *mongo.Database) (int, error) {
+	var last struct {
+		Version int `bson:"_id"`
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})
+	err := db.Collection("schema_migrations").FindOne(ctx, bson.M{}, opts).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return last.Version, nil
+}
+
+// MigrateMongoUp applies all pending migrations and returns the versions it applied.
+// Each migration is recorded in the schema_migrations collection once it succeeded,
+// so a failed one runs again next time and must be safe to repeat.
+func MigrateMongoUp(ctx context.Context, db *mongo.Database) ([]int, error) {
+	current, err := MongoSchemaVersion(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []int
+	for _, migration := range mongoMigrations {
+		if migration.Version <= current {
+			continue
+		}
+
+		if err := migration.Up(ctx, db); err != nil {
+			return applied, fmt.Errorf("migration %04d_%s up: %w", migration.Version, migration.Name, err)
+		}
+		_, err := db.Collection("schema_migrations").InsertOne(ctx, bson.M{
+			"_id":        migration.Version,
+			"name":       migration.Name,
+			"applied_at": time.Now().UTC(),
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %04d_%s up: %w", migration.Version, migration.Name, err)
+		}
+		applied = append(applied, migration.Version)
+	}
+	return applied, nil
+}
+
+// migrateBooksToCopies turns every book stored before copies existed into a title
+// with a single copy, which keeps the book's ID as its ID and barcode. The loans of
+// the book move to that copy. Books already converted are skipped, so it can run again.
+func migrateBooksToCopies(ctx context.Context, db *mongo.Database) error {
+	books := db.Collection("books")
+	cursor, err := books.Find(ctx, bson.M{"status": bson.M{"$exists": true}})
+	if err != nil {
+		return err
+	}
+
+	var legacy []struct {
+		ID     primitive.ObjectID `bson:"_id"`
+		Status string             `bson:"status"`
+	}
+	if err := cursor.All(ctx, &legacy); err != nil {
+		return err
+	}
+
+	for _, book := range legacy {
+		_, err := db.Collection("copies").UpdateOne(ctx,
+			bson.M{"_id": book.ID},
+			bson.M{"$setOnInsert": entity.Copy{
+				ID:        book.ID,
+				TitleID:   book.ID.Hex(),
+				Barcode:   book.ID.Hex(),
+				Status:    book.Status,
+				Condition: "good",
+			}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("copy of book %s: %w", book.ID.Hex(), err)
+		}
+
+		_, err = db.Collection("borrowed_books").UpdateMany(ctx,
+			bson.M{"book_id": book.ID.Hex(), "copy_id": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"copy_id": book.ID.Hex()}},
+		)
+		if err != nil {
+			return fmt.Errorf("loans of book %s: %w", book.ID.Hex(), err)
+		}
+
+		// The copy holds the status from now on
+		_, err = books.UpdateOne(ctx, bson.M{"_id": book.ID}, bson.M{"$unset": bson.M{"status": ""}})
+		if err != nil {
+			return fmt.Errorf("book %s: %w", book.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// createIndexes creates the indexes of the collection. Indexes that already exist
+// with the same options are left as they are.
+func createIndexes(ctx context.Context, collection *mongo.Collection, indexes ...mongo.IndexModel) error {
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
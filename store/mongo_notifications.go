@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *MongoStore) CreateNotification(ctx context.Context, notification *entity.Notification) error {
+	if notification.ID.IsZero() {
+		notification.ID = primitive.NewObjectID()
+	}
+
+	// The unique index rejects a second notification of the kind and key to the user
+	_, err := s.notificationsCollection.InsertOne(ctx, notification)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+func (s *MongoStore) DeleteNotification(ctx context.Context, id string) error {
+	notificationID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	result, err := s.notificationsCollection.DeleteOne(ctx, bson.M{"_id": notificationID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) ListNotifications(ctx context.Context, filter NotificationFilter) ([]entity.Notification, error) {
+	query := bson.M{}
+	if filter.UserID != "" {
+		query["user_id"] = filter.UserID
+	}
+	if filter.Kind != "" {
+		query["kind"] = filter.Kind
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "sent_at", Value: -1}, {Key: "_id", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+	cursor, err := s.notificationsCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var notifications []entity.Notification
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+func (s *MongoStore) SetNotificationPreferences(ctx context.Context, prefs entity.NotificationPreferences) error {
+	_, err := s.notifyPrefsCollection.ReplaceOne(ctx, bson.M{"_id": prefs.UserID}, prefs, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoStore) GetNotificationPreferences(ctx context.Context, userID string) (*entity.NotificationPreferences, error) {
+	var prefs entity.NotificationPreferences
+	err := s.notifyPrefsCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&prefs)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
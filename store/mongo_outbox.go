@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RequireMongoReplicaSet returns an error if the client is connected to a standalone
+// server. The store writes changes and their outbox events in one transaction, which
+// needs a replica set or a sharded cluster.
+func RequireMongoReplicaSet(ctx context.Context, client *mongo.Client) error {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return err
+	}
+
+	// mongos answers isdbgrid
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return errors.New("MongoDB is a standalone server, the store needs a replica set for transactions: start mongod with --replSet and run rs.initiate()")
+	}
+	return nil
+}
+
+// withOutbox makes the change and adds the events in one transaction, which needs a
+// replica set, see RequireMongoReplicaSet.
+func (s *MongoStore) withOutbox(ctx context.Context, events []entity.OutboxEvent, change func(ctx context.Context) error) error {
+	if len(events) == 0 {
+		return change(ctx)
+	}
+	return s.withTransaction(ctx, func(ctx context.Context) error {
+		if err := change(ctx); err != nil {
+			return err
+		}
+		return s.addOutboxEvents(ctx, events)
+	})
+}
+
+// withTransaction makes the change in one transaction, retried by the driver on
+// transient errors.
+func (s *MongoStore) withTransaction(ctx context.Context, change func(ctx context.Context) error) error {
+	session, err := s.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		return nil, change(ctx)
+	})
+	return err
+}
+
+func (s *MongoStore) addOutboxEvents(ctx context.Context, events []entity.OutboxEvent) error {
+	for _, event := range events {
+		if event.ID.IsZero() {
+			event.ID = primitive.NewObjectID()
+		}
+
+		// In a transaction the counter stays locked until the commit
+		var counter struct {
+			Value int64 `bson:"value"`
+		}
+		err := s.outboxSeqCollection.FindOneAndUpdate(ctx,
+			bson.M{"_id": "outbox"},
+			bson.M{"$inc": bson.M{"value": 1}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&counter)
+		if err != nil {
+			return err
+		}
+		event.Seq = counter.Value
+
+		if _, err := s.outboxCollection.InsertOne(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MongoStore) ListOutboxEvents(ctx context.Context, filter OutboxFilter) ([]entity.OutboxEvent, error) {
+	query := bson.M{}
+	if filter.Pending {
+		query["delivered_at"] = nil
+	}
+	if filter.AfterSeq > 0 {
+		query["seq"] = bson.M{"$gt": filter.AfterSeq}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+	cursor, err := s.outboxCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []entity.OutboxEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (s *MongoStore) MarkOutboxEventDelivered(ctx context.Context, id string, at time.Time) error {
+	return s.updateOutboxEvent(ctx, id, bson.M{"$set": bson.M{"delivered_at": at}})
+}
+
+func (s *MongoStore) RecordOutboxFailure(ctx context.Context, id, message string) error {
+	return s.updateOutboxEvent(ctx, id, bson.M{"$inc": bson.M{"attempts": 1}, "$set": bson.M{"last_error": message}})
+}
+
+func (s *MongoStore) updateOutboxEvent(ctx context.Context, id string, update bson.M) error {
+	eventID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	result, err := s.outboxCollection.UpdateOne(ctx, bson.M{"_id": eventID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) DeleteOutboxEvents(ctx context.Context, before time.Time) error {
+	_, err := s.outboxCollection.DeleteMany(ctx, bson.M{"delivered_at": bson.M{"$lt": before}})
+	return err
+}
+
+func (s *MongoStore) LastOutboxSeq(ctx context.Context) (int64, error) {
+	var counter struct {
+		Value int64 `bson:"value"`
+	}
+	err := s.outboxSeqCollection.FindOne(ctx, bson.M{"_id": "outbox"}).Decode(&counter)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	return counter.Value, err
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *MongoStore) CreateRefreshToken(ctx context.Context, token *entity.RefreshToken) error {
+	if token.ID.IsZero() {
+		token.ID = primitive.NewObjectID()
+	}
+	_, err := s.refreshTokensCollection.InsertOne(ctx, token)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+func (s *MongoStore) GetRefreshToken(ctx context.Context, tokenHash string) (*entity.RefreshToken, error) {
+	var token entity.RefreshToken
+	err := s.refreshTokensCollection.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *MongoStore) RevokeRefreshToken(ctx context.Context, id string, revokedAt time.Time) error {
+	tokenID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	// Only revoke the token if nobody did it first
+	result, err := s.refreshTokensCollection.UpdateOne(ctx,
+		bson.M{"_id": tokenID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": revokedAt}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		count, err := s.refreshTokensCollection.CountDocuments(ctx, bson.M{"_id": tokenID})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *MongoStore) RevokeRefreshTokenFamily(ctx context.Context, familyID string, revokedAt time.Time) error {
+	_, err := s.refreshTokensCollection.UpdateMany(ctx,
+		bson.M{"family_id": familyID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": revokedAt}},
+	)
+	return err
+}
+
+func (s *MongoStore) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := s.revokedTokensCollection.UpdateOne(ctx,
+		bson.M{"_id": jti},
+		bson.M{"$set": bson.M{"expires_at": expiresAt}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (s *MongoStore) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	count, err := s.revokedTokensCollection.CountDocuments(ctx, bson.M{"_id": jti}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *MongoStore) DeleteExpiredSessions(ctx context.Context, before time.Time) error {
+	expired := bson.M{"expires_at": bson.M{"$lt": before}}
+	if _, err := s.refreshTokensCollection.DeleteMany(ctx, expired); err != nil {
+		return err
+	}
+	_, err := s.revokedTokensCollection.DeleteMany(ctx, expired)
+	return err
+}
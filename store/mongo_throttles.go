@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *MongoStore) GetLoginThrottle(ctx context.Context, key string) (*entity.LoginThrottle, error) {
+	var throttle entity.LoginThrottle
+	err := s.throttlesCollection.FindOne(ctx, bson.M{"_id": key}).Decode(&throttle)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+func (s *MongoStore) RecordLoginFailure(ctx context.Context, key string, at, resetBefore time.Time) (*entity.LoginThrottle, error) {
+	// An update pipeline reads the previous failure and writes the new count in one step
+	update := bson.A{bson.M{"$set": bson.M{
+		"failures": bson.M{"$cond": bson.A{
+			// $max skips a missing locked_until, and a new document has neither field
+			bson.M{"$lt": bson.A{bson.M{"$ifNull": bson.A{bson.M{"$max": bson.A{"$last_failure", "$locked_until"}}, time.Time{}}}, resetBefore}},
+			1,
+			bson.M{"$add": bson.A{"$failures", 1}},
+		}},
+		"last_failure": at,
+		"locked_until": bson.M{"$cond": bson.A{
+			bson.M{"$lt": bson.A{bson.M{"$ifNull": bson.A{bson.M{"$max": bson.A{"$last_failure", "$locked_until"}}, time.Time{}}}, resetBefore}},
+			nil,
+			"$locked_until",
+		}},
+	}}}
+
+	var throttle entity.LoginThrottle
+	err := s.throttlesCollection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&throttle)
+	if err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+func (s *MongoStore) LockLogin(ctx context.Context, key string, until time.Time) error {
+	result, err := s.throttlesCollection.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{"locked_until": until}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) ClearLoginThrottle(ctx context.Context, key string) error {
+	_, err := s.throttlesCollection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+func (s *MongoStore) CreateAuditEvent(ctx context.Context, event *entity.AuditEvent) error {
+	if event.ID.IsZero() {
+		event.ID = primitive.NewObjectID()
+	}
+	_, err := s.auditEventsCollection.InsertOne(ctx, event)
+	return err
+}
+
+func (s *MongoStore) ListAuditEvents(ctx context.Context, filter AuditFilter) ([]entity.AuditEvent, error) {
+	query := bson.M{}
+	if filter.Username != "" {
+		query["username"] = filter.Username
+	}
+	if filter.Type != "" {
+		query["type"] = filter.Type
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+
+	cursor, err := s.auditEventsCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []entity.AuditEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
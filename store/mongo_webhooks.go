@@ -0,0 +1,152 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *MongoStore) CreateWebhookSubscription(ctx context.Context, sub *entity.WebhookSubscription) error {
+	if sub.ID.IsZero() {
+		sub.ID = primitive.NewObjectID()
+	}
+	_, err := s.webhooksCollection.InsertOne(ctx, sub)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+func (s *MongoStore) GetWebhookSubscription(ctx context.Context, id string) (*entity.WebhookSubscription, error) {
+	subID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var sub entity.WebhookSubscription
+	err = s.webhooksCollection.FindOne(ctx, bson.M{"_id": subID}).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (s *MongoStore) ListWebhookSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := s.webhooksCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var subs []entity.WebhookSubscription
+	if err := cursor.All(ctx, &subs); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+func (s *MongoStore) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	subID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	result, err := s.webhooksCollection.DeleteOne(ctx, bson.M{"_id": subID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	_, err = s.deliveriesCollection.DeleteMany(ctx, bson.M{"subscription_id": id})
+	return err
+}
+
+func (s *MongoStore) CreateWebhookDelivery(ctx context.Context, delivery *entity.WebhookDelivery) error {
+	if _, err := s.GetWebhookSubscription(ctx, delivery.SubscriptionID); err != nil {
+		return err
+	}
+	if delivery.ID.IsZero() {
+		delivery.ID = primitive.NewObjectID()
+	}
+
+	// The unique index rejects a second delivery of the event to the subscription
+	_, err := s.deliveriesCollection.InsertOne(ctx, delivery)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+func (s *MongoStore) ListWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter) ([]entity.WebhookDelivery, error) {
+	query := bson.M{}
+	if filter.SubscriptionID != "" {
+		query["subscription_id"] = filter.SubscriptionID
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	sort := bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}
+	if !filter.DueBy.IsZero() {
+		query["status"] = entity.DeliveryPending
+		query["next_attempt_at"] = bson.M{"$lte": filter.DueBy}
+		sort = bson.D{{Key: "next_attempt_at", Value: 1}, {Key: "_id", Value: 1}}
+	}
+
+	opts := options.Find().SetSort(sort)
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+	cursor, err := s.deliveriesCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []entity.WebhookDelivery
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (s *MongoStore) UpdateWebhookDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	set := bson.M{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"last_error":      delivery.LastError,
+		"response_code":   delivery.ResponseCode,
+		"next_attempt_at": delivery.NextAttemptAt,
+	}
+	update := bson.M{"$set": set}
+	if delivery.DeliveredAt != nil {
+		set["delivered_at"] = *delivery.DeliveredAt
+	} else {
+		update["$unset"] = bson.M{"delivered_at": ""}
+	}
+
+	result, err := s.deliveriesCollection.UpdateOne(ctx, bson.M{"_id": delivery.ID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) DeleteWebhookDeliveries(ctx context.Context, before time.Time) error {
+	_, err := s.deliveriesCollection.DeleteMany(ctx, bson.M{
+		"status":     bson.M{"$ne": entity.DeliveryPending},
+		"created_at": bson.M{"$lt": before},
+	})
+	return err
+}
@@ -0,0 +1,647 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQL drivers supported by SQLStore
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// SQLStore stores users, titles, copies and loans in PostgreSQL or SQLite.
+// The schema is created by the migrations in the migrations directory.
+type SQLStore struct {
+	db *sql.DB
+}
+
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) CreateUser(ctx context.Context, user *entity.User) error {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO users (id, username, password, role, category, loan_version) VALUES ($1, $2, $3, $4, $5, $6)`,
+		user.ID.Hex(), user.Username, user.Password, user.Role, user.Category, user.LoanVersion,
+	)
+	if isUniqueViolation(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+func (s *SQLStore) GetUserByID(ctx context.Context, id string) (*entity.User, error) {
+	return s.findUser(ctx, `SELECT id, username, password, role, category, loan_version FROM users WHERE id = $1`, id)
+}
+
+func (s *SQLStore) GetUserByUsername(ctx context.Context, username string) (*entity.User, error) {
+	return s.findUser(ctx, `SELECT id, username, password, role, category, loan_version FROM users WHERE username = $1`, username)
+}
+
+func (s *SQLStore) findUser(ctx context.Context, query string, args ...interface{}) (*entity.User, error) {
+	var user entity.User
+	var id string
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&id, &user.Username, &user.Password, &user.Role, &user.Category, &user.LoanVersion)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *SQLStore) UpdateUserPassword(ctx context.Context, id, password string) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET password = $1 WHERE id = $2`, password, id)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (s *SQLStore) UpdateUserRole(ctx context.Context, id, role string) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET role = $1 WHERE id = $2`, role, id)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (s *SQLStore) UpdateUserCategory(ctx context.Context, id, category string) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET category = $1 WHERE id = $2`, category, id)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (s *SQLStore) CreateTitle(ctx context.Context, title *entity.Title, copies []entity.Copy, events ...entity.OutboxEvent) error {
+	if title.ID.IsZero() {
+		title.ID = primitive.NewObjectID()
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO books (id, title, author, isbn, published_date, item_type) VALUES ($1, $2, $3, $4, $5, $6)`,
+		title.ID.Hex(), title.Title, title.Author, title.ISBN, title.PublishedDate.UTC(), title.ItemType,
+	)
+	if isUniqueViolation(err) {
+		return ErrAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := range copies {
+		item := &copies[i]
+		item.TitleID = title.ID.Hex()
+		if item.ID.IsZero() {
+			item.ID = primitive.NewObjectID()
+		}
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO copies (id, title_id, barcode, status, condition, location) VALUES ($1, $2, $3, $4, $5, $6)`,
+			item.ID.Hex(), item.TitleID, item.Barcode, item.Status, item.Condition, item.Location,
+		)
+		if isUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := addOutboxEvents(ctx, tx, events); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const titleColumns = `id, title, author, isbn, published_date, item_type`
+
+func scanTitle(row interface{ Scan(...interface{}) error }) (entity.Title, error) {
+	var title entity.Title
+	var id string
+	err := row.Scan(&id, &title.Title, &title.Author, &title.ISBN, &title.PublishedDate, &title.ItemType)
+	if err != nil {
+		return title, err
+	}
+
+	title.ID, err = primitive.ObjectIDFromHex(id)
+	title.PublishedDate = title.PublishedDate.UTC()
+	return title, err
+}
+
+func (s *SQLStore) GetTitle(ctx context.Context, id string) (*entity.Title, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+titleColumns+` FROM books WHERE id = $1`, id)
+
+	title, err := scanTitle(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &title, nil
+}
+
+func (s *SQLStore) DeleteTitle(ctx context.Context, id string, events ...entity.OutboxEvent) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Copies are removed by the cascade, unless loans reference them
+	result, err := tx.ExecContext(ctx, `DELETE FROM books WHERE id = $1`, id)
+	if isForeignKeyViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	if err := requireRow(result); err != nil {
+		return err
+	}
+	if err := addOutboxEvents(ctx, tx, events); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) ListTitles(ctx context.Context, filter TitleFilter) ([]entity.Title, error) {
+	var where []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.CopyStatus != "" {
+		where = append(where, "id IN (SELECT title_id FROM copies WHERE status = "+arg(filter.CopyStatus)+")")
+	}
+	if filter.Author != "" {
+		where = append(where, "author = "+arg(filter.Author))
+	}
+	if filter.TitlePrefix != "" {
+		where = append(where, `LOWER(title) LIKE `+arg(escapeLike(strings.ToLower(filter.TitlePrefix))+"%")+` ESCAPE '\'`)
+	}
+	if !filter.PublishedFrom.IsZero() {
+		where = append(where, "published_date >= "+arg(filter.PublishedFrom.UTC()))
+	}
+	if !filter.PublishedTo.IsZero() {
+		where = append(where, "published_date <= "+arg(filter.PublishedTo.UTC()))
+	}
+	if filter.IDs != nil {
+		if len(filter.IDs) == 0 {
+			where = append(where, "1 = 0")
+		} else {
+			var placeholders []string
+			for _, id := range filter.IDs {
+				placeholders = append(placeholders, arg(id))
+			}
+			where = append(where, "id IN ("+strings.Join(placeholders, ", ")+")")
+		}
+	}
+	if filter.AfterID != "" {
+		title := arg(filter.AfterTitle)
+		where = append(where, "(title > "+title+" OR (title = "+title+" AND id > "+arg(filter.AfterID)+"))")
+	}
+
+	query := `SELECT ` + titleColumns + ` FROM books`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY title, id"
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var titles []entity.Title
+	for rows.Next() {
+		title, err := scanTitle(rows)
+		if err != nil {
+			return nil, err
+		}
+		titles = append(titles, title)
+	}
+	return titles, rows.Err()
+}
+
+func (s *SQLStore) CreateLoan(ctx context.Context, loan *entity.BorrowedBooks, events ...entity.OutboxEvent) error {
+	if loan.ID.IsZero() {
+		loan.ID = primitive.NewObjectID()
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO borrowed_books (id, book_id, copy_id, user_id, borrowed_date, return_date, returned_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		loan.ID.Hex(), loan.BookID, nullString(loan.CopyID), loan.UserID, loan.BorrowedDate, loan.ReturnDate, nullTime(loan.ReturnedAt),
+	)
+	if isUniqueViolation(err) {
+		return ErrAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+	if err := addOutboxEvents(ctx, tx, events); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) BorrowCopy(ctx context.Context, loan *entity.BorrowedBooks, from, holdID string, loanVersion int, borrowedAt time.Time, events ...entity.OutboxEvent) error {
+	if loan.ID.IsZero() {
+		loan.ID = primitive.NewObjectID()
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE copies SET status = $1 WHERE id = $2 AND status = $3`,
+		entity.CopyBorrowed, loan.CopyID, from,
+	)
+	if err != nil {
+		return err
+	}
+	if err := requireChange(result); err != nil {
+		return err
+	}
+
+	if holdID != "" {
+		result, err := tx.ExecContext(ctx,
+			`UPDATE holds SET status = $1, closed_at = $2 WHERE id = $3 AND status = $4 AND user_id = $5 AND copy_id = $6`,
+			entity.HoldFulfilled, borrowedAt.UTC(), holdID, entity.HoldReady, loan.UserID, loan.CopyID,
+		)
+		if err != nil {
+			return err
+		}
+		if err := requireChange(result); err != nil {
+			return err
+		}
+	}
+
+	result, err = tx.ExecContext(ctx,
+		`UPDATE users SET loan_version = loan_version + 1 WHERE id = $1 AND loan_version = $2`,
+		loan.UserID, loanVersion,
+	)
+	if err != nil {
+		return err
+	}
+	if err := requireChange(result); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO borrowed_books (id, book_id, copy_id, user_id, borrowed_date, return_date, returned_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		loan.ID.Hex(), loan.BookID, nullString(loan.CopyID), loan.UserID, loan.BorrowedDate, loan.ReturnDate, nullTime(loan.ReturnedAt),
+	)
+	if isUniqueViolation(err) {
+		return ErrAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+	if err := addOutboxEvents(ctx, tx, events); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const loanColumns = `id, book_id, copy_id, user_id, borrowed_date, return_date, returned_at`
+
+func scanLoan(row interface{ Scan(...interface{}) error }) (entity.BorrowedBooks, error) {
+	var loan entity.BorrowedBooks
+	var id string
+	var copyID sql.NullString
+	var returnedAt sql.NullTime
+	err := row.Scan(&id, &loan.BookID, &copyID, &loan.UserID, &loan.BorrowedDate, &loan.ReturnDate, &returnedAt)
+	if err != nil {
+		return loan, err
+	}
+
+	loan.CopyID = copyID.String
+	if returnedAt.Valid {
+		t := returnedAt.Time.UTC()
+		loan.ReturnedAt = &t
+	}
+	loan.ID, err = primitive.ObjectIDFromHex(id)
+	return loan, err
+}
+
+func (s *SQLStore) GetLoan(ctx context.Context, id string) (*entity.BorrowedBooks, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+loanColumns+` FROM borrowed_books WHERE id = $1`, id)
+
+	loan, err := scanLoan(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	loans := []entity.BorrowedBooks{loan}
+	if err := s.loadRenewals(ctx, loans); err != nil {
+		return nil, err
+	}
+	return &loans[0], nil
+}
+
+func (s *SQLStore) ListLoans(ctx context.Context, filter LoanFilter) ([]entity.BorrowedBooks, error) {
+	var where []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.UserID != "" {
+		where = append(where, "user_id = "+arg(filter.UserID))
+	}
+	if filter.BookID != "" {
+		where = append(where, "book_id = "+arg(filter.BookID))
+	}
+	switch filter.State {
+	case LoanOpen:
+		where = append(where, "returned_at IS NULL")
+	case LoanClosed:
+		where = append(where, "returned_at IS NOT NULL")
+	}
+	if filter.DueBefore != "" {
+		where = append(where, "return_date < "+arg(filter.DueBefore))
+	}
+
+	query := `SELECT ` + loanColumns + ` FROM borrowed_books`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY borrowed_date DESC, id DESC"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var loans []entity.BorrowedBooks
+	for rows.Next() {
+		loan, err := scanLoan(rows)
+		if err != nil {
+			return nil, err
+		}
+		loans = append(loans, loan)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadRenewals(ctx, loans); err != nil {
+		return nil, err
+	}
+	return loans, nil
+}
+
+// loadRenewals fills in the renewal history of the loans.
+func (s *SQLStore) loadRenewals(ctx context.Context, loans []entity.BorrowedBooks) error {
+	if len(loans) == 0 {
+		return nil
+	}
+
+	index := map[string]int{}
+	var args []interface{}
+	var placeholders []string
+	for i, loan := range loans {
+		index[loan.ID.Hex()] = i
+		args = append(args, loan.ID.Hex())
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT loan_id, renewed_at, renewed_by, previous_due_date, due_date FROM loan_renewals
+		WHERE loan_id IN (`+strings.Join(placeholders, ", ")+`) ORDER BY renewed_at, id`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var loanID string
+		var renewal entity.LoanRenewal
+		if err := rows.Scan(&loanID, &renewal.RenewedAt, &renewal.RenewedBy, &renewal.PreviousDueDate, &renewal.DueDate); err != nil {
+			return err
+		}
+		renewal.RenewedAt = renewal.RenewedAt.UTC()
+		i := index[loanID]
+		loans[i].Renewals = append(loans[i].Renewals, renewal)
+	}
+	return rows.Err()
+}
+
+func (s *SQLStore) CloseLoan(ctx context.Context, id string, returnedAt time.Time, events ...entity.OutboxEvent) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE borrowed_books SET returned_at = $1 WHERE id = $2 AND returned_at IS NULL`,
+		returnedAt.UTC(), id,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		var count int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM borrowed_books WHERE id = $1`, id).Scan(&count); err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+		return ErrConflict
+	}
+
+	if err := addOutboxEvents(ctx, tx, events); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) RenewLoan(ctx context.Context, id string, renewals int, renewal entity.LoanRenewal) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The renewal counter makes the update a compare-and-set on the history's length
+	result, err := tx.ExecContext(ctx,
+		`UPDATE borrowed_books SET return_date = $1, renewals = renewals + 1
+		WHERE id = $2 AND renewals = $3 AND returned_at IS NULL`,
+		renewal.DueDate, id, renewals,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		var count int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM borrowed_books WHERE id = $1`, id).Scan(&count); err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+		return ErrConflict
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO loan_renewals (id, loan_id, renewed_at, renewed_by, previous_due_date, due_date) VALUES ($1, $2, $3, $4, $5, $6)`,
+		primitive.NewObjectID().Hex(), id, renewal.RenewedAt.UTC(), renewal.RenewedBy, renewal.PreviousDueDate, renewal.DueDate,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// requireRowOrConflict tells a missing row (ErrNotFound) from a row that did not
+// match the update's condition (ErrConflict) when the update affected nothing.
+func (s *SQLStore) requireRowOrConflict(ctx context.Context, result sql.Result, countQuery string, id string) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	var count int
+	if err := s.db.QueryRowContext(ctx, countQuery, id).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return ErrConflict
+}
+
+func requireRow(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// requireChange returns ErrConflict when the conditional update affected nothing.
+func requireChange(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	return false
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23503"
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		// RESTRICT actions are reported as trigger constraints, check the primary code and message
+		return sqliteErr.Code()&0xff == sqlite3.SQLITE_CONSTRAINT && strings.Contains(sqliteErr.Error(), "FOREIGN KEY")
+	}
+	return false
+}
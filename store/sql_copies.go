@@ -0,0 +1,218 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *SQLStore) CreateCopy(ctx context.Context, item *entity.Copy, events ...entity.OutboxEvent) error {
+	if item.ID.IsZero() {
+		item.ID = primitive.NewObjectID()
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO copies (id, title_id, barcode, status, condition, location) VALUES ($1, $2, $3, $4, $5, $6)`,
+		item.ID.Hex(), item.TitleID, item.Barcode, item.Status, item.Condition, item.Location,
+	)
+	if isUniqueViolation(err) {
+		return ErrAlreadyExists
+	}
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := addOutboxEvents(ctx, tx, events); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const copyColumns = `id, title_id, barcode, status, condition, location`
+
+func scanCopy(row interface{ Scan(...interface{}) error }) (entity.Copy, error) {
+	var item entity.Copy
+	var id string
+	err := row.Scan(&id, &item.TitleID, &item.Barcode, &item.Status, &item.Condition, &item.Location)
+	if err != nil {
+		return item, err
+	}
+
+	item.ID, err = primitive.ObjectIDFromHex(id)
+	return item, err
+}
+
+func (s *SQLStore) GetCopy(ctx context.Context, id string) (*entity.Copy, error) {
+	return s.findCopy(ctx, `SELECT `+copyColumns+` FROM copies WHERE id = $1`, id)
+}
+
+func (s *SQLStore) GetCopyByBarcode(ctx context.Context, barcode string) (*entity.Copy, error) {
+	return s.findCopy(ctx, `SELECT `+copyColumns+` FROM copies WHERE barcode = $1`, barcode)
+}
+
+func (s *SQLStore) findCopy(ctx context.Context, query string, args ...interface{}) (*entity.Copy, error) {
+	item, err := scanCopy(s.db.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *SQLStore) ListCopies(ctx context.Context, filter CopyFilter) ([]entity.Copy, error) {
+	var where []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.TitleID != "" {
+		where = append(where, "title_id = "+arg(filter.TitleID))
+	}
+	if filter.Status != "" {
+		where = append(where, "status = "+arg(filter.Status))
+	}
+
+	query := `SELECT ` + copyColumns + ` FROM copies`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY barcode"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var copies []entity.Copy
+	for rows.Next() {
+		item, err := scanCopy(rows)
+		if err != nil {
+			return nil, err
+		}
+		copies = append(copies, item)
+	}
+	return copies, rows.Err()
+}
+
+func (s *SQLStore) CountCopies(ctx context.Context, titleIDs []string) (map[string]CopyCounts, error) {
+	counts := map[string]CopyCounts{}
+	if len(titleIDs) == 0 {
+		return counts, nil
+	}
+
+	args := []interface{}{entity.CopyAvailable}
+	var placeholders []string
+	for _, id := range titleIDs {
+		args = append(args, id)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT title_id, COUNT(*), SUM(CASE WHEN status = $1 THEN 1 ELSE 0 END) FROM copies
+		WHERE title_id IN (`+strings.Join(placeholders, ", ")+`) GROUP BY title_id`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var titleID string
+		var count CopyCounts
+		if err := rows.Scan(&titleID, &count.Total, &count.Available); err != nil {
+			return nil, err
+		}
+		counts[titleID] = count
+	}
+	return counts, rows.Err()
+}
+
+func (s *SQLStore) UpdateCopyStatus(ctx context.Context, id, from, to string, events ...entity.OutboxEvent) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var result sql.Result
+	if from == "" {
+		result, err = tx.ExecContext(ctx, `UPDATE copies SET status = $1 WHERE id = $2`, to, id)
+	} else {
+		result, err = tx.ExecContext(ctx, `UPDATE copies SET status = $1 WHERE id = $2 AND status = $3`, to, id, from)
+	}
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		var count int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM copies WHERE id = $1`, id).Scan(&count); err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+		return ErrConflict
+	}
+
+	if err := addOutboxEvents(ctx, tx, events); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) UpdateCopyDetails(ctx context.Context, id, condition, location string) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE copies SET condition = $1, location = $2 WHERE id = $3`,
+		condition, location, id,
+	)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (s *SQLStore) DeleteCopy(ctx context.Context, id string, events ...entity.OutboxEvent) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM copies WHERE id = $1`, id)
+	if isForeignKeyViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	if err := requireRow(result); err != nil {
+		return err
+	}
+	if err := addOutboxEvents(ctx, tx, events); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
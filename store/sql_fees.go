@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *SQLStore) CreateFeeTransaction(ctx context.Context, entry *entity.FeeTransaction) error {
+	if entry.ID.IsZero() {
+		entry.ID = primitive.NewObjectID()
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO fee_transactions (id, user_id, kind, amount, loan_id, charge_id, note, created_by, created_at, idempotency_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		entry.ID.Hex(), entry.UserID, entry.Kind, entry.Amount, nullString(entry.LoanID), nullString(entry.ChargeID),
+		entry.Note, entry.CreatedBy, entry.CreatedAt.UTC(), nullString(entry.IdempotencyKey),
+	)
+	if isUniqueViolation(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+const feeColumns = `id, user_id, kind, amount, loan_id, charge_id, note, created_by, created_at, idempotency_key`
+
+func scanFeeTransaction(row interface{ Scan(...interface{}) error }) (entity.FeeTransaction, error) {
+	var entry entity.FeeTransaction
+	var id string
+	var loanID, chargeID, key sql.NullString
+	err := row.Scan(&id, &entry.UserID, &entry.Kind, &entry.Amount, &loanID, &chargeID,
+		&entry.Note, &entry.CreatedBy, &entry.CreatedAt, &key)
+	if err != nil {
+		return entry, err
+	}
+
+	entry.ID, err = primitive.ObjectIDFromHex(id)
+	entry.LoanID = loanID.String
+	entry.ChargeID = chargeID.String
+	entry.IdempotencyKey = key.String
+	entry.CreatedAt = entry.CreatedAt.UTC()
+	return entry, err
+}
+
+func (s *SQLStore) GetFeeTransaction(ctx context.Context, id string) (*entity.FeeTransaction, error) {
+	entry, err := scanFeeTransaction(s.db.QueryRowContext(ctx, `SELECT `+feeColumns+` FROM fee_transactions WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (s *SQLStore) ListFeeTransactions(ctx context.Context, filter FeeFilter) ([]entity.FeeTransaction, error) {
+	var where []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.UserID != "" {
+		where = append(where, "user_id = "+arg(filter.UserID))
+	}
+	if filter.LoanID != "" {
+		where = append(where, "loan_id = "+arg(filter.LoanID))
+	}
+	if filter.ChargeID != "" {
+		where = append(where, "charge_id = "+arg(filter.ChargeID))
+	}
+	if filter.Kind != "" {
+		where = append(where, "kind = "+arg(filter.Kind))
+	}
+
+	query := `SELECT ` + feeColumns + ` FROM fee_transactions`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at, id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []entity.FeeTransaction
+	for rows.Next() {
+		entry, err := scanFeeTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SQLStore) FeeBalance(ctx context.Context, userID string) (int64, error) {
+	var balance int64
+	err := s.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(amount), 0) FROM fee_transactions WHERE user_id = $1`, userID).Scan(&balance)
+	return balance, err
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *SQLStore) CreateHold(ctx context.Context, hold *entity.Hold) error {
+	if hold.ID.IsZero() {
+		hold.ID = primitive.NewObjectID()
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO holds (id, title_id, user_id, status, copy_id, created_at, ready_at, pickup_by, closed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		hold.ID.Hex(), hold.TitleID, hold.UserID, hold.Status, nullString(hold.CopyID), hold.CreatedAt.UTC(),
+		nullTime(hold.ReadyAt), nullTime(hold.PickupBy), nullTime(hold.ClosedAt),
+	)
+	if isUniqueViolation(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+const holdColumns = `id, title_id, user_id, status, copy_id, created_at, ready_at, pickup_by, closed_at`
+
+func scanHold(row interface{ Scan(...interface{}) error }) (entity.Hold, error) {
+	var hold entity.Hold
+	var id string
+	var copyID sql.NullString
+	var readyAt, pickupBy, closedAt sql.NullTime
+	err := row.Scan(&id, &hold.TitleID, &hold.UserID, &hold.Status, &copyID, &hold.CreatedAt, &readyAt, &pickupBy, &closedAt)
+	if err != nil {
+		return hold, err
+	}
+
+	hold.ID, err = primitive.ObjectIDFromHex(id)
+	hold.CopyID = copyID.String
+	hold.CreatedAt = hold.CreatedAt.UTC()
+	hold.ReadyAt = timePtr(readyAt)
+	hold.PickupBy = timePtr(pickupBy)
+	hold.ClosedAt = timePtr(closedAt)
+	return hold, err
+}
+
+func (s *SQLStore) GetHold(ctx context.Context, id string) (*entity.Hold, error) {
+	hold, err := scanHold(s.db.QueryRowContext(ctx, `SELECT `+holdColumns+` FROM holds WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+func (s *SQLStore) ListHolds(ctx context.Context, filter HoldFilter) ([]entity.Hold, error) {
+	var where []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.TitleID != "" {
+		where = append(where, "title_id = "+arg(filter.TitleID))
+	}
+	if filter.UserID != "" {
+		where = append(where, "user_id = "+arg(filter.UserID))
+	}
+	if filter.CopyID != "" {
+		where = append(where, "copy_id = "+arg(filter.CopyID))
+	}
+	if len(filter.Statuses) > 0 {
+		var placeholders []string
+		for _, status := range filter.Statuses {
+			placeholders = append(placeholders, arg(status))
+		}
+		where = append(where, "status IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if !filter.PickupBefore.IsZero() {
+		where = append(where, "pickup_by < "+arg(filter.PickupBefore.UTC()))
+	}
+
+	query := `SELECT ` + holdColumns + ` FROM holds`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at, id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holds []entity.Hold
+	for rows.Next() {
+		hold, err := scanHold(rows)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+	return holds, rows.Err()
+}
+
+func (s *SQLStore) ReadyHold(ctx context.Context, id, copyID string, readyAt, pickupBy time.Time, events ...entity.OutboxEvent) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE holds SET status = $1, copy_id = $2, ready_at = $3, pickup_by = $4 WHERE id = $5 AND status = $6`,
+		entity.HoldReady, copyID, readyAt.UTC(), pickupBy.UTC(), id, entity.HoldWaiting,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		var count int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM holds WHERE id = $1`, id).Scan(&count); err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+		return ErrConflict
+	}
+
+	if err := addOutboxEvents(ctx, tx, events); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) CloseHold(ctx context.Context, id, from, to string, closedAt time.Time) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE holds SET status = $1, closed_at = $2 WHERE id = $3 AND status = $4`,
+		to, closedAt.UTC(), id, from,
+	)
+	if err != nil {
+		return err
+	}
+	return s.requireRowOrConflict(ctx, result, `SELECT COUNT(*) FROM holds WHERE id = $1`, id)
+}
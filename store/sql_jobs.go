@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *SQLStore) CreateJobRun(ctx context.Context, run *entity.JobRun) error {
+	if run.ID.IsZero() {
+		run.ID = primitive.NewObjectID()
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO job_runs (id, job, scheduled_at, started_at, finished_at, status, error, checked, changed, summary, instance, triggered_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		run.ID.Hex(), run.Job, run.ScheduledAt.UTC(), run.StartedAt.UTC(), nullTime(run.FinishedAt), run.Status,
+		run.Error, run.Result.Checked, run.Result.Changed, run.Result.Summary, run.Instance, run.TriggeredBy,
+	)
+	if isUniqueViolation(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+func (s *SQLStore) FinishJobRun(ctx context.Context, run *entity.JobRun) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE job_runs SET status = $1, error = $2, checked = $3, changed = $4, summary = $5, finished_at = $6
+		WHERE id = $7 AND status = $8`,
+		run.Status, run.Error, run.Result.Checked, run.Result.Changed, run.Result.Summary, nullTime(run.FinishedAt),
+		run.ID.Hex(), entity.JobRunning,
+	)
+	if err != nil {
+		return err
+	}
+	return s.requireRowOrConflict(ctx, result, `SELECT COUNT(*) FROM job_runs WHERE id = $1`, run.ID.Hex())
+}
+
+const jobRunColumns = `id, job, scheduled_at, started_at, finished_at, status, error, checked, changed, summary, instance, triggered_by`
+
+func scanJobRun(row interface{ Scan(...interface{}) error }) (entity.JobRun, error) {
+	var run entity.JobRun
+	var id string
+	var finishedAt sql.NullTime
+	err := row.Scan(&id, &run.Job, &run.ScheduledAt, &run.StartedAt, &finishedAt, &run.Status, &run.Error,
+		&run.Result.Checked, &run.Result.Changed, &run.Result.Summary, &run.Instance, &run.TriggeredBy)
+	if err != nil {
+		return run, err
+	}
+
+	run.ID, err = primitive.ObjectIDFromHex(id)
+	run.ScheduledAt = run.ScheduledAt.UTC()
+	run.StartedAt = run.StartedAt.UTC()
+	run.FinishedAt = timePtr(finishedAt)
+	return run, err
+}
+
+func (s *SQLStore) GetJobRun(ctx context.Context, id string) (*entity.JobRun, error) {
+	run, err := scanJobRun(s.db.QueryRowContext(ctx, `SELECT `+jobRunColumns+` FROM job_runs WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (s *SQLStore) ListJobRuns(ctx context.Context, filter JobRunFilter) ([]entity.JobRun, error) {
+	var where []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.Job != "" {
+		where = append(where, "job = "+arg(filter.Job))
+	}
+	if filter.Status != "" {
+		where = append(where, "status = "+arg(filter.Status))
+	}
+
+	query := `SELECT ` + jobRunColumns + ` FROM job_runs`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY scheduled_at DESC, id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []entity.JobRun
+	for rows.Next() {
+		run, err := scanJobRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+func (s *SQLStore) DeleteJobRuns(ctx context.Context, before time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM job_runs WHERE finished_at < $1`, before.UTC())
+	return err
+}
+
+func (s *SQLStore) AcquireJobLease(ctx context.Context, job, holder string, now, until time.Time) error {
+	result, err := s.db.ExecContext(ctx,
+		`INSERT INTO job_leases (job, holder, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (job) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+		WHERE job_leases.holder = excluded.holder OR job_leases.expires_at <= $4`,
+		job, holder, until.UTC(), now.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *SQLStore) ReleaseJobLease(ctx context.Context, job, holder string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM job_leases WHERE job = $1 AND holder = $2`, job, holder)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *SQLStore) GetJobLease(ctx context.Context, job string) (*entity.JobLease, error) {
+	var lease entity.JobLease
+	err := s.db.QueryRowContext(ctx, `SELECT job, holder, expires_at FROM job_leases WHERE job = $1`, job).
+		Scan(&lease.Job, &lease.Holder, &lease.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	lease.ExpiresAt = lease.ExpiresAt.UTC()
+	return &lease, nil
+}
+
+func (s *SQLStore) SetJobState(ctx context.Context, state entity.JobState) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO job_states (job, paused, updated_by, updated_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (job) DO UPDATE SET paused = excluded.paused, updated_by = excluded.updated_by, updated_at = excluded.updated_at`,
+		state.Job, state.Paused, state.UpdatedBy, state.UpdatedAt.UTC(),
+	)
+	return err
+}
+
+func (s *SQLStore) GetJobState(ctx context.Context, job string) (*entity.JobState, error) {
+	var state entity.JobState
+	err := s.db.QueryRowContext(ctx, `SELECT job, paused, updated_by, updated_at FROM job_states WHERE job = $1`, job).
+		Scan(&state.Job, &state.Paused, &state.UpdatedBy, &state.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	state.UpdatedAt = state.UpdatedAt.UTC()
+	return &state, nil
+}
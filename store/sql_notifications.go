@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Channels and muted kinds are stored as comma separated lists
+func joinList(values []string) string {
+	return strings.Join(values, ",")
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func (s *SQLStore) CreateNotification(ctx context.Context, notification *entity.Notification) error {
+	if notification.ID.IsZero() {
+		notification.ID = primitive.NewObjectID()
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO notifications (id, user_id, kind, dedup_key, channels, subject, sent_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		notification.ID.Hex(), notification.UserID, notification.Kind, notification.Key,
+		joinList(notification.Channels), notification.Subject, notification.SentAt.UTC(),
+	)
+	if isUniqueViolation(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+func (s *SQLStore) DeleteNotification(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM notifications WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) ListNotifications(ctx context.Context, filter NotificationFilter) ([]entity.Notification, error) {
+	var where []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.UserID != "" {
+		where = append(where, "user_id = "+arg(filter.UserID))
+	}
+	if filter.Kind != "" {
+		where = append(where, "kind = "+arg(filter.Kind))
+	}
+
+	query := `SELECT id, user_id, kind, dedup_key, channels, subject, sent_at FROM notifications`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY sent_at DESC, id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []entity.Notification
+	for rows.Next() {
+		var notification entity.Notification
+		var id, channels string
+		err := rows.Scan(&id, &notification.UserID, &notification.Kind, &notification.Key,
+			&channels, &notification.Subject, &notification.SentAt)
+		if err != nil {
+			return nil, err
+		}
+		if notification.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+			return nil, err
+		}
+		notification.Channels = splitList(channels)
+		notification.SentAt = notification.SentAt.UTC()
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
+
+func (s *SQLStore) SetNotificationPreferences(ctx context.Context, prefs entity.NotificationPreferences) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO notification_preferences (user_id, email, channels, muted, updated_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE SET email = excluded.email, channels = excluded.channels,
+			muted = excluded.muted, updated_at = excluded.updated_at`,
+		prefs.UserID, prefs.Email, joinList(prefs.Channels), joinList(prefs.Muted), prefs.UpdatedAt.UTC(),
+	)
+	return err
+}
+
+func (s *SQLStore) GetNotificationPreferences(ctx context.Context, userID string) (*entity.NotificationPreferences, error) {
+	var prefs entity.NotificationPreferences
+	var channels, muted string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT user_id, email, channels, muted, updated_at FROM notification_preferences WHERE user_id = $1`, userID).
+		Scan(&prefs.UserID, &prefs.Email, &channels, &muted, &prefs.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	prefs.Channels = splitList(channels)
+	prefs.Muted = splitList(muted)
+	prefs.UpdatedAt = prefs.UpdatedAt.UTC()
+	return &prefs, nil
+}
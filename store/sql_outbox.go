@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// addOutboxEvents inserts the events in the transaction of the change they describe.
+// Taking the sequence numbers locks the counter until the transaction ends.
+func addOutboxEvents(ctx context.Context, tx *sql.Tx, events []entity.OutboxEvent) error {
+	for _, event := range events {
+		if event.ID.IsZero() {
+			event.ID = primitive.NewObjectID()
+		}
+		err := tx.QueryRowContext(ctx, `UPDATE outbox_sequence SET value = value + 1 WHERE id = 1 RETURNING value`).Scan(&event.Seq)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO outbox_events (id, seq, type, book_id, payload, created_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+			event.ID.Hex(), event.Seq, event.Type, event.BookID, string(event.Payload), event.CreatedAt.UTC(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) ListOutboxEvents(ctx context.Context, filter OutboxFilter) ([]entity.OutboxEvent, error) {
+	var where []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.Pending {
+		where = append(where, "delivered_at IS NULL")
+	}
+	if filter.AfterSeq > 0 {
+		where = append(where, "seq > "+arg(filter.AfterSeq))
+	}
+
+	query := `SELECT id, seq, type, book_id, payload, created_at, attempts, last_error, delivered_at FROM outbox_events`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY seq"
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []entity.OutboxEvent
+	for rows.Next() {
+		var event entity.OutboxEvent
+		var id, payload string
+		var deliveredAt sql.NullTime
+		err := rows.Scan(&id, &event.Seq, &event.Type, &event.BookID, &payload, &event.CreatedAt,
+			&event.Attempts, &event.LastError, &deliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		if event.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+			return nil, err
+		}
+		event.Payload = []byte(payload)
+		event.CreatedAt = event.CreatedAt.UTC()
+		event.DeliveredAt = timePtr(deliveredAt)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (s *SQLStore) MarkOutboxEventDelivered(ctx context.Context, id string, at time.Time) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE outbox_events SET delivered_at = $1 WHERE id = $2`, at.UTC(), id)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (s *SQLStore) RecordOutboxFailure(ctx context.Context, id, message string) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE outbox_events SET attempts = attempts + 1, last_error = $1 WHERE id = $2`,
+		message, id,
+	)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (s *SQLStore) DeleteOutboxEvents(ctx context.Context, before time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM outbox_events WHERE delivered_at < $1`, before.UTC())
+	return err
+}
+
+func (s *SQLStore) LastOutboxSeq(ctx context.Context) (int64, error) {
+	var seq int64
+	err := s.db.QueryRowContext(ctx, `SELECT value FROM outbox_sequence WHERE id = 1`).Scan(&seq)
+	return seq, err
+}
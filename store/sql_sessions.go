@@ -0,0 +1,92 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *SQLStore) CreateRefreshToken(ctx context.Context, token *entity.RefreshToken) error {
+	if token.ID.IsZero() {
+		token.ID = primitive.NewObjectID()
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (id, token_hash, user_id, family_id, created_at, expires_at, revoked_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		token.ID.Hex(), token.TokenHash, token.UserID, token.FamilyID, token.CreatedAt.UTC(), token.ExpiresAt.UTC(), nullTime(token.RevokedAt),
+	)
+	if isUniqueViolation(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+func (s *SQLStore) GetRefreshToken(ctx context.Context, tokenHash string) (*entity.RefreshToken, error) {
+	var token entity.RefreshToken
+	var id string
+	var revokedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, token_hash, user_id, family_id, created_at, expires_at, revoked_at FROM refresh_tokens WHERE token_hash = $1`,
+		tokenHash,
+	).Scan(&id, &token.TokenHash, &token.UserID, &token.FamilyID, &token.CreatedAt, &token.ExpiresAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token.CreatedAt = token.CreatedAt.UTC()
+	token.ExpiresAt = token.ExpiresAt.UTC()
+	if revokedAt.Valid {
+		t := revokedAt.Time.UTC()
+		token.RevokedAt = &t
+	}
+	token.ID, err = primitive.ObjectIDFromHex(id)
+	return &token, err
+}
+
+func (s *SQLStore) RevokeRefreshToken(ctx context.Context, id string, revokedAt time.Time) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`,
+		revokedAt.UTC(), id,
+	)
+	if err != nil {
+		return err
+	}
+	return s.requireRowOrConflict(ctx, result, `SELECT COUNT(*) FROM refresh_tokens WHERE id = $1`, id)
+}
+
+func (s *SQLStore) RevokeRefreshTokenFamily(ctx context.Context, familyID string, revokedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`,
+		revokedAt.UTC(), familyID,
+	)
+	return err
+}
+
+func (s *SQLStore) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`,
+		jti, expiresAt.UTC(),
+	)
+	return err
+}
+
+func (s *SQLStore) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM revoked_tokens WHERE jti = $1`, jti).Scan(&count)
+	return count > 0, err
+}
+
+func (s *SQLStore) DeleteExpiredSessions(ctx context.Context, before time.Time) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE expires_at < $1`, before.UTC()); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < $1`, before.UTC())
+	return err
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func scanThrottle(row interface{ Scan(...interface{}) error }) (*entity.LoginThrottle, error) {
+	var throttle entity.LoginThrottle
+	var lockedUntil sql.NullTime
+	if err := row.Scan(&throttle.Key, &throttle.Failures, &throttle.LastFailure, &lockedUntil); err != nil {
+		return nil, err
+	}
+
+	throttle.LastFailure = throttle.LastFailure.UTC()
+	if lockedUntil.Valid {
+		t := lockedUntil.Time.UTC()
+		throttle.LockedUntil = &t
+	}
+	return &throttle, nil
+}
+
+func (s *SQLStore) GetLoginThrottle(ctx context.Context, key string) (*entity.LoginThrottle, error) {
+	throttle, err := scanThrottle(s.db.QueryRowContext(ctx,
+		`SELECT key, failures, last_failure, locked_until FROM login_throttles WHERE key = $1`, key,
+	))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return throttle, err
+}
+
+func (s *SQLStore) RecordLoginFailure(ctx context.Context, key string, at, resetBefore time.Time) (*entity.LoginThrottle, error) {
+	return scanThrottle(s.db.QueryRowContext(ctx,
+		`INSERT INTO login_throttles (key, failures, last_failure) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failure < $3 AND (login_throttles.locked_until IS NULL OR login_throttles.locked_until < $3)
+				THEN 1 ELSE login_throttles.failures + 1 END,
+			locked_until = CASE WHEN login_throttles.last_failure < $3 AND (login_throttles.locked_until IS NULL OR login_throttles.locked_until < $3)
+				THEN NULL ELSE login_throttles.locked_until END,
+			last_failure = $2
+		RETURNING key, failures, last_failure, locked_until`,
+		key, at.UTC(), resetBefore.UTC(),
+	))
+}
+
+func (s *SQLStore) LockLogin(ctx context.Context, key string, until time.Time) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE login_throttles SET locked_until = $1 WHERE key = $2`,
+		until.UTC(), key,
+	)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (s *SQLStore) ClearLoginThrottle(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM login_throttles WHERE key = $1`, key)
+	return err
+}
+
+func (s *SQLStore) CreateAuditEvent(ctx context.Context, event *entity.AuditEvent) error {
+	if event.ID.IsZero() {
+		event.ID = primitive.NewObjectID()
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO audit_events (id, type, username, ip, actor_id, detail, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		event.ID.Hex(), event.Type, event.Username, event.IP, event.ActorID, event.Detail, event.CreatedAt.UTC(),
+	)
+	return err
+}
+
+func (s *SQLStore) ListAuditEvents(ctx context.Context, filter AuditFilter) ([]entity.AuditEvent, error) {
+	var where []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.Username != "" {
+		where = append(where, "username = "+arg(filter.Username))
+	}
+	if filter.Type != "" {
+		where = append(where, "type = "+arg(filter.Type))
+	}
+
+	query := `SELECT id, type, username, ip, actor_id, detail, created_at FROM audit_events`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []entity.AuditEvent
+	for rows.Next() {
+		var event entity.AuditEvent
+		var id string
+		if err := rows.Scan(&id, &event.Type, &event.Username, &event.IP, &event.ActorID, &event.Detail, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.CreatedAt = event.CreatedAt.UTC()
+		if event.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *SQLStore) CreateWebhookSubscription(ctx context.Context, sub *entity.WebhookSubscription) error {
+	if sub.ID.IsZero() {
+		sub.ID = primitive.NewObjectID()
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO webhook_subscriptions (id, url, event_types, secret, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		sub.ID.Hex(), sub.URL, joinList(sub.EventTypes), sub.Secret, sub.CreatedBy, sub.CreatedAt.UTC(),
+	)
+	if isUniqueViolation(err) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+const webhookSubscriptionColumns = `id, url, event_types, secret, created_by, created_at`
+
+func scanWebhookSubscription(row interface{ Scan(...interface{}) error }) (entity.WebhookSubscription, error) {
+	var sub entity.WebhookSubscription
+	var id, eventTypes string
+	err := row.Scan(&id, &sub.URL, &eventTypes, &sub.Secret, &sub.CreatedBy, &sub.CreatedAt)
+	if err != nil {
+		return sub, err
+	}
+
+	sub.EventTypes = splitList(eventTypes)
+	sub.CreatedAt = sub.CreatedAt.UTC()
+	sub.ID, err = primitive.ObjectIDFromHex(id)
+	return sub, err
+}
+
+func (s *SQLStore) GetWebhookSubscription(ctx context.Context, id string) (*entity.WebhookSubscription, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions WHERE id = $1`, id)
+	sub, err := scanWebhookSubscription(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (s *SQLStore) ListWebhookSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []entity.WebhookSubscription
+	for rows.Next() {
+		sub, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// DeleteWebhookSubscription relies on the foreign key to delete the deliveries.
+func (s *SQLStore) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (s *SQLStore) CreateWebhookDelivery(ctx context.Context, delivery *entity.WebhookDelivery) error {
+	if delivery.ID.IsZero() {
+		delivery.ID = primitive.NewObjectID()
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO webhook_deliveries (id, subscription_id, event_id, event_type, payload, status, attempts,
+			last_error, response_code, created_at, next_attempt_at, delivered_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		delivery.ID.Hex(), delivery.SubscriptionID, delivery.EventID, delivery.EventType, string(delivery.Payload),
+		delivery.Status, delivery.Attempts, delivery.LastError, delivery.ResponseCode,
+		delivery.CreatedAt.UTC(), delivery.NextAttemptAt.UTC(), nullTime(delivery.DeliveredAt),
+	)
+	if isUniqueViolation(err) {
+		return ErrAlreadyExists
+	}
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *SQLStore) ListWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter) ([]entity.WebhookDelivery, error) {
+	var where []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.SubscriptionID != "" {
+		where = append(where, "subscription_id = "+arg(filter.SubscriptionID))
+	}
+	if filter.Status != "" {
+		where = append(where, "status = "+arg(filter.Status))
+	}
+	order := " ORDER BY created_at DESC, id DESC"
+	if !filter.DueBy.IsZero() {
+		where = append(where, "status = "+arg(entity.DeliveryPending), "next_attempt_at <= "+arg(filter.DueBy.UTC()))
+		order = " ORDER BY next_attempt_at, id"
+	}
+
+	query := `SELECT id, subscription_id, event_id, event_type, payload, status, attempts, last_error, response_code,
+		created_at, next_attempt_at, delivered_at FROM webhook_deliveries`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += order
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []entity.WebhookDelivery
+	for rows.Next() {
+		var delivery entity.WebhookDelivery
+		var id, payload string
+		var deliveredAt sql.NullTime
+		err := rows.Scan(&id, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &payload,
+			&delivery.Status, &delivery.Attempts, &delivery.LastError, &delivery.ResponseCode,
+			&delivery.CreatedAt, &delivery.NextAttemptAt, &deliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		if delivery.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+			return nil, err
+		}
+		delivery.Payload = []byte(payload)
+		delivery.CreatedAt = delivery.CreatedAt.UTC()
+		delivery.NextAttemptAt = delivery.NextAttemptAt.UTC()
+		delivery.DeliveredAt = timePtr(deliveredAt)
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *SQLStore) UpdateWebhookDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET status = $1, attempts = $2, last_error = $3, response_code = $4,
+			next_attempt_at = $5, delivered_at = $6 WHERE id = $7`,
+		delivery.Status, delivery.Attempts, delivery.LastError, delivery.ResponseCode,
+		delivery.NextAttemptAt.UTC(), nullTime(delivery.DeliveredAt), delivery.ID.Hex(),
+	)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+func (s *SQLStore) DeleteWebhookDeliveries(ctx context.Context, before time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM webhook_deliveries WHERE status <> $1 AND created_at < $2`,
+		entity.DeliveryPending, before.UTC(),
+	)
+	return err
+}
@@ -0,0 +1,353 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gc2-yugo/entity"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists is returned when a record with the same unique key exists.
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrConflict is returned when a conditional update did not match the current state.
+	ErrConflict = errors.New("conflict")
+)
+
+// Store groups all the storage backends the server needs.
+type Store interface {
+	UserStore
+	BookStore
+	LoanStore
+	HoldStore
+	SessionStore
+	ThrottleStore
+	AuditStore
+	FeeStore
+	JobStore
+	NotificationStore
+	OutboxStore
+	WebhookStore
+}
+
+type UserStore interface {
+	// CreateUser inserts the user and sets its ID. It returns ErrAlreadyExists if the username is taken.
+	CreateUser(ctx context.Context, user *entity.User) error
+	GetUserByID(ctx context.Context, id string) (*entity.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*entity.User, error)
+	// UpdateUserPassword replaces the stored password hash of the user.
+	UpdateUserPassword(ctx context.Context, id, password string) error
+	UpdateUserRole(ctx context.Context, id, role string) error
+	// UpdateUserCategory sets the circulation category of the user, empty clears it.
+	UpdateUserCategory(ctx context.Context, id, category string) error
+}
+
+// BookStore keeps the titles of the catalogue and their physical copies.
+type BookStore interface {
+	// CreateTitle inserts the title with its copies, setting the IDs that are not set
+	// yet and the title ID of the copies, and adds the events to the outbox in the same
+	// operation. It returns ErrAlreadyExists and stores nothing if the title exists or
+	// a barcode is taken.
+	CreateTitle(ctx context.Context, title *entity.Title, copies []entity.Copy, events ...entity.OutboxEvent) error
+	GetTitle(ctx context.Context, id string) (*entity.Title, error)
+	// DeleteTitle removes the title and its copies and adds the events to the outbox.
+	// Backends enforcing foreign keys return ErrConflict if loans still reference them.
+	DeleteTitle(ctx context.Context, id string, events ...entity.OutboxEvent) error
+	// ListTitles returns the titles matching the filter, sorted by title then ID.
+	ListTitles(ctx context.Context, filter TitleFilter) ([]entity.Title, error)
+
+	// CreateCopy inserts the copy, setting its ID if it is not set yet. It returns
+	// ErrNotFound if the title does not exist and ErrAlreadyExists if the barcode is taken.
+	CreateCopy(ctx context.Context, item *entity.Copy, events ...entity.OutboxEvent) error
+	GetCopy(ctx context.Context, id string) (*entity.Copy, error)
+	GetCopyByBarcode(ctx context.Context, barcode string) (*entity.Copy, error)
+	// ListCopies returns the copies matching the filter, sorted by barcode.
+	ListCopies(ctx context.Context, filter CopyFilter) ([]entity.Copy, error)
+	// CountCopies returns the number of copies of each of the titles, titles without copies are left out.
+	CountCopies(ctx context.Context, titleIDs []string) (map[string]CopyCounts, error)
+	// UpdateCopyStatus sets the copy's status to "to" only if it currently is "from",
+	// or unconditionally if "from" is empty. It returns ErrConflict if the status did not match.
+	UpdateCopyStatus(ctx context.Context, id, from, to string, events ...entity.OutboxEvent) error
+	UpdateCopyDetails(ctx context.Context, id, condition, location string) error
+	// DeleteCopy removes the copy. Backends enforcing foreign keys return ErrConflict
+	// if loans still reference it.
+	DeleteCopy(ctx context.Context, id string, events ...entity.OutboxEvent) error
+}
+
+type LoanStore interface {
+	// CreateLoan inserts the loan, setting its ID if it is not set yet, and adds the
+	// events to the outbox in the same operation.
+	CreateLoan(ctx context.Context, loan *entity.BorrowedBooks, events ...entity.OutboxEvent) error
+	// BorrowCopy lends the loan's copy: it moves the copy from the "from" status to
+	// borrowed, closes the user's ready hold holdID keeping the copy as fulfilled when
+	// holdID is set, moves the user's loan version on from loanVersion, inserts the loan
+	// and adds the events, all in one transaction. It returns ErrConflict and changes
+	// nothing if the copy, the hold or the user's loan version changed meanwhile.
+	BorrowCopy(ctx context.Context, loan *entity.BorrowedBooks, from, holdID string, loanVersion int, borrowedAt time.Time, events ...entity.OutboxEvent) error
+	GetLoan(ctx context.Context, id string) (*entity.BorrowedBooks, error)
+	// ListLoans returns the loans matching the filter, most recently borrowed first.
+	ListLoans(ctx context.Context, filter LoanFilter) ([]entity.BorrowedBooks, error)
+	// CloseLoan stamps the loan's returned-at time and adds the events to the outbox.
+	// It returns ErrConflict if the loan is already closed, and adds no events then.
+	CloseLoan(ctx context.Context, id string, returnedAt time.Time, events ...entity.OutboxEvent) error
+	// RenewLoan moves the loan's due date to the renewal's and appends the renewal to its
+	// history. renewals is the number of renewals the caller saw, it returns ErrConflict
+	// if the loan was renewed meanwhile or is closed.
+	RenewLoan(ctx context.Context, id string, renewals int, renewal entity.LoanRenewal) error
+}
+
+// TitleFilter selects titles in ListTitles. Zero-valued fields match everything.
+type TitleFilter struct {
+	// CopyStatus only matches titles with at least one copy in this status.
+	CopyStatus    string
+	Author        string
+	TitlePrefix   string // case-insensitive
+	PublishedFrom time.Time
+	PublishedTo   time.Time
+	// IDs restricts the result to the given title IDs when non-nil; an empty slice matches nothing.
+	IDs []string
+	// AfterTitle and AfterID resume the listing after the given title.
+	AfterTitle string
+	AfterID    string
+	Limit      int
+}
+
+type LoanState int
+
+const (
+	LoanAny LoanState = iota
+	LoanOpen
+	LoanClosed
+)
+
+// CopyFilter selects copies in ListCopies. Zero-valued fields match everything.
+type CopyFilter struct {
+	TitleID string
+	Status  string
+}
+
+// CopyCounts summarises the copies of a title.
+type CopyCounts struct {
+	Total     int
+	Available int
+}
+
+// LoanFilter selects loans in ListLoans. Zero-valued fields match everything.
+type LoanFilter struct {
+	UserID    string
+	BookID    string
+	State     LoanState
+	DueBefore string // only loans due before this date (YYYY-MM-DD)
+}
+
+// HoldStore keeps the queues of patrons waiting for a title.
+type HoldStore interface {
+	// CreateHold inserts the hold and sets its ID. It returns ErrAlreadyExists if the user
+	// already has a waiting or ready hold on the title.
+	CreateHold(ctx context.Context, hold *entity.Hold) error
+	GetHold(ctx context.Context, id string) (*entity.Hold, error)
+	// ListHolds returns the matching holds in queue order, oldest first.
+	ListHolds(ctx context.Context, filter HoldFilter) ([]entity.Hold, error)
+	// ReadyHold keeps the copy for a waiting hold until pickupBy. It returns ErrConflict
+	// if the hold is no longer waiting.
+	ReadyHold(ctx context.Context, id, copyID string, readyAt, pickupBy time.Time, events ...entity.OutboxEvent) error
+	// CloseHold moves the hold from status "from" to the final status "to". It returns
+	// ErrConflict if the status did not match.
+	CloseHold(ctx context.Context, id, from, to string, closedAt time.Time) error
+}
+
+// HoldFilter selects holds in ListHolds. Zero-valued fields match everything.
+type HoldFilter struct {
+	TitleID  string
+	UserID   string
+	CopyID   string
+	Statuses []string // any of these statuses
+	// PickupBefore only matches holds whose pickup deadline is before this time.
+	PickupBefore time.Time
+}
+
+// SessionStore keeps the refresh tokens and the access tokens revoked before they expire.
+type SessionStore interface {
+	// CreateRefreshToken inserts the token and sets its ID.
+	CreateRefreshToken(ctx context.Context, token *entity.RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (*entity.RefreshToken, error)
+	// RevokeRefreshToken revokes one token. It returns ErrConflict if the token was already
+	// revoked, so a token can only be exchanged once.
+	RevokeRefreshToken(ctx context.Context, id string, revokedAt time.Time) error
+	// RevokeRefreshTokenFamily revokes every token of the family that is not revoked yet.
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string, revokedAt time.Time) error
+
+	// RevokeAccessToken denies the access token with the jti until it expires. Revoking twice is not an error.
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+
+	// DeleteExpiredSessions removes refresh tokens and revoked access tokens that expired before the time.
+	DeleteExpiredSessions(ctx context.Context, before time.Time) error
+}
+
+// ThrottleStore counts failed logins per key, a username or a client IP.
+type ThrottleStore interface {
+	// GetLoginThrottle returns ErrNotFound when the key has no recorded failures.
+	GetLoginThrottle(ctx context.Context, key string) (*entity.LoginThrottle, error)
+	// RecordLoginFailure atomically adds a failure and returns the new state. The count
+	// starts over when both the previous failure and the end of the lockout are before
+	// resetBefore, so a lockout longer than the failure window still escalates.
+	RecordLoginFailure(ctx context.Context, key string, at, resetBefore time.Time) (*entity.LoginThrottle, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	// ClearLoginThrottle forgets the failures and the lockout of the key. Clearing an unknown key is not an error.
+	ClearLoginThrottle(ctx context.Context, key string) error
+}
+
+type AuditStore interface {
+	// CreateAuditEvent inserts the event and sets its ID.
+	CreateAuditEvent(ctx context.Context, event *entity.AuditEvent) error
+	// ListAuditEvents returns the matching events, newest first.
+	ListAuditEvents(ctx context.Context, filter AuditFilter) ([]entity.AuditEvent, error)
+}
+
+// AuditFilter selects audit events. Zero fields match everything.
+type AuditFilter struct {
+	Username string
+	Type     string
+	Limit    int
+}
+
+// FeeStore keeps the fee ledgers of the users. Entries can only be added.
+type FeeStore interface {
+	// CreateFeeTransaction inserts the entry and sets its ID. It returns ErrAlreadyExists
+	// if an entry with the same idempotency key exists.
+	CreateFeeTransaction(ctx context.Context, entry *entity.FeeTransaction) error
+	GetFeeTransaction(ctx context.Context, id string) (*entity.FeeTransaction, error)
+	// ListFeeTransactions returns the matching entries, oldest first.
+	ListFeeTransactions(ctx context.Context, filter FeeFilter) ([]entity.FeeTransaction, error)
+	// FeeBalance returns the sum of the user's entries, what the user owes.
+	FeeBalance(ctx context.Context, userID string) (int64, error)
+}
+
+// FeeFilter selects fee transactions. Zero fields match everything.
+type FeeFilter struct {
+	UserID   string
+	LoanID   string
+	ChargeID string
+	Kind     string
+}
+
+// JobStore keeps the history of the scheduled jobs' runs, the leases of the instances
+// running them and the jobs' states.
+type JobStore interface {
+	// CreateJobRun inserts the run and sets its ID. It returns ErrAlreadyExists if the
+	// job already has a run scheduled at the same time.
+	CreateJobRun(ctx context.Context, run *entity.JobRun) error
+	// FinishJobRun records the status, error, result and finish time of a running run.
+	// It returns ErrConflict if the run already finished.
+	FinishJobRun(ctx context.Context, run *entity.JobRun) error
+	GetJobRun(ctx context.Context, id string) (*entity.JobRun, error)
+	// ListJobRuns returns the matching runs, most recently scheduled first.
+	ListJobRuns(ctx context.Context, filter JobRunFilter) ([]entity.JobRun, error)
+	// DeleteJobRuns removes the runs that finished before the time.
+	DeleteJobRuns(ctx context.Context, before time.Time) error
+
+	// AcquireJobLease gives the job's lease to the holder until the time, if it is free,
+	// expired at now or already held by the holder, which renews it. It returns
+	// ErrConflict if another holder has the lease.
+	AcquireJobLease(ctx context.Context, job, holder string, now, until time.Time) error
+	// ReleaseJobLease frees the lease if the holder has it. It returns ErrConflict if not.
+	ReleaseJobLease(ctx context.Context, job, holder string) error
+	// GetJobLease returns ErrNotFound when the job's lease is free.
+	GetJobLease(ctx context.Context, job string) (*entity.JobLease, error)
+
+	// SetJobState creates or replaces the state of the job.
+	SetJobState(ctx context.Context, state entity.JobState) error
+	// GetJobState returns ErrNotFound when the job's state was never set.
+	GetJobState(ctx context.Context, job string) (*entity.JobState, error)
+}
+
+// JobRunFilter selects job runs. Zero fields match everything.
+type JobRunFilter struct {
+	Job    string
+	Status string
+	Limit  int
+}
+
+// NotificationStore keeps the notification preferences of users and the
+// notifications sent to them.
+type NotificationStore interface {
+	// CreateNotification records the notification and sets its ID. It returns
+	// ErrAlreadyExists if the user already got a notification of the kind and key.
+	CreateNotification(ctx context.Context, notification *entity.Notification) error
+	// DeleteNotification forgets a notification, so it can be sent again.
+	DeleteNotification(ctx context.Context, id string) error
+	// ListNotifications returns the matching notifications, most recently sent first.
+	ListNotifications(ctx context.Context, filter NotificationFilter) ([]entity.Notification, error)
+
+	// SetNotificationPreferences creates or replaces the preferences of the user.
+	SetNotificationPreferences(ctx context.Context, prefs entity.NotificationPreferences) error
+	// GetNotificationPreferences returns ErrNotFound when the user never set any.
+	GetNotificationPreferences(ctx context.Context, userID string) (*entity.NotificationPreferences, error)
+}
+
+type NotificationFilter struct {
+	UserID string
+	Kind   string
+	Limit  int // 0 for all
+}
+
+// OutboxStore keeps the domain events waiting to be relayed to other systems. The
+// events are added by the methods making the changes they describe, and get their
+// IDs and sequence numbers there. The sequence numbers increase in commit order.
+type OutboxStore interface {
+	// ListOutboxEvents returns the matching events in sequence order.
+	ListOutboxEvents(ctx context.Context, filter OutboxFilter) ([]entity.OutboxEvent, error)
+	// MarkOutboxEventDelivered stamps the delivery time of the event.
+	MarkOutboxEventDelivered(ctx context.Context, id string, at time.Time) error
+	// RecordOutboxFailure counts a failed delivery of the event and keeps its error.
+	RecordOutboxFailure(ctx context.Context, id, message string) error
+	// DeleteOutboxEvents removes the events delivered before the time.
+	DeleteOutboxEvents(ctx context.Context, before time.Time) error
+	// LastOutboxSeq returns the sequence number of the last event added, 0 before the
+	// first. Events pruned since keep their number taken.
+	LastOutboxSeq(ctx context.Context) (int64, error)
+}
+
+// OutboxFilter selects outbox events. Zero fields match everything.
+type OutboxFilter struct {
+	Pending  bool  // only the events not delivered yet
+	AfterSeq int64 // only the events with a greater sequence number
+	Limit    int
+}
+
+// WebhookStore keeps the webhook subscriptions of partners and the log of the
+// deliveries to them.
+type WebhookStore interface {
+	// CreateWebhookSubscription inserts the subscription and sets its ID.
+	CreateWebhookSubscription(ctx context.Context, sub *entity.WebhookSubscription) error
+	GetWebhookSubscription(ctx context.Context, id string) (*entity.WebhookSubscription, error)
+	// ListWebhookSubscriptions returns every subscription, oldest first.
+	ListWebhookSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error)
+	// DeleteWebhookSubscription removes the subscription with its deliveries.
+	DeleteWebhookSubscription(ctx context.Context, id string) error
+
+	// CreateWebhookDelivery inserts the delivery and sets its ID. It returns
+	// ErrAlreadyExists if the subscription already has a delivery of the event.
+	CreateWebhookDelivery(ctx context.Context, delivery *entity.WebhookDelivery) error
+	// ListWebhookDeliveries returns the matching deliveries, newest first, or the
+	// most overdue first when DueBy is set.
+	ListWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter) ([]entity.WebhookDelivery, error)
+	// UpdateWebhookDelivery records an attempt: it saves the status, attempts, last
+	// error, response code, next attempt and delivery time of the delivery.
+	UpdateWebhookDelivery(ctx context.Context, delivery entity.WebhookDelivery) error
+	// DeleteWebhookDeliveries removes the delivered and dead deliveries created
+	// before the time.
+	DeleteWebhookDeliveries(ctx context.Context, before time.Time) error
+}
+
+// WebhookDeliveryFilter selects webhook deliveries. Zero fields match everything.
+type WebhookDeliveryFilter struct {
+	SubscriptionID string
+	Status         string
+	DueBy          time.Time // only the pending deliveries whose next attempt is due by then
+	Limit          int
+}
@@ -0,0 +1,1404 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"gc2-yugo/entity"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Every backend must behave the same, run the same checks against each of them
+func forEachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryStore())
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, NewSQLStore(openSQLite(t)))
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("TEST_POSTGRES_URL")
+		if dsn == "" {
+			t.Skip("TEST_POSTGRES_URL not set")
+		}
+		db, err := sql.Open(DriverPostgres, dsn)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			MigrateDown(context.Background(), db, 1000)
+			db.Close()
+		})
+
+		_, err = MigrateUp(context.Background(), db)
+		require.NoError(t, err)
+		test(t, NewSQLStore(db))
+	})
+
+	t.Run("mongo", func(t *testing.T) {
+		test(t, NewMongoStore(openMongo(t)))
+	})
+}
+
+// openMongo returns a new migrated database of the replica set at TEST_MONGO_URL,
+// dropped after the test.
+func openMongo(t *testing.T) *mongo.Database {
+	uri := os.Getenv("TEST_MONGO_URL")
+	if uri == "" {
+		t.Skip("TEST_MONGO_URL not set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	require.NoError(t, err)
+	db := client.Database("test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		db.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+	require.NoError(t, RequireMongoReplicaSet(ctx, client))
+
+	_, err = MigrateMongoUp(ctx, db)
+	require.NoError(t, err)
+	return db
+}
+
+func openSQLite(t *testing.T) *sql.DB {
+	db, err := sql.Open(DriverSQLite, "file:"+t.TempDir()+"/test.db?_pragma=foreign_keys(1)")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = MigrateUp(context.Background(), db)
+	require.NoError(t, err)
+	return db
+}
+
+func date(value string) time.Time {
+	t, _ := time.Parse("2006-01-02", value)
+	return t
+}
+
+func TestUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		user := entity.User{Username: "peter", Password: "secret", Role: "admin", Category: "staff"}
+		require.NoError(t, s.CreateUser(ctx, &user))
+		assert.False(t, user.ID.IsZero())
+
+		duplicate := entity.User{Username: "peter", Password: "other"}
+		assert.ErrorIs(t, s.CreateUser(ctx, &duplicate), ErrAlreadyExists)
+
+		found, err := s.GetUserByUsername(ctx, "peter")
+		require.NoError(t, err)
+		assert.Equal(t, user, *found)
+
+		found, err = s.GetUserByID(ctx, user.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, user, *found)
+
+		_, err = s.GetUserByUsername(ctx, "mary")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		require.NoError(t, s.UpdateUserPassword(ctx, user.ID.Hex(), "hashed"))
+		found, err = s.GetUserByID(ctx, user.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, "hashed", found.Password)
+
+		assert.ErrorIs(t, s.UpdateUserPassword(ctx, primitive.NewObjectID().Hex(), "hashed"), ErrNotFound)
+
+		require.NoError(t, s.UpdateUserRole(ctx, user.ID.Hex(), "librarian"))
+		found, err = s.GetUserByID(ctx, user.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, "librarian", found.Role)
+		assert.Equal(t, "hashed", found.Password)
+
+		assert.ErrorIs(t, s.UpdateUserRole(ctx, primitive.NewObjectID().Hex(), "admin"), ErrNotFound)
+
+		require.NoError(t, s.UpdateUserCategory(ctx, user.ID.Hex(), "student"))
+		found, err = s.GetUserByID(ctx, user.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, "student", found.Category)
+		assert.Equal(t, "librarian", found.Role)
+
+		assert.ErrorIs(t, s.UpdateUserCategory(ctx, primitive.NewObjectID().Hex(), "student"), ErrNotFound)
+	})
+}
+
+func TestTitles(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		titles := []entity.Title{
+			{Title: "Dune", Author: "Frank Herbert", ISBN: "9780441013593", PublishedDate: date("1965-08-01"), ItemType: "book"},
+			{Title: "Dune Messiah", Author: "Frank Herbert", PublishedDate: date("1969-10-15")},
+			{Title: "Neuromancer", Author: "William Gibson", PublishedDate: date("1984-07-01")},
+			{Title: "100%_Pure", Author: "Someone", PublishedDate: date("2001-01-01")},
+		}
+		for i := range titles {
+			require.NoError(t, s.CreateTitle(ctx, &titles[i], nil))
+		}
+		statuses := []string{entity.CopyAvailable, entity.CopyBorrowed, entity.CopyAvailable, entity.CopyAvailable}
+		for i, status := range statuses {
+			item := entity.Copy{TitleID: titles[i].ID.Hex(), Barcode: fmt.Sprintf("B%d", i), Status: status, Condition: entity.ConditionGood}
+			require.NoError(t, s.CreateCopy(ctx, &item))
+		}
+
+		found, err := s.GetTitle(ctx, titles[0].ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, titles[0], *found)
+
+		list, err := s.ListTitles(ctx, TitleFilter{TitlePrefix: "DUNE"})
+		require.NoError(t, err)
+		assert.Len(t, list, 2)
+
+		// LIKE wildcards in the prefix are matched literally
+		list, err = s.ListTitles(ctx, TitleFilter{TitlePrefix: "100%_"})
+		require.NoError(t, err)
+		assert.Len(t, list, 1)
+		list, err = s.ListTitles(ctx, TitleFilter{TitlePrefix: "1_0"})
+		require.NoError(t, err)
+		assert.Len(t, list, 0)
+
+		list, err = s.ListTitles(ctx, TitleFilter{CopyStatus: entity.CopyAvailable, PublishedFrom: date("1965-08-01"), PublishedTo: date("1984-07-01")})
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+		assert.Equal(t, "Dune", list[0].Title)
+		assert.Equal(t, "Neuromancer", list[1].Title)
+
+		list, err = s.ListTitles(ctx, TitleFilter{IDs: []string{}})
+		require.NoError(t, err)
+		assert.Len(t, list, 0)
+
+		// Resume after the second title, in title order
+		list, err = s.ListTitles(ctx, TitleFilter{AfterTitle: "Dune", AfterID: titles[0].ID.Hex(), Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, "Dune Messiah", list[0].Title)
+
+		// Removing a title removes its copies
+		assert.NoError(t, s.DeleteTitle(ctx, titles[2].ID.Hex()))
+		assert.ErrorIs(t, s.DeleteTitle(ctx, titles[2].ID.Hex()), ErrNotFound)
+		_, err = s.GetTitle(ctx, titles[2].ID.Hex())
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.GetCopyByBarcode(ctx, "B2")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestCopies(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		dune := entity.Title{Title: "Dune", Author: "Frank Herbert", PublishedDate: date("1965-08-01")}
+		neuromancer := entity.Title{Title: "Neuromancer", Author: "William Gibson", PublishedDate: date("1984-07-01")}
+		require.NoError(t, s.CreateTitle(ctx, &dune, nil))
+		require.NoError(t, s.CreateTitle(ctx, &neuromancer, nil))
+
+		copies := []entity.Copy{
+			{TitleID: dune.ID.Hex(), Barcode: "D2", Status: entity.CopyAvailable, Condition: entity.ConditionGood, Location: "SF-HER"},
+			{TitleID: dune.ID.Hex(), Barcode: "D1", Status: entity.CopyBorrowed, Condition: entity.ConditionNew},
+			{TitleID: dune.ID.Hex(), Barcode: "D3", Status: entity.CopyLost, Condition: entity.ConditionPoor},
+			{TitleID: neuromancer.ID.Hex(), Barcode: "N1", Status: entity.CopyBorrowed, Condition: entity.ConditionFair},
+		}
+		for i := range copies {
+			require.NoError(t, s.CreateCopy(ctx, &copies[i]))
+		}
+
+		// Barcodes are unique and copies need a title
+		duplicate := entity.Copy{TitleID: neuromancer.ID.Hex(), Barcode: "D1", Status: entity.CopyAvailable, Condition: entity.ConditionNew}
+		assert.ErrorIs(t, s.CreateCopy(ctx, &duplicate), ErrAlreadyExists)
+		orphan := entity.Copy{TitleID: primitive.NewObjectID().Hex(), Barcode: "X1", Status: entity.CopyAvailable, Condition: entity.ConditionNew}
+		assert.ErrorIs(t, s.CreateCopy(ctx, &orphan), ErrNotFound)
+
+		// A title is stored with all of its copies or not at all
+		emma := entity.Title{Title: "Emma", Author: "Jane Austen", PublishedDate: date("1815-12-23")}
+		clash := []entity.Copy{
+			{Barcode: "E1", Status: entity.CopyAvailable, Condition: entity.ConditionNew},
+			{Barcode: "N1", Status: entity.CopyAvailable, Condition: entity.ConditionNew},
+		}
+		assert.ErrorIs(t, s.CreateTitle(ctx, &emma, clash), ErrAlreadyExists)
+		_, err := s.GetTitle(ctx, emma.ID.Hex())
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.GetCopyByBarcode(ctx, "E1")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		emmaCopies := []entity.Copy{{Barcode: "E1", Status: entity.CopyAvailable, Condition: entity.ConditionNew}}
+		require.NoError(t, s.CreateTitle(ctx, &emma, emmaCopies))
+		found, err := s.GetCopyByBarcode(ctx, "E1")
+		require.NoError(t, err)
+		assert.Equal(t, emmaCopies[0], *found)
+		assert.Equal(t, emma.ID.Hex(), found.TitleID)
+
+		found, err = s.GetCopy(ctx, copies[0].ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, copies[0], *found)
+		found, err = s.GetCopyByBarcode(ctx, "N1")
+		require.NoError(t, err)
+		assert.Equal(t, copies[3], *found)
+		_, err = s.GetCopyByBarcode(ctx, "X1")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		list, err := s.ListCopies(ctx, CopyFilter{TitleID: dune.ID.Hex()})
+		require.NoError(t, err)
+		require.Len(t, list, 3)
+		assert.Equal(t, []string{"D1", "D2", "D3"}, []string{list[0].Barcode, list[1].Barcode, list[2].Barcode})
+		list, err = s.ListCopies(ctx, CopyFilter{Status: entity.CopyBorrowed})
+		require.NoError(t, err)
+		assert.Len(t, list, 2)
+
+		counts, err := s.CountCopies(ctx, []string{dune.ID.Hex(), neuromancer.ID.Hex(), primitive.NewObjectID().Hex()})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]CopyCounts{
+			dune.ID.Hex():        {Total: 3, Available: 1},
+			neuromancer.ID.Hex(): {Total: 1, Available: 0},
+		}, counts)
+
+		assert.ErrorIs(t, s.UpdateCopyStatus(ctx, copies[1].ID.Hex(), entity.CopyAvailable, entity.CopyBorrowed), ErrConflict)
+		assert.NoError(t, s.UpdateCopyStatus(ctx, copies[0].ID.Hex(), entity.CopyAvailable, entity.CopyBorrowed))
+		assert.NoError(t, s.UpdateCopyStatus(ctx, copies[0].ID.Hex(), "", entity.CopyAvailable))
+		assert.ErrorIs(t, s.UpdateCopyStatus(ctx, primitive.NewObjectID().Hex(), "", entity.CopyAvailable), ErrNotFound)
+
+		require.NoError(t, s.UpdateCopyDetails(ctx, copies[2].ID.Hex(), entity.ConditionDamaged, "Repairs"))
+		found, err = s.GetCopy(ctx, copies[2].ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, entity.ConditionDamaged, found.Condition)
+		assert.Equal(t, "Repairs", found.Location)
+		assert.ErrorIs(t, s.UpdateCopyDetails(ctx, primitive.NewObjectID().Hex(), entity.ConditionGood, ""), ErrNotFound)
+
+		assert.NoError(t, s.DeleteCopy(ctx, copies[2].ID.Hex()))
+		assert.ErrorIs(t, s.DeleteCopy(ctx, copies[2].ID.Hex()), ErrNotFound)
+	})
+}
+
+func TestLoans(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		user := entity.User{Username: "peter", Password: "secret"}
+		require.NoError(t, s.CreateUser(ctx, &user))
+		book := entity.Title{Title: "Dune", Author: "Frank Herbert", PublishedDate: date("1965-08-01")}
+		require.NoError(t, s.CreateTitle(ctx, &book, nil))
+		item := entity.Copy{TitleID: book.ID.Hex(), Barcode: "D1", Status: entity.CopyBorrowed, Condition: entity.ConditionGood}
+		require.NoError(t, s.CreateCopy(ctx, &item))
+
+		first := entity.BorrowedBooks{BookID: book.ID.Hex(), CopyID: item.ID.Hex(), UserID: user.ID.Hex(), BorrowedDate: "2024-01-01", ReturnDate: "2024-01-08"}
+		second := entity.BorrowedBooks{BookID: book.ID.Hex(), CopyID: item.ID.Hex(), UserID: user.ID.Hex(), BorrowedDate: "2024-02-01", ReturnDate: "2024-02-08"}
+		require.NoError(t, s.CreateLoan(ctx, &first))
+		require.NoError(t, s.CreateLoan(ctx, &second))
+
+		returnedAt := time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC)
+		require.NoError(t, s.CloseLoan(ctx, first.ID.Hex(), returnedAt))
+		assert.ErrorIs(t, s.CloseLoan(ctx, first.ID.Hex(), returnedAt), ErrConflict)
+
+		found, err := s.GetLoan(ctx, first.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, item.ID.Hex(), found.CopyID)
+		require.NotNil(t, found.ReturnedAt)
+		assert.True(t, returnedAt.Equal(*found.ReturnedAt))
+
+		// Most recently borrowed first
+		loans, err := s.ListLoans(ctx, LoanFilter{UserID: user.ID.Hex()})
+		require.NoError(t, err)
+		require.Len(t, loans, 2)
+		assert.Equal(t, second.ID, loans[0].ID)
+
+		loans, err = s.ListLoans(ctx, LoanFilter{State: LoanOpen, DueBefore: "2024-03-01"})
+		require.NoError(t, err)
+		require.Len(t, loans, 1)
+		assert.Equal(t, second.ID, loans[0].ID)
+
+		loans, err = s.ListLoans(ctx, LoanFilter{BookID: book.ID.Hex(), State: LoanClosed})
+		require.NoError(t, err)
+		require.Len(t, loans, 1)
+		assert.Equal(t, first.ID, loans[0].ID)
+
+		// Renewals move the due date and are kept in order
+		renewedAt := time.Date(2024, 2, 7, 9, 0, 0, 0, time.UTC)
+		renewal := entity.LoanRenewal{RenewedAt: renewedAt, RenewedBy: user.ID.Hex(), PreviousDueDate: "2024-02-08", DueDate: "2024-02-15"}
+		require.NoError(t, s.RenewLoan(ctx, second.ID.Hex(), 0, renewal))
+		assert.ErrorIs(t, s.RenewLoan(ctx, second.ID.Hex(), 0, renewal), ErrConflict)
+		again := entity.LoanRenewal{RenewedAt: renewedAt.Add(24 * time.Hour), RenewedBy: "librarian", PreviousDueDate: "2024-02-15", DueDate: "2024-02-22"}
+		require.NoError(t, s.RenewLoan(ctx, second.ID.Hex(), 1, again))
+
+		found, err = s.GetLoan(ctx, second.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, "2024-02-22", found.ReturnDate)
+		require.Len(t, found.Renewals, 2)
+		assert.Equal(t, renewal, found.Renewals[0])
+		assert.Equal(t, again, found.Renewals[1])
+
+		loans, err = s.ListLoans(ctx, LoanFilter{UserID: user.ID.Hex()})
+		require.NoError(t, err)
+		assert.Len(t, loans[0].Renewals, 2)
+		assert.Empty(t, loans[1].Renewals)
+
+		// Closed loans cannot be renewed
+		assert.ErrorIs(t, s.RenewLoan(ctx, first.ID.Hex(), 0, renewal), ErrConflict)
+		assert.ErrorIs(t, s.RenewLoan(ctx, primitive.NewObjectID().Hex(), 0, renewal), ErrNotFound)
+	})
+}
+
+func TestBorrowCopy(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		peter := entity.User{Username: "peter", Password: "secret"}
+		require.NoError(t, s.CreateUser(ctx, &peter))
+		mary := entity.User{Username: "mary", Password: "secret"}
+		require.NoError(t, s.CreateUser(ctx, &mary))
+		book := entity.Title{Title: "Dune", Author: "Frank Herbert", PublishedDate: date("1965-08-01")}
+		require.NoError(t, s.CreateTitle(ctx, &book, nil))
+		available := entity.Copy{TitleID: book.ID.Hex(), Barcode: "D1", Status: entity.CopyAvailable, Condition: entity.ConditionGood}
+		require.NoError(t, s.CreateCopy(ctx, &available))
+		kept := entity.Copy{TitleID: book.ID.Hex(), Barcode: "D2", Status: entity.CopyOnHold, Condition: entity.ConditionGood}
+		require.NoError(t, s.CreateCopy(ctx, &kept))
+		spare := entity.Copy{TitleID: book.ID.Hex(), Barcode: "D3", Status: entity.CopyAvailable, Condition: entity.ConditionGood}
+		require.NoError(t, s.CreateCopy(ctx, &spare))
+
+		created := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+		hold := entity.Hold{TitleID: book.ID.Hex(), UserID: peter.ID.Hex(), Status: entity.HoldWaiting, CreatedAt: created}
+		require.NoError(t, s.CreateHold(ctx, &hold))
+		require.NoError(t, s.ReadyHold(ctx, hold.ID.Hex(), kept.ID.Hex(), created, created.Add(72*time.Hour)))
+
+		borrowedAt := created.Add(time.Hour)
+		event := entity.OutboxEvent{Type: entity.EventBookBorrowed, BookID: book.ID.Hex(), Payload: []byte(`{}`), CreatedAt: borrowedAt}
+		loan := entity.BorrowedBooks{BookID: book.ID.Hex(), CopyID: available.ID.Hex(), UserID: mary.ID.Hex(), BorrowedDate: "2024-01-01", ReturnDate: "2024-01-08"}
+		require.NoError(t, s.BorrowCopy(ctx, &loan, entity.CopyAvailable, "", 0, borrowedAt, event))
+		assert.False(t, loan.ID.IsZero())
+		found, err := s.GetCopy(ctx, available.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, entity.CopyBorrowed, found.Status)
+		borrower, err := s.GetUserByID(ctx, mary.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, 1, borrower.LoanVersion)
+
+		// The user borrowed meanwhile, the rules must be checked again
+		stale := entity.BorrowedBooks{BookID: book.ID.Hex(), CopyID: spare.ID.Hex(), UserID: mary.ID.Hex(), BorrowedDate: "2024-01-01", ReturnDate: "2024-01-08"}
+		assert.ErrorIs(t, s.BorrowCopy(ctx, &stale, entity.CopyAvailable, "", 0, borrowedAt, event), ErrConflict)
+		found, err = s.GetCopy(ctx, spare.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, entity.CopyAvailable, found.Status)
+
+		// The copy is gone, nothing else is written
+		again := entity.BorrowedBooks{BookID: book.ID.Hex(), CopyID: available.ID.Hex(), UserID: peter.ID.Hex(), BorrowedDate: "2024-01-01", ReturnDate: "2024-01-08"}
+		assert.ErrorIs(t, s.BorrowCopy(ctx, &again, entity.CopyAvailable, "", 0, borrowedAt, event), ErrConflict)
+
+		// Only the patron of the hold can take the kept copy, and only with the hold
+		taken := entity.BorrowedBooks{BookID: book.ID.Hex(), CopyID: kept.ID.Hex(), UserID: mary.ID.Hex(), BorrowedDate: "2024-01-01", ReturnDate: "2024-01-08"}
+		assert.ErrorIs(t, s.BorrowCopy(ctx, &taken, entity.CopyOnHold, hold.ID.Hex(), 1, borrowedAt, event), ErrConflict)
+		taken.UserID = peter.ID.Hex()
+		assert.ErrorIs(t, s.BorrowCopy(ctx, &taken, entity.CopyOnHold, primitive.NewObjectID().Hex(), 0, borrowedAt, event), ErrConflict)
+		found, err = s.GetCopy(ctx, kept.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, entity.CopyOnHold, found.Status, "a failed borrow leaves the copy kept")
+
+		collected := entity.BorrowedBooks{BookID: book.ID.Hex(), CopyID: kept.ID.Hex(), UserID: peter.ID.Hex(), BorrowedDate: "2024-01-01", ReturnDate: "2024-01-08"}
+		require.NoError(t, s.BorrowCopy(ctx, &collected, entity.CopyOnHold, hold.ID.Hex(), 0, borrowedAt, event))
+		fulfilled, err := s.GetHold(ctx, hold.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, entity.HoldFulfilled, fulfilled.Status)
+		require.NotNil(t, fulfilled.ClosedAt)
+		assert.True(t, borrowedAt.Equal(*fulfilled.ClosedAt))
+		found, err = s.GetCopy(ctx, kept.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, entity.CopyBorrowed, found.Status)
+
+		loans, err := s.ListLoans(ctx, LoanFilter{BookID: book.ID.Hex()})
+		require.NoError(t, err)
+		assert.Len(t, loans, 2)
+		events, err := s.ListOutboxEvents(ctx, OutboxFilter{})
+		require.NoError(t, err)
+		assert.Len(t, events, 2, "failed borrows add no events")
+	})
+}
+
+func TestHolds(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		peter := entity.User{Username: "peter", Password: "secret"}
+		mary := entity.User{Username: "mary", Password: "secret"}
+		require.NoError(t, s.CreateUser(ctx, &peter))
+		require.NoError(t, s.CreateUser(ctx, &mary))
+		book := entity.Title{Title: "Dune", Author: "Frank Herbert", PublishedDate: date("1965-08-01")}
+		require.NoError(t, s.CreateTitle(ctx, &book, nil))
+		item := entity.Copy{TitleID: book.ID.Hex(), Barcode: "D1", Status: entity.CopyBorrowed, Condition: entity.ConditionGood}
+		require.NoError(t, s.CreateCopy(ctx, &item))
+
+		created := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+		first := entity.Hold{TitleID: book.ID.Hex(), UserID: mary.ID.Hex(), Status: entity.HoldWaiting, CreatedAt: created.Add(time.Minute)}
+		second := entity.Hold{TitleID: book.ID.Hex(), UserID: peter.ID.Hex(), Status: entity.HoldWaiting, CreatedAt: created.Add(2 * time.Minute)}
+		require.NoError(t, s.CreateHold(ctx, &first))
+		require.NoError(t, s.CreateHold(ctx, &second))
+
+		// One open hold per patron and title
+		duplicate := entity.Hold{TitleID: book.ID.Hex(), UserID: peter.ID.Hex(), Status: entity.HoldWaiting, CreatedAt: created}
+		assert.ErrorIs(t, s.CreateHold(ctx, &duplicate), ErrAlreadyExists)
+
+		// Queue order
+		holds, err := s.ListHolds(ctx, HoldFilter{TitleID: book.ID.Hex(), Statuses: []string{entity.HoldWaiting}})
+		require.NoError(t, err)
+		require.Len(t, holds, 2)
+		assert.Equal(t, first.ID, holds[0].ID)
+		assert.Equal(t, second.ID, holds[1].ID)
+
+		readyAt := created.Add(time.Hour)
+		pickupBy := readyAt.Add(72 * time.Hour)
+		event := entity.OutboxEvent{Type: entity.EventHoldReady, BookID: book.ID.Hex(), Payload: []byte(`{}`), CreatedAt: readyAt}
+		require.NoError(t, s.ReadyHold(ctx, first.ID.Hex(), item.ID.Hex(), readyAt, pickupBy, event))
+		assert.ErrorIs(t, s.ReadyHold(ctx, first.ID.Hex(), item.ID.Hex(), readyAt, pickupBy, event), ErrConflict)
+		assert.ErrorIs(t, s.ReadyHold(ctx, primitive.NewObjectID().Hex(), item.ID.Hex(), readyAt, pickupBy, event), ErrNotFound)
+		events, err := s.ListOutboxEvents(ctx, OutboxFilter{})
+		require.NoError(t, err)
+		require.Len(t, events, 1, "failed changes add no events")
+		assert.Equal(t, entity.EventHoldReady, events[0].Type)
+
+		found, err := s.GetHold(ctx, first.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, entity.HoldReady, found.Status)
+		assert.Equal(t, item.ID.Hex(), found.CopyID)
+		require.NotNil(t, found.PickupBy)
+		assert.True(t, pickupBy.Equal(*found.PickupBy))
+		assert.True(t, first.CreatedAt.Equal(found.CreatedAt))
+
+		holds, err = s.ListHolds(ctx, HoldFilter{CopyID: item.ID.Hex(), Statuses: []string{entity.HoldReady}})
+		require.NoError(t, err)
+		require.Len(t, holds, 1)
+		assert.Equal(t, first.ID, holds[0].ID)
+
+		// Only holds past their pickup deadline
+		holds, err = s.ListHolds(ctx, HoldFilter{PickupBefore: pickupBy})
+		require.NoError(t, err)
+		assert.Empty(t, holds)
+		holds, err = s.ListHolds(ctx, HoldFilter{PickupBefore: pickupBy.Add(time.Second)})
+		require.NoError(t, err)
+		require.Len(t, holds, 1)
+
+		require.NoError(t, s.CloseHold(ctx, first.ID.Hex(), entity.HoldReady, entity.HoldExpired, pickupBy))
+		assert.ErrorIs(t, s.CloseHold(ctx, first.ID.Hex(), entity.HoldReady, entity.HoldFulfilled, pickupBy), ErrConflict)
+
+		// A closed hold no longer blocks a new one
+		again := entity.Hold{TitleID: book.ID.Hex(), UserID: mary.ID.Hex(), Status: entity.HoldWaiting, CreatedAt: created.Add(time.Hour)}
+		require.NoError(t, s.CreateHold(ctx, &again))
+
+		holds, err = s.ListHolds(ctx, HoldFilter{UserID: mary.ID.Hex()})
+		require.NoError(t, err)
+		require.Len(t, holds, 2)
+		assert.Equal(t, entity.HoldExpired, holds[0].Status)
+		require.NotNil(t, holds[0].ClosedAt)
+
+		// Holds go with their title
+		require.NoError(t, s.DeleteTitle(ctx, book.ID.Hex()))
+		_, err = s.GetHold(ctx, second.ID.Hex())
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+// Only one of concurrent holds of a patron on a title is kept
+func TestCreateHoldConcurrent(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		peter := entity.User{Username: "peter", Password: "secret"}
+		require.NoError(t, s.CreateUser(ctx, &peter))
+		book := entity.Title{Title: "Dune", Author: "Frank Herbert", PublishedDate: date("1965-08-01")}
+		require.NoError(t, s.CreateTitle(ctx, &book, nil))
+
+		var wg sync.WaitGroup
+		errs := make([]error, 10)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = s.CreateHold(ctx, &entity.Hold{TitleID: book.ID.Hex(), UserID: peter.ID.Hex(), Status: entity.HoldWaiting, CreatedAt: time.Now()})
+			}(i)
+		}
+		wg.Wait()
+
+		created := 0
+		for _, err := range errs {
+			if err == nil {
+				created++
+				continue
+			}
+			assert.ErrorIs(t, err, ErrAlreadyExists)
+		}
+		assert.Equal(t, 1, created)
+	})
+}
+
+func TestSessions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		user := entity.User{Username: "peter", Password: "secret"}
+		require.NoError(t, s.CreateUser(ctx, &user))
+
+		first := entity.RefreshToken{TokenHash: "hash-1", UserID: user.ID.Hex(), FamilyID: "family", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+		second := entity.RefreshToken{TokenHash: "hash-2", UserID: user.ID.Hex(), FamilyID: "family", CreatedAt: now, ExpiresAt: now.Add(48 * time.Hour)}
+		require.NoError(t, s.CreateRefreshToken(ctx, &first))
+		require.NoError(t, s.CreateRefreshToken(ctx, &second))
+
+		found, err := s.GetRefreshToken(ctx, "hash-1")
+		require.NoError(t, err)
+		assert.Equal(t, first, *found)
+		_, err = s.GetRefreshToken(ctx, "hash-3")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// A token can only be revoked, that is exchanged, once
+		require.NoError(t, s.RevokeRefreshToken(ctx, first.ID.Hex(), now))
+		assert.ErrorIs(t, s.RevokeRefreshToken(ctx, first.ID.Hex(), now), ErrConflict)
+		assert.ErrorIs(t, s.RevokeRefreshToken(ctx, primitive.NewObjectID().Hex(), now), ErrNotFound)
+
+		require.NoError(t, s.RevokeRefreshTokenFamily(ctx, "family", now.Add(time.Minute)))
+		found, err = s.GetRefreshToken(ctx, "hash-1")
+		require.NoError(t, err)
+		assert.True(t, now.Equal(*found.RevokedAt), "first revocation is kept")
+		found, err = s.GetRefreshToken(ctx, "hash-2")
+		require.NoError(t, err)
+		require.NotNil(t, found.RevokedAt)
+
+		revoked, err := s.IsAccessTokenRevoked(ctx, "jti-1")
+		require.NoError(t, err)
+		assert.False(t, revoked)
+
+		require.NoError(t, s.RevokeAccessToken(ctx, "jti-1", now.Add(time.Hour)))
+		require.NoError(t, s.RevokeAccessToken(ctx, "jti-1", now.Add(time.Hour)))
+		require.NoError(t, s.RevokeAccessToken(ctx, "jti-2", now.Add(48*time.Hour)))
+		revoked, err = s.IsAccessTokenRevoked(ctx, "jti-1")
+		require.NoError(t, err)
+		assert.True(t, revoked)
+
+		// Only what expired before the cut-off is removed
+		require.NoError(t, s.DeleteExpiredSessions(ctx, now.Add(24*time.Hour)))
+		_, err = s.GetRefreshToken(ctx, "hash-1")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.GetRefreshToken(ctx, "hash-2")
+		assert.NoError(t, err)
+		revoked, err = s.IsAccessTokenRevoked(ctx, "jti-1")
+		require.NoError(t, err)
+		assert.False(t, revoked)
+		revoked, err = s.IsAccessTokenRevoked(ctx, "jti-2")
+		require.NoError(t, err)
+		assert.True(t, revoked)
+	})
+}
+
+func TestLoginThrottles(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		_, err := s.GetLoginThrottle(ctx, "user:peter")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, s.LockLogin(ctx, "user:peter", now), ErrNotFound)
+
+		for i := 1; i <= 3; i++ {
+			throttle, err := s.RecordLoginFailure(ctx, "user:peter", now.Add(time.Duration(i)*time.Minute), now.Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Equal(t, i, throttle.Failures)
+		}
+
+		require.NoError(t, s.LockLogin(ctx, "user:peter", now.Add(time.Hour)))
+		throttle, err := s.GetLoginThrottle(ctx, "user:peter")
+		require.NoError(t, err)
+		assert.Equal(t, 3, throttle.Failures)
+		assert.True(t, now.Add(3*time.Minute).Equal(throttle.LastFailure))
+		require.NotNil(t, throttle.LockedUntil)
+		assert.True(t, now.Add(time.Hour).Equal(*throttle.LockedUntil))
+
+		// The window counts from the end of the lockout
+		throttle, err = s.RecordLoginFailure(ctx, "user:peter", now.Add(90*time.Minute), now.Add(30*time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, 4, throttle.Failures)
+
+		// Failures older than the window start the count again
+		throttle, err = s.RecordLoginFailure(ctx, "user:peter", now.Add(3*time.Hour), now.Add(2*time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 1, throttle.Failures)
+		assert.Nil(t, throttle.LockedUntil)
+
+		// Keys are independent
+		throttle, err = s.RecordLoginFailure(ctx, "ip:10.0.0.1", now, now.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 1, throttle.Failures)
+
+		require.NoError(t, s.ClearLoginThrottle(ctx, "user:peter"))
+		require.NoError(t, s.ClearLoginThrottle(ctx, "user:peter"))
+		_, err = s.GetLoginThrottle(ctx, "user:peter")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.GetLoginThrottle(ctx, "ip:10.0.0.1")
+		assert.NoError(t, err)
+	})
+}
+
+// Concurrent registrations of a username must leave a single user
+func TestCreateUserConcurrent(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		var wg sync.WaitGroup
+		errs := make([]error, 10)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = s.CreateUser(ctx, &entity.User{Username: "peter", Password: "secret"})
+			}(i)
+		}
+		wg.Wait()
+
+		created := 0
+		for _, err := range errs {
+			if err == nil {
+				created++
+				continue
+			}
+			assert.ErrorIs(t, err, ErrAlreadyExists)
+		}
+		assert.Equal(t, 1, created)
+	})
+}
+
+// Concurrent failures must all be counted
+func TestRecordLoginFailureConcurrent(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		now := time.Now().UTC().Truncate(time.Second)
+
+		var wg sync.WaitGroup
+		errs := make([]error, 20)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = s.RecordLoginFailure(ctx, "ip:10.0.0.1", now, now.Add(-time.Hour))
+			}(i)
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+		throttle, err := s.GetLoginThrottle(ctx, "ip:10.0.0.1")
+		require.NoError(t, err)
+		assert.Equal(t, len(errs), throttle.Failures)
+	})
+}
+
+func TestAuditEvents(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		events := []entity.AuditEvent{
+			{Type: entity.AuditAccountLocked, Username: "peter", IP: "10.0.0.1", CreatedAt: now},
+			{Type: entity.AuditLoginBlocked, Username: "peter", IP: "10.0.0.1", CreatedAt: now.Add(time.Minute)},
+			{Type: entity.AuditAccountUnlocked, Username: "peter", ActorID: "admin", CreatedAt: now.Add(2 * time.Minute)},
+			{Type: entity.AuditAccountLocked, Username: "mary", IP: "10.0.0.2", Detail: "5 failures", CreatedAt: now.Add(3 * time.Minute)},
+		}
+		for i := range events {
+			require.NoError(t, s.CreateAuditEvent(ctx, &events[i]))
+			assert.False(t, events[i].ID.IsZero())
+		}
+
+		all, err := s.ListAuditEvents(ctx, AuditFilter{})
+		require.NoError(t, err)
+		require.Len(t, all, 4)
+		assert.Equal(t, events[3], all[0], "newest first")
+
+		peter, err := s.ListAuditEvents(ctx, AuditFilter{Username: "peter", Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, peter, 2)
+		assert.Equal(t, entity.AuditAccountUnlocked, peter[0].Type)
+		assert.Equal(t, entity.AuditLoginBlocked, peter[1].Type)
+
+		locked, err := s.ListAuditEvents(ctx, AuditFilter{Type: entity.AuditAccountLocked})
+		require.NoError(t, err)
+		require.Len(t, locked, 2)
+		assert.Equal(t, "mary", locked[0].Username)
+	})
+}
+
+// Parallel compare-and-set on the same copy, only one may succeed
+func TestUpdateCopyStatusConcurrent(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		book := entity.Title{Title: "Dune", Author: "Frank Herbert", PublishedDate: date("1965-08-01")}
+		require.NoError(t, s.CreateTitle(ctx, &book, nil))
+		item := entity.Copy{TitleID: book.ID.Hex(), Barcode: "D1", Status: entity.CopyAvailable, Condition: entity.ConditionGood}
+		require.NoError(t, s.CreateCopy(ctx, &item))
+
+		var wg sync.WaitGroup
+		errs := make([]error, 20)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = s.UpdateCopyStatus(ctx, item.ID.Hex(), entity.CopyAvailable, entity.CopyBorrowed)
+			}(i)
+		}
+		wg.Wait()
+
+		succeeded := 0
+		for _, err := range errs {
+			if err == nil {
+				succeeded++
+				continue
+			}
+			assert.ErrorIs(t, err, ErrConflict)
+		}
+		assert.Equal(t, 1, succeeded)
+	})
+}
+
+func TestSQLForeignKeys(t *testing.T) {
+	ctx := context.Background()
+	s := NewSQLStore(openSQLite(t))
+
+	user := entity.User{Username: "peter", Password: "secret"}
+	require.NoError(t, s.CreateUser(ctx, &user))
+	book := entity.Title{Title: "Dune", Author: "Frank Herbert", PublishedDate: date("1965-08-01")}
+	require.NoError(t, s.CreateTitle(ctx, &book, nil))
+	item := entity.Copy{TitleID: book.ID.Hex(), Barcode: "D1", Status: entity.CopyAvailable, Condition: entity.ConditionGood}
+	require.NoError(t, s.CreateCopy(ctx, &item))
+
+	// Loans must point at an existing title and copy
+	orphan := entity.BorrowedBooks{BookID: "60c72b2f9e15b92bbcf68f2b", UserID: user.ID.Hex(), BorrowedDate: "2024-01-01", ReturnDate: "2024-01-08"}
+	assert.Error(t, s.CreateLoan(ctx, &orphan))
+	orphan = entity.BorrowedBooks{BookID: book.ID.Hex(), CopyID: "60c72b2f9e15b92bbcf68f2b", UserID: user.ID.Hex(), BorrowedDate: "2024-01-01", ReturnDate: "2024-01-08"}
+	assert.Error(t, s.CreateLoan(ctx, &orphan))
+
+	// Titles and copies with loans cannot be removed
+	loan := entity.BorrowedBooks{BookID: book.ID.Hex(), CopyID: item.ID.Hex(), UserID: user.ID.Hex(), BorrowedDate: "2024-01-01", ReturnDate: "2024-01-08"}
+	require.NoError(t, s.CreateLoan(ctx, &loan))
+	assert.ErrorIs(t, s.DeleteCopy(ctx, item.ID.Hex()), ErrConflict)
+	removed := entity.OutboxEvent{Type: entity.EventBookRemoved, BookID: book.ID.Hex(), Payload: []byte(`{}`), CreatedAt: time.Now()}
+	assert.ErrorIs(t, s.DeleteTitle(ctx, book.ID.Hex(), removed), ErrConflict)
+	events, err := s.ListOutboxEvents(ctx, OutboxFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, events, "the event is rolled back with the change")
+}
+
+func TestMigrations(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+
+	latest, err := LatestSchemaVersion()
+	require.NoError(t, err)
+
+	version, err := SchemaVersion(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, latest, version)
+
+	// Running up again is a no-op
+	applied, err := MigrateUp(ctx, db)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	reverted, err := MigrateDown(ctx, db, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int{latest}, reverted)
+
+	version, err = SchemaVersion(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, latest-1, version)
+
+	// Revert everything, then apply everything again
+	_, err = MigrateDown(ctx, db, latest)
+	require.NoError(t, err)
+	version, err = SchemaVersion(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, 0, version)
+
+	applied, err = MigrateUp(ctx, db)
+	require.NoError(t, err)
+	assert.Len(t, applied, latest)
+}
+
+// Books stored before copies existed become titles with one copy each
+func TestMigrateCopies(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+
+	// Back to the schema before copies
+	latest, err := LatestSchemaVersion()
+	require.NoError(t, err)
+	_, err = MigrateDown(ctx, db, latest-5)
+	require.NoError(t, err)
+
+	_, err = db.ExecContext(ctx, `INSERT INTO users (id, username, password) VALUES ('u1', 'peter', 'secret')`)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `INSERT INTO books (id, title, author, published_date, status) VALUES
+		('60c72b2f9e15b92bbcf68f2b', 'Dune', 'Frank Herbert', '1965-08-01 00:00:00', 'borrowed'),
+		('60c72b2f9e15b92bbcf68f2c', 'Neuromancer', 'William Gibson', '1984-07-01 00:00:00', 'Available')`)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `INSERT INTO borrowed_books (id, book_id, user_id, borrowed_date, return_date) VALUES
+		('60c72b2f9e15b92bbcf68f2d', '60c72b2f9e15b92bbcf68f2b', 'u1', '2024-01-01', '2024-01-08')`)
+	require.NoError(t, err)
+
+	_, err = MigrateUp(ctx, db)
+	require.NoError(t, err)
+
+	s := NewSQLStore(db)
+	item, err := s.GetCopyByBarcode(ctx, "60c72b2f9e15b92bbcf68f2b")
+	require.NoError(t, err)
+	assert.Equal(t, "60c72b2f9e15b92bbcf68f2b", item.TitleID)
+	assert.Equal(t, entity.CopyBorrowed, item.Status)
+
+	loan, err := s.GetLoan(ctx, "60c72b2f9e15b92bbcf68f2d")
+	require.NoError(t, err)
+	assert.Equal(t, item.ID.Hex(), loan.CopyID)
+
+	counts, err := s.CountCopies(ctx, []string{"60c72b2f9e15b92bbcf68f2b", "60c72b2f9e15b92bbcf68f2c"})
+	require.NoError(t, err)
+	assert.Equal(t, CopyCounts{Total: 1, Available: 1}, counts["60c72b2f9e15b92bbcf68f2c"])
+
+	// Reverting keeps the books and their loans
+	_, err = MigrateDown(ctx, db, latest-5)
+	require.NoError(t, err)
+	var status string
+	require.NoError(t, db.QueryRowContext(ctx, `SELECT status FROM books WHERE id = '60c72b2f9e15b92bbcf68f2c'`).Scan(&status))
+	assert.Equal(t, entity.CopyAvailable, status)
+	var loans int
+	require.NoError(t, db.QueryRowContext(ctx, `SELECT COUNT(*) FROM borrowed_books`).Scan(&loans))
+	assert.Equal(t, 1, loans)
+}
+
+// Books stored in MongoDB before copies existed become titles with one copy each
+func TestMongoMigrateCopies(t *testing.T) {
+	ctx := context.Background()
+	db := openMongo(t)
+
+	dune, _ := primitive.ObjectIDFromHex("60c72b2f9e15b92bbcf68f2b")
+	neuromancer, _ := primitive.ObjectIDFromHex("60c72b2f9e15b92bbcf68f2c")
+	loanID, _ := primitive.ObjectIDFromHex("60c72b2f9e15b92bbcf68f2d")
+	_, err := db.Collection("books").InsertMany(ctx, []interface{}{
+		bson.M{"_id": dune, "title": "Dune", "author": "Frank Herbert", "status": entity.CopyBorrowed},
+		bson.M{"_id": neuromancer, "title": "Neuromancer", "author": "William Gibson", "status": entity.CopyAvailable},
+	})
+	require.NoError(t, err)
+	_, err = db.Collection("borrowed_books").InsertOne(ctx, bson.M{
+		"_id": loanID, "book_id": dune.Hex(), "user_id": "u1", "borrowed_date": "2024-01-01", "return_date": "2024-01-08",
+	})
+	require.NoError(t, err)
+
+	// Running it twice converts each book once
+	require.NoError(t, migrateBooksToCopies(ctx, db))
+	require.NoError(t, migrateBooksToCopies(ctx, db))
+
+	s := NewMongoStore(db)
+	item, err := s.GetCopyByBarcode(ctx, dune.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, dune, item.ID)
+	assert.Equal(t, dune.Hex(), item.TitleID)
+	assert.Equal(t, entity.CopyBorrowed, item.Status)
+
+	loan, err := s.GetLoan(ctx, loanID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, dune.Hex(), loan.CopyID)
+
+	counts, err := s.CountCopies(ctx, []string{dune.Hex(), neuromancer.Hex()})
+	require.NoError(t, err)
+	assert.Equal(t, CopyCounts{Total: 1, Available: 0}, counts[dune.Hex()])
+	assert.Equal(t, CopyCounts{Total: 1, Available: 1}, counts[neuromancer.Hex()])
+
+	remaining, err := db.Collection("books").CountDocuments(ctx, bson.M{"status": bson.M{"$exists": true}})
+	require.NoError(t, err)
+	assert.Zero(t, remaining)
+}
+
+func TestFeeTransactions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		peter := entity.User{Username: "peter", Password: "secret"}
+		require.NoError(t, s.CreateUser(ctx, &peter))
+		mary := entity.User{Username: "mary", Password: "secret"}
+		require.NoError(t, s.CreateUser(ctx, &mary))
+		title := entity.Title{Title: "Dune", Author: "Frank Herbert", PublishedDate: date("1965-08-01")}
+		require.NoError(t, s.CreateTitle(ctx, &title, nil))
+		loan := entity.BorrowedBooks{BookID: title.ID.Hex(), UserID: peter.ID.Hex(), BorrowedDate: "2024-01-01", ReturnDate: "2024-01-08"}
+		require.NoError(t, s.CreateLoan(ctx, &loan))
+
+		balance, err := s.FeeBalance(ctx, peter.ID.Hex())
+		require.NoError(t, err)
+		assert.Zero(t, balance)
+
+		fine := entity.FeeTransaction{UserID: peter.ID.Hex(), Kind: entity.FeeOverdue, Amount: 150, LoanID: loan.ID.Hex(),
+			Note: "6 days overdue", CreatedAt: now, IdempotencyKey: "overdue:" + loan.ID.Hex() + ":6"}
+		require.NoError(t, s.CreateFeeTransaction(ctx, &fine))
+		assert.False(t, fine.ID.IsZero())
+
+		// The same charge is only recorded once
+		again := fine
+		again.ID = primitive.NilObjectID
+		assert.ErrorIs(t, s.CreateFeeTransaction(ctx, &again), ErrAlreadyExists)
+
+		entries := []entity.FeeTransaction{
+			{UserID: peter.ID.Hex(), Kind: entity.FeeWaiver, Amount: -50, ChargeID: fine.ID.Hex(), CreatedBy: mary.ID.Hex(), CreatedAt: now.Add(time.Minute)},
+			{UserID: peter.ID.Hex(), Kind: entity.FeePayment, Amount: -40, CreatedBy: mary.ID.Hex(), CreatedAt: now.Add(2 * time.Minute)},
+			{UserID: mary.ID.Hex(), Kind: entity.FeeDamaged, Amount: 500, CreatedAt: now.Add(3 * time.Minute)},
+		}
+		for i := range entries {
+			require.NoError(t, s.CreateFeeTransaction(ctx, &entries[i]))
+		}
+
+		found, err := s.GetFeeTransaction(ctx, fine.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, fine, *found)
+		_, err = s.GetFeeTransaction(ctx, primitive.NewObjectID().Hex())
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		list, err := s.ListFeeTransactions(ctx, FeeFilter{UserID: peter.ID.Hex()})
+		require.NoError(t, err)
+		require.Len(t, list, 3)
+		assert.Equal(t, fine, list[0], "oldest first")
+		assert.Equal(t, entries[1], list[2])
+
+		list, err = s.ListFeeTransactions(ctx, FeeFilter{ChargeID: fine.ID.Hex()})
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, entity.FeeWaiver, list[0].Kind)
+
+		list, err = s.ListFeeTransactions(ctx, FeeFilter{LoanID: loan.ID.Hex(), Kind: entity.FeeOverdue})
+		require.NoError(t, err)
+		assert.Len(t, list, 1)
+
+		balance, err = s.FeeBalance(ctx, peter.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, int64(60), balance)
+		balance, err = s.FeeBalance(ctx, mary.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, int64(500), balance)
+	})
+}
+
+func TestJobRuns(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		var runs []entity.JobRun
+		for i, job := range []string{"late_books", "hold_expiry", "late_books"} {
+			run := entity.JobRun{
+				Job:         job,
+				ScheduledAt: base.Add(time.Duration(i) * time.Hour),
+				StartedAt:   base.Add(time.Duration(i)*time.Hour + time.Second),
+				Status:      entity.JobRunning,
+				Instance:    "server-1",
+			}
+			if i == 1 {
+				run.TriggeredBy = "admin"
+			}
+			require.NoError(t, s.CreateJobRun(ctx, &run))
+			assert.False(t, run.ID.IsZero())
+			runs = append(runs, run)
+		}
+
+		// A job runs once per scheduled time
+		duplicate := entity.JobRun{Job: "late_books", ScheduledAt: base, StartedAt: base, Status: entity.JobRunning}
+		assert.ErrorIs(t, s.CreateJobRun(ctx, &duplicate), ErrAlreadyExists)
+
+		finishedAt := base.Add(2 * time.Second)
+		runs[0].Status = entity.JobFailed
+		runs[0].Error = "store unavailable"
+		runs[0].Result = entity.JobResult{Checked: 3, Changed: 1, Summary: "1 of 3 updated"}
+		runs[0].FinishedAt = &finishedAt
+		require.NoError(t, s.FinishJobRun(ctx, &runs[0]))
+		assert.ErrorIs(t, s.FinishJobRun(ctx, &runs[0]), ErrConflict, "already finished")
+
+		missing := entity.JobRun{ID: primitive.NewObjectID(), Status: entity.JobSucceeded, FinishedAt: &finishedAt}
+		assert.ErrorIs(t, s.FinishJobRun(ctx, &missing), ErrNotFound)
+
+		found, err := s.GetJobRun(ctx, runs[0].ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, runs[0], *found)
+
+		_, err = s.GetJobRun(ctx, primitive.NewObjectID().Hex())
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		list, err := s.ListJobRuns(ctx, JobRunFilter{Job: "late_books"})
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+		assert.Equal(t, runs[2].ID, list[0].ID, "newest first")
+		assert.Equal(t, runs[0].ID, list[1].ID)
+
+		list, err = s.ListJobRuns(ctx, JobRunFilter{Status: entity.JobRunning, Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, runs[2].ID, list[0].ID)
+
+		// Only finished runs are pruned
+		require.NoError(t, s.DeleteJobRuns(ctx, base.Add(time.Hour)))
+		list, err = s.ListJobRuns(ctx, JobRunFilter{})
+		require.NoError(t, err)
+		assert.Len(t, list, 2)
+		_, err = s.GetJobRun(ctx, runs[0].ID.Hex())
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestJobLeases(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		_, err := s.GetJobLease(ctx, "late_books")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		require.NoError(t, s.AcquireJobLease(ctx, "late_books", "a", now, now.Add(time.Minute)))
+		assert.ErrorIs(t, s.AcquireJobLease(ctx, "late_books", "b", now.Add(30*time.Second), now.Add(time.Minute)), ErrConflict)
+		require.NoError(t, s.AcquireJobLease(ctx, "hold_expiry", "b", now, now.Add(time.Minute)), "leases are per job")
+
+		// The holder renews its lease
+		require.NoError(t, s.AcquireJobLease(ctx, "late_books", "a", now.Add(30*time.Second), now.Add(2*time.Minute)))
+		lease, err := s.GetJobLease(ctx, "late_books")
+		require.NoError(t, err)
+		assert.Equal(t, entity.JobLease{Job: "late_books", Holder: "a", ExpiresAt: now.Add(2 * time.Minute)}, *lease)
+		assert.ErrorIs(t, s.AcquireJobLease(ctx, "late_books", "b", now.Add(time.Minute), now.Add(3*time.Minute)), ErrConflict)
+
+		// Another holder takes an expired lease over, and the previous one cannot renew it
+		require.NoError(t, s.AcquireJobLease(ctx, "late_books", "b", now.Add(2*time.Minute), now.Add(3*time.Minute)))
+		assert.ErrorIs(t, s.AcquireJobLease(ctx, "late_books", "a", now.Add(2*time.Minute), now.Add(3*time.Minute)), ErrConflict)
+
+		assert.ErrorIs(t, s.ReleaseJobLease(ctx, "late_books", "a"), ErrConflict)
+		require.NoError(t, s.ReleaseJobLease(ctx, "late_books", "b"))
+		_, err = s.GetJobLease(ctx, "late_books")
+		assert.ErrorIs(t, err, ErrNotFound)
+		require.NoError(t, s.AcquireJobLease(ctx, "late_books", "a", now.Add(2*time.Minute), now.Add(3*time.Minute)))
+	})
+}
+
+func TestJobStates(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		_, err := s.GetJobState(ctx, "late_books")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		paused := entity.JobState{Job: "late_books", Paused: true, UpdatedBy: "admin", UpdatedAt: now}
+		require.NoError(t, s.SetJobState(ctx, paused))
+		state, err := s.GetJobState(ctx, "late_books")
+		require.NoError(t, err)
+		assert.Equal(t, paused, *state)
+
+		resumed := entity.JobState{Job: "late_books", UpdatedBy: "other", UpdatedAt: now.Add(time.Hour)}
+		require.NoError(t, s.SetJobState(ctx, resumed))
+		state, err = s.GetJobState(ctx, "late_books")
+		require.NoError(t, err)
+		assert.Equal(t, resumed, *state)
+	})
+}
+
+func TestNotifications(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+		peter := entity.User{Username: "peter", Password: "hash"}
+		require.NoError(t, s.CreateUser(ctx, &peter))
+		mary := entity.User{Username: "mary", Password: "hash"}
+		require.NoError(t, s.CreateUser(ctx, &mary))
+
+		first := entity.Notification{UserID: peter.ID.Hex(), Kind: entity.NotifyDueSoon, Key: "loan/2024-01-03",
+			Channels: []string{entity.ChannelEmail, entity.ChannelLog}, Subject: "Dune is due", SentAt: now}
+		require.NoError(t, s.CreateNotification(ctx, &first))
+		assert.False(t, first.ID.IsZero())
+
+		// Once per user, kind and key
+		again := entity.Notification{UserID: peter.ID.Hex(), Kind: entity.NotifyDueSoon, Key: "loan/2024-01-03", SentAt: now}
+		assert.ErrorIs(t, s.CreateNotification(ctx, &again), ErrAlreadyExists)
+		for _, other := range []entity.Notification{
+			{UserID: peter.ID.Hex(), Kind: entity.NotifyOverdue, Key: "loan/2024-01-03", SentAt: now.Add(time.Hour)},
+			{UserID: mary.ID.Hex(), Kind: entity.NotifyDueSoon, Key: "loan/2024-01-03", SentAt: now.Add(2 * time.Hour)},
+		} {
+			require.NoError(t, s.CreateNotification(ctx, &other))
+		}
+
+		sent, err := s.ListNotifications(ctx, NotificationFilter{UserID: peter.ID.Hex()})
+		require.NoError(t, err)
+		require.Len(t, sent, 2)
+		assert.Equal(t, entity.NotifyOverdue, sent[0].Kind, "newest first")
+		assert.Equal(t, first, sent[1])
+
+		sent, err = s.ListNotifications(ctx, NotificationFilter{Kind: entity.NotifyDueSoon, Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, sent, 1)
+		assert.Equal(t, mary.ID.Hex(), sent[0].UserID)
+
+		// A deleted notification can be sent again
+		require.NoError(t, s.DeleteNotification(ctx, first.ID.Hex()))
+		assert.ErrorIs(t, s.DeleteNotification(ctx, first.ID.Hex()), ErrNotFound)
+		require.NoError(t, s.CreateNotification(ctx, &again))
+	})
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		user := entity.User{Username: "peter", Password: "hash"}
+		require.NoError(t, s.CreateUser(ctx, &user))
+
+		_, err := s.GetNotificationPreferences(ctx, user.ID.Hex())
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		prefs := entity.NotificationPreferences{UserID: user.ID.Hex(), Email: "peter@example.com",
+			Channels: []string{entity.ChannelEmail}, Muted: []string{entity.NotifyDueSoon, entity.NotifyOverdue}, UpdatedAt: now}
+		require.NoError(t, s.SetNotificationPreferences(ctx, prefs))
+		stored, err := s.GetNotificationPreferences(ctx, user.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, prefs, *stored)
+
+		prefs = entity.NotificationPreferences{UserID: user.ID.Hex(), UpdatedAt: now.Add(time.Hour)}
+		require.NoError(t, s.SetNotificationPreferences(ctx, prefs))
+		stored, err = s.GetNotificationPreferences(ctx, user.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, prefs, *stored)
+	})
+}
+
+func TestOutbox(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+		event := func(kind, bookID string) entity.OutboxEvent {
+			return entity.OutboxEvent{Type: kind, BookID: bookID, Payload: []byte(`{"id":"` + bookID + `"}`), CreatedAt: now}
+		}
+
+		user := entity.User{Username: "peter", Password: "secret"}
+		require.NoError(t, s.CreateUser(ctx, &user))
+		book := entity.Title{ID: primitive.NewObjectID(), Title: "Dune", Author: "Frank Herbert", PublishedDate: date("1965-08-01")}
+		require.NoError(t, s.CreateTitle(ctx, &book, nil, event(entity.EventBookAdded, book.ID.Hex())))
+		loan := entity.BorrowedBooks{BookID: book.ID.Hex(), UserID: user.ID.Hex(), BorrowedDate: "2024-01-01", ReturnDate: "2024-01-08"}
+		require.NoError(t, s.CreateLoan(ctx, &loan, event(entity.EventBookBorrowed, book.ID.Hex())))
+		require.NoError(t, s.CloseLoan(ctx, loan.ID.Hex(), now, event(entity.EventBookReturned, book.ID.Hex())))
+
+		// Failed changes add no events
+		assert.ErrorIs(t, s.CreateTitle(ctx, &book, nil, event(entity.EventBookAdded, book.ID.Hex())), ErrAlreadyExists)
+		assert.ErrorIs(t, s.CloseLoan(ctx, loan.ID.Hex(), now, event(entity.EventBookReturned, book.ID.Hex())), ErrConflict)
+		missing := primitive.NewObjectID().Hex()
+		assert.ErrorIs(t, s.DeleteTitle(ctx, missing, event(entity.EventBookRemoved, missing)), ErrNotFound)
+
+		other := entity.Title{Title: "Emma", Author: "Jane Austen", PublishedDate: date("1815-12-23")}
+		require.NoError(t, s.CreateTitle(ctx, &other, nil))
+		require.NoError(t, s.DeleteTitle(ctx, other.ID.Hex(), event(entity.EventBookRemoved, other.ID.Hex())))
+
+		events, err := s.ListOutboxEvents(ctx, OutboxFilter{Pending: true})
+		require.NoError(t, err)
+		require.Len(t, events, 4)
+		var types []string
+		for i, event := range events {
+			types = append(types, event.Type)
+			assert.False(t, event.ID.IsZero())
+			if i > 0 {
+				assert.Greater(t, event.Seq, events[i-1].Seq)
+			}
+		}
+		assert.Equal(t, []string{entity.EventBookAdded, entity.EventBookBorrowed, entity.EventBookReturned, entity.EventBookRemoved}, types)
+		assert.Equal(t, book.ID.Hex(), events[0].BookID)
+		assert.JSONEq(t, `{"id":"`+book.ID.Hex()+`"}`, string(events[0].Payload))
+		assert.True(t, now.Equal(events[0].CreatedAt))
+		assert.Nil(t, events[0].DeliveredAt)
+
+		// Delivered events leave the pending ones, failures are counted
+		require.NoError(t, s.MarkOutboxEventDelivered(ctx, events[0].ID.Hex(), now.Add(time.Minute)))
+		require.NoError(t, s.RecordOutboxFailure(ctx, events[1].ID.Hex(), "connection refused"))
+		require.NoError(t, s.RecordOutboxFailure(ctx, events[1].ID.Hex(), "timeout"))
+		assert.ErrorIs(t, s.MarkOutboxEventDelivered(ctx, missing, now), ErrNotFound)
+		assert.ErrorIs(t, s.RecordOutboxFailure(ctx, missing, "timeout"), ErrNotFound)
+
+		pending, err := s.ListOutboxEvents(ctx, OutboxFilter{Pending: true, Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, pending, 2)
+		assert.Equal(t, events[1].ID, pending[0].ID)
+		assert.Equal(t, 2, pending[0].Attempts)
+		assert.Equal(t, "timeout", pending[0].LastError)
+
+		after, err := s.ListOutboxEvents(ctx, OutboxFilter{AfterSeq: events[2].Seq})
+		require.NoError(t, err)
+		require.Len(t, after, 1)
+		assert.Equal(t, events[3].ID, after[0].ID)
+
+		// Only delivered events are deleted
+		require.NoError(t, s.DeleteOutboxEvents(ctx, now.Add(time.Hour)))
+		all, err := s.ListOutboxEvents(ctx, OutboxFilter{})
+		require.NoError(t, err)
+		require.Len(t, all, 3)
+		assert.Equal(t, events[1].ID, all[0].ID)
+	})
+}
+
+func TestOutboxCopyEvents(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+		seq, err := s.LastOutboxSeq(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, seq)
+
+		book := entity.Title{Title: "Dune", Author: "Frank Herbert", PublishedDate: date("1965-08-01")}
+		require.NoError(t, s.CreateTitle(ctx, &book, nil))
+		event := entity.OutboxEvent{Type: entity.EventBookStatusChanged, BookID: book.ID.Hex(), Payload: []byte(`{}`), CreatedAt: now}
+
+		item := entity.Copy{TitleID: book.ID.Hex(), Barcode: "B-1", Status: entity.CopyAvailable}
+		require.NoError(t, s.CreateCopy(ctx, &item, event))
+		require.NoError(t, s.UpdateCopyStatus(ctx, item.ID.Hex(), entity.CopyAvailable, entity.CopyLost, event))
+
+		// Failed changes add no events
+		duplicate := entity.Copy{TitleID: book.ID.Hex(), Barcode: "B-1", Status: entity.CopyAvailable}
+		assert.ErrorIs(t, s.CreateCopy(ctx, &duplicate, event), ErrAlreadyExists)
+		assert.ErrorIs(t, s.UpdateCopyStatus(ctx, item.ID.Hex(), entity.CopyAvailable, entity.CopyLost, event), ErrConflict)
+		missing := primitive.NewObjectID().Hex()
+		assert.ErrorIs(t, s.UpdateCopyStatus(ctx, missing, "", entity.CopyLost, event), ErrNotFound)
+		assert.ErrorIs(t, s.DeleteCopy(ctx, missing, event), ErrNotFound)
+
+		require.NoError(t, s.DeleteCopy(ctx, item.ID.Hex(), event))
+
+		events, err := s.ListOutboxEvents(ctx, OutboxFilter{})
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+		seq, err = s.LastOutboxSeq(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, events[2].Seq, seq)
+
+		// The sequence number stays when the events are pruned
+		for _, event := range events {
+			require.NoError(t, s.MarkOutboxEventDelivered(ctx, event.ID.Hex(), now))
+		}
+		require.NoError(t, s.DeleteOutboxEvents(ctx, now.Add(time.Hour)))
+		seq, err = s.LastOutboxSeq(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, events[2].Seq, seq)
+	})
+}
+
+func TestWebhooks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+		partner := entity.WebhookSubscription{URL: "https://partner.example/hooks", EventTypes: []string{entity.EventBookAdded, entity.EventHoldReady}, Secret: "whsec_1", CreatedBy: "admin", CreatedAt: now}
+		require.NoError(t, s.CreateWebhookSubscription(ctx, &partner))
+		other := entity.WebhookSubscription{URL: "https://other.example/hooks", EventTypes: []string{entity.EventBookAdded}, Secret: "whsec_2", CreatedBy: "admin", CreatedAt: now.Add(time.Minute)}
+		require.NoError(t, s.CreateWebhookSubscription(ctx, &other))
+
+		got, err := s.GetWebhookSubscription(ctx, partner.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, partner.EventTypes, got.EventTypes)
+		assert.Equal(t, "whsec_1", got.Secret)
+		assert.True(t, now.Equal(got.CreatedAt))
+		_, err = s.GetWebhookSubscription(ctx, primitive.NewObjectID().Hex())
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		subs, err := s.ListWebhookSubscriptions(ctx)
+		require.NoError(t, err)
+		require.Len(t, subs, 2)
+		assert.Equal(t, partner.ID, subs[0].ID)
+		assert.Equal(t, other.ID, subs[1].ID)
+
+		// A subscription gets an event once
+		first := entity.WebhookDelivery{SubscriptionID: partner.ID.Hex(), EventID: "event-1", EventType: entity.EventBookAdded, Payload: []byte(`{"seq":1}`), Status: entity.DeliveryPending, CreatedAt: now, NextAttemptAt: now}
+		require.NoError(t, s.CreateWebhookDelivery(ctx, &first))
+		duplicate := first
+		duplicate.ID = primitive.NilObjectID
+		assert.ErrorIs(t, s.CreateWebhookDelivery(ctx, &duplicate), ErrAlreadyExists)
+		unknown := first
+		unknown.ID, unknown.SubscriptionID = primitive.NilObjectID, primitive.NewObjectID().Hex()
+		assert.ErrorIs(t, s.CreateWebhookDelivery(ctx, &unknown), ErrNotFound)
+
+		second := entity.WebhookDelivery{SubscriptionID: partner.ID.Hex(), EventID: "event-2", EventType: entity.EventHoldReady, Payload: []byte(`{"seq":2}`), Status: entity.DeliveryPending, CreatedAt: now.Add(time.Minute), NextAttemptAt: now.Add(-time.Minute)}
+		require.NoError(t, s.CreateWebhookDelivery(ctx, &second))
+		forOther := entity.WebhookDelivery{SubscriptionID: other.ID.Hex(), EventID: "event-1", EventType: entity.EventBookAdded, Payload: []byte(`{"seq":1}`), Status: entity.DeliveryPending, CreatedAt: now, NextAttemptAt: now.Add(time.Hour)}
+		require.NoError(t, s.CreateWebhookDelivery(ctx, &forOther))
+
+		// Due deliveries come most overdue first
+		due, err := s.ListWebhookDeliveries(ctx, WebhookDeliveryFilter{DueBy: now})
+		require.NoError(t, err)
+		require.Len(t, due, 2)
+		assert.Equal(t, second.ID, due[0].ID)
+		assert.Equal(t, first.ID, due[1].ID)
+		assert.JSONEq(t, `{"seq":2}`, string(due[0].Payload))
+
+		delivered := now.Add(2 * time.Minute)
+		first.Status, first.Attempts, first.ResponseCode, first.DeliveredAt = entity.DeliveryDelivered, 2, 200, &delivered
+		require.NoError(t, s.UpdateWebhookDelivery(ctx, first))
+		second.Status, second.Attempts, second.LastError, second.ResponseCode = entity.DeliveryDead, 8, "webhook responded 503 Service Unavailable", 503
+		require.NoError(t, s.UpdateWebhookDelivery(ctx, second))
+		missing := first
+		missing.ID = primitive.NewObjectID()
+		assert.ErrorIs(t, s.UpdateWebhookDelivery(ctx, missing), ErrNotFound)
+
+		due, err = s.ListWebhookDeliveries(ctx, WebhookDeliveryFilter{DueBy: now.Add(time.Hour)})
+		require.NoError(t, err)
+		require.Len(t, due, 1)
+		assert.Equal(t, forOther.ID, due[0].ID)
+
+		// The log of a subscription is newest first
+		log, err := s.ListWebhookDeliveries(ctx, WebhookDeliveryFilter{SubscriptionID: partner.ID.Hex()})
+		require.NoError(t, err)
+		require.Len(t, log, 2)
+		assert.Equal(t, second.ID, log[0].ID)
+		assert.Equal(t, entity.DeliveryDead, log[0].Status)
+		assert.Equal(t, "webhook responded 503 Service Unavailable", log[0].LastError)
+		assert.Equal(t, 503, log[0].ResponseCode)
+		assert.Nil(t, log[0].DeliveredAt)
+		assert.Equal(t, entity.DeliveryDelivered, log[1].Status)
+		assert.Equal(t, 2, log[1].Attempts)
+		require.NotNil(t, log[1].DeliveredAt)
+		assert.True(t, delivered.Equal(*log[1].DeliveredAt))
+
+		dead, err := s.ListWebhookDeliveries(ctx, WebhookDeliveryFilter{Status: entity.DeliveryDead, Limit: 5})
+		require.NoError(t, err)
+		require.Len(t, dead, 1)
+		assert.Equal(t, second.ID, dead[0].ID)
+
+		// Pruning keeps pending deliveries
+		require.NoError(t, s.DeleteWebhookDeliveries(ctx, now.Add(time.Hour)))
+		all, err := s.ListWebhookDeliveries(ctx, WebhookDeliveryFilter{})
+		require.NoError(t, err)
+		require.Len(t, all, 1)
+		assert.Equal(t, forOther.ID, all[0].ID)
+
+		require.NoError(t, s.DeleteWebhookSubscription(ctx, other.ID.Hex()))
+		assert.ErrorIs(t, s.DeleteWebhookSubscription(ctx, other.ID.Hex()), ErrNotFound)
+		all, err = s.ListWebhookDeliveries(ctx, WebhookDeliveryFilter{})
+		require.NoError(t, err)
+		assert.Empty(t, all, "deleted with the subscription")
+	})
+}
+
+func TestMongoMigrations(t *testing.T) {
+	migrations := MongoMigrations()
+	for i, migration := range migrations {
+		assert.Equal(t, i+1, migration.Version, "versions follow each other")
+		assert.NotEmpty(t, migration.Name)
+		assert.NotNil(t, migration.Up)
+	}
+	assert.Equal(t, len(migrations), LatestMongoSchemaVersion())
+
+	// Migrating an up to date database changes nothing
+	db := openMongo(t)
+	ctx := context.Background()
+	version, err := MongoSchemaVersion(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, LatestMongoSchemaVersion(), version)
+	applied, err := MigrateMongoUp(ctx, db)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+}
@@ -1,11 +1,73 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/subtle"
+	"fmt"
+	"gc2-yugo/config"
+	"unicode"
 
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	"golang.org/x/crypto/bcrypt"
+)
+
+func HashPassword(password string, cost int) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 	if err != nil {
 		return "", err
 	}
 	return string(hashedPassword), nil
 }
+
+// CheckPassword compares a password with the stored one. Stored values that are
+// not bcrypt hashes are legacy plaintext passwords. needsRehash reports a match
+// that should be stored again as a hash of the given cost.
+func CheckPassword(stored, password string, cost int) (ok bool, needsRehash bool) {
+	storedCost, err := bcrypt.Cost([]byte(stored))
+	if err != nil {
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok
+	}
+
+	ok = bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	return ok, ok && storedCost != cost
+}
+
+// ValidatePassword returns every rule of the policy the password breaks.
+func ValidatePassword(password string, policy config.PasswordConfig) []string {
+	var violations []string
+
+	if len(password) < policy.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", policy.MinLength))
+	}
+	if len(password) > config.MaxPasswordLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d bytes long", config.MaxPasswordLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+
+	if policy.RequireUpper && !upper {
+		violations = append(violations, "must contain an upper case letter")
+	}
+	if policy.RequireLower && !lower {
+		violations = append(violations, "must contain a lower case letter")
+	}
+	if policy.RequireDigit && !digit {
+		violations = append(violations, "must contain a digit")
+	}
+	if policy.RequireSymbol && !symbol {
+		violations = append(violations, "must contain a symbol")
+	}
+
+	return violations
+}
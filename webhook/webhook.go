@@ -0,0 +1,339 @@
+// Package webhook posts the outbox events partners subscribed to to their URLs.
+// Each subscription gets its own delivery of an event, signed with the
+// subscription's secret, retried with exponential backoff and dead-lettered once
+// its attempts run out. The deliveries stay in the store as the subscription's log.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gc2-yugo/config"
+	"gc2-yugo/entity"
+	"gc2-yugo/lease"
+	"gc2-yugo/outbox"
+	"gc2-yugo/store"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LeaseName is the job lease the dispatching replica holds.
+const LeaseName = "webhook_dispatcher"
+
+// EventTypes are the types of the events partners can subscribe to.
+var EventTypes = []string{
+	entity.EventBookAdded,
+	entity.EventBookRemoved,
+	entity.EventBookBorrowed,
+	entity.EventBookReturned,
+	entity.EventBookStatusChanged,
+	entity.EventHoldReady,
+}
+
+// EventTest is the type of the events SendTest posts. They are not retried.
+const EventTest = "webhook.test"
+
+// Headers of the posts
+const (
+	HeaderSignature = "X-Webhook-Signature" // t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">
+	HeaderDelivery  = "X-Webhook-ID"        // the same for every attempt of a delivery
+	HeaderEventID   = "X-Event-ID"
+	HeaderEventType = "X-Event-Type"
+)
+
+const batchSize = 100
+
+// NewSecret returns a random signing secret for a subscription.
+func NewSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(key), nil
+}
+
+// Sign returns the signature header of a post of the body at the time. The time is
+// signed as well, so receivers can refuse old posts replayed to them.
+func Sign(secret string, at time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + signature(secret, timestamp, body)
+}
+
+// Verify checks the signature header of a post of the body, made at most
+// tolerance before now. Receivers written in Go can use it as is.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var timestamp, signed string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signed = value
+		}
+	}
+	at, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || signed == "" {
+		return errors.New("malformed signature header")
+	}
+	if !hmac.Equal([]byte(signed), []byte(signature(secret, timestamp, body))) {
+		return errors.New("signature mismatch")
+	}
+	if age := now.Sub(time.Unix(at, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("signature made %s ago, outside the tolerance", age.Round(time.Second))
+	}
+	return nil
+}
+
+func signature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Store is what the dispatcher needs of the store: the subscriptions, their
+// deliveries and the job leases.
+type Store interface {
+	store.WebhookStore
+	lease.Store
+}
+
+// Dispatcher queues a delivery of each outbox event per subscription to its type,
+// as a sink of the relay, and sends the due deliveries every interval. Replicas
+// sharing a store take turns through a lease, so one sends at a time.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	cfg    config.WebhooksConfig
+	now    func() time.Time
+	loop   *lease.Loop
+}
+
+// NewDispatcher returns a dispatcher of the store's deliveries with the settings of
+// the configuration. instance names the replica in the lease.
+func NewDispatcher(deliveries Store, cfg config.WebhooksConfig, instance string) *Dispatcher {
+	d := &Dispatcher{
+		store:  deliveries,
+		client: &http.Client{Timeout: cfg.Timeout},
+		cfg:    cfg,
+		now:    time.Now,
+	}
+	d.loop = lease.NewLoop(deliveries, lease.Config{
+		Name:     LeaseName,
+		Instance: instance,
+		Interval: cfg.Interval,
+		Work:     d.deliverDue,
+		Prune:    d.prune,
+		Now:      func() time.Time { return d.now() },
+	})
+	return d
+}
+
+// Deliver queues a delivery of the event to each subscription to its type. The
+// event may come again, subscriptions already having it are skipped.
+func (d *Dispatcher) Deliver(ctx context.Context, event outbox.Event) error {
+	subs, err := d.store.ListWebhookSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	now := d.now().UTC()
+	for _, sub := range subs {
+		if !slices.Contains(sub.EventTypes, event.Type) {
+			continue
+		}
+		delivery := entity.WebhookDelivery{
+			SubscriptionID: sub.ID.Hex(),
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        payload,
+			Status:         entity.DeliveryPending,
+			CreatedAt:      now,
+			NextAttemptAt:  now,
+		}
+		err := d.store.CreateWebhookDelivery(ctx, &delivery)
+		// A subscription deleted since the listing gets nothing
+		if err != nil && !errors.Is(err, store.ErrAlreadyExists) && !errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("failed to queue the %s event for subscription %s: %w", event.Type, sub.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// Start sends the due deliveries every interval until Stop.
+func (d *Dispatcher) Start(ctx context.Context) {
+	d.loop.Start(ctx)
+}
+
+// Stop stops sending, waits for the pass in progress and frees the lease.
+func (d *Dispatcher) Stop() {
+	d.loop.Stop()
+}
+
+// DeliverDue sends a batch of the deliveries due now and returns how many were
+// delivered. It sends nothing while another replica holds the lease.
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	return d.loop.Run(ctx)
+}
+
+func (d *Dispatcher) deliverDue(ctx context.Context, l *lease.Lease) (int, error) {
+	due, err := d.store.ListWebhookDeliveries(ctx, store.WebhookDeliveryFilter{DueBy: d.now(), Limit: batchSize})
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	var failures []error
+	subs := map[string]*entity.WebhookSubscription{}
+	for _, delivery := range due {
+		// Renewing before each post keeps the lease through it, as the timeout of a post
+		// is bounded well under the lease
+		if err := l.Keep(ctx); err != nil {
+			failures = append(failures, err)
+			break
+		}
+
+		sub, ok := subs[delivery.SubscriptionID]
+		if !ok {
+			sub, err = d.store.GetWebhookSubscription(ctx, delivery.SubscriptionID)
+			// The deliveries of a deleted subscription went with it
+			if errors.Is(err, store.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				failures = append(failures, err)
+				continue
+			}
+			subs[delivery.SubscriptionID] = sub
+		}
+
+		code, postErr := d.post(ctx, *sub, delivery)
+		d.record(&delivery, code, postErr)
+		if err := d.store.UpdateWebhookDelivery(ctx, delivery); err != nil {
+			failures = append(failures, err)
+			continue
+		}
+		if postErr != nil {
+			failures = append(failures, fmt.Errorf("%s delivery %s: %w", delivery.EventType, delivery.ID.Hex(), postErr))
+			continue
+		}
+		delivered++
+	}
+	return delivered, errors.Join(failures...)
+}
+
+func (d *Dispatcher) prune(ctx context.Context, now time.Time) error {
+	if err := d.store.DeleteWebhookDeliveries(ctx, now.Add(-d.cfg.Retention)); err != nil {
+		return fmt.Errorf("failed to prune finished deliveries: %w", err)
+	}
+	return nil
+}
+
+// SendTest posts a test event to the subscription right away and returns the
+// delivery, logged with the others. A failed test is dead-lettered at once.
+func (d *Dispatcher) SendTest(ctx context.Context, sub entity.WebhookSubscription) (entity.WebhookDelivery, error) {
+	now := d.now().UTC()
+	data, _ := json.Marshal(map[string]string{"subscription_id": sub.ID.Hex()})
+	event := outbox.Event{ID: primitive.NewObjectID().Hex(), Type: EventTest, CreatedAt: now, Data: data}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return entity.WebhookDelivery{}, err
+	}
+
+	delivery := entity.WebhookDelivery{
+		SubscriptionID: sub.ID.Hex(),
+		EventID:        event.ID,
+		EventType:      event.Type,
+		Payload:        payload,
+		Status:         entity.DeliveryPending,
+		CreatedAt:      now,
+		NextAttemptAt:  now,
+	}
+	if err := d.store.CreateWebhookDelivery(ctx, &delivery); err != nil {
+		return entity.WebhookDelivery{}, err
+	}
+
+	code, postErr := d.post(ctx, sub, delivery)
+	d.record(&delivery, code, postErr)
+	if postErr != nil {
+		delivery.Status = entity.DeliveryDead
+	}
+	if err := d.store.UpdateWebhookDelivery(ctx, delivery); err != nil {
+		return entity.WebhookDelivery{}, err
+	}
+	return delivery, nil
+}
+
+// post sends the delivery to the subscription's URL and returns the status code
+// of the response, 0 without one.
+func (d *Dispatcher) post(ctx context.Context, sub entity.WebhookSubscription, delivery entity.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, d.now(), delivery.Payload))
+	req.Header.Set(HeaderDelivery, delivery.ID.Hex())
+	req.Header.Set(HeaderEventID, delivery.EventID)
+	req.Header.Set(HeaderEventType, delivery.EventType)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// record sets the outcome of an attempt on the delivery: delivered, retried after
+// the backoff, or dead once it had its attempts.
+func (d *Dispatcher) record(delivery *entity.WebhookDelivery, code int, err error) {
+	now := d.now().UTC()
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	if err == nil {
+		delivery.Status = entity.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.cfg.MaxAttempts {
+		delivery.Status = entity.DeliveryDead
+		return
+	}
+	delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+}
+
+// backoff returns the delay after the failed attempt: the initial backoff, doubled
+// after each failure up to the maximum.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.cfg.InitialBackoff
+	for i := 1; i < attempts && delay < d.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.cfg.MaxBackoff)
+}
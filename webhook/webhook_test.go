@@ -0,0 +1,321 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gc2-yugo/config"
+	"gc2-yugo/entity"
+	"gc2-yugo/outbox"
+	"gc2-yugo/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// receiver is a partner's endpoint keeping the posts it got, answering with status.
+type receiver struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	status int
+	posts  []*http.Request
+	bodies [][]byte
+}
+
+func newReceiver(t *testing.T) *receiver {
+	r := &receiver{status: http.StatusOK}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		assert.NoError(t, err)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.posts = append(r.posts, req)
+		r.bodies = append(r.bodies, body)
+		w.WriteHeader(r.status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) respond(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func (r *receiver) received() ([]*http.Request, [][]byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*http.Request(nil), r.posts...), append([][]byte(nil), r.bodies...)
+}
+
+// clock is a settable time for the dispatcher.
+type clock struct{ now time.Time }
+
+func newClock() *clock {
+	return &clock{now: time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)}
+}
+
+func (c *clock) Now() time.Time          { return c.now }
+func (c *clock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func testConfig() config.WebhooksConfig {
+	return config.Default().Webhooks
+}
+
+// subscribe stores a subscription of the URL to the event types.
+func subscribe(t *testing.T, s store.Store, url string, types ...string) entity.WebhookSubscription {
+	secret, err := NewSecret()
+	require.NoError(t, err)
+	sub := entity.WebhookSubscription{URL: url, EventTypes: types, Secret: secret, CreatedBy: "admin", CreatedAt: time.Now()}
+	require.NoError(t, s.CreateWebhookSubscription(context.Background(), &sub))
+	return sub
+}
+
+func bookEvent(kind, bookID string) outbox.Event {
+	return outbox.Event{
+		ID:        primitive.NewObjectID().Hex(),
+		Seq:       1,
+		Type:      kind,
+		BookID:    bookID,
+		CreatedAt: time.Date(2024, 1, 1, 7, 0, 0, 0, time.UTC),
+		Data:      json.RawMessage(`{"book_id":"` + bookID + `"}`),
+	}
+}
+
+func TestDeliverSigned(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	partner := newReceiver(t)
+	sub := subscribe(t, s, partner.URL, entity.EventBookAdded, entity.EventHoldReady)
+	other := subscribe(t, s, partner.URL+"/other", entity.EventBookRemoved)
+
+	clock := newClock()
+	dispatcher := NewDispatcher(s, testConfig(), "replica-1")
+	dispatcher.now = clock.Now
+
+	// Only the subscriptions to the type get the event, once
+	added := bookEvent(entity.EventBookAdded, "book-1")
+	require.NoError(t, dispatcher.Deliver(ctx, added))
+	require.NoError(t, dispatcher.Deliver(ctx, added))
+	require.NoError(t, dispatcher.Deliver(ctx, bookEvent(entity.EventBookBorrowed, "book-1")))
+	deliveries, err := s.ListWebhookDeliveries(ctx, store.WebhookDeliveryFilter{})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, sub.ID.Hex(), deliveries[0].SubscriptionID)
+	assert.Equal(t, entity.DeliveryPending, deliveries[0].Status)
+
+	delivered, err := dispatcher.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+
+	posts, bodies := partner.received()
+	require.Len(t, posts, 1)
+	post := posts[0]
+	assert.Equal(t, http.MethodPost, post.Method)
+	assert.Equal(t, "application/json", post.Header.Get("Content-Type"))
+	assert.Equal(t, deliveries[0].ID.Hex(), post.Header.Get(HeaderDelivery))
+	assert.Equal(t, added.ID, post.Header.Get(HeaderEventID))
+	assert.Equal(t, entity.EventBookAdded, post.Header.Get(HeaderEventType))
+
+	// The receiver checks the signature with the subscription's secret
+	signature := post.Header.Get(HeaderSignature)
+	require.NoError(t, Verify(sub.Secret, signature, bodies[0], clock.Now(), 5*time.Minute))
+	assert.Error(t, Verify(other.Secret, signature, bodies[0], clock.Now(), 5*time.Minute), "another secret")
+	assert.Error(t, Verify(sub.Secret, signature, []byte(`{"forged":true}`), clock.Now(), 5*time.Minute), "another body")
+	assert.ErrorContains(t, Verify(sub.Secret, signature, bodies[0], clock.Now().Add(time.Hour), 5*time.Minute), "outside the tolerance")
+	assert.ErrorContains(t, Verify(sub.Secret, "v1=abc", bodies[0], clock.Now(), 5*time.Minute), "malformed")
+
+	var event outbox.Event
+	require.NoError(t, json.Unmarshal(bodies[0], &event))
+	assert.Equal(t, added.ID, event.ID)
+	assert.Equal(t, "book-1", event.BookID)
+	assert.JSONEq(t, `{"book_id":"book-1"}`, string(event.Data))
+
+	log, err := s.ListWebhookDeliveries(ctx, store.WebhookDeliveryFilter{SubscriptionID: sub.ID.Hex()})
+	require.NoError(t, err)
+	require.Len(t, log, 1)
+	assert.Equal(t, entity.DeliveryDelivered, log[0].Status)
+	assert.Equal(t, 1, log[0].Attempts)
+	assert.Equal(t, http.StatusOK, log[0].ResponseCode)
+	require.NotNil(t, log[0].DeliveredAt)
+	assert.True(t, clock.Now().Equal(*log[0].DeliveredAt))
+
+	delivered, err = dispatcher.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, delivered)
+}
+
+func TestRetryAndDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	partner := newReceiver(t)
+	partner.respond(http.StatusServiceUnavailable)
+	sub := subscribe(t, s, partner.URL, entity.EventHoldReady)
+
+	cfg := testConfig()
+	cfg.MaxAttempts = 4
+	cfg.InitialBackoff = time.Minute
+	cfg.MaxBackoff = 3 * time.Minute
+	clock := newClock()
+	dispatcher := NewDispatcher(s, cfg, "replica-1")
+	dispatcher.now = clock.Now
+	require.NoError(t, dispatcher.Deliver(ctx, bookEvent(entity.EventHoldReady, "book-1")))
+
+	// Retried after 1m, 2m, then 3m as the backoff is capped
+	for attempt, backoff := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		delivered, err := dispatcher.DeliverDue(ctx)
+		assert.ErrorContains(t, err, "webhook responded 503 Service Unavailable")
+		assert.Zero(t, delivered)
+
+		deliveries, err := s.ListWebhookDeliveries(ctx, store.WebhookDeliveryFilter{SubscriptionID: sub.ID.Hex()})
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, entity.DeliveryPending, deliveries[0].Status)
+		assert.Equal(t, attempt+1, deliveries[0].Attempts)
+		assert.Equal(t, http.StatusServiceUnavailable, deliveries[0].ResponseCode)
+		assert.True(t, clock.Now().Add(backoff).Equal(deliveries[0].NextAttemptAt), "attempt %d", attempt+1)
+
+		// Not due before its backoff
+		clock.Advance(backoff - time.Second)
+		delivered, err = dispatcher.DeliverDue(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, delivered)
+		clock.Advance(time.Second)
+	}
+	posts, _ := partner.received()
+	assert.Len(t, posts, 3)
+
+	// The last attempt dead-letters it
+	_, err := dispatcher.DeliverDue(ctx)
+	assert.Error(t, err)
+	dead, err := s.ListWebhookDeliveries(ctx, store.WebhookDeliveryFilter{Status: entity.DeliveryDead})
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 4, dead[0].Attempts)
+	assert.Equal(t, "webhook responded 503 Service Unavailable", dead[0].LastError)
+	assert.Nil(t, dead[0].DeliveredAt)
+
+	partner.respond(http.StatusOK)
+	clock.Advance(time.Hour)
+	delivered, err := dispatcher.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, delivered)
+	posts, _ = partner.received()
+	assert.Len(t, posts, 4, "dead deliveries are not retried")
+}
+
+func TestFailingSubscription(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	partner := newReceiver(t)
+	sub := subscribe(t, s, partner.URL, entity.EventBookAdded)
+	// Nothing listens at this one
+	down := subscribe(t, s, "http://127.0.0.1:1/hooks", entity.EventBookAdded)
+
+	clock := newClock()
+	dispatcher := NewDispatcher(s, testConfig(), "replica-1")
+	dispatcher.now = clock.Now
+	require.NoError(t, dispatcher.Deliver(ctx, bookEvent(entity.EventBookAdded, "book-1")))
+
+	// One subscription failing does not hold back the other
+	delivered, err := dispatcher.DeliverDue(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, 1, delivered)
+
+	failed, err := s.ListWebhookDeliveries(ctx, store.WebhookDeliveryFilter{SubscriptionID: down.ID.Hex()})
+	require.NoError(t, err)
+	require.Len(t, failed, 1)
+	assert.Equal(t, entity.DeliveryPending, failed[0].Status)
+	assert.Zero(t, failed[0].ResponseCode, "no response")
+	assert.NotEmpty(t, failed[0].LastError)
+
+	// Deleting the subscription drops its retries
+	require.NoError(t, s.DeleteWebhookSubscription(ctx, down.ID.Hex()))
+
+	clock.Advance(testConfig().InitialBackoff)
+	delivered, err = dispatcher.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, delivered)
+
+	log, err := s.ListWebhookDeliveries(ctx, store.WebhookDeliveryFilter{SubscriptionID: sub.ID.Hex()})
+	require.NoError(t, err)
+	require.Len(t, log, 1)
+	assert.Equal(t, entity.DeliveryDelivered, log[0].Status)
+}
+
+func TestSendTest(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	partner := newReceiver(t)
+	sub := subscribe(t, s, partner.URL, entity.EventBookAdded)
+	dispatcher := NewDispatcher(s, testConfig(), "replica-1")
+
+	delivery, err := dispatcher.SendTest(ctx, sub)
+	require.NoError(t, err)
+	assert.Equal(t, entity.DeliveryDelivered, delivery.Status)
+	assert.Equal(t, EventTest, delivery.EventType)
+	assert.Equal(t, http.StatusOK, delivery.ResponseCode)
+
+	posts, bodies := partner.received()
+	require.Len(t, posts, 1)
+	assert.Equal(t, EventTest, posts[0].Header.Get(HeaderEventType))
+	require.NoError(t, Verify(sub.Secret, posts[0].Header.Get(HeaderSignature), bodies[0], time.Now(), time.Minute))
+	var event outbox.Event
+	require.NoError(t, json.Unmarshal(bodies[0], &event))
+	assert.JSONEq(t, `{"subscription_id":"`+sub.ID.Hex()+`"}`, string(event.Data))
+
+	// A failed test is logged and not retried
+	partner.respond(http.StatusUnauthorized)
+	delivery, err = dispatcher.SendTest(ctx, sub)
+	require.NoError(t, err)
+	assert.Equal(t, entity.DeliveryDead, delivery.Status)
+	assert.Equal(t, http.StatusUnauthorized, delivery.ResponseCode)
+	assert.True(t, strings.HasSuffix(delivery.LastError, "401 Unauthorized"))
+
+	log, err := s.ListWebhookDeliveries(ctx, store.WebhookDeliveryFilter{SubscriptionID: sub.ID.Hex()})
+	require.NoError(t, err)
+	assert.Len(t, log, 2)
+	pending, err := s.ListWebhookDeliveries(ctx, store.WebhookDeliveryFilter{DueBy: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestDispatcherLease(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	partner := newReceiver(t)
+	subscribe(t, s, partner.URL, entity.EventBookAdded)
+
+	cfg := testConfig()
+	cfg.Interval = 10 * time.Millisecond
+	dispatcher := NewDispatcher(s, cfg, "replica-1")
+	require.NoError(t, dispatcher.Deliver(ctx, bookEvent(entity.EventBookAdded, "book-1")))
+
+	// Another replica sends
+	now := time.Now()
+	require.NoError(t, s.AcquireJobLease(ctx, LeaseName, "replica-2", now, now.Add(time.Minute)))
+	delivered, err := dispatcher.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, delivered)
+
+	require.NoError(t, s.ReleaseJobLease(ctx, LeaseName, "replica-2"))
+	dispatcher.Start(ctx)
+	require.Eventually(t, func() bool {
+		posts, _ := partner.received()
+		return len(posts) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	dispatcher.Stop()
+	_, err = s.GetJobLease(ctx, LeaseName)
+	assert.ErrorIs(t, err, store.ErrNotFound, "the lease is freed")
+}